@@ -0,0 +1,255 @@
+package gostorage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAccessStatsMaxKeys = 10000
+
+// AccessStat is number of reads and last read time of an object
+type AccessStat struct {
+	ObjectPath string    `json:"object_path"`
+	Reads      int64     `json:"reads"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// AccessStatsOptions configure AccessStats
+type AccessStatsOptions struct {
+	// MaxKeys bound number of tracked objects, least recently read objects are forgotten first, default 10000
+	MaxKeys int
+
+	// OnFlush receive snapshot of tracked objects on every Flush
+	OnFlush func(stats []AccessStat)
+
+	// Storage and ObjectPath receive snapshot of tracked objects as JSON on every Flush
+	Storage    Storage
+	ObjectPath string
+}
+
+// AccessStats track reads of objects going through storages wrapped by WithAccessStats, e.g. to move
+// hot objects to a faster tier or report assets nobody read for a while
+type AccessStats struct {
+	mu      sync.Mutex
+	options AccessStatsOptions
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently read
+}
+
+// NewAccessStats create empty access statistics
+func NewAccessStats(options AccessStatsOptions) *AccessStats {
+	if options.MaxKeys <= 0 {
+		options.MaxKeys = defaultAccessStatsMaxKeys
+	}
+	return &AccessStats{
+		options: options,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (a *AccessStats) record(objectPath string) {
+	objectPath = objectKey(objectPath)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	element, ok := a.entries[objectPath]
+	if !ok {
+		element = a.order.PushFront(&AccessStat{ObjectPath: objectPath})
+		a.entries[objectPath] = element
+	}
+	stat := element.Value.(*AccessStat)
+	stat.Reads++
+	stat.LastAccess = time.Now()
+	a.order.MoveToFront(element)
+
+	for a.order.Len() > a.options.MaxKeys {
+		oldest := a.order.Back()
+		a.order.Remove(oldest)
+		delete(a.entries, oldest.Value.(*AccessStat).ObjectPath)
+	}
+}
+
+// forget drop objects matching, a.mu must be held
+func (a *AccessStats) forget(match func(objectPath string) bool) {
+	for objectPath, element := range a.entries {
+		if match(objectPath) {
+			a.order.Remove(element)
+			delete(a.entries, objectPath)
+		}
+	}
+}
+
+// rename move statistics of an object to its new path
+func (a *AccessStats) rename(srcObjectPath string, dstObjectPath string) {
+	srcObjectPath, dstObjectPath = objectKey(srcObjectPath), objectKey(dstObjectPath)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	element, ok := a.entries[srcObjectPath]
+	if !ok || srcObjectPath == dstObjectPath {
+		return
+	}
+	a.forget(func(objectPath string) bool { return objectPath == dstObjectPath })
+	delete(a.entries, srcObjectPath)
+	element.Value.(*AccessStat).ObjectPath = dstObjectPath
+	a.entries[dstObjectPath] = element
+}
+
+// Get return statistics of objectPath, false when it wasn't read or was forgotten
+func (a *AccessStats) Get(objectPath string) (AccessStat, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	element, ok := a.entries[objectKey(objectPath)]
+	if !ok {
+		return AccessStat{}, false
+	}
+	return *element.Value.(*AccessStat), true
+}
+
+// Snapshot return copy of tracked statistics sorted by object path
+func (a *AccessStats) Snapshot() []AccessStat {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	stats := make([]AccessStat, 0, len(a.entries))
+	for _, element := range a.entries {
+		stats = append(stats, *element.Value.(*AccessStat))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].ObjectPath < stats[j].ObjectPath
+	})
+	return stats
+}
+
+// Flush hand snapshot to OnFlush and write it to ObjectPath of Storage when configured
+func (a *AccessStats) Flush() error {
+	stats := a.Snapshot()
+	if a.options.OnFlush != nil {
+		a.options.OnFlush(stats)
+	}
+	if a.options.Storage == nil || a.options.ObjectPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return a.options.Storage.Put(a.options.ObjectPath, bytes.NewReader(data), ObjectPrivate)
+}
+
+// Run flush statistics every interval until ctx is done, then flush one last time
+func (a *AccessStats) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return a.Flush()
+		case <-ticker.C:
+			if err := a.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// UnusedObjects list objects under prefix of storage which weren't read since, objects forgotten
+// because of MaxKeys are reported as unused
+func (a *AccessStats) UnusedObjects(storage Storage, prefix string, since time.Time) ([]ObjectInfo, error) {
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var unused []ObjectInfo
+	for iterator.Next() {
+		object := iterator.Object()
+		if stat, ok := a.Get(object.ObjectPath); !ok || stat.LastAccess.Before(since) {
+			unused = append(unused, object)
+		}
+	}
+	return unused, iterator.Err()
+}
+
+type accessStatsStorage struct {
+	Storage
+	stats *AccessStats
+}
+
+// WithAccessStats wrap storage to record successful Read and ReadRange calls into stats,
+// Delete and Move keep stats in sync
+func WithAccessStats(storage Storage, stats *AccessStats) Storage {
+	return &accessStatsStorage{
+		Storage: storage,
+		stats:   stats,
+	}
+}
+
+func (s *accessStatsStorage) Read(objectPath string) (io.ReadCloser, error) {
+	reader, err := s.Storage.Read(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	s.stats.record(objectPath)
+	return reader, nil
+}
+
+func (s *accessStatsStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := s.Storage.ReadRange(objectPath, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	s.stats.record(objectPath)
+	return reader, nil
+}
+
+func (s *accessStatsStorage) Delete(objectPaths ...string) error {
+	err := s.Storage.Delete(objectPaths...)
+
+	deleted := make(map[string]bool, len(objectPaths))
+	for _, objectPath := range deletedObjectPaths(objectPaths, err) {
+		deleted[objectKey(objectPath)] = true
+	}
+
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.forget(func(objectPath string) bool { return deleted[objectPath] })
+	return err
+}
+
+func (s *accessStatsStorage) DeletePrefix(prefix string) error {
+	if err := s.Storage.DeletePrefix(prefix); err != nil {
+		return err
+	}
+
+	prefix = trimPrefixRoot(prefix)
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	s.stats.forget(func(objectPath string) bool { return strings.HasPrefix(objectPath, prefix) })
+	return nil
+}
+
+func (s *accessStatsStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.Storage.Move(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	s.stats.rename(srcObjectPath, dstObjectPath)
+	return nil
+}
+
+func (s *accessStatsStorage) Unwrap() Storage {
+	return s.Storage
+}
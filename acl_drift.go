@@ -0,0 +1,123 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// VisibilityPolicy return visibility objectPath is expected to have, empty when any is fine
+type VisibilityPolicy func(objectPath string) ObjectVisibility
+
+// VisibilityByPrefix return policy expecting visibility of the longest matching prefix, objects
+// matching no prefix are expected to be private, e.g.
+//
+//	VisibilityByPrefix(map[string]ObjectVisibility{"public/": ObjectPublicRead})
+func VisibilityByPrefix(prefixes map[string]ObjectVisibility) VisibilityPolicy {
+	return func(objectPath string) ObjectVisibility {
+		objectPath = objectKey(objectPath)
+		matched, visibility := "", ObjectPrivate
+		for prefix, prefixVisibility := range prefixes {
+			if strings.HasPrefix(objectPath, prefix) && len(prefix) >= len(matched) {
+				matched, visibility = prefix, prefixVisibility
+			}
+		}
+		return visibility
+	}
+}
+
+// ACLDrift is an object whose visibility differ from the policy, or couldn't be checked when Err is set
+type ACLDrift struct {
+	ObjectPath string           `json:"object_path"`
+	Expected   ObjectVisibility `json:"expected"`
+	Actual     ObjectVisibility `json:"actual,omitempty"`
+	Remediated bool             `json:"remediated"` // visibility was set to Expected
+	Reason     string           `json:"reason,omitempty"`
+	Err        error            `json:"-"`
+	At         time.Time        `json:"at"`
+}
+
+// Public report whether the object is readable by anyone while it's not expected to be, these
+// drifts are the ones to look at first
+func (d ACLDrift) Public() bool {
+	public := func(visibility ObjectVisibility) bool {
+		return visibility == ObjectPublicRead || visibility == ObjectPublicReadWrite
+	}
+	return public(d.Actual) && !public(d.Expected)
+}
+
+// ACLDriftOptions configure DetectACLDrift
+type ACLDriftOptions struct {
+	// Remediate set visibility of drifted objects to the expected one
+	Remediate bool
+
+	// Observer receive every drift as it's found, it may be nil
+	Observer func(drift ACLDrift)
+}
+
+// DetectACLDrift compare visibility of every object under prefix with expected and return objects
+// which differ, remediating them when asked. It cost a request per object on S3 and OSS. Failures
+// of single objects are returned as drifts with Err set and the audit continue, the returned error
+// summarize them. Listing failures and ctx cancellation stop the audit.
+func DetectACLDrift(ctx context.Context, storage Storage, prefix string, expected VisibilityPolicy, options ACLDriftOptions) ([]ACLDrift, error) {
+	var drifts []ACLDrift
+	failed := 0
+	report := func(drift ACLDrift) {
+		if drift.Err != nil {
+			failed++
+			drift.Reason = drift.Err.Error()
+		}
+		drift.At = time.Now()
+		drifts = append(drifts, drift)
+		if options.Observer != nil {
+			options.Observer(drift)
+		}
+	}
+
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("err acl drift listing %s: %w", prefix, err)
+	}
+	for iterator.Next() {
+		if err := ctx.Err(); err != nil {
+			return drifts, err
+		}
+
+		object := iterator.Object()
+		drift := ACLDrift{ObjectPath: object.ObjectPath, Expected: expected(object.ObjectPath)}
+		if drift.Expected == "" || drift.Expected == ObjectVisibilityInherit {
+			continue
+		}
+
+		// listings reporting visibility spare a request
+		drift.Actual = object.Visibility
+		if drift.Actual == "" {
+			if drift.Actual, err = storage.GetVisibility(object.ObjectPath); err != nil {
+				drift.Err = err
+				report(drift)
+				continue
+			}
+		}
+		if drift.Actual == drift.Expected {
+			continue
+		}
+
+		if options.Remediate {
+			if err := storage.SetVisibility(object.ObjectPath, drift.Expected); err != nil {
+				drift.Err = fmt.Errorf("err remediating visibility of %s: %w", object.ObjectPath, err)
+			} else {
+				drift.Remediated = true
+			}
+		}
+		report(drift)
+	}
+	if err := iterator.Err(); err != nil {
+		return drifts, fmt.Errorf("err acl drift listing %s: %w", prefix, err)
+	}
+
+	if failed > 0 {
+		return drifts, fmt.Errorf("err acl drift of %s: %d objects failed", prefix, failed)
+	}
+	return drifts, nil
+}
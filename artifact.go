@@ -0,0 +1,132 @@
+package gostorage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const artifactManifestName = "MANIFEST.json"
+
+// ErrArtifactCorrupted returned by PullArtifact when a pulled file doesn't match its manifest checksum
+var ErrArtifactCorrupted = errors.New("artifact file checksum mismatch")
+
+// ArtifactManifest list every file of an artifact with its checksum
+type ArtifactManifest struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []ArtifactFile `json:"files"`
+}
+
+// ArtifactFile is a file of an artifact, Path is slash separated and relative to the artifact root
+type ArtifactFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// PushArtifact upload every file of localDir under prefix followed by a manifest holding
+// per-file SHA-256 checksums, the manifest is written last so a partial push is never pullable
+func PushArtifact(storage Storage, localDir string, prefix string) (*ArtifactManifest, error) {
+	manifest := &ArtifactManifest{CreatedAt: time.Now()}
+	err := filepath.Walk(localDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(localDir, filePath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		hash := sha256.New()
+		if err := storage.Put(path.Join(prefix, relPath), io.TeeReader(file, hash), ObjectPrivate); err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, ArtifactFile{
+			Path:   relPath,
+			Size:   info.Size(),
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(path.Join(prefix, artifactManifestName), bytes.NewReader(data), ObjectPrivate); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// PullArtifact download artifact under prefix into localDir verifying every file against
+// the manifest, ErrArtifactCorrupted is returned (wrapped) on checksum or size mismatch
+func PullArtifact(storage Storage, prefix string, localDir string) (*ArtifactManifest, error) {
+	reader, err := storage.Read(path.Join(prefix, artifactManifestName))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var manifest ArtifactManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("err invalid artifact manifest of %s: %s", prefix, err)
+	}
+
+	for _, file := range manifest.Files {
+		if err := pullArtifactFile(storage, prefix, localDir, file); err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+func pullArtifactFile(storage Storage, prefix string, localDir string, file ArtifactFile) error {
+	localPath := filepath.Join(localDir, filepath.FromSlash(file.Path))
+	if err := checkAndCreateParentDirectory(localPath); err != nil {
+		return err
+	}
+
+	reader, err := storage.Read(path.Join(prefix, file.Path))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	dest, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dest, hash), reader)
+	if err != nil {
+		return err
+	}
+
+	if size != file.Size || hex.EncodeToString(hash.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%w: %s", ErrArtifactCorrupted, file.Path)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package gostorage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAuditPrefix = ".audit"
+
+// ErrAuditImmutable is returned when writing into the audit prefix through the audited storage
+var ErrAuditImmutable = errors.New("audit log is write-once")
+
+// ErrAuditTampered is returned by VerifyAuditLog when a record signature or the chain is broken
+var ErrAuditTampered = errors.New("audit log has been tampered")
+
+// AuditOperation is a kind of destructive operation recorded in the audit log
+type AuditOperation string
+
+const (
+	AuditDelete        AuditOperation = "delete"
+	AuditOverwrite     AuditOperation = "overwrite"
+	AuditSetVisibility AuditOperation = "set_visibility"
+)
+
+// AuditRecord is a single line of the audit log, every record is signed and
+// chained to the previous one through Prev
+type AuditRecord struct {
+	Seq        int64            `json:"seq"`
+	Time       time.Time        `json:"time"`
+	Operation  AuditOperation   `json:"op"`
+	ObjectPath string           `json:"path"`
+	Visibility ObjectVisibility `json:"visibility,omitempty"`
+	Actor      string           `json:"actor,omitempty"`
+	Prev       string           `json:"prev,omitempty"`
+	Signature  string           `json:"sig,omitempty"`
+}
+
+func (r AuditRecord) sign(secret []byte) (string, error) {
+	r.Signature = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// AuditOptions configure WithAuditLog
+type AuditOptions struct {
+	Secret []byte // HMAC key signing records, required
+	Prefix string // where daily JSONL logs are written, default ".audit"
+	Actor  string // recorded as actor of every operation, e.g. service name
+}
+
+type auditStorage struct {
+	Storage
+	options AuditOptions
+
+	mu      sync.Mutex
+	loaded  bool
+	seq     int64
+	lastSig string
+}
+
+// WithAuditLog wrap storage so every Delete, overwriting Put/Copy/Compose and SetVisibility append a signed
+// record to a daily log under the audit prefix after the operation succeeded, records are chained so removing
+// or editing a line is detected by VerifyAuditLog. The audit prefix can't be modified through the returned
+// storage. Only a single writer per audit prefix is supported.
+func WithAuditLog(storage Storage, options AuditOptions) Storage {
+	if len(options.Secret) == 0 {
+		panic(fmt.Errorf("err audit log require secret"))
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultAuditPrefix
+	}
+	options.Prefix = objectKey(options.Prefix)
+
+	return &auditStorage{
+		Storage: storage,
+		options: options,
+	}
+}
+
+// AuditLogPath return object path of the audit log of day under prefix
+func AuditLogPath(prefix string, day time.Time) string {
+	return path.Join(prefix, day.UTC().Format("2006-01-02")+".jsonl")
+}
+
+func (s *auditStorage) protected(objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		objectPath = objectKey(objectPath)
+		if objectPath == s.options.Prefix || strings.HasPrefix(objectPath, s.options.Prefix+"/") {
+			return fmt.Errorf("%w: %s", ErrAuditImmutable, objectPath)
+		}
+	}
+	return nil
+}
+
+// load restore sequence and chain from the last record of the current log, s.mu must be held
+func (s *auditStorage) load(logPath string) error {
+	if s.loaded {
+		return nil
+	}
+
+	exist, err := s.Storage.Exist(logPath)
+	if err != nil || !exist {
+		s.loaded = err == nil
+		return err
+	}
+
+	records, err := readAuditRecords(s.Storage, logPath)
+	if err != nil {
+		return err
+	}
+	if n := len(records); n > 0 {
+		s.seq, s.lastSig = records[n-1].Seq, records[n-1].Signature
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *auditStorage) record(operation AuditOperation, visibility ObjectVisibility, objectPaths ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	logPath := AuditLogPath(s.options.Prefix, now)
+	if err := s.load(logPath); err != nil {
+		return fmt.Errorf("err loading audit log: %s", err)
+	}
+
+	var buf bytes.Buffer
+	seq, lastSig := s.seq, s.lastSig
+	for _, objectPath := range objectPaths {
+		seq++
+		record := AuditRecord{
+			Seq:        seq,
+			Time:       now,
+			Operation:  operation,
+			ObjectPath: objectPath,
+			Visibility: visibility,
+			Actor:      s.options.Actor,
+			Prev:       lastSig,
+		}
+
+		signature, err := record.sign(s.options.Secret)
+		if err != nil {
+			return err
+		}
+		record.Signature = signature
+		lastSig = signature
+
+		if err := json.NewEncoder(&buf).Encode(record); err != nil {
+			return err
+		}
+	}
+
+	if err := s.appendLog(logPath, &buf); err != nil {
+		return fmt.Errorf("err writing audit record: %s", err)
+	}
+	s.seq, s.lastSig = seq, lastSig
+	return nil
+}
+
+// appendLog append lines to the log, composing existing log and the new lines into a pending
+// object first so the log is replaced in a single copy
+func (s *auditStorage) appendLog(logPath string, lines io.Reader) error {
+	exist, err := s.Storage.Exist(logPath)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.Storage.Put(logPath, lines, ObjectPrivate)
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return err
+	}
+	chunkPath := path.Join(s.options.Prefix, "pending", id+".chunk")
+	composedPath := path.Join(s.options.Prefix, "pending", id+".jsonl")
+	defer s.Storage.Delete(chunkPath, composedPath)
+
+	if err := s.Storage.Put(chunkPath, lines, ObjectPrivate); err != nil {
+		return err
+	}
+	if err := s.Storage.Compose(composedPath, ObjectPrivate, logPath, chunkPath); err != nil {
+		return err
+	}
+	return s.Storage.Copy(composedPath, logPath)
+}
+
+// overwritten return whether objectPath exists before it's written
+func (s *auditStorage) overwritten(objectPath string) bool {
+	exist, err := s.Storage.Exist(objectPath)
+	return err == nil && exist
+}
+
+func (s *auditStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	if err := s.protected(objectPath); err != nil {
+		return err
+	}
+
+	overwrite := s.overwritten(objectPath)
+	if err := s.Storage.Put(objectPath, source, visibility); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, visibility, objectPath)
+}
+
+func (s *auditStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *auditStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	if err := s.protected(objectPath); err != nil {
+		return err
+	}
+
+	overwrite := s.overwritten(objectPath)
+	if err := s.Storage.PutWithOptions(objectPath, source, options); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, options.Visibility, objectPath)
+}
+
+// Touch of an existing object rewrite it on S3 and OSS, so it's recorded as an overwrite
+func (s *auditStorage) Touch(objectPath string) error {
+	if err := s.protected(objectPath); err != nil {
+		return err
+	}
+
+	overwrite := s.overwritten(objectPath)
+	if err := s.Storage.Touch(objectPath); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, "", objectPath)
+}
+
+func (s *auditStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	if err := s.protected(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.SetMetadata(objectPath, metadata)
+}
+
+func (s *auditStorage) Delete(objectPaths ...string) error {
+	if err := s.protected(objectPaths...); err != nil {
+		return err
+	}
+	err := s.Storage.Delete(objectPaths...)
+	if deleted := deletedObjectPaths(objectPaths, err); len(deleted) > 0 {
+		if recordErr := s.record(AuditDelete, "", deleted...); recordErr != nil && err == nil {
+			return recordErr
+		}
+	}
+	return err
+}
+
+func (s *auditStorage) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
+}
+
+func (s *auditStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	if err := s.protected(dstObjectPath); err != nil {
+		return err
+	}
+
+	overwrite := s.overwritten(dstObjectPath)
+	if err := s.Storage.Copy(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, "", dstObjectPath)
+}
+
+func (s *auditStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *auditStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *auditStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.protected(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	if sameObjectPath(srcObjectPath, dstObjectPath) {
+		return nil
+	}
+
+	overwrite := s.overwritten(dstObjectPath)
+	if err := s.Storage.Move(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	if err := s.record(AuditDelete, "", srcObjectPath); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, "", dstObjectPath)
+}
+
+func (s *auditStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := s.protected(dstObjectPath); err != nil {
+		return err
+	}
+
+	overwrite := s.overwritten(dstObjectPath)
+	if err := s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...); err != nil {
+		return err
+	}
+	if !overwrite {
+		return nil
+	}
+	return s.record(AuditOverwrite, visibility, dstObjectPath)
+}
+
+func (s *auditStorage) SetVisibility(objectPath string, visibility ObjectVisibility) error {
+	if err := s.protected(objectPath); err != nil {
+		return err
+	}
+	if err := s.Storage.SetVisibility(objectPath, visibility); err != nil {
+		return err
+	}
+	return s.record(AuditSetVisibility, visibility, objectPath)
+}
+
+func readAuditRecords(storage Storage, logPath string) ([]AuditRecord, error) {
+	reader, err := storage.Read(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%w: %s: invalid record: %s", ErrAuditTampered, logPath, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// VerifyAuditLog read logs in order and check every record signature and that records are chained
+// without gaps, the first record of the first log may continue a chain from an earlier log
+func VerifyAuditLog(storage Storage, secret []byte, logPaths ...string) ([]AuditRecord, error) {
+	var all []AuditRecord
+	for _, logPath := range logPaths {
+		records, err := readAuditRecords(storage, logPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			signature, err := record.sign(secret)
+			if err != nil {
+				return nil, err
+			}
+			if !hmac.Equal([]byte(signature), []byte(record.Signature)) {
+				return nil, fmt.Errorf("%w: %s: invalid signature of record %d", ErrAuditTampered, logPath, record.Seq)
+			}
+
+			if n := len(all); n > 0 {
+				prev := all[n-1]
+				if record.Prev != prev.Signature || record.Seq != prev.Seq+1 {
+					return nil, fmt.Errorf("%w: %s: chain broken at record %d", ErrAuditTampered, logPath, record.Seq)
+				}
+			}
+			all = append(all, record)
+		}
+	}
+	return all, nil
+}
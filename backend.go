@@ -0,0 +1,64 @@
+package gostorage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// BackendFactory create storage of a registered backend from its config, backend specific
+// settings are usually read from config.Params
+type BackendFactory func(config StorageConfig, opts ...Option) (Storage, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BackendFactory{}
+)
+
+// builtinDrivers can't be replaced by Register
+var builtinDrivers = map[string]bool{
+	DriverLocal:        true,
+	DriverS3:           true,
+	DriverOSS:          true,
+	DriverOBS:          true,
+	DriverS3Compatible: true,
+}
+
+// Register add or replace third-party backend under driver name, so StorageConfig.NewStorage,
+// LoadConfig and FromEnv (GOSTORAGE_DRIVER) can create it. Usually called from init of the
+// backend package, it panics when driver is empty or a built-in driver.
+func Register(driver string, factory BackendFactory) {
+	if driver == "" || factory == nil {
+		panic(fmt.Errorf("err registering backend: driver and factory are required"))
+	}
+	if builtinDrivers[driver] {
+		panic(fmt.Errorf("err registering backend: %s is a built-in driver", driver))
+	}
+
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[driver] = factory
+}
+
+func lookupBackend(driver string) (BackendFactory, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	factory, ok := backends[driver]
+	return factory, ok
+}
+
+// Drivers return sorted names of built-in and registered drivers
+func Drivers() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(builtinDrivers)+len(backends))
+	for name := range builtinDrivers {
+		names = append(names, name)
+	}
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,207 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BandwidthOptions configure a BandwidthLimiter
+type BandwidthOptions struct {
+	// Windows are times of day "HH:MM-HH:MM" in UTC when heavy transfers run, a window may wrap
+	// midnight like "22:00-06:00". Without windows WindowRate always apply.
+	Windows []string
+
+	// WindowRate limit bytes per second inside windows, 0 is unlimited
+	WindowRate int64
+
+	// OutsideRate limit bytes per second outside windows, 0 pause transfers until the next window
+	OutsideRate int64
+}
+
+// BandwidthLimiter throttle transfers of background jobs depending on time of day, so nightly
+// migrations don't compete with daytime traffic. A limiter is shared by every transfer using it.
+type BandwidthLimiter struct {
+	mu          sync.Mutex
+	windows     []bandwidthWindow
+	windowRate  int64
+	outsideRate int64
+	free        time.Time // when bytes already let through are paid off
+}
+
+// bandwidthWindow is a time of day range, start and end are offsets from midnight
+type bandwidthWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// NewBandwidthLimiter create limiter of options, windows are validated
+func NewBandwidthLimiter(options BandwidthOptions) (*BandwidthLimiter, error) {
+	if options.WindowRate < 0 || options.OutsideRate < 0 {
+		return nil, fmt.Errorf("err invalid bandwidth: rates must not be negative")
+	}
+
+	limiter := &BandwidthLimiter{windowRate: options.WindowRate, outsideRate: options.OutsideRate}
+	for _, window := range options.Windows {
+		parsed, err := parseBandwidthWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		limiter.windows = append(limiter.windows, parsed)
+	}
+	return limiter, nil
+}
+
+func parseBandwidthWindow(window string) (bandwidthWindow, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return bandwidthWindow{}, fmt.Errorf("err invalid bandwidth window %s: expected HH:MM-HH:MM", window)
+	}
+
+	var bounds [2]time.Duration
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return bandwidthWindow{}, fmt.Errorf("err invalid bandwidth window %s: %s", window, err)
+		}
+		bounds[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if bounds[0] == bounds[1] {
+		return bandwidthWindow{}, fmt.Errorf("err invalid bandwidth window %s: empty window", window)
+	}
+	return bandwidthWindow{start: bounds[0], end: bounds[1]}, nil
+}
+
+func (w bandwidthWindow) contains(offset time.Duration) bool {
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// InWindow return whether t is inside one of the windows, always true without windows
+func (l *BandwidthLimiter) InWindow(t time.Time) bool {
+	if l == nil || len(l.windows) == 0 {
+		return true
+	}
+	t = t.UTC()
+	offset := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC))
+	for _, window := range l.windows {
+		if window.contains(offset) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextWindow return when the next window start after t
+func (l *BandwidthLimiter) nextWindow(t time.Time) time.Time {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	var next time.Time
+	for _, window := range l.windows {
+		start := midnight.Add(window.start)
+		if !start.After(t) {
+			start = start.AddDate(0, 0, 1)
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// Wait block until n more bytes may be transferred or ctx is done
+func (l *BandwidthLimiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	for {
+		now := time.Now()
+		inWindow := l.InWindow(now)
+		rate := l.outsideRate
+		if inWindow {
+			rate = l.windowRate
+		}
+
+		var delay time.Duration
+		l.mu.Lock()
+		switch {
+		case inWindow && rate == 0:
+			l.mu.Unlock()
+			return nil
+		case rate == 0:
+			delay = l.nextWindow(now).Sub(now)
+		default:
+			if l.free.Before(now) {
+				l.free = now
+			}
+			delay = l.free.Sub(now)
+			l.free = l.free.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+		}
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		if rate > 0 {
+			return nil
+		}
+		// paused until the window opened, check again
+	}
+}
+
+// Reader throttle reads of reader, reads fail with ctx error when ctx is done while waiting
+func (l *BandwidthLimiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	if l == nil {
+		return reader
+	}
+	return &bandwidthReader{ctx: ctx, reader: reader, limiter: l}
+}
+
+type bandwidthReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (r *bandwidthReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if waitErr := r.limiter.Wait(r.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type bandwidthContextKey struct{}
+
+// ContextWithBandwidth return ctx carrying limiter, Sync throttle its transfers with it. Scheduler
+// set the limiter of ScheduledJob.Bandwidth on the context of each run.
+func ContextWithBandwidth(ctx context.Context, limiter *BandwidthLimiter) context.Context {
+	return context.WithValue(ctx, bandwidthContextKey{}, limiter)
+}
+
+// BandwidthFromContext return limiter of ctx, nil when there is none. Methods of a nil limiter
+// don't throttle, so jobs can use it unconditionally.
+func BandwidthFromContext(ctx context.Context) *BandwidthLimiter {
+	limiter, _ := ctx.Value(bandwidthContextKey{}).(*BandwidthLimiter)
+	return limiter
+}
@@ -0,0 +1,177 @@
+package gostorage
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const defaultBrowseURLExpiry = 15 * time.Minute
+
+// DirLister list direct children of dir, sub directories (ending with "/") and objects,
+// MetadataIndex implement it
+type DirLister interface {
+	ListDir(dir string) ([]string, []IndexedObject, error)
+}
+
+// BrowseOptions configure NewBrowseHandler
+type BrowseOptions struct {
+	// Auth wrap the handler to authenticate requests, it is required so content is never exposed by accident
+	Auth func(http.Handler) http.Handler
+
+	// Lister provide directory listings, default to storage when it implements DirLister
+	Lister DirLister
+
+	URLExpiry time.Duration // lifetime of download URLs, default 15m
+	Title     string        // page title, default "Index of"
+}
+
+type browseHandler struct {
+	storage Storage
+	prefix  string
+	options BrowseOptions
+}
+
+type browseEntry struct {
+	Name         string
+	Href         string
+	Size         int64
+	LastModified time.Time
+	Dir          bool
+}
+
+type browsePage struct {
+	Title   string
+	Path    string
+	Parent  bool
+	Entries []browseEntry
+}
+
+var browseTemplate = template.Must(template.New("browse").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}} /{{.Path}}</title>
+<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}td,th{padding:.2em 1em;text-align:left}td.size{text-align:right}</style>
+</head>
+<body>
+<h1>{{.Title}} /{{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Last modified</th></tr>
+{{if .Parent}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>{{end}}
+{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}</a></td>{{if .Dir}}<td></td><td></td>{{else}}<td class="size">{{.Size}}</td><td>{{.LastModified.Format "2006-01-02 15:04:05"}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// NewBrowseHandler create read-only http.Handler rendering a directory browser of objects under prefix,
+// downloads are redirected to temporary URLs. Request paths are relative to prefix, so mount it with
+// http.StripPrefix when serving under a sub path.
+func NewBrowseHandler(storage Storage, prefix string, options BrowseOptions) http.Handler {
+	if options.Auth == nil {
+		panic(fmt.Errorf("err browse handler require auth middleware"))
+	}
+	if options.Lister == nil {
+		lister, ok := storage.(DirLister)
+		if !ok {
+			panic(fmt.Errorf("err browse handler require lister"))
+		}
+		options.Lister = lister
+	}
+	if options.URLExpiry <= 0 {
+		options.URLExpiry = defaultBrowseURLExpiry
+	}
+	if options.Title == "" {
+		options.Title = "Index of"
+	}
+
+	return options.Auth(&browseHandler{
+		storage: storage,
+		prefix:  strings.Trim(prefix, "/"),
+		options: options,
+	})
+}
+
+func (h *browseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// cleaning a rooted path drop any "..", so requests can't escape prefix
+	relPath := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if relPath != "" && !strings.HasSuffix(r.URL.Path, "/") {
+		h.serveObject(w, r, relPath)
+		return
+	}
+	h.serveDir(w, r, relPath)
+}
+
+func (h *browseHandler) serveObject(w http.ResponseWriter, r *http.Request, relPath string) {
+	objectPath := path.Join(h.prefix, relPath)
+	exist, err := h.storage.Exist(objectPath)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	if !exist {
+		// might be a directory requested without trailing slash
+		dirs, objects, err := h.options.Lister.ListDir(objectPath)
+		if err == nil && (len(dirs) > 0 || len(objects) > 0) {
+			http.Redirect(w, r, path.Base(relPath)+"/", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	signedURL, err := h.storage.TemporaryURL(objectPath, h.options.URLExpiry, nil)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, signedURL, http.StatusFound)
+}
+
+func (h *browseHandler) serveDir(w http.ResponseWriter, r *http.Request, relPath string) {
+	dir := path.Join(h.prefix, relPath)
+	dirs, objects, err := h.options.Lister.ListDir(dir)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	if relPath != "" && len(dirs) == 0 && len(objects) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	page := browsePage{
+		Title:  h.options.Title,
+		Path:   relPath,
+		Parent: relPath != "",
+	}
+	for _, subDir := range dirs {
+		name := path.Base(strings.TrimSuffix(subDir, "/")) + "/"
+		page.Entries = append(page.Entries, browseEntry{Name: name, Href: url.PathEscape(name[:len(name)-1]) + "/", Dir: true})
+	}
+	for _, object := range objects {
+		name := path.Base(object.ObjectPath)
+		page.Entries = append(page.Entries, browseEntry{
+			Name:         name,
+			Href:         url.PathEscape(name),
+			Size:         object.Size,
+			LastModified: object.LastModified,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = browseTemplate.Execute(w, page)
+}
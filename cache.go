@@ -0,0 +1,365 @@
+package gostorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskCacheOptions configure NewDiskCache
+type DiskCacheOptions struct {
+	Dir      string // cache directory, its content is cleared when the cache is created
+	MaxBytes int64  // total size of cached objects, pinned objects included
+
+	// Priorities weight object paths by their longest matching prefix, objects of the lowest
+	// priority are evicted first and least recently used first within the same priority,
+	// paths matching no prefix have priority 0
+	Priorities map[string]int
+
+	// NegativeTTL remember Exist misses for this long so repeated lookups of missing objects,
+	// e.g. bots probing predictable URLs, don't reach the backend, zero disable negative caching
+	NegativeTTL        time.Duration
+	NegativeMaxEntries int // default 10000
+}
+
+const defaultNegativeMaxEntries = 10000
+
+type diskCacheEntry struct {
+	objectPath string
+	size       int64
+	lastAccess time.Time
+}
+
+// DiskCache wrap storage caching object content read through it on local disk, writes through the
+// cache invalidate cached content. Pinned objects are never evicted.
+type DiskCache struct {
+	Storage
+	options DiskCacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*diskCacheEntry
+	pinned  map[string]bool
+	used    int64
+
+	missing map[string]time.Time // object path to negative entry expiry
+}
+
+// NewDiskCache create disk cache in front of storage
+func NewDiskCache(storage Storage, options DiskCacheOptions) (*DiskCache, error) {
+	if options.Dir == "" || options.MaxBytes <= 0 {
+		return nil, fmt.Errorf("err disk cache require dir and max bytes")
+	}
+	if options.NegativeMaxEntries <= 0 {
+		options.NegativeMaxEntries = defaultNegativeMaxEntries
+	}
+	if err := os.RemoveAll(options.Dir); err != nil {
+		return nil, err
+	}
+	if err := mkdirIfNotExists(options.Dir); err != nil {
+		return nil, err
+	}
+
+	return &DiskCache{
+		Storage: storage,
+		options: options,
+		entries: make(map[string]*diskCacheEntry),
+		pinned:  make(map[string]bool),
+		missing: make(map[string]time.Time),
+	}, nil
+}
+
+func (c *DiskCache) filePath(objectPath string) string {
+	sum := sha256.Sum256([]byte(objectPath))
+	return filepath.Join(c.options.Dir, hex.EncodeToString(sum[:]))
+}
+
+// priority return weight of the longest prefix matching objectPath
+func (c *DiskCache) priority(objectPath string) int {
+	priority, longest := 0, -1
+	for prefix, weight := range c.options.Priorities {
+		if strings.HasPrefix(objectPath, prefix) && len(prefix) > longest {
+			priority, longest = weight, len(prefix)
+		}
+	}
+	return priority
+}
+
+// Cached check whether objectPath content is currently in the cache
+func (c *DiskCache) Cached(objectPath string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[objectPath]
+	return ok
+}
+
+// Pin fetch objectPath into the cache and keep it there until Unpin, it stays pinned across overwrites
+func (c *DiskCache) Pin(objectPath string) error {
+	c.mu.Lock()
+	c.pinned[objectPath] = true
+	c.mu.Unlock()
+
+	reader, err := c.Read(objectPath)
+	if err != nil {
+		return err
+	}
+	return reader.Close()
+}
+
+// Unpin make objectPath evictable again
+func (c *DiskCache) Unpin(objectPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pinned, objectPath)
+	c.evict()
+}
+
+func (c *DiskCache) Read(objectPath string) (io.ReadCloser, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[objectPath]; ok {
+		entry.lastAccess = time.Now()
+		file, err := os.Open(c.filePath(objectPath))
+		c.mu.Unlock()
+		if err == nil {
+			return file, nil
+		}
+	} else {
+		c.mu.Unlock()
+	}
+
+	return c.fill(objectPath)
+}
+
+// ReadRange serve cached objects from disk, ranges of objects not cached are fetched from the
+// backend without filling the cache
+func (c *DiskCache) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[objectPath]
+	if !ok {
+		c.mu.Unlock()
+		return c.Storage.ReadRange(objectPath, offset, length)
+	}
+	entry.lastAccess = time.Now()
+	file, err := os.Open(c.filePath(objectPath))
+	c.mu.Unlock()
+	if err != nil {
+		return c.Storage.ReadRange(objectPath, offset, length)
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// fill download objectPath into the cache and return reader of the cached copy
+func (c *DiskCache) fill(objectPath string) (io.ReadCloser, error) {
+	reader, err := c.Storage.Read(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(c.options.Dir, "fill-")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// objects larger than the whole cache are served once without being kept
+	if size > c.options.MaxBytes {
+		os.Remove(tmp.Name())
+		return tmp, nil
+	}
+
+	c.forget(objectPath)
+	if err := os.Rename(tmp.Name(), c.filePath(objectPath)); err != nil {
+		os.Remove(tmp.Name())
+		return tmp, nil
+	}
+	c.entries[objectPath] = &diskCacheEntry{objectPath: objectPath, size: size, lastAccess: time.Now()}
+	c.used += size
+	c.evict()
+	return tmp, nil
+}
+
+// forget remove cached content of objectPath, c.mu must be held
+func (c *DiskCache) forget(objectPath string) {
+	entry, ok := c.entries[objectPath]
+	if !ok {
+		return
+	}
+	delete(c.entries, objectPath)
+	c.used -= entry.size
+	os.Remove(c.filePath(objectPath))
+}
+
+// evict remove unpinned entries until the cache fit MaxBytes, c.mu must be held
+func (c *DiskCache) evict() {
+	if c.used <= c.options.MaxBytes {
+		return
+	}
+
+	candidates := make([]*diskCacheEntry, 0, len(c.entries))
+	for objectPath, entry := range c.entries {
+		if !c.pinned[objectPath] {
+			candidates = append(candidates, entry)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		pi, pj := c.priority(candidates[i].objectPath), c.priority(candidates[j].objectPath)
+		if pi != pj {
+			return pi < pj
+		}
+		return candidates[i].lastAccess.Before(candidates[j].lastAccess)
+	})
+
+	for _, entry := range candidates {
+		if c.used <= c.options.MaxBytes {
+			return
+		}
+		c.forget(entry.objectPath)
+	}
+}
+
+func (c *DiskCache) invalidate(objectPaths ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, objectPath := range objectPaths {
+		c.forget(objectPath)
+		delete(c.missing, objectPath)
+	}
+}
+
+// invalidateMatching drop cached content and pins of objects whose key match, e.g. erased objects
+func (c *DiskCache) invalidateMatching(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for objectPath := range c.entries {
+		if match(objectKey(objectPath)) {
+			c.forget(objectPath)
+		}
+	}
+	for objectPath := range c.pinned {
+		if match(objectKey(objectPath)) {
+			delete(c.pinned, objectPath)
+		}
+	}
+}
+
+// Exist answer from cached content or a negative entry before asking the backend
+func (c *DiskCache) Exist(objectPath string) (bool, error) {
+	c.mu.Lock()
+	_, cached := c.entries[objectPath]
+	expiry, missing := c.missing[objectPath]
+	c.mu.Unlock()
+
+	if cached {
+		return true, nil
+	}
+	if missing && time.Now().Before(expiry) {
+		return false, nil
+	}
+
+	exist, err := c.Storage.Exist(objectPath)
+	if err != nil || exist || c.options.NegativeTTL <= 0 {
+		return exist, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.missing) >= c.options.NegativeMaxEntries {
+		now := time.Now()
+		for missingPath, expiry := range c.missing {
+			if !now.Before(expiry) {
+				delete(c.missing, missingPath)
+			}
+		}
+		if len(c.missing) >= c.options.NegativeMaxEntries {
+			c.missing = make(map[string]time.Time)
+		}
+	}
+	c.missing[objectPath] = time.Now().Add(c.options.NegativeTTL)
+	return false, nil
+}
+
+// ExistMany call Exist of the wrapper for every path
+func (c *DiskCache) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	return existEach(c, objectPaths)
+}
+
+func (c *DiskCache) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	defer c.invalidate(objectPath)
+	return c.Storage.Put(objectPath, source, visibility)
+}
+
+func (c *DiskCache) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return c.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (c *DiskCache) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	defer c.invalidate(objectPath)
+	return c.Storage.PutWithOptions(objectPath, source, options)
+}
+
+func (c *DiskCache) Touch(objectPath string) error {
+	defer c.invalidate(objectPath)
+	return c.Storage.Touch(objectPath)
+}
+
+func (c *DiskCache) Delete(objectPaths ...string) error {
+	defer c.invalidate(objectPaths...)
+	return c.Storage.Delete(objectPaths...)
+}
+
+func (c *DiskCache) DeletePrefix(prefix string) error {
+	return deleteListed(c, prefix)
+}
+
+func (c *DiskCache) Copy(srcObjectPath string, dstObjectPath string) error {
+	defer c.invalidate(dstObjectPath)
+	return c.Storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (c *DiskCache) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(c, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (c *DiskCache) Unwrap() Storage {
+	return c.Storage
+}
+
+func (c *DiskCache) Move(srcObjectPath string, dstObjectPath string) error {
+	defer c.invalidate(srcObjectPath, dstObjectPath)
+	return c.Storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (c *DiskCache) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	defer c.invalidate(dstObjectPath)
+	return c.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
@@ -0,0 +1,99 @@
+package gostorage
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChecksumAlgo is an algorithm used by Checksum
+type ChecksumAlgo string
+
+const (
+	// ChecksumMD5 is hex encoded md5 digest, taken from the ETag of single part uploads
+	ChecksumMD5 ChecksumAlgo = "md5"
+
+	// ChecksumSHA256 is hex encoded sha256 digest, taken from the sidecar on local storage
+	ChecksumSHA256 ChecksumAlgo = "sha256"
+
+	// ChecksumCRC32C is hex encoded big-endian CRC-32 using the Castagnoli polynomial
+	ChecksumCRC32C ChecksumAlgo = "crc32c"
+
+	// ChecksumCRC64ECMA is decimal CRC-64 using the ECMA polynomial, as reported by OSS
+	ChecksumCRC64ECMA ChecksumAlgo = "crc64ecma"
+)
+
+var (
+	crc32cTable    = crc32.MakeTable(crc32.Castagnoli)
+	crc64ECMATable = crc64.MakeTable(crc64.ECMA)
+
+	md5ETagPattern = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+)
+
+func newChecksumHash(algo ChecksumAlgo) (hash.Hash, error) {
+	switch algo {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32cTable), nil
+	case ChecksumCRC64ECMA:
+		return crc64.New(crc64ECMATable), nil
+	}
+	return nil, fmt.Errorf("err unsupported checksum algorithm: %s", algo)
+}
+
+func formatChecksum(algo ChecksumAlgo, h hash.Hash) string {
+	if h64, ok := h.(hash.Hash64); ok && algo == ChecksumCRC64ECMA {
+		return strconv.FormatUint(h64.Sum64(), 10)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// streamChecksum compute checksum of objectPath by reading it from storage
+func streamChecksum(storage Storage, objectPath string, algo ChecksumAlgo) (string, error) {
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := storage.Read(objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return formatChecksum(algo, h), nil
+}
+
+// etagMD5 return md5 hex of etag when it is a plain md5 digest, multipart and encrypted
+// uploads have opaque ETags
+func etagMD5(etag string) (string, bool) {
+	etag = strings.Trim(etag, `"`)
+	if !md5ETagPattern.MatchString(etag) {
+		return "", false
+	}
+	return strings.ToLower(etag), true
+}
+
+// contentMD5 return md5 hex of a base64 Content-MD5 header value
+func contentMD5(value string) (string, bool) {
+	sum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(sum) != md5.Size {
+		return "", false
+	}
+	return hex.EncodeToString(sum), true
+}
@@ -0,0 +1,385 @@
+package gostorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultClientPartURLExpiry = 15 * time.Minute
+	defaultClientUploadTimeout = 24 * time.Hour
+	maxClientUploadParts       = 10000
+)
+
+var (
+	// ErrUploadNotFound returned for callbacks of client uploads which are unknown, completed or aborted
+	ErrUploadNotFound = errors.New("client upload not found")
+
+	// ErrPartMismatch returned when parts reported by a client don't match parts received by the backend
+	ErrPartMismatch = errors.New("uploaded part doesn't match")
+)
+
+// clientUploader is a backend able to let clients upload parts directly with presigned URLs
+type clientUploader interface {
+	multipartUploader
+	abortUpload(objectPath string, uploadID string) error
+	listUploadedParts(objectPath string, uploadID string) ([]CheckpointPart, error)
+	signPartURL(objectPath string, uploadID string, partNumber int, expireIn time.Duration) (string, error)
+}
+
+// ClientUploadOptions configure NewClientUploads
+type ClientUploadOptions struct {
+	PartURLExpiry time.Duration // validity of presigned part URLs, default 15 minutes
+
+	// Timeout after the last callback of an upload, Sweep then complete it when every part was
+	// reported and abort it otherwise, default 24 hours
+	Timeout time.Duration
+
+	OnComplete func(upload ClientUpload)
+	OnAbort    func(upload ClientUpload)
+}
+
+// ClientUpload is a multipart upload whose parts are sent directly by a client, e.g. a browser
+type ClientUpload struct {
+	UploadID   string           `json:"upload_id"`
+	ObjectPath string           `json:"object_path"`
+	PartCount  int              `json:"part_count"`
+	PartURLs   []string         `json:"part_urls,omitempty"` // presigned URL of part i+1, only returned by Start
+	Parts      []CheckpointPart `json:"parts"`               // parts reported by the client and validated, ordered by number
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+func (u *ClientUpload) complete() bool {
+	return len(u.Parts) == u.PartCount
+}
+
+func (u *ClientUpload) copy() ClientUpload {
+	c := *u
+	c.PartURLs = nil
+	c.Parts = append([]CheckpointPart(nil), u.Parts...)
+	return c
+}
+
+// ClientUploads track multipart uploads of clients sending parts with presigned URLs to S3 or OSS.
+// Clients report every uploaded part, its ETag is checked against the backend, and the upload is
+// completed once all parts arrived. Abandoned uploads are finalized or aborted by Sweep, so their
+// parts don't linger in the bucket. Uploads are tracked in memory, a bucket lifecycle rule
+// aborting incomplete uploads should cover process restarts.
+type ClientUploads struct {
+	uploader clientUploader
+	options  ClientUploadOptions
+
+	mu      sync.Mutex
+	uploads map[string]*ClientUpload
+}
+
+// NewClientUploads create tracker of client uploads into storage, which must be S3 or OSS. Parts
+// go straight to the backend, so wrapped storages are refused instead of silently bypassing
+// residency, retention, audit or other checks of their wrappers.
+func NewClientUploads(storage Storage, options ClientUploadOptions) (*ClientUploads, error) {
+	if _, wrapped := storage.(Unwrapper); wrapped {
+		return nil, fmt.Errorf("err client multipart uploads bypass storage wrappers, pass the S3 or OSS storage itself")
+	}
+	uploader, ok := storage.(clientUploader)
+	if !ok {
+		return nil, fmt.Errorf("err storage doesn't support client multipart uploads")
+	}
+	if options.PartURLExpiry <= 0 {
+		options.PartURLExpiry = defaultClientPartURLExpiry
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = defaultClientUploadTimeout
+	}
+
+	return &ClientUploads{
+		uploader: uploader,
+		options:  options,
+		uploads:  make(map[string]*ClientUpload),
+	}, nil
+}
+
+// Start initiate upload of objectPath in partCount parts and return presigned URLs of the parts,
+// every part except the last must be at least 5MB
+func (c *ClientUploads) Start(objectPath string, partCount int, visibility ObjectVisibility) (ClientUpload, error) {
+	if partCount < 1 || partCount > maxClientUploadParts {
+		return ClientUpload{}, fmt.Errorf("err client upload must have between 1 and %d parts, got %d", maxClientUploadParts, partCount)
+	}
+
+	objectPath = objectKey(objectPath)
+	uploadID, err := c.uploader.initiateUpload(objectPath, visibility)
+	if err != nil {
+		return ClientUpload{}, err
+	}
+	now := time.Now()
+	upload := &ClientUpload{
+		UploadID:   uploadID,
+		ObjectPath: objectPath,
+		PartCount:  partCount,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	urls := make([]string, 0, partCount)
+	for partNumber := 1; partNumber <= partCount; partNumber++ {
+		url, err := c.uploader.signPartURL(objectPath, uploadID, partNumber, c.options.PartURLExpiry)
+		if err != nil {
+			_ = c.uploader.abortUpload(objectPath, uploadID)
+			return ClientUpload{}, err
+		}
+		urls = append(urls, url)
+	}
+
+	c.mu.Lock()
+	c.uploads[uploadID] = upload
+	c.mu.Unlock()
+
+	started := upload.copy()
+	started.PartURLs = urls
+	return started, nil
+}
+
+// Get return state of a tracked upload
+func (c *ClientUploads) Get(uploadID string) (ClientUpload, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	upload, ok := c.uploads[uploadID]
+	if !ok {
+		return ClientUpload{}, false
+	}
+	return upload.copy(), true
+}
+
+// PartURL sign URL of a part again, e.g. when the previous one expired before the client used it
+func (c *ClientUploads) PartURL(uploadID string, partNumber int) (string, error) {
+	upload, ok := c.Get(uploadID)
+	if !ok {
+		return "", ErrUploadNotFound
+	}
+	if partNumber < 1 || partNumber > upload.PartCount {
+		return "", fmt.Errorf("%w: part %d out of range of upload %s", ErrPartMismatch, partNumber, uploadID)
+	}
+	return c.uploader.signPartURL(upload.ObjectPath, uploadID, partNumber, c.options.PartURLExpiry)
+}
+
+// PartCompleted record part reported by the client after checking its ETag against the backend,
+// the upload is completed once every part was reported
+func (c *ClientUploads) PartCompleted(uploadID string, partNumber int, etag string) error {
+	upload, ok := c.Get(uploadID)
+	if !ok {
+		return ErrUploadNotFound
+	}
+	if partNumber < 1 || partNumber > upload.PartCount {
+		return fmt.Errorf("%w: part %d out of range of upload %s", ErrPartMismatch, partNumber, uploadID)
+	}
+
+	parts, err := c.uploader.listUploadedParts(upload.ObjectPath, uploadID)
+	if err != nil {
+		return err
+	}
+	var uploaded *CheckpointPart
+	for i := range parts {
+		if parts[i].Number == partNumber {
+			uploaded = &parts[i]
+		}
+	}
+	if uploaded == nil {
+		return fmt.Errorf("%w: part %d of upload %s wasn't received", ErrPartMismatch, partNumber, uploadID)
+	}
+	if strings.Trim(uploaded.ETag, `"`) != strings.Trim(etag, `"`) {
+		return fmt.Errorf("%w: part %d of upload %s has ETag %s, client reported %s", ErrPartMismatch, partNumber, uploadID, uploaded.ETag, etag)
+	}
+
+	c.mu.Lock()
+	tracked, ok := c.uploads[uploadID]
+	if !ok {
+		c.mu.Unlock()
+		return ErrUploadNotFound
+	}
+	tracked.Parts = setCheckpointPart(tracked.Parts, *uploaded)
+	tracked.UpdatedAt = time.Now()
+	complete := tracked.complete()
+	c.mu.Unlock()
+
+	if !complete {
+		return nil
+	}
+	err = c.Complete(uploadID)
+	if errors.Is(err, ErrUploadNotFound) {
+		// completed by a concurrent callback
+		return nil
+	}
+	return err
+}
+
+// setCheckpointPart add part to parts ordered by number, replacing a part with the same number
+func setCheckpointPart(parts []CheckpointPart, part CheckpointPart) []CheckpointPart {
+	i := sort.Search(len(parts), func(i int) bool { return parts[i].Number >= part.Number })
+	if i < len(parts) && parts[i].Number == part.Number {
+		parts[i] = part
+		return parts
+	}
+	parts = append(parts, CheckpointPart{})
+	copy(parts[i+1:], parts[i:])
+	parts[i] = part
+	return parts
+}
+
+// take stop tracking uploadID while it's completed or aborted, concurrent callbacks get ErrUploadNotFound
+func (c *ClientUploads) take(uploadID string) (*ClientUpload, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	upload, ok := c.uploads[uploadID]
+	if !ok {
+		return nil, ErrUploadNotFound
+	}
+	delete(c.uploads, uploadID)
+	return upload, nil
+}
+
+// restore track upload again after failing to complete or abort it, so it can be retried
+func (c *ClientUploads) restore(upload *ClientUpload) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploads[upload.UploadID] = upload
+}
+
+// Complete finalize upload, every part must have been reported
+func (c *ClientUploads) Complete(uploadID string) error {
+	upload, err := c.take(uploadID)
+	if err != nil {
+		return err
+	}
+	if !upload.complete() {
+		c.restore(upload)
+		return fmt.Errorf("%w: upload %s has %d of %d parts", ErrPartMismatch, uploadID, len(upload.Parts), upload.PartCount)
+	}
+	if err := c.uploader.completeUpload(upload.ObjectPath, uploadID, upload.Parts); err != nil {
+		c.restore(upload)
+		return err
+	}
+
+	if c.options.OnComplete != nil {
+		c.options.OnComplete(upload.copy())
+	}
+	return nil
+}
+
+// Abort discard upload and parts already received by the backend
+func (c *ClientUploads) Abort(uploadID string) error {
+	upload, err := c.take(uploadID)
+	if err != nil {
+		return err
+	}
+	if err := c.uploader.abortUpload(upload.ObjectPath, uploadID); err != nil && !errors.Is(err, ErrObjectNotExist) {
+		c.restore(upload)
+		return err
+	}
+
+	if c.options.OnAbort != nil {
+		c.options.OnAbort(upload.copy())
+	}
+	return nil
+}
+
+// Sweep complete uploads idle for Timeout having every part reported and abort the others
+func (c *ClientUploads) Sweep() error {
+	deadline := time.Now().Add(-c.options.Timeout)
+	var idle []ClientUpload
+	c.mu.Lock()
+	for _, upload := range c.uploads {
+		if upload.UpdatedAt.Before(deadline) {
+			idle = append(idle, upload.copy())
+		}
+	}
+	c.mu.Unlock()
+
+	var errs []error
+	for _, upload := range idle {
+		var err error
+		if upload.complete() {
+			err = c.Complete(upload.UploadID)
+		} else {
+			err = c.Abort(upload.UploadID)
+		}
+		if err != nil && !errors.Is(err, ErrUploadNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run sweep abandoned uploads every interval until ctx is done
+func (c *ClientUploads) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.Sweep(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// clientUploadCallback is body of callbacks received by ServeHTTP
+type clientUploadCallback struct {
+	UploadID   string `json:"upload_id"`
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// ServeHTTP receive JSON callbacks of clients: POST {"upload_id", "part_number", "etag"} to a path
+// ending with /part once a part is uploaded, and {"upload_id"} to /complete or /abort. It doesn't
+// authenticate requests, wrap it with the authentication of the application.
+func (c *ClientUploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var callback clientUploadCallback
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&callback); err != nil || callback.UploadID == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch path.Base(r.URL.Path) {
+	case "part":
+		err = c.PartCompleted(callback.UploadID, callback.PartNumber, callback.ETag)
+	case "complete":
+		err = c.Complete(callback.UploadID)
+	case "abort":
+		err = c.Abort(callback.UploadID)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrUploadNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrPartMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,114 @@
+package gostorage
+
+import (
+	"io"
+)
+
+// concatReader stream objects back-to-back, each object is only opened
+// once the previous one has been fully read
+type concatReader struct {
+	storage     Storage
+	objectPaths []string
+	current     io.ReadCloser
+}
+
+// ConcatReaders return a single reader streaming given objects one after another,
+// useful to read chunked exports (csv, parquet row groups, logs) as a single logical file
+func ConcatReaders(storage Storage, objectPaths ...string) io.ReadCloser {
+	return &concatReader{
+		storage:     storage,
+		objectPaths: objectPaths,
+	}
+}
+
+func (r *concatReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.objectPaths) == 0 {
+				return 0, io.EOF
+			}
+
+			reader, err := r.storage.Read(r.objectPaths[0])
+			if err != nil {
+				return 0, err
+			}
+			r.current = reader
+			r.objectPaths = r.objectPaths[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			closeErr := r.current.Close()
+			r.current = nil
+			if closeErr != nil {
+				return n, closeErr
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *concatReader) Close() error {
+	r.objectPaths = nil
+	if r.current == nil {
+		return nil
+	}
+
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
+
+// Concat write content of srcObjectPaths back-to-back into dstObjectPath by streaming
+// them through the client
+func Concat(storage Storage, dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	reader := ConcatReaders(storage, srcObjectPaths...)
+	defer reader.Close()
+
+	return storage.Put(dstObjectPath, reader, visibility)
+}
+
+// composePart is a byte range of a source object copied server-side as one part of a compose,
+// whole is set when the range cover the entire object
+type composePart struct {
+	source int
+	offset int64
+	length int64
+	whole  bool
+}
+
+// composeParts split sources into part copies no larger than maxPartSize, false is returned when
+// a source other than the last is below the backend minimum part size or there would be too many parts
+func composeParts(sizes []int64, minPartSize int64, maxPartSize int64, maxParts int) ([]composePart, bool) {
+	if len(sizes) == 0 {
+		return nil, false
+	}
+
+	var parts []composePart
+	for i, size := range sizes {
+		if i < len(sizes)-1 && size < minPartSize {
+			return nil, false
+		}
+		if size <= maxPartSize {
+			parts = append(parts, composePart{source: i, length: size, whole: true})
+			continue
+		}
+
+		// split evenly, every range is at least half of maxPartSize so above the minimum
+		count := (size + maxPartSize - 1) / maxPartSize
+		var offset int64
+		for j := int64(0); j < count; j++ {
+			length := size / count
+			if j < size%count {
+				length++
+			}
+			parts = append(parts, composePart{source: i, offset: offset, length: length})
+			offset += length
+		}
+	}
+	return parts, len(parts) <= maxParts
+}
@@ -0,0 +1,190 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+var (
+	_ ConditionalReadStorage = (*storageS3)(nil)
+	_ ConditionalReadStorage = (*storageAlibabaOSS)(nil)
+	_ ConditionalReadStorage = (*storageLocalFile)(nil)
+)
+
+var (
+	// ErrPreconditionFailed is matched by errors of reads and writes whose Preconditions don't hold
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrNotModified is matched by errors of reads skipped by IfNoneMatch or IfModifiedSince,
+	// the caller's copy is still current
+	ErrNotModified = errors.New("object not modified")
+)
+
+// Preconditions make a read or write conditional on the current state of the object like HTTP
+// conditional requests, zero values are ignored. ETags are compared as returned by Stat, quotes
+// are ignored.
+type Preconditions struct {
+	IfMatch           string    // ETag the object must have, a missing object fail
+	IfNoneMatch       string    // ETag the object must not have, "*" require the object to not exist
+	IfModifiedSince   time.Time // read only, skip the read when the object wasn't modified after
+	IfUnmodifiedSince time.Time // fail when the object was modified after
+}
+
+// ReadOptions configure ReadWithOptions
+type ReadOptions struct {
+	Preconditions
+}
+
+// ConditionalReadStorage is implemented by storages able to evaluate Preconditions of a read with
+// the same request reading the object
+type ConditionalReadStorage interface {
+	Storage
+
+	// ReadWithOptions behave like Read when options preconditions hold, otherwise it fail with
+	// ErrPreconditionFailed or ErrNotModified
+	ReadWithOptions(objectPath string, options ReadOptions) (io.ReadCloser, error)
+}
+
+// ReadWithOptions read objectPath when options preconditions hold. Storages not implementing
+// ConditionalReadStorage, like wrappers, are checked with Stat before Read, so the object could
+// change in between.
+func ReadWithOptions(storage Storage, objectPath string, options ReadOptions) (io.ReadCloser, error) {
+	if conditional, ok := storage.(ConditionalReadStorage); ok {
+		return conditional.ReadWithOptions(objectPath, options)
+	}
+	if err := checkPreconditions(storage, objectPath, options.Preconditions, true); err != nil {
+		return nil, err
+	}
+	return storage.Read(objectPath)
+}
+
+// RequestPreconditions return Preconditions of HTTP conditional request headers, so requests can
+// be passed through to ReadWithOptions and PutWithOptions
+func RequestPreconditions(r *http.Request) Preconditions {
+	var preconditions Preconditions
+	preconditions.IfMatch = r.Header.Get("If-Match")
+	preconditions.IfNoneMatch = r.Header.Get("If-None-Match")
+	if t, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		preconditions.IfModifiedSince = t
+	}
+	if t, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil {
+		preconditions.IfUnmodifiedSince = t
+	}
+	return preconditions
+}
+
+func (p Preconditions) empty() bool {
+	return p == Preconditions{}
+}
+
+// evaluate check preconditions against info of objectPath, exist is false for missing objects.
+// Like HTTP, reads fail IfNoneMatch and IfModifiedSince with ErrNotModified, writes ignore
+// IfModifiedSince.
+func (p Preconditions) evaluate(objectPath string, info ObjectInfo, exist bool, read bool) error {
+	lastModified := info.LastModified.Truncate(time.Second)
+	if p.IfMatch != "" && (!exist || !etagMatch(p.IfMatch, info.ETag)) {
+		return fmt.Errorf("%w: %s, if-match %s", ErrPreconditionFailed, objectPath, p.IfMatch)
+	}
+	if !p.IfUnmodifiedSince.IsZero() && exist && lastModified.After(p.IfUnmodifiedSince) {
+		return fmt.Errorf("%w: %s, modified at %s", ErrPreconditionFailed, objectPath, info.LastModified.Format(time.RFC3339))
+	}
+
+	notModified := ErrPreconditionFailed
+	if read {
+		notModified = ErrNotModified
+	}
+	if p.IfNoneMatch != "" && exist && (p.IfNoneMatch == "*" || etagMatch(p.IfNoneMatch, info.ETag)) {
+		return fmt.Errorf("%w: %s, if-none-match %s", notModified, objectPath, p.IfNoneMatch)
+	}
+	if read && p.IfNoneMatch == "" && !p.IfModifiedSince.IsZero() && exist && !lastModified.After(p.IfModifiedSince) {
+		return fmt.Errorf("%w: %s, modified at %s", ErrNotModified, objectPath, info.LastModified.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkPreconditions evaluate preconditions of a read or write of objectPath with Stat
+func checkPreconditions(storage Storage, objectPath string, preconditions Preconditions, read bool) error {
+	if preconditions.empty() {
+		return nil
+	}
+	info, err := storage.Stat(objectPath)
+	exist := err == nil
+	if errors.Is(err, ErrObjectNotExist) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return preconditions.evaluate(objectPath, info, exist, read)
+}
+
+// etagMatch compare a precondition ETag, possibly a comma separated list, with etag of an object
+func etagMatch(condition string, etag string) bool {
+	etag = strings.Trim(etag, `"`)
+	for _, candidate := range strings.Split(condition, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || strings.Trim(candidate, `"`) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// s3ReadPreconditions set preconditions on a GetObject request
+func s3ReadPreconditions(input *s3.GetObjectInput, preconditions Preconditions) {
+	if preconditions.IfMatch != "" {
+		input.IfMatch = aws.String(preconditions.IfMatch)
+	}
+	if preconditions.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(preconditions.IfNoneMatch)
+	}
+	if !preconditions.IfModifiedSince.IsZero() {
+		input.IfModifiedSince = aws.Time(preconditions.IfModifiedSince)
+	}
+	if !preconditions.IfUnmodifiedSince.IsZero() {
+		input.IfUnmodifiedSince = aws.Time(preconditions.IfUnmodifiedSince)
+	}
+}
+
+// s3PreconditionHeaders send ETag preconditions with CompleteMultipartUpload, so S3 reject the put
+// atomically when the object changed while parts were uploaded. The SDK has no fields for them.
+func s3PreconditionHeaders(preconditions Preconditions) []request.Option {
+	headers := map[string]string{}
+	if preconditions.IfMatch != "" {
+		headers["If-Match"] = preconditions.IfMatch
+	}
+	if preconditions.IfNoneMatch != "" {
+		headers["If-None-Match"] = preconditions.IfNoneMatch
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return []request.Option{request.WithSetRequestHeaders(headers)}
+}
+
+// ossPreconditions return OSS options of preconditions of a read
+func ossPreconditions(preconditions Preconditions) []oss.Option {
+	var options []oss.Option
+	if preconditions.IfMatch != "" {
+		options = append(options, oss.IfMatch(preconditions.IfMatch))
+	}
+	if preconditions.IfNoneMatch != "" {
+		options = append(options, oss.IfNoneMatch(preconditions.IfNoneMatch))
+	}
+	if !preconditions.IfModifiedSince.IsZero() {
+		options = append(options, oss.IfModifiedSince(preconditions.IfModifiedSince))
+	}
+	if !preconditions.IfUnmodifiedSince.IsZero() {
+		options = append(options, oss.IfUnmodifiedSince(preconditions.IfUnmodifiedSince))
+	}
+	return options
+}
@@ -0,0 +1,285 @@
+package gostorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+	DriverOSS   = "oss"
+	DriverOBS   = "obs"
+
+	// DriverS3Compatible use the S3 compatible preset named by StorageConfig.Preset
+	DriverS3Compatible = "s3-compatible"
+)
+
+// Config describe multiple named storages, usually loaded from file by LoadConfig
+type Config struct {
+	Default  string                   `json:"default" yaml:"default"`
+	Storages map[string]StorageConfig `json:"storages" yaml:"storages"`
+}
+
+// StorageConfig describe a single storage, only fields relevant to Driver are used
+type StorageConfig struct {
+	Driver string `json:"driver" yaml:"driver"` // local, s3, oss, obs, s3-compatible or a registered driver
+	Preset string `json:"preset" yaml:"preset"` // preset name of s3-compatible driver
+
+	// local
+	BaseDir       string `json:"base_dir" yaml:"base_dir"`
+	PublicBaseDir string `json:"public_base_dir" yaml:"public_base_dir"`
+	PublicBaseURL string `json:"public_base_url" yaml:"public_base_url"`
+
+	// s3, oss and obs
+	Bucket          string `json:"bucket" yaml:"bucket"`
+	Region          string `json:"region" yaml:"region"`
+	Endpoint        string `json:"endpoint" yaml:"endpoint"`
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" yaml:"secret_access_key"`
+	SessionToken    string `json:"session_token" yaml:"session_token"`
+
+	// options
+	DisableACL            bool   `json:"disable_acl" yaml:"disable_acl"`
+	SkipURLExistenceCheck bool   `json:"skip_url_existence_check" yaml:"skip_url_existence_check"`
+	Debug                 bool   `json:"debug" yaml:"debug"`
+	Timeout               string `json:"timeout" yaml:"timeout"` // default operation timeout, e.g. "30s"
+	ReadRetryAttempts     int    `json:"read_retry_attempts" yaml:"read_retry_attempts"`
+	HedgeDelay            string `json:"hedge_delay" yaml:"hedge_delay"`     // enable hedged reads, e.g. "50ms"
+	StallTimeout          string `json:"stall_timeout" yaml:"stall_timeout"` // abort streams idle for e.g. "20s"
+	DirectoryMarkers      bool   `json:"directory_markers" yaml:"directory_markers"`
+	OSSSignatureV4        bool   `json:"oss_signature_v4" yaml:"oss_signature_v4"`
+	OSSInternalEndpoint   bool   `json:"oss_internal_endpoint" yaml:"oss_internal_endpoint"`
+
+	// bounds of TemporaryURL expiry e.g. "1m" and "168h", setting either replace driver defaults
+	MinTemporaryURLExpiry string `json:"min_temporary_url_expiry" yaml:"min_temporary_url_expiry"`
+	MaxTemporaryURLExpiry string `json:"max_temporary_url_expiry" yaml:"max_temporary_url_expiry"`
+
+	// settings of drivers added by Register
+	Params map[string]string `json:"params" yaml:"params"`
+}
+
+// ConfigDecrypter decrypt content of an encrypted config file before it's parsed,
+// implement it to plug other encryption schemes such as age
+type ConfigDecrypter interface {
+	Decrypt(data []byte) ([]byte, error)
+}
+
+// ConfigDecrypterFunc is function adapter of ConfigDecrypter
+type ConfigDecrypterFunc func(data []byte) ([]byte, error)
+
+func (f ConfigDecrypterFunc) Decrypt(data []byte) ([]byte, error) {
+	return f(data)
+}
+
+type kmsConfigDecrypter struct {
+	region string
+}
+
+// NewKMSConfigDecrypter create decrypter for files encrypted by AWS KMS (e.g. "aws kms encrypt"
+// output written as raw binary), credentials are resolved by the default AWS provider chain
+func NewKMSConfigDecrypter(region string) ConfigDecrypter {
+	return &kmsConfigDecrypter{region: region}
+}
+
+func (d *kmsConfigDecrypter) Decrypt(data []byte) ([]byte, error) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(d.region)})
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := kms.New(sess).Decrypt(&kms.DecryptInput{CiphertextBlob: data})
+	if err != nil {
+		return nil, fmt.Errorf("err decrypting config: %s", err)
+	}
+	return output.Plaintext, nil
+}
+
+// LoadConfig read YAML (.yaml, .yml) or JSON config file, decrypting it first when decrypter
+// is not nil, and register every configured storage into a new Manager
+func LoadConfig(filePath string, decrypter ConfigDecrypter, opts ...Option) (*Manager, error) {
+	config, err := readConfig(filePath, decrypter)
+	if err != nil {
+		return nil, err
+	}
+	return config.NewManager(opts...)
+}
+
+// ReloadConfig read config file like LoadConfig and apply it to manager with Reconfigure
+func (m *Manager) ReloadConfig(filePath string, decrypter ConfigDecrypter, opts ...Option) error {
+	config, err := readConfig(filePath, decrypter)
+	if err != nil {
+		return err
+	}
+	return m.Reconfigure(config, opts...)
+}
+
+func readConfig(filePath string, decrypter ConfigDecrypter) (Config, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if decrypter != nil {
+		if data, err = decrypter.Decrypt(data); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var config Config
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(filePath, ".enc"))) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("err invalid config %s: %s", filePath, err)
+	}
+	return config, nil
+}
+
+// NewManager create storage of every entry and register them under their names,
+// opts are applied to every storage before options of the entry
+func (c Config) NewManager(opts ...Option) (*Manager, error) {
+	manager := NewManager()
+	for name, storageConfig := range c.Storages {
+		storage, err := storageConfig.NewStorage(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("err storage %s: %s", name, err)
+		}
+		manager.Register(name, storage)
+	}
+
+	if c.Default != "" {
+		if _, ok := c.Storages[c.Default]; !ok {
+			return nil, fmt.Errorf("err default storage %s is not configured", c.Default)
+		}
+		manager.SetDefault(c.Default)
+	}
+	return manager, nil
+}
+
+func (c StorageConfig) options() ([]Option, error) {
+	var opts []Option
+	if c.DisableACL {
+		opts = append(opts, WithoutACL())
+	}
+	if c.SkipURLExistenceCheck {
+		opts = append(opts, WithoutURLExistenceCheck())
+	}
+	if c.Debug {
+		opts = append(opts, WithDebug())
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %s", c.Timeout)
+		}
+		opts = append(opts, WithOperationTimeout(OperationTimeouts{Default: timeout}))
+	}
+	if c.ReadRetryAttempts > 0 {
+		opts = append(opts, WithReadRetry(c.ReadRetryAttempts))
+	}
+	if c.HedgeDelay != "" {
+		delay, err := time.ParseDuration(c.HedgeDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hedge delay %s", c.HedgeDelay)
+		}
+		opts = append(opts, WithHedgedReads(delay))
+	}
+	if c.StallTimeout != "" {
+		timeout, err := time.ParseDuration(c.StallTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stall timeout %s", c.StallTimeout)
+		}
+		opts = append(opts, WithStallTimeout(timeout))
+	}
+	if c.DirectoryMarkers {
+		opts = append(opts, WithDirectoryMarkers())
+	}
+	if c.OSSSignatureV4 {
+		opts = append(opts, WithOSSSignatureV4(c.Region))
+	}
+	if c.OSSInternalEndpoint {
+		opts = append(opts, WithOSSInternalEndpoint())
+	}
+	if c.MinTemporaryURLExpiry != "" || c.MaxTemporaryURLExpiry != "" {
+		var bounds [2]time.Duration
+		for i, value := range []string{c.MinTemporaryURLExpiry, c.MaxTemporaryURLExpiry} {
+			if value == "" {
+				continue
+			}
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid temporary url expiry %s", value)
+			}
+			bounds[i] = duration
+		}
+		opts = append(opts, WithTemporaryURLExpiry(bounds[0], bounds[1]))
+	}
+	return opts, nil
+}
+
+// NewStorage create storage described by the config
+func (c StorageConfig) NewStorage(opts ...Option) (Storage, error) {
+	configOptions, err := c.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(append([]Option{}, opts...), configOptions...)
+
+	switch c.Driver {
+	case DriverLocal:
+		if c.BaseDir == "" {
+			return nil, fmt.Errorf("base_dir is required")
+		}
+		return NewLocalStorage(c.BaseDir, c.PublicBaseDir, c.PublicBaseURL, nil, opts...), nil
+	case DriverS3:
+		if c.Bucket == "" || c.Region == "" {
+			return nil, fmt.Errorf("bucket and region are required")
+		}
+		return NewAWSS3Storage(c.Bucket, c.Region, c.AccessKeyID, c.SecretAccessKey, c.SessionToken, opts...), nil
+	case DriverOSS:
+		if c.Bucket == "" || c.Endpoint == "" {
+			return nil, fmt.Errorf("bucket and endpoint are required")
+		}
+		return NewAlibabaOSSStorage(c.Bucket, c.Endpoint, c.AccessKeyID, c.SecretAccessKey, opts...), nil
+	case DriverOBS:
+		if c.Bucket == "" || c.Endpoint == "" {
+			return nil, fmt.Errorf("bucket and endpoint are required")
+		}
+		return NewHuaweiOBSStorage(c.Endpoint, c.AccessKeyID, c.SecretAccessKey, c.Bucket, opts...), nil
+	case DriverS3Compatible:
+		preset, ok := LookupS3Preset(c.Preset)
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %s", c.Preset)
+		}
+		if c.Bucket == "" || (preset.Endpoint == "" && c.Endpoint == "") {
+			return nil, fmt.Errorf("bucket and endpoint are required")
+		}
+		creds := S3Credentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			Region:          c.Region,
+			Endpoint:        c.Endpoint,
+		}
+		return NewS3CompatibleStorage(c.Preset, creds, c.Bucket, opts...), nil
+	default:
+		factory, ok := lookupBackend(c.Driver)
+		if !ok {
+			return nil, fmt.Errorf("unknown driver %s", c.Driver)
+		}
+		return factory(c, opts...)
+	}
+}
@@ -0,0 +1,98 @@
+package gostorage
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+)
+
+var (
+	_ CopyOptionsStorage = (*storageLocalFile)(nil)
+	_ CopyOptionsStorage = (*storageS3)(nil)
+	_ CopyOptionsStorage = (*storageAlibabaOSS)(nil)
+)
+
+// ErrCopyOptionsUnsupported is returned when copy options are requested from a storage which can't honor them
+var ErrCopyOptionsUnsupported = errors.New("storage doesn't support copy options")
+
+// MetadataDirective choose where metadata of a copied object come from
+type MetadataDirective string
+
+const (
+	MetadataCopy    MetadataDirective = "COPY"    // keep headers and user metadata of the source
+	MetadataReplace MetadataDirective = "REPLACE" // use headers and user metadata given in CopyOptions
+)
+
+// CopyOptions control metadata, visibility, storage class and tags of the destination of a copy
+type CopyOptions struct {
+	// MetadataDirective default to MetadataCopy, Headers and Metadata are only used with MetadataReplace
+	MetadataDirective MetadataDirective
+	Headers           ObjectHeaders
+	Metadata          map[string]string
+
+	// Visibility of the destination, empty keep visibility of the source
+	Visibility ObjectVisibility
+
+	// SourceBucket copy srcObjectPath from another bucket of the same S3 or OSS account into the storage
+	// bucket, empty copy within the storage bucket. Unsupported by local storage.
+	SourceBucket string
+
+	// StorageClass of the destination, e.g. S3 "STANDARD_IA" or OSS "IA", empty use the bucket default.
+	// Ignored by local storage.
+	StorageClass string
+
+	// ReplaceTags set Tags on the destination instead of keeping tags of the source,
+	// empty Tags remove all tags. Ignored by local storage.
+	ReplaceTags bool
+	Tags        map[string]string
+}
+
+// CopyOptionsStorage is implemented by storages able to control metadata of copied objects
+type CopyOptionsStorage interface {
+	Storage
+
+	// CopyWithOptions behave like Copy and apply options to the destination
+	CopyWithOptions(srcObjectPath string, dstObjectPath string, options CopyOptions) error
+}
+
+// CopyWithOptions copy srcObjectPath to dstObjectPath applying options, storages without support
+// fail with ErrCopyOptionsUnsupported unless options only set visibility
+func CopyWithOptions(storage Storage, srcObjectPath string, dstObjectPath string, options CopyOptions) error {
+	if copier, ok := storage.(CopyOptionsStorage); ok {
+		return copier.CopyWithOptions(srcObjectPath, dstObjectPath, options)
+	}
+	if options.MetadataDirective == MetadataReplace || options.StorageClass != "" || options.ReplaceTags || options.SourceBucket != "" {
+		return ErrCopyOptionsUnsupported
+	}
+
+	visibility := options.Visibility
+	if visibility == "" {
+		var err error
+		if visibility, err = storage.GetVisibility(srcObjectPath); err != nil {
+			return err
+		}
+	}
+	if err := storage.Copy(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	return storage.SetVisibility(dstObjectPath, visibility)
+}
+
+// encodeTags format tags as URL query, used by S3 x-amz-tagging header
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// sortedTagKeys return keys of tags in order, so requests are deterministic
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// defaultCopyConcurrency is number of copies CopyPrefix run in parallel by default
+const defaultCopyConcurrency = 8
+
+// WithCopyConcurrency bound number of objects CopyPrefix copy in parallel, default 8
+func WithCopyConcurrency(workers int) Option {
+	return func(o *storageOptions) {
+		o.copyConcurrency = workers
+	}
+}
+
+func (o storageOptions) copyWorkers() int {
+	if o.copyConcurrency <= 0 {
+		return defaultCopyConcurrency
+	}
+	return o.copyConcurrency
+}
+
+// trimPrefixRoot drop leading slash of a listing prefix, listed object paths have none
+func trimPrefixRoot(prefix string) string {
+	return strings.TrimPrefix(filepath.ToSlash(prefix), "/")
+}
+
+// copyListed copy every object listed under srcPrefix to the same relative path under dstPrefix
+// using up to workers parallel copies, the first failure stop scheduling further copies
+func copyListed(storage Storage, srcPrefix string, dstPrefix string, workers int) error {
+	srcPrefix, dstPrefix = trimPrefixRoot(srcPrefix), trimPrefixRoot(dstPrefix)
+	if srcPrefix == dstPrefix {
+		return nil
+	}
+	// copies would be listed again and copied endlessly
+	if strings.HasPrefix(dstPrefix, srcPrefix) {
+		return fmt.Errorf("err copying prefix %q into %q: destination is inside of source", srcPrefix, dstPrefix)
+	}
+
+	return ParallelForEachObject(context.Background(), storage, srcPrefix, workers, func(ctx context.Context, object ObjectInfo) error {
+		dstObjectPath := dstPrefix + strings.TrimPrefix(object.ObjectPath, srcPrefix)
+		if err := storage.Copy(object.ObjectPath, dstObjectPath); err != nil {
+			return fmt.Errorf("err copying %s to %s: %w", object.ObjectPath, dstObjectPath, err)
+		}
+		return nil
+	})
+}
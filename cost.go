@@ -0,0 +1,377 @@
+package gostorage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+type CostOperation string
+
+const (
+	CostOperationRead     CostOperation = "read"
+	CostOperationPut      CostOperation = "put"
+	CostOperationDelete   CostOperation = "delete"
+	CostOperationCopy     CostOperation = "copy"
+	CostOperationMetadata CostOperation = "metadata"
+)
+
+// PricingTable is provider pricing used for estimation, all prices are in USD
+type PricingTable struct {
+	RequestCost         map[CostOperation]float64 // price per single request
+	TransferInPerGB     float64                   // upload to the provider
+	TransferOutPerGB    float64                   // download from the provider
+	CountDeleteRequests bool                      // some providers don't charge delete request
+}
+
+// AWSS3StandardPricing is S3 standard storage class pricing of us-east-1
+var AWSS3StandardPricing = PricingTable{
+	RequestCost: map[CostOperation]float64{
+		CostOperationRead:     0.0004 / 1000,
+		CostOperationPut:      0.005 / 1000,
+		CostOperationCopy:     0.005 / 1000,
+		CostOperationMetadata: 0.0004 / 1000,
+	},
+	TransferOutPerGB: 0.09,
+}
+
+// AlibabaOSSStandardPricing is OSS standard storage class pricing of international regions
+var AlibabaOSSStandardPricing = PricingTable{
+	RequestCost: map[CostOperation]float64{
+		CostOperationRead:     0.01 / 10000,
+		CostOperationPut:      0.01 / 10000,
+		CostOperationCopy:     0.01 / 10000,
+		CostOperationMetadata: 0.01 / 10000,
+	},
+	TransferOutPerGB: 0.117,
+}
+
+// CostEntry is cumulative usage and estimated cost of an operation under a prefix
+type CostEntry struct {
+	Operation        CostOperation `json:"operation"`
+	Prefix           string        `json:"prefix"`
+	Requests         int64         `json:"requests"`
+	BytesIn          int64         `json:"bytes_in"`
+	BytesOut         int64         `json:"bytes_out"`
+	EstimatedCostUSD float64       `json:"estimated_cost_usd"`
+}
+
+type costKey struct {
+	operation CostOperation
+	prefix    string
+}
+
+// CostEstimator accumulate estimated request and transfer cost per operation and prefix,
+// it implements http.Handler serving metrics in prometheus text exposition format
+type CostEstimator struct {
+	mu          sync.Mutex
+	pricing     PricingTable
+	prefixDepth int
+	entries     map[costKey]*CostEntry
+}
+
+// NewCostEstimator create estimator grouping object paths by their first prefixDepth segments
+func NewCostEstimator(pricing PricingTable, prefixDepth int) *CostEstimator {
+	return &CostEstimator{
+		pricing:     pricing,
+		prefixDepth: prefixDepth,
+		entries:     make(map[costKey]*CostEntry),
+	}
+}
+
+func (e *CostEstimator) prefix(objectPath string) string {
+	if e.prefixDepth <= 0 {
+		return ""
+	}
+
+	segments := strings.Split(strings.TrimPrefix(objectPath, "/"), "/")
+	if len(segments) <= e.prefixDepth {
+		segments = segments[:len(segments)-1]
+	} else {
+		segments = segments[:e.prefixDepth]
+	}
+	return strings.Join(segments, "/")
+}
+
+func (e *CostEstimator) record(operation CostOperation, objectPath string, requests int64, bytesIn int64, bytesOut int64) {
+	if operation == CostOperationDelete && !e.pricing.CountDeleteRequests {
+		requests = 0
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := costKey{operation: operation, prefix: e.prefix(objectPath)}
+	entry, ok := e.entries[key]
+	if !ok {
+		entry = &CostEntry{Operation: operation, Prefix: key.prefix}
+		e.entries[key] = entry
+	}
+
+	entry.Requests += requests
+	entry.BytesIn += bytesIn
+	entry.BytesOut += bytesOut
+	entry.EstimatedCostUSD += float64(requests)*e.pricing.RequestCost[operation] +
+		float64(bytesIn)/bytesPerGB*e.pricing.TransferInPerGB +
+		float64(bytesOut)/bytesPerGB*e.pricing.TransferOutPerGB
+}
+
+// Snapshot return copy of current entries sorted by operation and prefix
+func (e *CostEstimator) Snapshot() []CostEntry {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	entries := make([]CostEntry, 0, len(e.entries))
+	for _, entry := range e.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Operation != entries[j].Operation {
+			return entries[i].Operation < entries[j].Operation
+		}
+		return entries[i].Prefix < entries[j].Prefix
+	})
+	return entries
+}
+
+// ServeHTTP write metrics in prometheus text exposition format
+func (e *CostEstimator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	entries := e.Snapshot()
+	metrics := []struct {
+		name  string
+		help  string
+		value func(entry CostEntry) string
+	}{
+		{"gostorage_estimated_cost_usd_total", "Estimated cumulative cost in USD.", func(entry CostEntry) string {
+			return fmt.Sprintf("%g", entry.EstimatedCostUSD)
+		}},
+		{"gostorage_requests_total", "Number of billable requests.", func(entry CostEntry) string {
+			return fmt.Sprintf("%d", entry.Requests)
+		}},
+		{"gostorage_transfer_in_bytes_total", "Bytes uploaded to the provider.", func(entry CostEntry) string {
+			return fmt.Sprintf("%d", entry.BytesIn)
+		}},
+		{"gostorage_transfer_out_bytes_total", "Bytes downloaded from the provider.", func(entry CostEntry) string {
+			return fmt.Sprintf("%d", entry.BytesOut)
+		}},
+	}
+
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", metric.name, metric.help, metric.name)
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s{operation=\"%s\",prefix=\"%s\"} %s\n", metric.name,
+				prometheusLabelEscaper.Replace(string(entry.Operation)), prometheusLabelEscaper.Replace(entry.Prefix), metric.value(entry))
+		}
+	}
+}
+
+// prometheusLabelEscaper escape label values as the text exposition format expect, other characters
+// including non-ASCII are written as is
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type costStorage struct {
+	Storage
+	estimator *CostEstimator
+}
+
+// WithCostEstimation wrap storage to record every operation into estimator
+func WithCostEstimation(storage Storage, estimator *CostEstimator) Storage {
+	return &costStorage{
+		Storage:   storage,
+		estimator: estimator,
+	}
+}
+
+// countingReader count bytes passing through and report them once on close or EOF
+type countingReader struct {
+	io.Reader
+	closer   io.Closer
+	n        int64
+	once     sync.Once
+	onFinish func(n int64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	r.finish()
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func (r *countingReader) finish() {
+	r.once.Do(func() {
+		r.onFinish(r.n)
+	})
+}
+
+func (s *costStorage) Read(objectPath string) (io.ReadCloser, error) {
+	reader, err := s.Storage.Read(objectPath)
+	if err != nil {
+		s.estimator.record(CostOperationRead, objectPath, 1, 0, 0)
+		return nil, err
+	}
+
+	return &countingReader{
+		Reader: reader,
+		closer: reader,
+		onFinish: func(n int64) {
+			s.estimator.record(CostOperationRead, objectPath, 1, 0, n)
+		},
+	}, nil
+}
+
+func (s *costStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := s.Storage.ReadRange(objectPath, offset, length)
+	if err != nil {
+		s.estimator.record(CostOperationRead, objectPath, 1, 0, 0)
+		return nil, err
+	}
+
+	return &countingReader{
+		Reader: reader,
+		closer: reader,
+		onFinish: func(n int64) {
+			s.estimator.record(CostOperationRead, objectPath, 1, 0, n)
+		},
+	}, nil
+}
+
+func (s *costStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	var written int64
+	counter := &countingReader{Reader: source, onFinish: func(n int64) { written = n }}
+	err := s.Storage.Put(objectPath, counter, visibility)
+	counter.finish()
+
+	s.estimator.record(CostOperationPut, objectPath, 1, written, 0)
+	return err
+}
+
+func (s *costStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *costStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	var written int64
+	counter := &countingReader{Reader: source, onFinish: func(n int64) { written = n }}
+	err := s.Storage.PutWithOptions(objectPath, counter, options)
+	counter.finish()
+
+	s.estimator.record(CostOperationPut, objectPath, 1, written, 0)
+	return err
+}
+
+func (s *costStorage) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.GetMetadata(objectPath)
+}
+
+func (s *costStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	s.estimator.record(CostOperationCopy, objectPath, 1, 0, 0)
+	return s.Storage.SetMetadata(objectPath, metadata)
+}
+
+func (s *costStorage) Touch(objectPath string) error {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	s.estimator.record(CostOperationCopy, objectPath, 1, 0, 0)
+	return s.Storage.Touch(objectPath)
+}
+
+func (s *costStorage) Delete(objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		s.estimator.record(CostOperationDelete, objectPath, 1, 0, 0)
+	}
+	return s.Storage.Delete(objectPaths...)
+}
+
+func (s *costStorage) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
+}
+
+func (s *costStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	s.estimator.record(CostOperationCopy, dstObjectPath, 1, 0, 0)
+	return s.Storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (s *costStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *costStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *costStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	s.estimator.record(CostOperationCopy, dstObjectPath, 1, 0, 0)
+	s.estimator.record(CostOperationDelete, srcObjectPath, 1, 0, 0)
+	return s.Storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (s *costStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	s.estimator.record(CostOperationCopy, dstObjectPath, int64(len(srcObjectPaths)+2), 0, 0)
+	return s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *costStorage) Size(objectPath string) (int64, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.Size(objectPath)
+}
+
+func (s *costStorage) LastModified(objectPath string) (time.Time, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.LastModified(objectPath)
+}
+
+func (s *costStorage) Stat(objectPath string) (ObjectInfo, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.Stat(objectPath)
+}
+
+func (s *costStorage) MimeType(objectPath string) (string, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.MimeType(objectPath)
+}
+
+func (s *costStorage) Exist(objectPath string) (bool, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.Exist(objectPath)
+}
+
+// ExistMany call Exist of the wrapper for every path
+func (s *costStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	return existEach(s, objectPaths)
+}
+
+func (s *costStorage) SetVisibility(objectPath string, visibility ObjectVisibility) error {
+	s.estimator.record(CostOperationPut, objectPath, 1, 0, 0)
+	return s.Storage.SetVisibility(objectPath, visibility)
+}
+
+func (s *costStorage) GetVisibility(objectPath string) (ObjectVisibility, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.GetVisibility(objectPath)
+}
+
+func (s *costStorage) GetACL(objectPath string) ([]Grant, error) {
+	s.estimator.record(CostOperationMetadata, objectPath, 1, 0, 0)
+	return s.Storage.GetACL(objectPath)
+}
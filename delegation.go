@@ -0,0 +1,146 @@
+package gostorage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrTokenInvalid is returned when a scoped token is malformed or its signature doesn't match
+var ErrTokenInvalid = errors.New("scoped token is invalid")
+
+// ErrTokenExpired is returned when a scoped token is used after its expiry
+var ErrTokenExpired = errors.New("scoped token is expired")
+
+// ErrTokenScope is returned when an operation is outside of the scope granted by a token
+var ErrTokenScope = errors.New("operation is not allowed by token scope")
+
+// Operation is a kind of access to objects
+type Operation string
+
+const (
+	OperationRead   Operation = "read"   // Read, URL, TemporaryURL and metadata lookups
+	OperationWrite  Operation = "write"  // Put, Copy/Compose destination and SetVisibility
+	OperationDelete Operation = "delete" // Delete
+	OperationList   Operation = "list"   // listing objects under a prefix
+)
+
+// TokenScope is what a scoped token grants, access to objects under Prefix
+// with the listed operations until ExpiresAt. Prefix is a directory, with or without
+// trailing slash, sibling keys sharing its name are outside of the scope.
+type TokenScope struct {
+	Subject    string      `json:"sub,omitempty"` // who the token was issued to, informational
+	Prefix     string      `json:"prefix"`
+	Operations []Operation `json:"ops"`
+	ExpiresAt  time.Time   `json:"exp"`
+}
+
+// Allow check whether operation on objectPath is inside the scope
+func (s TokenScope) Allow(operation Operation, objectPath string) bool {
+	allowed := false
+	for _, op := range s.Operations {
+		if op == operation {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return false
+	}
+
+	objectPath = strings.TrimPrefix(objectPath, "/")
+	if objectPath != "" && path.Clean(objectPath) != strings.TrimSuffix(objectPath, "/") {
+		// reject paths with "." or ".." segments which could resolve outside of prefix
+		return false
+	}
+	prefix := strings.Trim(s.Prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	// the prefix is a directory, "uploads/tenant-42" doesn't grant "uploads/tenant-420/", and
+	// listing the prefix itself without trailing slash would list such siblings as well
+	if objectPath == prefix {
+		return operation != OperationList
+	}
+	return strings.HasPrefix(objectPath, prefix+"/")
+}
+
+// MintScopedToken create token granting scope, signed with secret using HMAC-SHA256,
+// e.g. write under "uploads/tenant-42/" for an hour
+func MintScopedToken(secret []byte, scope TokenScope) (string, error) {
+	if len(secret) == 0 {
+		return "", fmt.Errorf("err minting scoped token: empty secret")
+	}
+	if scope.ExpiresAt.IsZero() {
+		return "", fmt.Errorf("err minting scoped token: expiry is required")
+	}
+
+	payload, err := json.Marshal(scope)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signToken(secret, encoded)), nil
+}
+
+// VerifyScopedToken check token signature and expiry and return the scope it grants
+func VerifyScopedToken(secret []byte, token string) (*TokenScope, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, signToken(secret, encoded)) {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+	var scope TokenScope
+	if err := json.Unmarshal(payload, &scope); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	if !time.Now().Before(scope.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	return &scope, nil
+}
+
+func signToken(secret []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// WithScopedToken verify token and wrap storage so every operation is checked against the
+// granted scope, operations outside of it fail with ErrTokenScope and all operations fail
+// with ErrTokenExpired once the token expired
+func WithScopedToken(storage Storage, secret []byte, token string) (Storage, error) {
+	scope, err := VerifyScopedToken(secret, token)
+	if err != nil {
+		return nil, err
+	}
+	return newScopedStorage(storage, *scope), nil
+}
+
+func newScopedStorage(storage Storage, scope TokenScope) Storage {
+	return newGuardedStorage(storage, func(ctx context.Context, operation Operation, objectPath string) error {
+		if !time.Now().Before(scope.ExpiresAt) {
+			return ErrTokenExpired
+		}
+		if !scope.Allow(operation, objectPath) {
+			return fmt.Errorf("%w: %s %s", ErrTokenScope, operation, objectPath)
+		}
+		return nil
+	})
+}
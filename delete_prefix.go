@@ -0,0 +1,79 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// deleteBatchSize is maximum number of keys of S3 and OSS multi-object delete requests
+const deleteBatchSize = 1000
+
+// checkDeletePrefix reject prefixes covering the whole storage
+func checkDeletePrefix(prefix string) error {
+	if objectKey(prefix) == "" {
+		return fmt.Errorf("err deleting prefix %q: it would delete every object", prefix)
+	}
+	return nil
+}
+
+// deleteListed delete objects listed under prefix in batches of deleteBatchSize
+func deleteListed(storage Storage, prefix string) error {
+	if err := checkDeletePrefix(prefix); err != nil {
+		return err
+	}
+
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return err
+	}
+	// objects failing in a batch don't stop deleting the next batches, failures of all batches are returned
+	var failures []DeleteFailure
+	deleteBatch := func(batch []string) error {
+		err := storage.Delete(batch...)
+		var multiErr *MultiDeleteError
+		if errors.As(err, &multiErr) {
+			failures = append(failures, multiErr.Failures...)
+			return nil
+		}
+		return err
+	}
+
+	batch := make([]string, 0, deleteBatchSize)
+	for iterator.Next() {
+		batch = append(batch, iterator.Object().ObjectPath)
+		if len(batch) < deleteBatchSize {
+			continue
+		}
+		if err := deleteBatch(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	if err := deleteBatch(batch); err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return &MultiDeleteError{Failures: failures}
+	}
+	return nil
+}
+
+// CountPrefix return number of objects DeletePrefix would delete, use it as a dry run
+func CountPrefix(storage Storage, prefix string) (int, error) {
+	if err := checkDeletePrefix(prefix); err != nil {
+		return 0, err
+	}
+
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for iterator.Next() {
+		count++
+	}
+	return count, iterator.Err()
+}
@@ -0,0 +1,188 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	deployManifestName = ".deploy-manifest.json"
+
+	defaultImmutableCacheControl = "public, max-age=31536000, immutable"
+	defaultHTMLCacheControl      = "public, max-age=0, must-revalidate"
+	defaultAssetCacheControl     = "public, max-age=3600"
+)
+
+// defaultHashedFilePattern match fingerprinted file names such as app.3f2a9b1c.js or main-3f2a9b1c.css
+var defaultHashedFilePattern = regexp.MustCompile(`[.\-_][0-9a-fA-F]{8,}\.[^./]+$`)
+
+// DeployOptions configure DeployAssets, zero value fields use sensible defaults
+type DeployOptions struct {
+	Visibility            ObjectVisibility // default ObjectPublicRead
+	ImmutableCacheControl string           // for hashed file names, they never change
+	HTMLCacheControl      string           // for html pages, always revalidated
+	AssetCacheControl     string           // for every other file
+	HashedFilePattern     *regexp.Regexp   // match base name of hashed files
+	DeleteRemoved         bool             // delete files uploaded by previous deploy but missing locally
+}
+
+// DeployResult list object paths touched by DeployAssets
+type DeployResult struct {
+	Uploaded []string `json:"uploaded"`
+	Deleted  []string `json:"deleted"`
+}
+
+type deployManifest struct {
+	Files []string `json:"files"`
+}
+
+func (o DeployOptions) withDefaults() DeployOptions {
+	if o.Visibility == "" {
+		o.Visibility = ObjectPublicRead
+	}
+	if o.ImmutableCacheControl == "" {
+		o.ImmutableCacheControl = defaultImmutableCacheControl
+	}
+	if o.HTMLCacheControl == "" {
+		o.HTMLCacheControl = defaultHTMLCacheControl
+	}
+	if o.AssetCacheControl == "" {
+		o.AssetCacheControl = defaultAssetCacheControl
+	}
+	if o.HashedFilePattern == nil {
+		o.HashedFilePattern = defaultHashedFilePattern
+	}
+	return o
+}
+
+func (o DeployOptions) headers(filePath string) ObjectHeaders {
+	headers := ObjectHeaders{ContentType: mime.TypeByExtension(strings.ToLower(path.Ext(filePath)))}
+	if headers.ContentType == "" {
+		headers.ContentType = "application/octet-stream"
+	}
+
+	switch {
+	case isHTMLFile(filePath):
+		headers.CacheControl = o.HTMLCacheControl
+	case o.HashedFilePattern.MatchString(path.Base(filePath)):
+		headers.CacheControl = o.ImmutableCacheControl
+	default:
+		headers.CacheControl = o.AssetCacheControl
+	}
+	return headers
+}
+
+// DeployAssets upload static site in localDir under prefix with content type and cache control
+// set per file. Html pages are uploaded last so they never reference assets not uploaded yet.
+// Deployed files are recorded in a manifest under prefix, used to find removed files on next deploy.
+func DeployAssets(storage Storage, localDir string, prefix string, opts DeployOptions) (*DeployResult, error) {
+	opts = opts.withDefaults()
+
+	var files []string
+	err := filepath.Walk(localDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		relPath, err := filepath.Rel(localDir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return !isHTMLFile(files[i]) && isHTMLFile(files[j])
+	})
+
+	previous, err := readDeployManifest(storage, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeployResult{}
+	for _, file := range files {
+		objectPath := path.Join(prefix, file)
+		if err := deployFile(storage, filepath.Join(localDir, filepath.FromSlash(file)), objectPath, opts); err != nil {
+			return result, err
+		}
+		result.Uploaded = append(result.Uploaded, objectPath)
+	}
+
+	data, err := json.Marshal(deployManifest{Files: files})
+	if err != nil {
+		return result, err
+	}
+	if err := storage.Put(path.Join(prefix, deployManifestName), bytes.NewReader(data), ObjectPrivate); err != nil {
+		return result, err
+	}
+
+	if !opts.DeleteRemoved {
+		return result, nil
+	}
+
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file] = true
+	}
+
+	var removed []string
+	for _, file := range previous.Files {
+		if !current[file] {
+			removed = append(removed, path.Join(prefix, file))
+		}
+	}
+	if len(removed) > 0 {
+		if err := storage.Delete(removed...); err != nil {
+			return result, err
+		}
+		result.Deleted = removed
+	}
+	return result, nil
+}
+
+func deployFile(storage Storage, localPath string, objectPath string, opts DeployOptions) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return putWithHeaders(storage, objectPath, file, opts.Visibility, opts.headers(objectPath))
+}
+
+func readDeployManifest(storage Storage, prefix string) (*deployManifest, error) {
+	manifestPath := path.Join(prefix, deployManifestName)
+	exist, err := storage.Exist(manifestPath)
+	if err != nil || !exist {
+		return &deployManifest{}, err
+	}
+
+	reader, err := storage.Read(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var manifest deployManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func isHTMLFile(filePath string) bool {
+	ext := strings.ToLower(path.Ext(filePath))
+	return ext == ".html" || ext == ".htm"
+}
@@ -0,0 +1,138 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultDownloadPartSize    = 8 * 1024 * 1024
+	defaultDownloadConcurrency = 4
+)
+
+// RangeReader is the part of Storage reading part of an object, for callers which need nothing else
+type RangeReader interface {
+	// ReadRange read length bytes starting at offset, negative length read until the end of the object
+	ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error)
+}
+
+// DownloadOptions configure DownloadTo
+type DownloadOptions struct {
+	PartSize    int64 // size of each range request, default 8MB
+	Concurrency int   // range requests in flight, default 4
+}
+
+type downloadPart struct {
+	data []byte
+	err  error
+}
+
+// DownloadTo stream objectPath into w fetching parts with parallel range requests, parts are written
+// in order so w doesn't need to be seekable and at most Concurrency parts are buffered in memory.
+// Return number of bytes written.
+func DownloadTo(storage Storage, objectPath string, w io.Writer, options DownloadOptions) (int64, error) {
+	if options.PartSize <= 0 {
+		options.PartSize = defaultDownloadPartSize
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultDownloadConcurrency
+	}
+
+	size, err := storage.Size(objectPath)
+	if err != nil {
+		return 0, err
+	}
+	parts := int((size + options.PartSize - 1) / options.PartSize)
+	if parts <= 1 || options.Concurrency == 1 {
+		return downloadSingle(storage, objectPath, w)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]chan downloadPart, parts)
+	for i := range results {
+		results[i] = make(chan downloadPart, 1)
+	}
+
+	// a slot is taken before a part is fetched and released once it's written,
+	// bounding buffered parts to Concurrency
+	slots := make(chan struct{}, options.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		for i := 0; i < parts; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			offset := int64(i) * options.PartSize
+			length := min(options.PartSize, size-offset)
+			wg.Add(1)
+			go func(result chan<- downloadPart) {
+				defer wg.Done()
+				data, err := readPart(storage, objectPath, offset, length)
+				result <- downloadPart{data: data, err: err}
+			}(results[i])
+		}
+	}()
+
+	var written int64
+	for i := 0; i < parts; i++ {
+		var part downloadPart
+		select {
+		case part = <-results[i]:
+		case <-ctx.Done():
+			return written, ctx.Err()
+		}
+		if part.err != nil {
+			cancel()
+			return written, part.err
+		}
+
+		n, err := w.Write(part.data)
+		written += int64(n)
+		if err != nil {
+			cancel()
+			return written, err
+		}
+		<-slots
+	}
+	return written, nil
+}
+
+// httpRange format Range header value of length bytes at offset, negative length read until the end
+func httpRange(offset, length int64) string {
+	if length < 0 {
+		return fmt.Sprintf("bytes=%d-", offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+}
+
+func readPart(rangeReader RangeReader, objectPath string, offset, length int64) ([]byte, error) {
+	reader, err := rangeReader.ReadRange(objectPath, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, fmt.Errorf("err reading %s at offset %d: %s", objectPath, offset, err)
+	}
+	return data, nil
+}
+
+func downloadSingle(storage Storage, objectPath string, w io.Writer) (int64, error) {
+	reader, err := storage.Read(objectPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	return io.Copy(w, reader)
+}
@@ -0,0 +1,139 @@
+package gostorage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "GOSTORAGE_"
+
+// FromEnv create storage configured by environment variables:
+//
+//	GOSTORAGE_DRIVER                local, s3, oss, obs or a registered driver, inferred from the other variables when empty
+//	GOSTORAGE_BUCKET                bucket name, AWS_S3_BUCKET, OSS_BUCKET and OBS_BUCKET are also accepted
+//	GOSTORAGE_LOCAL_DIR             base directory of local storage
+//	GOSTORAGE_LOCAL_PUBLIC_DIR      public base directory of local storage
+//	GOSTORAGE_LOCAL_PUBLIC_URL      public base url of local storage
+//	AWS_REGION                      (or AWS_DEFAULT_REGION) AWS_ACCESS_KEY_ID AWS_SECRET_ACCESS_KEY AWS_SESSION_TOKEN
+//	OSS_ENDPOINT                    OSS_REGION OSS_ACCESS_KEY_ID OSS_ACCESS_KEY_SECRET
+//	OBS_ENDPOINT                    OBS_ACCESS_KEY_ID OBS_SECRET_ACCESS_KEY
+//	GOSTORAGE_DISABLE_ACL, GOSTORAGE_SKIP_URL_EXISTENCE_CHECK, GOSTORAGE_DEBUG, GOSTORAGE_DIRECTORY_MARKERS,
+//	GOSTORAGE_OSS_SIGNATURE_V4, GOSTORAGE_OSS_INTERNAL_ENDPOINT   booleans
+//	GOSTORAGE_TIMEOUT               default operation timeout, e.g. "30s"
+//	GOSTORAGE_READ_RETRY            read retry attempts
+//	GOSTORAGE_HEDGE_DELAY           delay before hedged read request, e.g. "50ms"
+//	GOSTORAGE_STALL_TIMEOUT         abort streams transferring no bytes for this long, e.g. "20s"
+//	GOSTORAGE_MIN_TEMPORARY_URL_EXPIRY, GOSTORAGE_MAX_TEMPORARY_URL_EXPIRY   bounds of TemporaryURL expiry, e.g. "1m"
+//	GOSTORAGE_PARAM_<NAME>          param "<name>" (lowercase) of registered drivers
+func FromEnv(opts ...Option) (Storage, error) {
+	config, err := storageConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return config.NewStorage(opts...)
+}
+
+func storageConfigFromEnv() (StorageConfig, error) {
+	config := StorageConfig{
+		Driver:        os.Getenv(envPrefix + "DRIVER"),
+		BaseDir:       os.Getenv(envPrefix + "LOCAL_DIR"),
+		PublicBaseDir: os.Getenv(envPrefix + "LOCAL_PUBLIC_DIR"),
+		PublicBaseURL: os.Getenv(envPrefix + "LOCAL_PUBLIC_URL"),
+		Bucket:        firstEnv(envPrefix+"BUCKET", "AWS_S3_BUCKET", "OSS_BUCKET", "OBS_BUCKET"),
+		Timeout:       os.Getenv(envPrefix + "TIMEOUT"),
+		HedgeDelay:    os.Getenv(envPrefix + "HEDGE_DELAY"),
+		StallTimeout:  os.Getenv(envPrefix + "STALL_TIMEOUT"),
+
+		MinTemporaryURLExpiry: os.Getenv(envPrefix + "MIN_TEMPORARY_URL_EXPIRY"),
+		MaxTemporaryURLExpiry: os.Getenv(envPrefix + "MAX_TEMPORARY_URL_EXPIRY"),
+	}
+
+	if config.Driver == "" {
+		switch {
+		case config.BaseDir != "":
+			config.Driver = DriverLocal
+		case os.Getenv("OSS_ENDPOINT") != "":
+			config.Driver = DriverOSS
+		case os.Getenv("OBS_ENDPOINT") != "":
+			config.Driver = DriverOBS
+		case firstEnv("AWS_REGION", "AWS_DEFAULT_REGION") != "":
+			config.Driver = DriverS3
+		default:
+			return config, fmt.Errorf("err %sDRIVER is not set and can't be inferred", envPrefix)
+		}
+	}
+
+	switch strings.ToLower(config.Driver) {
+	case DriverS3:
+		config.Driver = DriverS3
+		config.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	case DriverOSS:
+		config.Driver = DriverOSS
+		config.Region = os.Getenv("OSS_REGION")
+		config.Endpoint = os.Getenv("OSS_ENDPOINT")
+		config.AccessKeyID = os.Getenv("OSS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("OSS_ACCESS_KEY_SECRET")
+	case DriverOBS:
+		config.Driver = DriverOBS
+		config.Endpoint = os.Getenv("OBS_ENDPOINT")
+		config.AccessKeyID = os.Getenv("OBS_ACCESS_KEY_ID")
+		config.SecretAccessKey = os.Getenv("OBS_SECRET_ACCESS_KEY")
+	}
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if param := strings.TrimPrefix(name, envPrefix+"PARAM_"); param != name && param != "" {
+			if config.Params == nil {
+				config.Params = make(map[string]string)
+			}
+			config.Params[strings.ToLower(param)] = value
+		}
+	}
+
+	flags := []struct {
+		name  string
+		value *bool
+	}{
+		{"DISABLE_ACL", &config.DisableACL},
+		{"SKIP_URL_EXISTENCE_CHECK", &config.SkipURLExistenceCheck},
+		{"DEBUG", &config.Debug},
+		{"DIRECTORY_MARKERS", &config.DirectoryMarkers},
+		{"OSS_SIGNATURE_V4", &config.OSSSignatureV4},
+		{"OSS_INTERNAL_ENDPOINT", &config.OSSInternalEndpoint},
+	}
+	for _, flag := range flags {
+		value := os.Getenv(envPrefix + flag.name)
+		if value == "" {
+			continue
+		}
+
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("err invalid %s%s: %s", envPrefix, flag.name, value)
+		}
+		*flag.value = enabled
+	}
+
+	if value := os.Getenv(envPrefix + "READ_RETRY"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil {
+			return config, fmt.Errorf("err invalid %sREAD_RETRY: %s", envPrefix, value)
+		}
+		config.ReadRetryAttempts = attempts
+	}
+	return config, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
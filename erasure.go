@@ -0,0 +1,295 @@
+package gostorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrErasureReportInvalid is returned when signature of an erasure report doesn't match its content
+var ErrErasureReportInvalid = errors.New("erasure report signature is invalid")
+
+// ErasureRequest select objects holding data of a subject, e.g. for a GDPR right to erasure request
+type ErasureRequest struct {
+	Subject     string   // reference of the subject or request recorded in the report, e.g. ticket ID
+	Prefixes    []string // every object under these prefixes is erased
+	ObjectPaths []string // objects erased individually
+	Storages    []string // names of registered storages to erase from, all of them when empty
+}
+
+// ErasedObject is an object removed from a storage
+type ErasedObject struct {
+	Storage    string   `json:"storage"`
+	ObjectPath string   `json:"object_path"`
+	Versions   []string `json:"versions,omitempty"` // IDs of versions and delete markers permanently removed
+	Verified   bool     `json:"verified"`           // object and its versions were confirmed gone afterwards
+}
+
+// ErasureReport list objects EraseSubjectData removed, signed so it can be kept as evidence
+type ErasureReport struct {
+	Subject     string         `json:"subject"`
+	Prefixes    []string       `json:"prefixes,omitempty"`
+	ObjectPaths []string       `json:"object_paths,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt time.Time      `json:"completed_at"`
+	Objects     []ErasedObject `json:"objects"`
+	Failures    []string       `json:"failures,omitempty"`
+	Signature   string         `json:"signature"`
+}
+
+func (r ErasureReport) sign(secret []byte) (string, error) {
+	r.Signature = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyErasureReport check report was signed with secret and wasn't changed since
+func VerifyErasureReport(report *ErasureReport, secret []byte) error {
+	signature, err := report.sign(secret)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(report.Signature)) {
+		return ErrErasureReportInvalid
+	}
+	return nil
+}
+
+// EraseSubjectData delete objects selected by request from registered storages together with every
+// version of versioned buckets, tags and metadata going with them, cached copies of disk caches
+// wrapping the storages and copies kept in trash by WithTrash. Each object is looked up again afterwards to verify it's gone. The report
+// is signed with secret and returned even when some objects couldn't be erased, those are listed
+// as failures and returned as error.
+func (m *Manager) EraseSubjectData(request ErasureRequest, secret []byte) (*ErasureReport, error) {
+	if len(request.Prefixes) == 0 && len(request.ObjectPaths) == 0 {
+		return nil, fmt.Errorf("err erasure request select no object")
+	}
+	for _, prefix := range request.Prefixes {
+		if err := checkDeletePrefix(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	names := request.Storages
+	if len(names) == 0 {
+		names = m.Names()
+	}
+	storages := make(map[string]Storage, len(names))
+	for _, name := range names {
+		storage, err := m.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		storages[name] = storage
+	}
+
+	report := &ErasureReport{
+		Subject:     request.Subject,
+		Prefixes:    request.Prefixes,
+		ObjectPaths: request.ObjectPaths,
+		StartedAt:   time.Now().UTC(),
+		Objects:     []ErasedObject{},
+	}
+	var errs []error
+	for _, name := range names {
+		objects, err := eraseFromStorage(name, storages[name], request)
+		report.Objects = append(report.Objects, objects...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			report.Failures = append(report.Failures, fmt.Sprintf("%s: %s", name, err))
+		}
+	}
+	for _, object := range report.Objects {
+		if !object.Verified {
+			err := fmt.Errorf("%s: %s is still present after erasure", object.Storage, object.ObjectPath)
+			errs = append(errs, err)
+			report.Failures = append(report.Failures, err.Error())
+		}
+	}
+	report.CompletedAt = time.Now().UTC()
+
+	signature, err := report.sign(secret)
+	if err != nil {
+		return nil, err
+	}
+	report.Signature = signature
+	return report, errors.Join(errs...)
+}
+
+// erasureSelection match keys of objects selected by an erasure request
+type erasureSelection struct {
+	prefixes []string
+	keys     map[string]bool
+}
+
+func newErasureSelection(request ErasureRequest) erasureSelection {
+	selection := erasureSelection{keys: make(map[string]bool, len(request.ObjectPaths))}
+	for _, prefix := range request.Prefixes {
+		selection.prefixes = append(selection.prefixes, trimPrefixRoot(prefix))
+	}
+	for _, objectPath := range request.ObjectPaths {
+		selection.keys[objectKey(objectPath)] = true
+	}
+	return selection
+}
+
+func (e erasureSelection) match(key string) bool {
+	if e.keys[key] {
+		return true
+	}
+	for _, prefix := range e.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// listVersions return versions of selected objects, nil when storage isn't able to purge versions
+func (e erasureSelection) listVersions(purger VersionPurger) ([]ObjectVersion, error) {
+	if purger == nil {
+		return nil, nil
+	}
+	var selected []ObjectVersion
+	listed := make(map[string]bool)
+	for _, prefix := range append(append([]string{}, e.prefixes...), sortedKeys(e.keys)...) {
+		versions, err := purger.ListVersions(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			id := version.ObjectPath + "\x00" + version.VersionID
+			if e.match(version.ObjectPath) && !listed[id] {
+				listed[id] = true
+				selected = append(selected, version)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// deleteKeys delete keys through storage in batches of deleteBatchSize
+func deleteKeys(storage Storage, keys []string) error {
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := storage.Delete(keys[start:end]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func eraseFromStorage(name string, storage Storage, request ErasureRequest) ([]ErasedObject, error) {
+	selection := newErasureSelection(request)
+	purger, _ := underlying(storage).(VersionPurger)
+
+	// current objects are deleted through the storage so wrappers keep their state in sync
+	keys := make(map[string]bool)
+	for key := range selection.keys {
+		keys[key] = true
+	}
+	for _, prefix := range selection.prefixes {
+		iterator, err := storage.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+		for iterator.Next() {
+			keys[iterator.Object().ObjectPath] = true
+		}
+		if err := iterator.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if err := deleteKeys(storage, sortedKeys(keys)); err != nil {
+		return nil, err
+	}
+
+	// with WithTrash Delete only moved objects to trash, trashed copies, including ones trashed
+	// before the request, are deleted for good and verified like the objects themselves
+	trashed, err := storageTrash(storage).trashedMatching(storage, selection.match)
+	if err != nil {
+		return nil, err
+	}
+	for _, trashPath := range trashed {
+		keys[objectKey(trashPath)] = true
+		selection.keys[objectKey(trashPath)] = true
+	}
+	if err := deleteKeys(storage, trashed); err != nil {
+		return nil, err
+	}
+
+	// versions are listed after Delete to remove delete markers it left as well
+	versions, err := selection.listVersions(purger)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		if err := purger.DeleteVersions(versions...); err != nil {
+			return nil, err
+		}
+	}
+	removed := make(map[string][]string)
+	for _, version := range versions {
+		keys[version.ObjectPath] = true
+		removed[version.ObjectPath] = append(removed[version.ObjectPath], version.VersionID)
+	}
+
+	for wrapped := storage; wrapped != nil; {
+		if cache, ok := wrapped.(*DiskCache); ok {
+			cache.invalidateMatching(selection.match)
+		}
+		unwrapper, ok := wrapped.(Unwrapper)
+		if !ok {
+			break
+		}
+		wrapped = unwrapper.Unwrap()
+	}
+
+	remaining, err := selection.listVersions(purger)
+	if err != nil {
+		return nil, err
+	}
+	left := make(map[string]bool, len(remaining))
+	for _, version := range remaining {
+		left[version.ObjectPath] = true
+	}
+
+	verifier := underlying(storage)
+	var objects []ErasedObject
+	for _, key := range sortedKeys(keys) {
+		exist, err := verifier.Exist(key)
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, ErasedObject{
+			Storage:    name,
+			ObjectPath: key,
+			Versions:   removed[key],
+			Verified:   !exist && !left[key],
+		})
+	}
+	return objects, nil
+}
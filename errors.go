@@ -0,0 +1,231 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+var (
+	// ErrObjectNotExist is matched by errors of operations on missing objects
+	ErrObjectNotExist = errors.New("object does not exist")
+
+	// ErrBucketNotExist is matched by errors of operations on missing buckets
+	ErrBucketNotExist = errors.New("bucket does not exist")
+
+	// ErrPermissionDenied is matched by errors of operations the credentials aren't allowed to perform
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// backendError keep error of the backend unchanged while matching sentinel with errors.Is,
+// so SDK error types can still be inspected with errors.As
+type backendError struct {
+	sentinel error
+	err      error
+}
+
+func (e *backendError) Error() string {
+	return e.err.Error()
+}
+
+func (e *backendError) Unwrap() []error {
+	return []error{e.sentinel, e.err}
+}
+
+func withSentinel(sentinel error, err error) error {
+	if sentinel == nil || errors.Is(err, sentinel) {
+		return err
+	}
+	return &backendError{sentinel: sentinel, err: err}
+}
+
+// s3Error match S3 error codes and status codes with sentinel errors
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sentinel error
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case "NoSuchKey", "NoSuchVersion":
+			sentinel = ErrObjectNotExist
+		case "NoSuchBucket":
+			sentinel = ErrBucketNotExist
+		case "AccessDenied", "AllAccessDisabled", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			sentinel = ErrPermissionDenied
+		case "PreconditionFailed", "ConditionalRequestConflict":
+			sentinel = ErrPreconditionFailed
+		}
+	}
+	var reqErr awserr.RequestFailure
+	if sentinel == nil && errors.As(err, &reqErr) {
+		// HEAD responses have no body, so only the status is known
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			sentinel = ErrObjectNotExist
+		case http.StatusForbidden:
+			sentinel = ErrPermissionDenied
+		case http.StatusPreconditionFailed:
+			sentinel = ErrPreconditionFailed
+		case http.StatusNotModified:
+			sentinel = ErrNotModified
+		}
+	}
+	return withSentinel(sentinel, err)
+}
+
+// useSentinelErrors make errors returned by AWS SDK requests of handlers match sentinel errors,
+// pushed after retry decisions so retries still see raw SDK errors
+func useSentinelErrors(handlers *request.Handlers) {
+	handlers.AfterRetry.PushBackNamed(request.NamedHandler{
+		Name: "gostorage.SentinelErrors",
+		Fn: func(r *request.Request) {
+			r.Error = s3Error(r.Error)
+		},
+	})
+}
+
+// ossError match OSS error codes and status codes with sentinel errors
+func ossError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sentinel error
+	var serviceErr oss.ServiceError
+	if errors.As(err, &serviceErr) {
+		switch {
+		case serviceErr.Code == "NoSuchKey":
+			sentinel = ErrObjectNotExist
+		case serviceErr.Code == "NoSuchBucket":
+			sentinel = ErrBucketNotExist
+		case serviceErr.Code == "FileAlreadyExists", serviceErr.StatusCode == http.StatusPreconditionFailed:
+			sentinel = ErrPreconditionFailed
+		case serviceErr.StatusCode == http.StatusNotModified:
+			sentinel = ErrNotModified
+		case serviceErr.StatusCode == http.StatusForbidden:
+			sentinel = ErrPermissionDenied
+		case serviceErr.StatusCode == http.StatusNotFound:
+			sentinel = ErrObjectNotExist
+		}
+	}
+	return withSentinel(sentinel, err)
+}
+
+// localError match filesystem errors with sentinel errors
+func localError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var sentinel error
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		sentinel = ErrObjectNotExist
+	case errors.Is(err, os.ErrPermission):
+		sentinel = ErrPermissionDenied
+	}
+	return withSentinel(sentinel, err)
+}
+
+// DeleteFailure is an object a batch Delete couldn't remove and reason reported by the backend
+type DeleteFailure struct {
+	ObjectPath string // path as given to Delete
+	Code       string
+	Message    string
+}
+
+// MultiDeleteError returned by batch Delete when some objects weren't removed, the other objects were.
+// Failed objects are matched with sentinel errors from their code, e.g. ErrPermissionDenied.
+type MultiDeleteError struct {
+	Failures []DeleteFailure
+}
+
+func (e *MultiDeleteError) Error() string {
+	if len(e.Failures) == 1 {
+		failure := e.Failures[0]
+		return fmt.Sprintf("err deleting %s: %s: %s", failure.ObjectPath, failure.Code, failure.Message)
+	}
+	return fmt.Sprintf("err deleting %d objects, first failure %s: %s: %s", len(e.Failures), e.Failures[0].ObjectPath, e.Failures[0].Code, e.Failures[0].Message)
+}
+
+// ObjectPaths return paths of objects which weren't deleted, to retry only them
+func (e *MultiDeleteError) ObjectPaths() []string {
+	objectPaths := make([]string, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		objectPaths = append(objectPaths, failure.ObjectPath)
+	}
+	return objectPaths
+}
+
+func (e *MultiDeleteError) Unwrap() []error {
+	var sentinels []error
+	seen := make(map[error]bool)
+	for _, failure := range e.Failures {
+		sentinel := deleteFailureSentinel(failure.Code)
+		if sentinel != nil && !seen[sentinel] {
+			seen[sentinel] = true
+			sentinels = append(sentinels, sentinel)
+		}
+	}
+	return sentinels
+}
+
+func deleteFailureSentinel(code string) error {
+	switch code {
+	case "NoSuchKey", "NoSuchVersion":
+		return ErrObjectNotExist
+	case "NoSuchBucket":
+		return ErrBucketNotExist
+	case "AccessDenied", "AllAccessDisabled":
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// newMultiDeleteError map failed keys of a batch back to paths given to Delete, nil without failures
+func newMultiDeleteError(objectPaths []string, cleanPath func(string) string, failures []DeleteFailure) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	original := make(map[string]string, len(objectPaths))
+	for _, objectPath := range objectPaths {
+		original[cleanPath(objectPath)] = objectPath
+	}
+	for i := range failures {
+		if objectPath, ok := original[failures[i].ObjectPath]; ok {
+			failures[i].ObjectPath = objectPath
+		}
+	}
+	return &MultiDeleteError{Failures: failures}
+}
+
+// deletedObjectPaths return paths of objectPaths removed by a Delete returning err, which is all of
+// them on success and the ones missing from a MultiDeleteError
+func deletedObjectPaths(objectPaths []string, err error) []string {
+	if err == nil {
+		return objectPaths
+	}
+	var multiErr *MultiDeleteError
+	if !errors.As(err, &multiErr) {
+		return nil
+	}
+	failed := make(map[string]bool, len(multiErr.Failures))
+	for _, failure := range multiErr.Failures {
+		failed[failure.ObjectPath] = true
+	}
+	var deleted []string
+	for _, objectPath := range objectPaths {
+		if !failed[objectPath] {
+			deleted = append(deleted, objectPath)
+		}
+	}
+	return deleted
+}
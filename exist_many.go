@@ -0,0 +1,123 @@
+package gostorage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+const (
+	// existManyConcurrency is number of Exist calls ExistMany and StatMany run in parallel
+	existManyConcurrency = 16
+
+	// existManyListThreshold is number of paths from which ExistMany try listing their common prefix
+	existManyListThreshold = 16
+
+	// existManyListFactor bound listed objects per checked path before listing is abandoned
+	existManyListFactor = 4
+)
+
+// existEach check every path with its own Exist call, running up to existManyConcurrency at once
+func existEach(storage Storage, objectPaths []string) (map[string]bool, error) {
+	var mu sync.Mutex
+	result := make(map[string]bool, len(objectPaths))
+	err := ParallelForEach(context.Background(), objectPaths, existManyConcurrency, func(ctx context.Context, objectPath string) error {
+		exist, err := storage.Exist(objectPath)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[objectPath] = exist
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// existMany look many paths sharing a prefix up by listing the prefix once, listing is abandoned
+// for existEach when it goes through more than existManyListFactor objects per path.
+// Backends reporting directory markers as existing objects must use existEach.
+func existMany(storage Storage, objectPaths []string) (map[string]bool, error) {
+	if len(objectPaths) < existManyListThreshold {
+		return existEach(storage, objectPaths)
+	}
+
+	keys := make([]string, 0, len(objectPaths))
+	wanted := make(map[string]bool, len(objectPaths))
+	for _, objectPath := range objectPaths {
+		key := objectKey(objectPath)
+		if !wanted[key] {
+			wanted[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	prefix := commonPrefix(keys[0], keys[len(keys)-1])
+	if prefix == "" {
+		return existEach(storage, objectPaths)
+	}
+
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(keys))
+	limit := len(keys) * existManyListFactor
+	for listed := 0; iterator.Next(); listed++ {
+		key := iterator.Object().ObjectPath
+		// listing is in lexical order, nothing after the last key is needed
+		if key > keys[len(keys)-1] {
+			break
+		}
+		if listed >= limit {
+			return existEach(storage, objectPaths)
+		}
+		if wanted[key] {
+			found[key] = true
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(objectPaths))
+	for _, objectPath := range objectPaths {
+		result[objectPath] = found[objectKey(objectPath)]
+	}
+	return result, nil
+}
+
+// commonPrefix return longest common prefix of first and last of sorted strings, shared by all of them
+func commonPrefix(first string, last string) string {
+	i := 0
+	for i < len(first) && i < len(last) && first[i] == last[i] {
+		i++
+	}
+	return first[:i]
+}
+
+// StatMany stat every path with up to 16 parallel Stat calls, missing objects are left out of the result
+func StatMany(storage Storage, objectPaths ...string) (map[string]ObjectInfo, error) {
+	var mu sync.Mutex
+	result := make(map[string]ObjectInfo, len(objectPaths))
+	err := ParallelForEach(context.Background(), objectPaths, existManyConcurrency, func(ctx context.Context, objectPath string) error {
+		info, err := storage.Stat(objectPath)
+		if errors.Is(err, ErrObjectNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		mu.Lock()
+		result[objectPath] = info
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package gostorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DownloadFile download objectPath into localPath, creating parent directories. Data is written to
+// a ".part" file next to localPath which is renamed once complete, so localPath never hold a partial
+// object. A download interrupted before is resumed from its part file when the object didn't change.
+func DownloadFile(storage Storage, objectPath string, localPath string) error {
+	info, err := storage.Stat(objectPath)
+	if err != nil {
+		return err
+	}
+	if err := checkAndCreateParentDirectory(localPath); err != nil {
+		return err
+	}
+
+	partPath := downloadPartPath(localPath, info)
+	if err := removeStaleParts(localPath, partPath); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > info.Size {
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if offset < info.Size {
+		reader, err := storage.ReadRange(objectPath, offset, -1)
+		if err != nil {
+			return err
+		}
+		written, err := io.Copy(file, reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("err downloading %s at offset %d: %w", objectPath, offset+written, err)
+		}
+		offset += written
+	}
+	if offset != info.Size {
+		return fmt.Errorf("err downloading %s: expected %d bytes, got %d", objectPath, info.Size, offset)
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, localPath)
+}
+
+// downloadPartPath return part file of a download of the object version described by info,
+// a changed object get another part file so stale data is never resumed
+func downloadPartPath(localPath string, info ObjectInfo) string {
+	version := fmt.Sprintf("%s/%d/%d", info.ETag, info.Size, info.LastModified.UnixNano())
+	sum := sha256.Sum256([]byte(version))
+	return localPath + "." + hex.EncodeToString(sum[:4]) + ".part"
+}
+
+// removeStaleParts remove part files of previous downloads of other object versions into localPath
+func removeStaleParts(localPath string, partPath string) error {
+	matches, err := filepath.Glob(escapeGlob(localPath) + ".*.part")
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		if match != partPath {
+			if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// escapeGlob escape glob metacharacters of a literal path
+func escapeGlob(path string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return replacer.Replace(path)
+}
+
+// UploadFile upload localPath to objectPath, content type is detected from the file like Put
+func UploadFile(storage Storage, localPath string, objectPath string, visibility ObjectVisibility) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return storage.Put(objectPath, file, visibility)
+}
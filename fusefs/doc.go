@@ -0,0 +1,8 @@
+// Package fusefs mount a gostorage.Storage as a read-write filesystem using FUSE (linux and macOS),
+// so tools which only understand file paths can work with bucket content.
+//
+// Objects are downloaded whole into a local cache on first read and served from there, writes go to
+// a local temporary copy which is uploaded when the file is flushed or closed. Directory listings
+// require the storage to implement DirLister, otherwise only objects looked up by name or created
+// through the mount are listed.
+package fusefs
@@ -0,0 +1,538 @@
+//go:build linux || darwin
+
+package fusefs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	gostorage "github.com/kevinangkajaya/go-storage"
+)
+
+const (
+	fileMode = 0644
+	dirMode  = 0755
+)
+
+// DirLister is implemented by storages able to list direct children of a directory,
+// dirs and objects are names relative to dir
+type DirLister interface {
+	ListDir(dir string) (dirs []string, objects []string, err error)
+}
+
+// Options configure the mount
+type Options struct {
+	CacheDir   string                     // where downloaded objects are cached, default a temporary directory
+	Visibility gostorage.ObjectVisibility // visibility of written objects, default private
+	Debug      bool                       // log every FUSE request
+}
+
+type filesystem struct {
+	storage    gostorage.Storage
+	cacheDir   string
+	visibility gostorage.ObjectVisibility
+}
+
+// Mount serve storage at mountPoint until the returned server is unmounted
+func Mount(storage gostorage.Storage, mountPoint string, options Options) (*fuse.Server, error) {
+	if options.Visibility == "" {
+		options.Visibility = gostorage.ObjectPrivate
+	}
+	if options.CacheDir == "" {
+		dir, err := os.MkdirTemp("", "gostorage-fuse-")
+		if err != nil {
+			return nil, err
+		}
+		options.CacheDir = dir
+	} else if err := os.MkdirAll(options.CacheDir, dirMode); err != nil {
+		return nil, err
+	}
+
+	root := &dirNode{
+		fs: &filesystem{
+			storage:    storage,
+			cacheDir:   options.CacheDir,
+			visibility: options.Visibility,
+		},
+	}
+	return fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "gostorage",
+			Name:   "gostorage",
+			Debug:  options.Debug,
+		},
+	})
+}
+
+// cachePath return local path caching content of an object version
+func (f *filesystem) cachePath(objectPath string, size int64, modTime time.Time) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", objectPath, size, modTime.UnixNano())))
+	return filepath.Join(f.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// download object into the read cache unless it's already there
+func (f *filesystem) download(node *fileNode) (string, error) {
+	node.mu.Lock()
+	cachePath := f.cachePath(node.objectPath, node.size, node.modTime)
+	node.mu.Unlock()
+
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, nil
+	}
+
+	reader, err := f.storage.Read(node.objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(f.cacheDir, "download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return cachePath, os.Rename(tmp.Name(), cachePath)
+}
+
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+	if os.IsNotExist(err) {
+		return syscall.ENOENT
+	}
+	return syscall.EIO
+}
+
+type dirNode struct {
+	fs.Inode
+	fs      *filesystem
+	dirPath string
+}
+
+var (
+	_ fs.NodeLookuper  = (*dirNode)(nil)
+	_ fs.NodeReaddirer = (*dirNode)(nil)
+	_ fs.NodeGetattrer = (*dirNode)(nil)
+	_ fs.NodeCreater   = (*dirNode)(nil)
+	_ fs.NodeMkdirer   = (*dirNode)(nil)
+	_ fs.NodeUnlinker  = (*dirNode)(nil)
+	_ fs.NodeRmdirer   = (*dirNode)(nil)
+	_ fs.NodeRenamer   = (*dirNode)(nil)
+)
+
+func (n *dirNode) childPath(name string) string {
+	return path.Join(n.dirPath, name)
+}
+
+func (n *dirNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | dirMode
+	return 0
+}
+
+func (n *dirNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	childPath := n.childPath(name)
+	exist, err := n.fs.storage.Exist(childPath)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+
+	if exist {
+		node := &fileNode{fs: n.fs, objectPath: childPath}
+		if err := node.refresh(); err != nil {
+			return nil, toErrno(err)
+		}
+		node.fillAttr(&out.Attr)
+		return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), 0
+	}
+
+	lister, ok := n.fs.storage.(DirLister)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	dirs, objects, err := lister.ListDir(childPath)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if len(dirs) == 0 && len(objects) == 0 {
+		return nil, syscall.ENOENT
+	}
+
+	out.Mode = fuse.S_IFDIR | dirMode
+	return n.NewInode(ctx, &dirNode{fs: n.fs, dirPath: childPath}, fs.StableAttr{Mode: fuse.S_IFDIR}), 0
+}
+
+func (n *dirNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	entries := make(map[string]uint32)
+	if lister, ok := n.fs.storage.(DirLister); ok {
+		dirs, objects, err := lister.ListDir(n.dirPath)
+		if err != nil {
+			return nil, syscall.EIO
+		}
+		for _, dir := range dirs {
+			entries[path.Base(dir)] = fuse.S_IFDIR
+		}
+		for _, object := range objects {
+			entries[path.Base(object)] = fuse.S_IFREG
+		}
+	}
+
+	// children known to this mount, e.g. just created files and empty directories
+	for name, child := range n.Children() {
+		entries[name] = child.Mode()
+	}
+
+	list := make([]fuse.DirEntry, 0, len(entries))
+	for name, mode := range entries {
+		list = append(list, fuse.DirEntry{Name: name, Mode: mode})
+	}
+	return fs.NewListDirStream(list), 0
+}
+
+func (n *dirNode) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	node := &fileNode{fs: n.fs, objectPath: n.childPath(name), modTime: time.Now()}
+	handle, err := newWriteHandle(node, "")
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+
+	// create the object right away so it's visible to others even before the first flush
+	handle.dirty = true
+	if errno := handle.Flush(ctx); errno != 0 {
+		handle.Release(ctx)
+		return nil, nil, 0, errno
+	}
+
+	node.fillAttr(&out.Attr)
+	return n.NewInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), handle, 0, 0
+}
+
+// Mkdir only create the directory in this mount, it will exist in storage once a file is written into it
+func (n *dirNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	out.Mode = fuse.S_IFDIR | dirMode
+	return n.NewInode(ctx, &dirNode{fs: n.fs, dirPath: n.childPath(name)}, fs.StableAttr{Mode: fuse.S_IFDIR}), 0
+}
+
+func (n *dirNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	return toErrno(n.fs.storage.Delete(n.childPath(name)))
+}
+
+func (n *dirNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	if lister, ok := n.fs.storage.(DirLister); ok {
+		dirs, objects, err := lister.ListDir(n.childPath(name))
+		if err != nil {
+			return syscall.EIO
+		}
+		if len(dirs) > 0 || len(objects) > 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+	return 0
+}
+
+// Rename copy then delete the object, directories can't be renamed
+func (n *dirNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	child := n.GetChild(name)
+	if child != nil && child.IsDir() {
+		return syscall.ENOTSUP
+	}
+
+	parent, ok := newParent.(*dirNode)
+	if !ok {
+		return syscall.EXDEV
+	}
+
+	srcPath, dstPath := n.childPath(name), parent.childPath(newName)
+	if err := n.fs.storage.Copy(srcPath, dstPath); err != nil {
+		return toErrno(err)
+	}
+	if err := n.fs.storage.Delete(srcPath); err != nil {
+		return toErrno(err)
+	}
+
+	if child != nil {
+		if node, ok := child.Operations().(*fileNode); ok {
+			node.mu.Lock()
+			node.objectPath = dstPath
+			node.mu.Unlock()
+		}
+	}
+	return 0
+}
+
+type fileNode struct {
+	fs.Inode
+	fs *filesystem
+
+	mu         sync.Mutex
+	objectPath string
+	size       int64
+	modTime    time.Time
+}
+
+var (
+	_ fs.NodeGetattrer = (*fileNode)(nil)
+	_ fs.NodeSetattrer = (*fileNode)(nil)
+	_ fs.NodeOpener    = (*fileNode)(nil)
+)
+
+// refresh load size and modification time from storage
+func (n *fileNode) refresh() error {
+	n.mu.Lock()
+	objectPath := n.objectPath
+	n.mu.Unlock()
+
+	size, err := n.fs.storage.Size(objectPath)
+	if err != nil {
+		return err
+	}
+	modTime, err := n.fs.storage.LastModified(objectPath)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.size, n.modTime = size, modTime
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *fileNode) fillAttr(attr *fuse.Attr) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	attr.Mode = fuse.S_IFREG | fileMode
+	attr.Size = uint64(n.size)
+	attr.SetTimes(nil, &n.modTime, &n.modTime)
+}
+
+func (n *fileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	if handle, ok := f.(*fileHandle); ok && handle.writable {
+		return handle.Getattr(ctx, out)
+	}
+	n.fillAttr(&out.Attr)
+	return 0
+}
+
+// Setattr support truncate, other attributes are ignored
+func (n *fileNode) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	size, ok := in.GetSize()
+	if !ok {
+		n.fillAttr(&out.Attr)
+		return 0
+	}
+
+	handle, ok := f.(*fileHandle)
+	if !ok || !handle.writable {
+		if size != 0 {
+			return syscall.ENOTSUP
+		}
+
+		var err error
+		if handle, err = newWriteHandle(n, ""); err != nil {
+			return toErrno(err)
+		}
+		defer handle.Release(ctx)
+	}
+
+	handle.mu.Lock()
+	err := handle.file.Truncate(int64(size))
+	handle.dirty = true
+	handle.mu.Unlock()
+	if err != nil {
+		return toErrno(err)
+	}
+
+	if errno := handle.Flush(ctx); errno != 0 {
+		return errno
+	}
+	return handle.Getattr(ctx, out)
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	writable := flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0
+	if !writable {
+		cachePath, err := n.fs.download(n)
+		if err != nil {
+			return nil, 0, toErrno(err)
+		}
+
+		file, err := os.Open(cachePath)
+		if err != nil {
+			return nil, 0, toErrno(err)
+		}
+		return &fileHandle{node: n, file: file}, fuse.FOPEN_KEEP_CACHE, 0
+	}
+
+	source := ""
+	if flags&syscall.O_TRUNC == 0 {
+		cachePath, err := n.fs.download(n)
+		if err != nil {
+			return nil, 0, toErrno(err)
+		}
+		source = cachePath
+	}
+
+	handle, err := newWriteHandle(n, source)
+	if err != nil {
+		return nil, 0, toErrno(err)
+	}
+	handle.dirty = flags&syscall.O_TRUNC != 0
+	return handle, 0, 0
+}
+
+// fileHandle read from the cached copy of an object, writable handles work on a private
+// temporary copy uploaded back on flush
+type fileHandle struct {
+	mu       sync.Mutex
+	node     *fileNode
+	file     *os.File
+	writable bool
+	dirty    bool
+}
+
+var (
+	_ fs.FileReader    = (*fileHandle)(nil)
+	_ fs.FileWriter    = (*fileHandle)(nil)
+	_ fs.FileFlusher   = (*fileHandle)(nil)
+	_ fs.FileFsyncer   = (*fileHandle)(nil)
+	_ fs.FileReleaser  = (*fileHandle)(nil)
+	_ fs.FileGetattrer = (*fileHandle)(nil)
+)
+
+// newWriteHandle create writable handle over a temporary copy of source, empty source start empty
+func newWriteHandle(node *fileNode, source string) (*fileHandle, error) {
+	file, err := os.CreateTemp(node.fs.cacheDir, "write-")
+	if err != nil {
+		return nil, err
+	}
+
+	if source != "" {
+		src, err := os.Open(source)
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, err
+		}
+		_, err = io.Copy(file, src)
+		src.Close()
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, err
+		}
+	}
+
+	return &fileHandle{node: node, file: file, writable: true}, nil
+}
+
+func (h *fileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err := h.file.ReadAt(dest, off)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *fileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	if !h.writable {
+		return 0, syscall.EBADF
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n, err := h.file.WriteAt(data, off)
+	h.dirty = true
+	return uint32(n), toErrno(err)
+}
+
+func (h *fileHandle) Getattr(ctx context.Context, out *fuse.AttrOut) syscall.Errno {
+	if !h.writable {
+		h.node.fillAttr(&out.Attr)
+		return 0
+	}
+
+	h.mu.Lock()
+	info, err := h.file.Stat()
+	h.mu.Unlock()
+	if err != nil {
+		return toErrno(err)
+	}
+
+	modTime := info.ModTime()
+	out.Mode = fuse.S_IFREG | fileMode
+	out.Size = uint64(info.Size())
+	out.SetTimes(nil, &modTime, &modTime)
+	return 0
+}
+
+// Flush upload the temporary copy when it has been modified
+func (h *fileHandle) Flush(ctx context.Context) syscall.Errno {
+	if !h.writable {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return 0
+	}
+
+	info, err := h.file.Stat()
+	if err != nil {
+		return toErrno(err)
+	}
+
+	h.node.mu.Lock()
+	objectPath := h.node.objectPath
+	h.node.mu.Unlock()
+
+	if err := h.node.fs.storage.Put(objectPath, io.NewSectionReader(h.file, 0, info.Size()), h.node.fs.visibility); err != nil {
+		return syscall.EIO
+	}
+	h.dirty = false
+
+	h.node.mu.Lock()
+	h.node.size, h.node.modTime = info.Size(), time.Now()
+	h.node.mu.Unlock()
+	return 0
+}
+
+func (h *fileHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *fileHandle) Release(ctx context.Context) syscall.Errno {
+	errno := h.Flush(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.file.Close()
+	if h.writable {
+		os.Remove(h.file.Name())
+	}
+	return errno
+}
@@ -0,0 +1,269 @@
+package gostorage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// authorizeFunc decide whether operation on objectPath is allowed, returning error deny it
+type authorizeFunc func(ctx context.Context, operation Operation, objectPath string) error
+
+// guardedStorage authorize every operation before forwarding it, it doesn't embed Storage
+// so methods added to the interface can't bypass the checks
+type guardedStorage struct {
+	storage   Storage
+	ctx       context.Context
+	authorize authorizeFunc
+}
+
+func newGuardedStorage(storage Storage, authorize authorizeFunc) *guardedStorage {
+	return &guardedStorage{
+		storage:   storage,
+		ctx:       context.Background(),
+		authorize: authorize,
+	}
+}
+
+// check authorize objectPaths as the key the storage resolve them to, so "." and ".." segments
+// or duplicate slashes can't sidestep a rule, prefixes keep their trailing slash
+func (s *guardedStorage) check(operation Operation, objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		key := objectKey(objectPath)
+		if key != "" && strings.HasSuffix(objectPath, "/") {
+			key += "/"
+		}
+		if err := s.authorize(s.ctx, operation, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithContext return copy of the storage whose authorization checks see ctx
+func (s *guardedStorage) WithContext(ctx context.Context) Storage {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *guardedStorage) Connect(ctx context.Context) error {
+	return s.storage.Connect(ctx)
+}
+
+func (s *guardedStorage) Ping(ctx context.Context) error {
+	return s.storage.Ping(ctx)
+}
+
+func (s *guardedStorage) Read(objectPath string) (io.ReadCloser, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return nil, err
+	}
+	return s.storage.Read(objectPath)
+}
+
+func (s *guardedStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return nil, err
+	}
+	return s.storage.ReadRange(objectPath, offset, length)
+}
+
+func (s *guardedStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return err
+	}
+	return s.storage.Put(objectPath, source, visibility)
+}
+
+func (s *guardedStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return nil, err
+	}
+	return s.storage.Writer(objectPath, visibility)
+}
+
+func (s *guardedStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return err
+	}
+	return s.storage.PutWithOptions(objectPath, source, options)
+}
+
+func (s *guardedStorage) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return ObjectMetadata{}, err
+	}
+	return s.storage.GetMetadata(objectPath)
+}
+
+func (s *guardedStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return err
+	}
+	return s.storage.SetMetadata(objectPath, metadata)
+}
+
+func (s *guardedStorage) Touch(objectPath string) error {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return err
+	}
+	return s.storage.Touch(objectPath)
+}
+
+func (s *guardedStorage) Delete(objectPaths ...string) error {
+	if err := s.check(OperationDelete, objectPaths...); err != nil {
+		return err
+	}
+	return s.storage.Delete(objectPaths...)
+}
+
+func (s *guardedStorage) DeletePrefix(prefix string) error {
+	if err := s.check(OperationDelete, prefix); err != nil {
+		return err
+	}
+	return s.storage.DeletePrefix(prefix)
+}
+
+func (s *guardedStorage) URL(objectPath string, storageResize *StorageResize) (string, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return "", err
+	}
+	return s.storage.URL(objectPath, storageResize)
+}
+
+func (s *guardedStorage) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return "", err
+	}
+	return s.storage.TemporaryURL(objectPath, expireIn, storageResize)
+}
+
+func (s *guardedStorage) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	if err := s.check(OperationRead, objectPaths...); err != nil {
+		return nil, err
+	}
+	return s.storage.TemporaryURLs(objectPaths, expireIn, storageResize)
+}
+
+func (s *guardedStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	if err := s.check(OperationRead, srcObjectPath); err != nil {
+		return err
+	}
+	if err := s.check(OperationWrite, dstObjectPath); err != nil {
+		return err
+	}
+	return s.storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (s *guardedStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	if err := s.check(OperationRead, srcPrefix); err != nil {
+		return err
+	}
+	if err := s.check(OperationWrite, dstPrefix); err != nil {
+		return err
+	}
+	return s.storage.CopyPrefix(srcPrefix, dstPrefix)
+}
+
+func (s *guardedStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.check(OperationDelete, srcObjectPath); err != nil {
+		return err
+	}
+	if err := s.check(OperationWrite, dstObjectPath); err != nil {
+		return err
+	}
+	return s.storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (s *guardedStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := s.check(OperationRead, srcObjectPaths...); err != nil {
+		return err
+	}
+	if err := s.check(OperationWrite, dstObjectPath); err != nil {
+		return err
+	}
+	return s.storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *guardedStorage) Size(objectPath string) (int64, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return 0, err
+	}
+	return s.storage.Size(objectPath)
+}
+
+func (s *guardedStorage) LastModified(objectPath string) (time.Time, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return time.Time{}, err
+	}
+	return s.storage.LastModified(objectPath)
+}
+
+func (s *guardedStorage) Stat(objectPath string) (ObjectInfo, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.storage.Stat(objectPath)
+}
+
+func (s *guardedStorage) MimeType(objectPath string) (string, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return "", err
+	}
+	return s.storage.MimeType(objectPath)
+}
+
+func (s *guardedStorage) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return "", err
+	}
+	return s.storage.Checksum(objectPath, algo)
+}
+
+func (s *guardedStorage) Exist(objectPath string) (bool, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return false, err
+	}
+	return s.storage.Exist(objectPath)
+}
+
+func (s *guardedStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	if err := s.check(OperationRead, objectPaths...); err != nil {
+		return nil, err
+	}
+	return s.storage.ExistMany(objectPaths...)
+}
+
+func (s *guardedStorage) List(prefix string) (ObjectIterator, error) {
+	if err := s.check(OperationList, prefix); err != nil {
+		return nil, err
+	}
+	return s.storage.List(prefix)
+}
+
+func (s *guardedStorage) SetVisibility(objectPath string, visibility ObjectVisibility) error {
+	if err := s.check(OperationWrite, objectPath); err != nil {
+		return err
+	}
+	return s.storage.SetVisibility(objectPath, visibility)
+}
+
+func (s *guardedStorage) GetVisibility(objectPath string) (ObjectVisibility, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return "", err
+	}
+	return s.storage.GetVisibility(objectPath)
+}
+
+func (s *guardedStorage) GetACL(objectPath string) ([]Grant, error) {
+	if err := s.check(OperationRead, objectPath); err != nil {
+		return nil, err
+	}
+	return s.storage.GetACL(objectPath)
+}
+
+func (s *guardedStorage) Capabilities() Capabilities {
+	return s.storage.Capabilities()
+}
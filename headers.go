@@ -0,0 +1,31 @@
+package gostorage
+
+import (
+	"io"
+)
+
+var (
+	_ HeaderStorage = (*storageS3)(nil)
+	_ HeaderStorage = (*storageAlibabaOSS)(nil)
+)
+
+// ObjectHeaders is HTTP headers stored along with object and returned when it's served,
+// empty fields are left to the backend default
+type ObjectHeaders struct {
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+}
+
+// HeaderStorage is implemented by storages able to store HTTP headers with objects
+type HeaderStorage interface {
+	Storage
+
+	// PutWithHeaders behave like Put and additionally store headers with the object
+	PutWithHeaders(objectPath string, source io.Reader, visibility ObjectVisibility, headers ObjectHeaders) error
+}
+
+// putWithHeaders store object with headers
+func putWithHeaders(storage Storage, objectPath string, source io.Reader, visibility ObjectVisibility, headers ObjectHeaders) error {
+	return storage.PutWithOptions(objectPath, source, PutOptions{Visibility: visibility, ObjectMetadata: ObjectMetadata{Headers: headers}})
+}
@@ -0,0 +1,88 @@
+package gostorage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 5 * time.Second
+)
+
+// HealthChecker ping storage periodically and keep the last result, so readiness probes don't
+// call the backend on every request. Until the first ping, LastError report the storage healthy.
+type HealthChecker struct {
+	storage  Storage
+	interval time.Duration
+	timeout  time.Duration
+
+	mu        sync.RWMutex
+	lastError error
+	checkedAt time.Time
+}
+
+// NewHealthChecker create checker pinging storage every interval with timeout, zero values default
+// to 30s and 5s
+func NewHealthChecker(storage Storage, interval time.Duration, timeout time.Duration) *HealthChecker {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	return &HealthChecker{storage: storage, interval: interval, timeout: timeout}
+}
+
+// Check ping storage now and record the result
+func (h *HealthChecker) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	err := h.storage.Ping(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastError = err
+	h.checkedAt = time.Now()
+	return err
+}
+
+// LastError return error of the last ping, nil when it succeeded
+func (h *HealthChecker) LastError() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.lastError
+}
+
+// CheckedAt return when the last ping happened, zero before the first one
+func (h *HealthChecker) CheckedAt() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.checkedAt
+}
+
+// Run block pinging storage every interval until ctx is done, the first ping happen immediately
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		_ = h.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServeHTTP answer readiness probes with 200 when the last ping succeeded, 503 otherwise
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h.LastError(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
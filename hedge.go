@@ -0,0 +1,87 @@
+package gostorage
+
+import (
+	"context"
+	"time"
+)
+
+// WithHedgedReads fire a second identical request when a Read, Size or Exist request hasn't been
+// answered after delay and use whichever responds first, the slower request is canceled. It cuts
+// tail latency of small object reads at the cost of extra requests. Supported by S3 and OSS, OSS SDK
+// has no context support so there the slower request is left to finish and its response discarded.
+func WithHedgedReads(delay time.Duration) Option {
+	return func(o *storageOptions) {
+		o.hedgeDelay = delay
+	}
+}
+
+type hedgeAttempt struct {
+	index int
+	value interface{}
+	err   error
+}
+
+// hedge run call and, when hedged reads are enabled, once more if it's still running after the delay.
+// The first successful result is returned with cancel func of its context which must be called once the
+// result is no longer used, the other attempt is canceled and its successful result passed to discard.
+// Error is returned when every started attempt failed, an attempt failing before the delay isn't hedged.
+func (o storageOptions) hedge(ctx context.Context, call func(ctx context.Context) (interface{}, error), discard func(interface{})) (interface{}, context.CancelFunc, error) {
+	if o.hedgeDelay <= 0 {
+		value, err := call(ctx)
+		return value, func() {}, err
+	}
+
+	results := make(chan hedgeAttempt, 2)
+	var cancels []context.CancelFunc
+	start := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			value, err := call(attemptCtx)
+			results <- hedgeAttempt{index: index, value: value, err: err}
+		}()
+	}
+
+	start()
+	timer := time.NewTimer(o.hedgeDelay)
+	defer timer.Stop()
+
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			o.logger.Debugf("[hedge] no response after %s, sending hedged request\n", o.hedgeDelay)
+			start()
+			pending++
+
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				for index, cancel := range cancels {
+					if index != result.index {
+						cancel()
+					}
+				}
+				if pending > 0 {
+					go func() {
+						loser := <-results
+						if loser.err == nil && discard != nil {
+							discard(loser.value)
+						}
+					}()
+				}
+				return result.value, cancels[result.index], nil
+			}
+
+			cancels[result.index]()
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			if pending == 0 {
+				return nil, func() {}, firstErr
+			}
+		}
+	}
+}
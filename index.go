@@ -0,0 +1,397 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var indexObjectsBucket = []byte("objects")
+
+// IndexedObject is object metadata kept in the local index
+type IndexedObject struct {
+	ObjectPath   string    `json:"object_path"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	IndexedAt    time.Time `json:"indexed_at"`
+}
+
+// IndexQuery filter objects in the index, zero value fields are ignored
+type IndexQuery struct {
+	Prefix         string // object path prefix
+	Contains       string // case insensitive substring of object path
+	ContentType    string // content type prefix, e.g. "image/" or "application/pdf"
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Limit          int // maximum number of results, zero means unlimited
+}
+
+func (q IndexQuery) match(object IndexedObject) bool {
+	if q.Contains != "" && !strings.Contains(strings.ToLower(object.ObjectPath), strings.ToLower(q.Contains)) {
+		return false
+	}
+	if q.ContentType != "" && !strings.HasPrefix(object.ContentType, q.ContentType) {
+		return false
+	}
+	if q.MinSize > 0 && object.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && object.Size > q.MaxSize {
+		return false
+	}
+	if !q.ModifiedAfter.IsZero() && !object.LastModified.After(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !object.LastModified.Before(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// MetadataIndex mirror object metadata into a local bbolt database,
+// giving instant lookup and directory listing over buckets with millions of keys
+type MetadataIndex struct {
+	db *bolt.DB
+}
+
+// OpenMetadataIndex open or create index database at filePath
+func OpenMetadataIndex(filePath string) (*MetadataIndex, error) {
+	if err := checkAndCreateParentDirectory(filePath); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filePath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(indexObjectsBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &MetadataIndex{db: db}, nil
+}
+
+// Close release the index database
+func (i *MetadataIndex) Close() error {
+	return i.db.Close()
+}
+
+// Put add or replace metadata of objects
+func (i *MetadataIndex) Put(objects ...IndexedObject) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexObjectsBucket)
+		for _, object := range objects {
+			data, err := json.Marshal(object)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(object.ObjectPath), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Delete remove objects from the index
+func (i *MetadataIndex) Delete(objectPaths ...string) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(indexObjectsBucket)
+		for _, objectPath := range objectPaths {
+			if err := bucket.Delete([]byte(objectPath)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get return indexed metadata of objectPath, nil if the object is not indexed
+func (i *MetadataIndex) Get(objectPath string) (*IndexedObject, error) {
+	var object *IndexedObject
+	err := i.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(indexObjectsBucket).Get([]byte(objectPath))
+		if data == nil {
+			return nil
+		}
+		object = &IndexedObject{}
+		return json.Unmarshal(data, object)
+	})
+	return object, err
+}
+
+// ListDir return direct children of dir, sub directories (ending with "/") and objects
+func (i *MetadataIndex) ListDir(dir string) ([]string, []IndexedObject, error) {
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+
+	var dirs []string
+	var objects []IndexedObject
+	err := i.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(indexObjectsBucket).Cursor()
+		prefix := []byte(dir)
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); {
+			rest := string(key[len(prefix):])
+			if slash := strings.Index(rest, "/"); slash >= 0 {
+				subDir := dir + rest[:slash+1]
+				dirs = append(dirs, subDir)
+
+				// skip every nested key of the sub directory, '0' is the byte right after '/'
+				key, value = cursor.Seek([]byte(subDir[:len(subDir)-1] + "0"))
+				continue
+			}
+
+			var object IndexedObject
+			if err := json.Unmarshal(value, &object); err != nil {
+				return err
+			}
+			objects = append(objects, object)
+			key, value = cursor.Next()
+		}
+		return nil
+	})
+	return dirs, objects, err
+}
+
+// Search return indexed objects matching query ordered by object path
+func (i *MetadataIndex) Search(query IndexQuery) ([]IndexedObject, error) {
+	var objects []IndexedObject
+	err := i.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(indexObjectsBucket).Cursor()
+		prefix := []byte(query.Prefix)
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var object IndexedObject
+			if err := json.Unmarshal(value, &object); err != nil {
+				return err
+			}
+			if !query.match(object) {
+				continue
+			}
+
+			objects = append(objects, object)
+			if query.Limit > 0 && len(objects) >= query.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return objects, err
+}
+
+// Refresh fetch current metadata of object paths from storage into the index,
+// objects which no longer exist are removed
+func (i *MetadataIndex) Refresh(storage Storage, objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		exist, err := storage.Exist(objectPath)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			if err := i.Delete(objectPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		size, err := storage.Size(objectPath)
+		if err != nil {
+			return err
+		}
+		lastModified, err := storage.LastModified(objectPath)
+		if err != nil {
+			return err
+		}
+
+		err = i.Put(IndexedObject{
+			ObjectPath:   objectPath,
+			Size:         size,
+			ContentType:  mime.TypeByExtension(path.Ext(objectPath)),
+			LastModified: lastModified,
+			IndexedAt:    time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type indexedStorage struct {
+	Storage
+	index  *MetadataIndex
+	prefix string
+}
+
+// WithMetadataIndex wrap storage so writes under prefix keep the index up to date and
+// Exist, Size and LastModified are answered from the index, missing entries are fetched
+// from storage and indexed on first lookup
+func WithMetadataIndex(storage Storage, index *MetadataIndex, prefix string) Storage {
+	return &indexedStorage{
+		Storage: storage,
+		index:   index,
+		prefix:  prefix,
+	}
+}
+
+func (s *indexedStorage) covers(objectPath string) bool {
+	return strings.HasPrefix(objectPath, s.prefix)
+}
+
+func (s *indexedStorage) refresh(objectPaths ...string) error {
+	var covered []string
+	for _, objectPath := range objectPaths {
+		if s.covers(objectPath) {
+			covered = append(covered, objectPath)
+		}
+	}
+	return s.index.Refresh(s.Storage, covered...)
+}
+
+func (s *indexedStorage) lookup(objectPath string) (*IndexedObject, error) {
+	object, err := s.index.Get(objectPath)
+	if err != nil || object != nil {
+		return object, err
+	}
+
+	if err := s.index.Refresh(s.Storage, objectPath); err != nil {
+		return nil, err
+	}
+	return s.index.Get(objectPath)
+}
+
+func (s *indexedStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	if err := s.Storage.Put(objectPath, source, visibility); err != nil {
+		return err
+	}
+	return s.refresh(objectPath)
+}
+
+func (s *indexedStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *indexedStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	if err := s.Storage.PutWithOptions(objectPath, source, options); err != nil {
+		return err
+	}
+	return s.refresh(objectPath)
+}
+
+func (s *indexedStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	if err := s.Storage.SetMetadata(objectPath, metadata); err != nil {
+		return err
+	}
+	return s.refresh(objectPath)
+}
+
+func (s *indexedStorage) Touch(objectPath string) error {
+	if err := s.Storage.Touch(objectPath); err != nil {
+		return err
+	}
+	return s.refresh(objectPath)
+}
+
+func (s *indexedStorage) Delete(objectPaths ...string) error {
+	err := s.Storage.Delete(objectPaths...)
+	if deleted := deletedObjectPaths(objectPaths, err); len(deleted) > 0 {
+		if indexErr := s.index.Delete(deleted...); indexErr != nil && err == nil {
+			return indexErr
+		}
+	}
+	return err
+}
+
+func (s *indexedStorage) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
+}
+
+func (s *indexedStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	if err := s.Storage.Copy(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	return s.refresh(dstObjectPath)
+}
+
+func (s *indexedStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *indexedStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *indexedStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.Storage.Move(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	if sameObjectPath(srcObjectPath, dstObjectPath) {
+		return nil
+	}
+	if err := s.index.Delete(srcObjectPath); err != nil {
+		return err
+	}
+	return s.refresh(dstObjectPath)
+}
+
+func (s *indexedStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...); err != nil {
+		return err
+	}
+	return s.refresh(dstObjectPath)
+}
+
+func (s *indexedStorage) Exist(objectPath string) (bool, error) {
+	if !s.covers(objectPath) {
+		return s.Storage.Exist(objectPath)
+	}
+
+	object, err := s.lookup(objectPath)
+	return object != nil, err
+}
+
+// ExistMany call Exist of the wrapper for every path
+func (s *indexedStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	return existEach(s, objectPaths)
+}
+
+func (s *indexedStorage) Size(objectPath string) (int64, error) {
+	if !s.covers(objectPath) {
+		return s.Storage.Size(objectPath)
+	}
+
+	object, err := s.lookup(objectPath)
+	if err != nil || object == nil {
+		return s.Storage.Size(objectPath)
+	}
+	return object.Size, nil
+}
+
+func (s *indexedStorage) LastModified(objectPath string) (time.Time, error) {
+	if !s.covers(objectPath) {
+		return s.Storage.LastModified(objectPath)
+	}
+
+	object, err := s.lookup(objectPath)
+	if err != nil || object == nil {
+		return s.Storage.LastModified(objectPath)
+	}
+	return object.LastModified, nil
+}
@@ -0,0 +1,289 @@
+package gostorage
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultIngestDebounce       = 2 * time.Second
+	defaultIngestStableInterval = time.Second
+)
+
+// IngestAction is what happen to a source file after it has been uploaded
+type IngestAction string
+
+const (
+	IngestKeep   IngestAction = "keep"
+	IngestDelete IngestAction = "delete"
+	IngestMove   IngestAction = "move" // move into IngestOptions.MoveDir
+)
+
+// IngestOptions configure Ingestor, zero value fields use sensible defaults
+type IngestOptions struct {
+	Prefix         string           // destination prefix in storage
+	Visibility     ObjectVisibility // default ObjectPrivate
+	Debounce       time.Duration    // quiet period after the last change of a file, default 2s
+	StableInterval time.Duration    // file size must not change during this interval, default 1s
+	AfterUpload    IngestAction     // default IngestKeep
+	MoveDir        string           // destination directory of IngestMove
+	Retries        int              // additional upload attempts after a failure
+	RetryDelay     time.Duration
+	OnResult       func(IngestResult)
+}
+
+// IngestResult is reported for every file processed by Ingestor
+type IngestResult struct {
+	FilePath   string
+	ObjectPath string
+	Size       int64
+	Attempts   int
+	Err        error
+}
+
+// Ingestor watch a drop folder and upload new or changed files into storage once they stopped
+// changing, existing files are ingested on start
+type Ingestor struct {
+	dir     string
+	storage Storage
+	options IngestOptions
+
+	mu      sync.Mutex
+	pending map[string]*time.Timer
+	ready   chan string
+	stopped chan struct{}
+}
+
+// NewIngestor create ingestor of dir, Run must be called to start watching
+func NewIngestor(dir string, storage Storage, options IngestOptions) *Ingestor {
+	if options.Visibility == "" {
+		options.Visibility = ObjectPrivate
+	}
+	if options.Debounce <= 0 {
+		options.Debounce = defaultIngestDebounce
+	}
+	if options.StableInterval <= 0 {
+		options.StableInterval = defaultIngestStableInterval
+	}
+	if options.AfterUpload == "" {
+		options.AfterUpload = IngestKeep
+	}
+
+	return &Ingestor{
+		dir:     filepath.Clean(dir),
+		storage: storage,
+		options: options,
+		pending: make(map[string]*time.Timer),
+		ready:   make(chan string, 64),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Run block watching the directory until ctx is done, it can only be called once
+func (i *Ingestor) Run(ctx context.Context) error {
+	defer close(i.stopped)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := i.watchTree(watcher, i.dir); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		i.process(ctx)
+	}()
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.stopPending()
+			return nil
+		case err := <-watcher.Errors:
+			if err != nil {
+				i.report(IngestResult{FilePath: i.dir, Err: err})
+			}
+		case event := <-watcher.Events:
+			if i.ignored(event.Name) || event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				if err := i.watchTree(watcher, event.Name); err != nil {
+					i.report(IngestResult{FilePath: event.Name, Err: err})
+				}
+				continue
+			}
+			i.schedule(event.Name)
+		}
+	}
+}
+
+// watchTree add dir and its sub directories to watcher and schedule files already there
+func (i *Ingestor) watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if i.ignored(filePath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return watcher.Add(filePath)
+		}
+		i.schedule(filePath)
+		return nil
+	})
+}
+
+func (i *Ingestor) ignored(filePath string) bool {
+	if i.options.AfterUpload != IngestMove || i.options.MoveDir == "" {
+		return false
+	}
+	moveDir := filepath.Clean(i.options.MoveDir)
+	return filePath == moveDir || strings.HasPrefix(filePath, moveDir+string(filepath.Separator))
+}
+
+// schedule (re)start debounce timer of filePath
+func (i *Ingestor) schedule(filePath string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if timer, ok := i.pending[filePath]; ok {
+		timer.Reset(i.options.Debounce)
+		return
+	}
+	i.pending[filePath] = time.AfterFunc(i.options.Debounce, func() {
+		i.mu.Lock()
+		delete(i.pending, filePath)
+		i.mu.Unlock()
+
+		select {
+		case i.ready <- filePath:
+		case <-i.stopped:
+		}
+	})
+}
+
+func (i *Ingestor) stopPending() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for filePath, timer := range i.pending {
+		timer.Stop()
+		delete(i.pending, filePath)
+	}
+}
+
+func (i *Ingestor) process(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case filePath := <-i.ready:
+			if stable, err := i.stable(ctx, filePath); err != nil || !stable {
+				if err == nil {
+					i.schedule(filePath)
+				}
+				continue
+			}
+			i.report(i.ingest(ctx, filePath))
+		}
+	}
+}
+
+// stable check the file size doesn't change during StableInterval, a file which disappeared is dropped
+func (i *Ingestor) stable(ctx context.Context, filePath string) (bool, error) {
+	before, err := os.Stat(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(i.options.StableInterval):
+	}
+
+	after, err := os.Stat(filePath)
+	if err != nil {
+		return false, err
+	}
+	return before.Size() == after.Size() && before.ModTime().Equal(after.ModTime()), nil
+}
+
+func (i *Ingestor) ingest(ctx context.Context, filePath string) IngestResult {
+	relPath, err := filepath.Rel(i.dir, filePath)
+	if err != nil {
+		return IngestResult{FilePath: filePath, Err: err}
+	}
+
+	result := IngestResult{FilePath: filePath, ObjectPath: path.Join(i.options.Prefix, filepath.ToSlash(relPath))}
+	for result.Attempts = 1; ; result.Attempts++ {
+		result.Size, result.Err = i.upload(filePath, result.ObjectPath)
+		if result.Err == nil || result.Attempts > i.options.Retries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return result
+		case <-time.After(i.options.RetryDelay):
+		}
+	}
+	if result.Err != nil {
+		return result
+	}
+
+	switch i.options.AfterUpload {
+	case IngestDelete:
+		result.Err = os.Remove(filePath)
+	case IngestMove:
+		movedPath := filepath.Join(i.options.MoveDir, relPath)
+		if result.Err = checkAndCreateParentDirectory(movedPath); result.Err == nil {
+			result.Err = os.Rename(filePath, movedPath)
+		}
+	}
+	return result
+}
+
+func (i *Ingestor) upload(filePath string, objectPath string) (int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), i.storage.Put(objectPath, file, i.options.Visibility)
+}
+
+func (i *Ingestor) report(result IngestResult) {
+	if i.options.OnResult != nil {
+		i.options.OnResult(result)
+	}
+}
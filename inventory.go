@@ -0,0 +1,233 @@
+package gostorage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	inventoryPrefix    = ".inventory"
+	inventoryChunkSize = 8 * 1024 * 1024 // compressed size of a part, above the minimum part size of every backend
+)
+
+var (
+	_ afterLister = (*storageS3)(nil)
+	_ afterLister = (*storageAlibabaOSS)(nil)
+)
+
+// afterLister is implemented by storages able to start a listing after a key without listing the
+// keys before it
+type afterLister interface {
+	listAfter(prefix string, startAfter string) (ObjectIterator, error)
+}
+
+// InventoryCheckpoint is the state of an unfinished inventory job
+type InventoryCheckpoint struct {
+	Prefix         string    `json:"prefix"`
+	DstObjectPath  string    `json:"dst_object_path"`
+	Parts          int       `json:"parts"`            // number of uploaded parts
+	Objects        int64     `json:"objects"`          // number of objects in uploaded parts
+	LastObjectPath string    `json:"last_object_path"` // last object of the last uploaded part
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// InventoryJob write a listing of a prefix to an object in the background, see StartInventoryJob
+type InventoryJob struct {
+	done chan struct{}
+
+	mu      sync.Mutex
+	objects int64
+	err     error
+}
+
+// StartInventoryJob write every object under prefix of storage to dstObjectPath as gzip compressed
+// JSON lines of ObjectInfo, in the background. The listing is uploaded in parts of about 8MB
+// checkpointed under ".inventory/", so a job stopped by ctx or a crash is resumed by starting it
+// again with the same prefix and dstObjectPath. Parts are composed into dstObjectPath at the end.
+func StartInventoryJob(ctx context.Context, storage Storage, prefix string, dstObjectPath string) *InventoryJob {
+	job := &InventoryJob{done: make(chan struct{})}
+	go func() {
+		defer close(job.done)
+		err := job.run(ctx, storage, trimPrefixRoot(prefix), objectKey(dstObjectPath))
+
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		job.err = err
+	}()
+	return job
+}
+
+// Done is closed when the job finished
+func (j *InventoryJob) Done() <-chan struct{} {
+	return j.done
+}
+
+// Wait block until the job finished and return its error
+func (j *InventoryJob) Wait() error {
+	<-j.done
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// Objects return number of objects written so far, including the ones of a resumed job
+func (j *InventoryJob) Objects() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.objects
+}
+
+func (j *InventoryJob) setObjects(objects int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.objects = objects
+}
+
+func inventoryDir(dstObjectPath string) string {
+	return path.Join(inventoryPrefix, dstObjectPath)
+}
+
+func inventoryPartPath(dstObjectPath string, part int) string {
+	return path.Join(inventoryDir(dstObjectPath), fmt.Sprintf("part-%06d.json.gz", part))
+}
+
+func (j *InventoryJob) run(ctx context.Context, storage Storage, prefix string, dstObjectPath string) error {
+	checkpointPath := path.Join(inventoryDir(dstObjectPath), "checkpoint.json")
+	checkpoint, err := loadInventoryCheckpoint(storage, checkpointPath)
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil || checkpoint.Prefix != prefix {
+		checkpoint = &InventoryCheckpoint{Prefix: prefix, DstObjectPath: dstObjectPath}
+	}
+	j.setObjects(checkpoint.Objects)
+
+	iterator, err := listInventory(storage, checkpoint)
+	if err != nil {
+		return fmt.Errorf("err inventory listing %s: %w", prefix, err)
+	}
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	objects, lastObjectPath := checkpoint.Objects, checkpoint.LastObjectPath
+	flush := func() error {
+		if err := writer.Close(); err != nil {
+			return err
+		}
+		checkpoint.Parts++
+		if err := storage.Put(inventoryPartPath(dstObjectPath, checkpoint.Parts), bytes.NewReader(buffer.Bytes()), ObjectPrivate); err != nil {
+			return err
+		}
+		checkpoint.Objects, checkpoint.LastObjectPath, checkpoint.UpdatedAt = objects, lastObjectPath, time.Now()
+		if err := saveInventoryCheckpoint(storage, checkpointPath, checkpoint); err != nil {
+			return err
+		}
+
+		buffer.Reset()
+		writer.Reset(&buffer)
+		return nil
+	}
+
+	for iterator.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		object := iterator.Object()
+		if err := encoder.Encode(object); err != nil {
+			return err
+		}
+		objects++
+		lastObjectPath = object.ObjectPath
+		j.setObjects(objects)
+
+		if buffer.Len() >= inventoryChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		return fmt.Errorf("err inventory listing %s: %w", prefix, err)
+	}
+	// the last part is written even when empty, so an empty listing give a valid gzip object
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// concatenated gzip streams are a valid gzip stream
+	partPaths := make([]string, checkpoint.Parts)
+	for i := range partPaths {
+		partPaths[i] = inventoryPartPath(dstObjectPath, i+1)
+	}
+	if err := storage.Compose(dstObjectPath, ObjectPrivate, partPaths...); err != nil {
+		return err
+	}
+	return storage.Delete(append(partPaths, checkpointPath)...)
+}
+
+// listInventory list objects not written by checkpoint yet, storages unable to start a listing
+// after a key skip the written objects instead. Objects of the job itself aren't listed.
+func listInventory(storage Storage, checkpoint *InventoryCheckpoint) (ObjectIterator, error) {
+	lister, after := storage.(afterLister)
+	var iterator ObjectIterator
+	var err error
+	if after {
+		iterator, err = lister.listAfter(checkpoint.Prefix, checkpoint.LastObjectPath)
+	} else {
+		iterator, err = storage.List(checkpoint.Prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := int64(0)
+	return &chainedObjectIterator{
+		iterators: []ObjectIterator{iterator},
+		filters: []func(object ObjectInfo) bool{func(object ObjectInfo) bool {
+			if object.ObjectPath == checkpoint.DstObjectPath || strings.HasPrefix(object.ObjectPath, inventoryPrefix+"/") {
+				return false
+			}
+			if !after && skipped < checkpoint.Objects {
+				skipped++
+				return false
+			}
+			return true
+		}},
+	}, nil
+}
+
+func loadInventoryCheckpoint(storage Storage, checkpointPath string) (*InventoryCheckpoint, error) {
+	exist, err := storage.Exist(checkpointPath)
+	if err != nil || !exist {
+		return nil, err
+	}
+
+	reader, err := storage.Read(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var checkpoint InventoryCheckpoint
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("err invalid inventory checkpoint %s: %s", checkpointPath, err)
+	}
+	return &checkpoint, nil
+}
+
+func saveInventoryCheckpoint(storage Storage, checkpointPath string, checkpoint *InventoryCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return storage.Put(checkpointPath, bytes.NewReader(data), ObjectPrivate)
+}
@@ -0,0 +1,298 @@
+package gostorage
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// StorageFactory create the actual storage, called at most once by lazy storage
+type StorageFactory func() (Storage, error)
+
+type lazyStorage struct {
+	mu      sync.Mutex
+	factory StorageFactory
+	storage Storage
+}
+
+// NewLazyStorage defer creating the storage until Connect or the first operation,
+// so binaries that never touch the storage don't need credentials nor pay startup cost.
+// Failed initialization is retried on the next call.
+func NewLazyStorage(factory StorageFactory) Storage {
+	return &lazyStorage{factory: factory}
+}
+
+func (s *lazyStorage) get() (Storage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.storage != nil {
+		return s.storage, nil
+	}
+
+	storage, err := s.factory()
+	if err != nil {
+		return nil, err
+	}
+	s.storage = storage
+	return storage, nil
+}
+
+// Unwrap create the storage if needed, nil when creating it failed
+func (s *lazyStorage) Unwrap() Storage {
+	storage, err := s.get()
+	if err != nil {
+		return nil
+	}
+	return storage
+}
+
+func (s *lazyStorage) Connect(ctx context.Context) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Connect(ctx)
+}
+
+func (s *lazyStorage) Ping(ctx context.Context) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Ping(ctx)
+}
+
+func (s *lazyStorage) Read(objectPath string) (io.ReadCloser, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Read(objectPath)
+}
+
+func (s *lazyStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.ReadRange(objectPath, offset, length)
+}
+
+func (s *lazyStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Put(objectPath, source, visibility)
+}
+
+func (s *lazyStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Writer(objectPath, visibility)
+}
+
+func (s *lazyStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.PutWithOptions(objectPath, source, options)
+}
+
+func (s *lazyStorage) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	storage, err := s.get()
+	if err != nil {
+		return ObjectMetadata{}, err
+	}
+	return storage.GetMetadata(objectPath)
+}
+
+func (s *lazyStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.SetMetadata(objectPath, metadata)
+}
+
+func (s *lazyStorage) Touch(objectPath string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Touch(objectPath)
+}
+
+func (s *lazyStorage) Delete(objectPaths ...string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Delete(objectPaths...)
+}
+
+func (s *lazyStorage) URL(objectPath string, storageResize *StorageResize) (string, error) {
+	storage, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	return storage.URL(objectPath, storageResize)
+}
+
+func (s *lazyStorage) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
+	storage, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	return storage.TemporaryURL(objectPath, expireIn, storageResize)
+}
+
+func (s *lazyStorage) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.TemporaryURLs(objectPaths, expireIn, storageResize)
+}
+
+func (s *lazyStorage) DeletePrefix(prefix string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.DeletePrefix(prefix)
+}
+
+func (s *lazyStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (s *lazyStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.CopyPrefix(srcPrefix, dstPrefix)
+}
+
+func (s *lazyStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (s *lazyStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *lazyStorage) Size(objectPath string) (int64, error) {
+	storage, err := s.get()
+	if err != nil {
+		return 0, err
+	}
+	return storage.Size(objectPath)
+}
+
+func (s *lazyStorage) LastModified(objectPath string) (time.Time, error) {
+	storage, err := s.get()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return storage.LastModified(objectPath)
+}
+
+func (s *lazyStorage) Stat(objectPath string) (ObjectInfo, error) {
+	storage, err := s.get()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return storage.Stat(objectPath)
+}
+
+func (s *lazyStorage) MimeType(objectPath string) (string, error) {
+	storage, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	return storage.MimeType(objectPath)
+}
+
+func (s *lazyStorage) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	storage, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	return storage.Checksum(objectPath, algo)
+}
+
+func (s *lazyStorage) Exist(objectPath string) (bool, error) {
+	storage, err := s.get()
+	if err != nil {
+		return false, err
+	}
+	return storage.Exist(objectPath)
+}
+
+func (s *lazyStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.ExistMany(objectPaths...)
+}
+
+func (s *lazyStorage) List(prefix string) (ObjectIterator, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.List(prefix)
+}
+
+func (s *lazyStorage) SetVisibility(objectPath string, visibility ObjectVisibility) error {
+	storage, err := s.get()
+	if err != nil {
+		return err
+	}
+	return storage.SetVisibility(objectPath, visibility)
+}
+
+func (s *lazyStorage) GetVisibility(objectPath string) (ObjectVisibility, error) {
+	storage, err := s.get()
+	if err != nil {
+		return "", err
+	}
+	return storage.GetVisibility(objectPath)
+}
+
+func (s *lazyStorage) GetACL(objectPath string) ([]Grant, error) {
+	storage, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetACL(objectPath)
+}
+
+// Capabilities return no capability if the storage can't be initialized
+func (s *lazyStorage) Capabilities() Capabilities {
+	storage, err := s.get()
+	if err != nil {
+		return Capabilities{}
+	}
+	return storage.Capabilities()
+}
@@ -0,0 +1,97 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	_ LegalHoldStorage = (*storageS3)(nil)
+	_ LegalHoldStorage = (*storageLocalFile)(nil)
+)
+
+// ErrLegalHold is matched by errors of operations refused because an object is under legal hold
+var ErrLegalHold = errors.New("object is under legal hold")
+
+// LegalHoldError returned when deleting objects under legal hold, none of the objects is deleted
+type LegalHoldError struct {
+	ObjectPaths []string
+}
+
+func (e *LegalHoldError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrLegalHold, strings.Join(e.ObjectPaths, ", "))
+}
+
+func (e *LegalHoldError) Unwrap() error {
+	return ErrLegalHold
+}
+
+// LegalHoldOverride justify ForceDelete of an object under legal hold, it's logged with the deletion
+type LegalHoldOverride struct {
+	Actor  string // who requested the deletion
+	Reason string // why the hold doesn't apply anymore, required
+}
+
+// LegalHoldStorage is implemented by storages able to place objects under legal hold, held objects
+// can't be deleted until the hold is released or ForceDelete is used
+type LegalHoldStorage interface {
+	Storage
+
+	// SetLegalHold place objectPath under legal hold or release it
+	SetLegalHold(objectPath string, hold bool) error
+
+	// LegalHold return whether objectPath is under legal hold, false for missing objects
+	LegalHold(objectPath string) (bool, error)
+
+	// ForceDelete release legal hold of objectPath and delete it, the storage must be created
+	// with WithLegalHoldOverride
+	ForceDelete(objectPath string, override LegalHoldOverride) error
+}
+
+// WithLegalHolds make Delete of S3 storage refuse objects under legal hold with LegalHoldError.
+// S3 only protect versions of held objects, Delete of a versioned bucket would hide them behind
+// a delete marker. It cost one request per deleted object. Local storage always check holds.
+func WithLegalHolds() Option {
+	return func(o *storageOptions) {
+		o.legalHolds = true
+	}
+}
+
+// WithLegalHoldOverride allow ForceDelete of objects under legal hold, it should only be given to
+// storages of privileged tools
+func WithLegalHoldOverride() Option {
+	return func(o *storageOptions) {
+		o.legalHoldOverride = true
+	}
+}
+
+// checkOverride validate ForceDelete of objectPath is allowed and log it
+func (o storageOptions) checkOverride(objectPath string, override LegalHoldOverride) error {
+	if !o.legalHoldOverride {
+		return fmt.Errorf("%w: force delete of %s require WithLegalHoldOverride", ErrPermissionDenied, objectPath)
+	}
+	if strings.TrimSpace(override.Reason) == "" {
+		return fmt.Errorf("err force delete of %s require a reason", objectPath)
+	}
+	o.logger.Debugf("force deleting %s under legal hold, actor: %s, reason: %s\n", objectPath, override.Actor, override.Reason)
+	return nil
+}
+
+// checkLegalHolds return LegalHoldError listing objectPaths under legal hold of storage
+func checkLegalHolds(storage LegalHoldStorage, objectPaths ...string) error {
+	var held []string
+	for _, objectPath := range objectPaths {
+		hold, err := storage.LegalHold(objectPath)
+		if err != nil {
+			return err
+		}
+		if hold {
+			held = append(held, objectPath)
+		}
+	}
+	if len(held) > 0 {
+		return &LegalHoldError{ObjectPaths: held}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package gostorage
+
+// ObjectIterator iterate over objects returned by List, e.g.
+//
+//	iterator, err := storage.List("invoices/")
+//	for iterator.Next() {
+//		object := iterator.Object()
+//	}
+//	err = iterator.Err()
+type ObjectIterator interface {
+	// Next advance to the next object, return false when there are no more objects or listing failed
+	Next() bool
+
+	// Object return the current object
+	Object() ObjectInfo
+
+	// Err return error which stopped the iteration
+	Err() error
+}
+
+// objectPageFetcher return a page of objects starting at token and token of the next page,
+// empty next token means the page is the last one
+type objectPageFetcher func(token string) (objects []ObjectInfo, nextToken string, err error)
+
+type pagedObjectIterator struct {
+	fetch   objectPageFetcher
+	page    []ObjectInfo
+	index   int
+	token   string
+	last    bool
+	current ObjectInfo
+	err     error
+}
+
+// newPagedObjectIterator fetch the first page right away so listing errors are returned by List
+func newPagedObjectIterator(fetch objectPageFetcher) (ObjectIterator, error) {
+	iterator := &pagedObjectIterator{fetch: fetch}
+	if err := iterator.fetchPage(); err != nil {
+		return nil, err
+	}
+	return iterator, nil
+}
+
+func (i *pagedObjectIterator) fetchPage() error {
+	page, token, err := i.fetch(i.token)
+	if err != nil {
+		return err
+	}
+	i.page, i.index, i.token, i.last = page, 0, token, token == ""
+	return nil
+}
+
+func (i *pagedObjectIterator) Next() bool {
+	for i.index >= len(i.page) {
+		if i.last || i.err != nil {
+			return false
+		}
+		if err := i.fetchPage(); err != nil {
+			i.err = err
+			return false
+		}
+	}
+
+	i.current = i.page[i.index]
+	i.index++
+	return true
+}
+
+func (i *pagedObjectIterator) Object() ObjectInfo {
+	return i.current
+}
+
+func (i *pagedObjectIterator) Err() error {
+	return i.err
+}
+
+// chainedObjectIterator iterate over iterators one after another, keeping only objects accepted by
+// the filter of their iterator
+type chainedObjectIterator struct {
+	iterators []ObjectIterator
+	filters   []func(object ObjectInfo) bool
+	current   ObjectInfo
+	err       error
+}
+
+func (i *chainedObjectIterator) Next() bool {
+	for len(i.iterators) > 0 && i.err == nil {
+		iterator := i.iterators[0]
+		for iterator.Next() {
+			if object := iterator.Object(); i.filters[0](object) {
+				i.current = object
+				return true
+			}
+		}
+		i.err = iterator.Err()
+		i.iterators, i.filters = i.iterators[1:], i.filters[1:]
+	}
+	return false
+}
+
+func (i *chainedObjectIterator) Object() ObjectInfo {
+	return i.current
+}
+
+func (i *chainedObjectIterator) Err() error {
+	return i.err
+}
@@ -0,0 +1,186 @@
+package gostorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// localMetadataDir is directory inside local storage base directory holding sidecar metadata,
+// it's hidden from List
+const localMetadataDir = ".gostorage-meta"
+
+// localMetadataVersion is current schema version of sidecar metadata
+const localMetadataVersion = 1
+
+// localMetadata is sidecar of a local object, stored as JSON at
+// <baseDir>/.gostorage-meta/<objectPath>.json
+type localMetadata struct {
+	Version            int               `json:"version"`
+	Visibility         ObjectVisibility  `json:"visibility"`
+	ContentType        string            `json:"content_type,omitempty"`
+	ContentDisposition string            `json:"content_disposition,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+	SHA256             string            `json:"sha256,omitempty"` // hex checksum of the content
+	Size               int64             `json:"size"`
+	LegalHold          bool              `json:"legal_hold,omitempty"`
+}
+
+func (m *localMetadata) objectMetadata() ObjectMetadata {
+	return ObjectMetadata{
+		Headers: ObjectHeaders{
+			ContentType:        m.ContentType,
+			ContentDisposition: m.ContentDisposition,
+			CacheControl:       m.CacheControl,
+		},
+		Metadata: lowerMetadata(m.Metadata),
+	}
+}
+
+// setObjectMetadata replace headers and user metadata, content type default to the one of objectPath extension
+func (m *localMetadata) setObjectMetadata(objectPath string, metadata ObjectMetadata) {
+	m.ContentType = metadata.Headers.ContentType
+	if m.ContentType == "" {
+		m.ContentType = mime.TypeByExtension(path.Ext(objectPath))
+	}
+	m.ContentDisposition = metadata.Headers.ContentDisposition
+	m.CacheControl = metadata.Headers.CacheControl
+	m.Metadata = lowerMetadata(metadata.Metadata)
+}
+
+// localMetadataMigrations upgrade sidecar of version i to version i+1, version 0 is an object
+// stored before sidecars existed whose metadata is derived from the filesystem
+var localMetadataMigrations = []func(s *storageLocalFile, objectPath string, meta *localMetadata) error{
+	func(s *storageLocalFile, objectPath string, meta *localMetadata) error {
+		info, err := os.Stat(localPath(s.baseDir, objectPath))
+		if err != nil {
+			return err
+		}
+		checksum, err := s.checksum(objectPath)
+		if err != nil {
+			return err
+		}
+
+		meta.Visibility = ObjectPrivate
+		if isFileExists(localPath(s.publicBaseDir, objectPath)) {
+			meta.Visibility = ObjectPublicRead
+		}
+		meta.ContentType = mime.TypeByExtension(path.Ext(objectPath))
+		meta.SHA256 = checksum
+		meta.Size = info.Size()
+		return nil
+	},
+}
+
+func (s *storageLocalFile) metadataPath(objectPath string) string {
+	return localPath(filepath.Join(s.baseDir, localMetadataDir), objectPath) + ".json"
+}
+
+// checksum return hex sha256 of object content
+func (s *storageLocalFile) checksum(objectPath string) (string, error) {
+	file, err := os.Open(localPath(s.baseDir, objectPath))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readMetadata return sidecar of objectPath, sidecars of older schema versions or missing sidecars
+// of existing objects are migrated and written back
+func (s *storageLocalFile) readMetadata(objectPath string) (*localMetadata, error) {
+	meta := &localMetadata{}
+	data, err := os.ReadFile(s.metadataPath(objectPath))
+	if err == nil {
+		if err := json.Unmarshal(data, meta); err != nil {
+			return nil, fmt.Errorf("[local-storage] err invalid metadata of %s: %s", objectPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if meta.Version == localMetadataVersion {
+		return meta, nil
+	}
+	if meta.Version > localMetadataVersion {
+		return nil, fmt.Errorf("[local-storage] err metadata of %s has version %d, newer than supported %d", objectPath, meta.Version, localMetadataVersion)
+	}
+
+	for meta.Version < localMetadataVersion {
+		if err := localMetadataMigrations[meta.Version](s, objectPath, meta); err != nil {
+			return nil, err
+		}
+		meta.Version++
+	}
+	return meta, s.writeMetadata(objectPath, meta)
+}
+
+// writeMetadata replace sidecar of objectPath atomically
+func (s *storageLocalFile) writeMetadata(objectPath string, meta *localMetadata) error {
+	meta.Version = localMetadataVersion
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	metaPath := s.metadataPath(objectPath)
+	if err := checkAndCreateParentDirectory(metaPath); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(metaPath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), metaPath)
+}
+
+func (s *storageLocalFile) deleteMetadata(objectPath string) error {
+	if err := os.Remove(s.metadataPath(objectPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// MigrateLocalMetadata upgrade sidecar metadata of every object of local storage to the current
+// schema version, creating sidecars of objects stored by older versions of this package.
+// Sidecars are otherwise migrated lazily when read. Return number of objects checked.
+func MigrateLocalMetadata(storage Storage) (int, error) {
+	local, ok := underlying(storage).(*storageLocalFile)
+	if !ok {
+		return 0, fmt.Errorf("err migrating metadata: not a local storage")
+	}
+
+	iterator, err := local.List("")
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for iterator.Next() {
+		if _, err := local.readMetadata(iterator.Object().ObjectPath); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, iterator.Err()
+}
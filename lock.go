@@ -0,0 +1,203 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const lockMarkerSuffix = ".lock"
+
+// ErrLockHeld returned when the object lock is currently owned by another worker
+var ErrLockHeld = errors.New("object lock is held by another owner")
+
+// ErrLockLost returned when renewing or releasing a lock that has been taken over
+// by another worker, usually because it was not renewed before its ttl expired
+var ErrLockLost = errors.New("object lock is no longer owned")
+
+// ObjectLock is a lease on an object path backed by a lock marker object stored
+// next to it, the lease must be renewed before its ttl expired to keep owning it
+type ObjectLock struct {
+	mu          sync.Mutex
+	storage     Storage
+	lockPath    string
+	token       string
+	etag        string
+	conditional bool
+	expireAt    time.Time
+}
+
+type lockMarker struct {
+	Token    string    `json:"token"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+// AcquireObjectLock try to take the lock of objectPath for ttl, ErrLockHeld is returned
+// when another worker owns an unexpired lock. On storages reporting Capabilities.ConditionalWrite
+// the marker is created with IfNoneMatch "*", or replaced with IfMatch when expired, so only one
+// worker can win. Other storages fall back to reading the marker back after writing it, which is
+// unsafe: two workers interleaving their write and read back can both believe they own the lock.
+func AcquireObjectLock(storage Storage, objectPath string, ttl time.Duration) (*ObjectLock, error) {
+	lockPath := objectPath + lockMarkerSuffix
+
+	current, etag, err := readLockMarker(storage, lockPath)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && time.Now().Before(current.ExpireAt) {
+		return nil, ErrLockHeld
+	}
+
+	token, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &ObjectLock{
+		storage:     storage,
+		lockPath:    lockPath,
+		token:       token,
+		conditional: storage.Capabilities().ConditionalWrite,
+	}
+
+	if lock.conditional {
+		preconditions := Preconditions{IfNoneMatch: "*"}
+		if current != nil {
+			if etag == "" {
+				// the marker is still being written
+				return nil, ErrLockHeld
+			}
+			preconditions = Preconditions{IfMatch: etag}
+		}
+		if err := lock.writeMarker(time.Now().Add(ttl), preconditions); err != nil {
+			if errors.Is(err, ErrPreconditionFailed) {
+				return nil, ErrLockHeld
+			}
+			return nil, err
+		}
+		return lock, nil
+	}
+
+	if err := lock.writeMarker(time.Now().Add(ttl), Preconditions{}); err != nil {
+		return nil, err
+	}
+	if err := lock.verifyOwner(); err != nil {
+		if err == ErrLockLost {
+			return nil, ErrLockHeld
+		}
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// Renew extend the lease for another ttl from now
+func (l *ObjectLock) Renew(ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.replaceMarker(time.Now().Add(ttl))
+}
+
+// Release give up the lock so another worker can acquire it immediately. With conditional
+// writes the marker is replaced by an expired one instead of being deleted, since a delete
+// can't be made conditional and could remove the marker of the next owner.
+func (l *ObjectLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conditional {
+		return l.replaceMarker(time.Time{})
+	}
+	if err := l.verifyOwner(); err != nil {
+		return err
+	}
+	return l.storage.Delete(l.lockPath)
+}
+
+// replaceMarker write marker expiring at expireAt if the lock is still owned, l.mu must be held
+func (l *ObjectLock) replaceMarker(expireAt time.Time) error {
+	if !l.conditional {
+		if err := l.verifyOwner(); err != nil {
+			return err
+		}
+		return l.writeMarker(expireAt, Preconditions{})
+	}
+
+	if err := l.writeMarker(expireAt, Preconditions{IfMatch: l.etag}); err != nil {
+		if errors.Is(err, ErrPreconditionFailed) {
+			return ErrLockLost
+		}
+		return err
+	}
+	return nil
+}
+
+// ExpireAt return time when the current lease expires
+func (l *ObjectLock) ExpireAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expireAt
+}
+
+func (l *ObjectLock) writeMarker(expireAt time.Time, preconditions Preconditions) error {
+	marker := lockMarker{
+		Token:    l.token,
+		ExpireAt: expireAt,
+	}
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+
+	result, err := PutWithResult(l.storage, l.lockPath, bytes.NewReader(data), PutOptions{
+		Visibility:    ObjectPrivate,
+		Preconditions: preconditions,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.etag = result.ETag
+	l.expireAt = marker.ExpireAt
+	return nil
+}
+
+func (l *ObjectLock) verifyOwner() error {
+	current, _, err := readLockMarker(l.storage, l.lockPath)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Token != l.token {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// readLockMarker return marker and the ETag it was read with, nil marker if the lock object does not exist
+func readLockMarker(storage Storage, lockPath string) (*lockMarker, string, error) {
+	info, err := storage.Stat(lockPath)
+	if errors.Is(err, ErrObjectNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	reader, err := storage.Read(lockPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	// a marker which can't be decoded, e.g. read while being written, is treated as expired,
+	// replacing it is still guarded by its ETag
+	var marker lockMarker
+	if err := json.NewDecoder(reader).Decode(&marker); err != nil {
+		return &lockMarker{}, info.ETag, nil
+	}
+	return &marker, info.ETag, nil
+}
@@ -0,0 +1,57 @@
+package gostorage
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Logger is a pluggable logger used by storage implementations, *logrus.Logger satisfies it
+type Logger interface {
+	Debugf(format string, args ...interface{})
+}
+
+// debugTransport log sanitized summary of every http request sent by an SDK client,
+// query string (which may contain signature) and headers are never logged
+type debugTransport struct {
+	name   string
+	logger Logger
+	next   http.RoundTripper
+}
+
+func newDebugHTTPClient(name string, logger Logger) *http.Client {
+	return &http.Client{
+		Transport: &debugTransport{
+			name:   name,
+			logger: logger,
+			next:   http.DefaultTransport,
+		},
+	}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	duration := time.Since(start)
+
+	if err != nil {
+		// url.Error quote the full URL including query string, log only the underlying cause
+		cause := err
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			cause = urlErr.Err
+		}
+		t.logger.Debugf("[%s] %s %s err=%s duration=%s", t.name, req.Method, req.URL.Path, cause.Error(), duration)
+		return resp, err
+	}
+
+	requestID := resp.Header.Get("x-amz-request-id")
+	if requestID == "" {
+		requestID = resp.Header.Get("x-oss-request-id")
+	}
+
+	t.logger.Debugf("[%s] %s %s status=%d duration=%s request_id=%s",
+		t.name, req.Method, req.URL.Path, resp.StatusCode, duration, requestID)
+	return resp, nil
+}
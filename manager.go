@@ -0,0 +1,75 @@
+package gostorage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Manager is a registry of named storages shared across an application
+type Manager struct {
+	mu       sync.RWMutex
+	storages map[string]Storage
+	fallback string
+}
+
+// NewManager create empty storage registry
+func NewManager() *Manager {
+	return &Manager{storages: make(map[string]Storage)}
+}
+
+// Register add storage under name, replacing any storage previously registered with the same name
+func (m *Manager) Register(name string, storage Storage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storages[name] = storage
+}
+
+// SetDefault choose storage returned by Default
+func (m *Manager) SetDefault(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = name
+}
+
+// Get return storage registered under name
+func (m *Manager) Get(name string) (Storage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	storage, ok := m.storages[name]
+	if !ok {
+		return nil, fmt.Errorf("err storage %s is not registered", name)
+	}
+	return storage, nil
+}
+
+// Default return the default storage, or the only registered one when no default is set
+func (m *Manager) Default() (Storage, error) {
+	m.mu.RLock()
+	name := m.fallback
+	if name == "" && len(m.storages) == 1 {
+		for only := range m.storages {
+			name = only
+		}
+	}
+	m.mu.RUnlock()
+
+	if name == "" {
+		return nil, fmt.Errorf("err default storage is not set")
+	}
+	return m.Get(name)
+}
+
+// Names return sorted names of registered storages
+func (m *Manager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, 0, len(m.storages))
+	for name := range m.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
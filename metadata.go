@@ -0,0 +1,38 @@
+package gostorage
+
+import (
+	"strings"
+)
+
+// ObjectMetadata is HTTP headers and user metadata stored with an object
+type ObjectMetadata struct {
+	Headers ObjectHeaders
+
+	// Metadata is user defined key/value pairs, keys are case insensitive and returned lower case
+	Metadata map[string]string
+}
+
+// PutOptions configure PutWithOptions, unmet Preconditions fail the put with ErrPreconditionFailed
+// before anything is uploaded
+type PutOptions struct {
+	Visibility ObjectVisibility
+	ObjectMetadata
+	Preconditions
+
+	// StorageClass of the object, e.g. S3 "STANDARD_IA" or OSS "IA", empty use the bucket default.
+	// Ignored by local storage.
+	StorageClass string
+}
+
+// lowerMetadata return copy of metadata with lower case keys
+func lowerMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	lowered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		lowered[strings.ToLower(key)] = value
+	}
+	return lowered
+}
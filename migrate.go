@@ -0,0 +1,282 @@
+package gostorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const defaultMigrateCheckpointInterval = 100
+
+// MappingFormat is the encoding of a key mapping file given to MigrateKeys
+type MappingFormat string
+
+const (
+	MappingCSV       MappingFormat = "csv"   // "old,new" records without header
+	MappingJSONLines MappingFormat = "jsonl" // {"old": "...", "new": "..."} lines
+)
+
+// KeyMapping rename object Old to New
+type KeyMapping struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type MigrateEventType string
+
+const (
+	MigrateEventMigrated MigrateEventType = "migrated"
+	MigrateEventSkipped  MigrateEventType = "skipped"
+	MigrateEventErrored  MigrateEventType = "errored"
+)
+
+// MigrateEvent describe outcome of a single mapping, events can be encoded as JSON lines to build
+// reports of migrations
+type MigrateEvent struct {
+	Type   MigrateEventType `json:"type"`
+	Line   int              `json:"line"` // 1-based index of the mapping in the mapping file
+	Old    string           `json:"old"`
+	New    string           `json:"new"`
+	Size   int64            `json:"size"`
+	Reason string           `json:"reason,omitempty"` // why the mapping was skipped, error message
+	Err    error            `json:"-"`
+	At     time.Time        `json:"at"`
+}
+
+// MigrateOptions configure MigrateKeys
+type MigrateOptions struct {
+	// Format of the mapping file, default MappingCSV
+	Format MappingFormat
+
+	// KeepSource keep old objects after copying them, by default they're deleted once verified
+	KeepSource bool
+
+	// CheckpointPath is an object of storage recording how many mappings were processed, so an
+	// interrupted migration started again resume after them. Empty disable resuming.
+	CheckpointPath string
+
+	// CheckpointInterval is the number of mappings between checkpoints, default 100
+	CheckpointInterval int
+
+	// Observer receive an event for each mapping, it may be nil
+	Observer func(event MigrateEvent)
+}
+
+// MigrateResult count mappings by outcome of MigrateKeys
+type MigrateResult struct {
+	Migrated int
+	Skipped  int
+	Errored  int
+	Bytes    int64 // size of migrated objects
+}
+
+// MigrateKeys rename objects of storage according to old to new key mappings read from mappingReader.
+// Each object is copied server-side, the copy is verified against the source size and ETag, then
+// the source is deleted. Mappings whose old object is missing while the new one exist are skipped
+// as already migrated. Failures of single mappings are reported to the observer and the migration
+// continue, the returned error summarize them. Invalid mapping files and ctx cancellation stop it.
+func MigrateKeys(ctx context.Context, storage Storage, mappingReader io.Reader, options MigrateOptions) (MigrateResult, error) {
+	var result MigrateResult
+	if options.CheckpointInterval <= 0 {
+		options.CheckpointInterval = defaultMigrateCheckpointInterval
+	}
+
+	next, err := newMappingReader(mappingReader, options.Format)
+	if err != nil {
+		return result, err
+	}
+	done, err := loadMigrateCheckpoint(storage, options.CheckpointPath)
+	if err != nil {
+		return result, err
+	}
+
+	emit := func(event MigrateEvent) {
+		switch event.Type {
+		case MigrateEventMigrated:
+			result.Migrated++
+			result.Bytes += event.Size
+		case MigrateEventSkipped:
+			result.Skipped++
+		case MigrateEventErrored:
+			result.Errored++
+			event.Reason = event.Err.Error()
+		}
+		if options.Observer != nil {
+			event.At = time.Now()
+			options.Observer(event)
+		}
+	}
+
+	// the checkpoint never pass a failed mapping, so it's retried when the migration is started again
+	line, failedLine := 0, 0
+	checkpoint := func() error {
+		if failedLine > 0 {
+			return saveMigrateCheckpoint(storage, options.CheckpointPath, failedLine-1)
+		}
+		return saveMigrateCheckpoint(storage, options.CheckpointPath, line)
+	}
+
+	for {
+		mapping, err := next()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return result, fmt.Errorf("err reading key mapping %d: %w", line, err)
+		}
+		if line <= done {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			line--
+			if checkpointErr := checkpoint(); checkpointErr != nil {
+				return result, checkpointErr
+			}
+			return result, err
+		}
+
+		event := MigrateEvent{Line: line, Old: mapping.Old, New: mapping.New}
+		event.Type, event.Size, event.Reason, event.Err = migrateKey(storage, mapping, options.KeepSource)
+		if event.Type == MigrateEventErrored && failedLine == 0 {
+			failedLine = line
+		}
+		emit(event)
+
+		if line%options.CheckpointInterval == 0 {
+			if err := checkpoint(); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	if result.Errored > 0 {
+		if err := checkpoint(); err != nil {
+			return result, err
+		}
+		return result, fmt.Errorf("err migrating keys: %d mappings failed", result.Errored)
+	}
+	if options.CheckpointPath != "" {
+		if err := storage.Delete(options.CheckpointPath); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// migrateKey copy, verify and delete a single mapping
+func migrateKey(storage Storage, mapping KeyMapping, keepSource bool) (MigrateEventType, int64, string, error) {
+	if sameObjectPath(mapping.Old, mapping.New) {
+		return MigrateEventSkipped, 0, "same key", nil
+	}
+
+	src, err := storage.Stat(mapping.Old)
+	if errors.Is(err, ErrObjectNotExist) {
+		if exist, existErr := storage.Exist(mapping.New); existErr == nil && exist {
+			return MigrateEventSkipped, 0, "already migrated", nil
+		}
+	}
+	if err != nil {
+		return MigrateEventErrored, 0, "", err
+	}
+
+	if err := storage.Copy(mapping.Old, mapping.New); err != nil {
+		return MigrateEventErrored, src.Size, "", err
+	}
+	dst, err := storage.Stat(mapping.New)
+	if err != nil {
+		return MigrateEventErrored, src.Size, "", err
+	}
+	if dst.Size != src.Size {
+		return MigrateEventErrored, src.Size, "", fmt.Errorf("err verifying %s: size %d, expected %d", mapping.New, dst.Size, src.Size)
+	}
+	// ETags of multipart uploads change when copied
+	if !strings.Contains(src.ETag, "-") && src.ETag != "" && dst.ETag != "" && !strings.EqualFold(src.ETag, dst.ETag) {
+		return MigrateEventErrored, src.Size, "", fmt.Errorf("err verifying %s: etag %s, expected %s", mapping.New, dst.ETag, src.ETag)
+	}
+
+	if !keepSource {
+		if err := storage.Delete(mapping.Old); err != nil {
+			return MigrateEventErrored, src.Size, "", fmt.Errorf("err migrating %s to %s, copied but source not deleted: %w", mapping.Old, mapping.New, err)
+		}
+	}
+	return MigrateEventMigrated, src.Size, "", nil
+}
+
+// newMappingReader return function reading the next mapping of reader, io.EOF after the last one
+func newMappingReader(reader io.Reader, format MappingFormat) (func() (KeyMapping, error), error) {
+	switch format {
+	case "", MappingCSV:
+		csvReader := csv.NewReader(reader)
+		csvReader.FieldsPerRecord = 2
+		csvReader.TrimLeadingSpace = true
+		return func() (KeyMapping, error) {
+			record, err := csvReader.Read()
+			if err != nil {
+				return KeyMapping{}, err
+			}
+			return validKeyMapping(KeyMapping{Old: record[0], New: record[1]})
+		}, nil
+	case MappingJSONLines:
+		decoder := json.NewDecoder(reader)
+		return func() (KeyMapping, error) {
+			var mapping KeyMapping
+			if err := decoder.Decode(&mapping); err != nil {
+				return KeyMapping{}, err
+			}
+			return validKeyMapping(mapping)
+		}, nil
+	}
+	return nil, fmt.Errorf("err invalid mapping format: %s", format)
+}
+
+func validKeyMapping(mapping KeyMapping) (KeyMapping, error) {
+	if mapping.Old == "" || mapping.New == "" {
+		return mapping, fmt.Errorf("err empty key in mapping %q to %q", mapping.Old, mapping.New)
+	}
+	return mapping, nil
+}
+
+type migrateCheckpoint struct {
+	Done      int       `json:"done"` // number of processed mappings
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func loadMigrateCheckpoint(storage Storage, checkpointPath string) (int, error) {
+	if checkpointPath == "" {
+		return 0, nil
+	}
+	exist, err := storage.Exist(checkpointPath)
+	if err != nil || !exist {
+		return 0, err
+	}
+
+	reader, err := storage.Read(checkpointPath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	var checkpoint migrateCheckpoint
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return 0, fmt.Errorf("err invalid migrate checkpoint %s: %s", checkpointPath, err)
+	}
+	return checkpoint.Done, nil
+}
+
+func saveMigrateCheckpoint(storage Storage, checkpointPath string, done int) error {
+	if checkpointPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(migrateCheckpoint{Done: done, UpdatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	return storage.Put(checkpointPath, bytes.NewReader(data), ObjectPrivate)
+}
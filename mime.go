@@ -0,0 +1,45 @@
+package gostorage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLength is number of bytes http.DetectContentType look at
+const sniffLength = 512
+
+// sniffContentType detect content type of the first bytes of reader
+func sniffContentType(reader io.Reader) (string, error) {
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// detectContentType set content type of options from objectPath extension, or sniffed from the
+// head of source when the extension is unknown, unless a content type is given. The returned
+// source replay sniffed bytes.
+func detectContentType(objectPath string, source io.Reader, options PutOptions) (io.Reader, PutOptions, error) {
+	if options.Headers.ContentType != "" {
+		return source, options, nil
+	}
+	if contentType := mime.TypeByExtension(strings.ToLower(path.Ext(objectPath))); contentType != "" {
+		options.Headers.ContentType = contentType
+		return source, options, nil
+	}
+
+	var head bytes.Buffer
+	contentType, err := sniffContentType(io.TeeReader(source, &head))
+	if err != nil {
+		return nil, options, err
+	}
+	options.Headers.ContentType = contentType
+	return io.MultiReader(&head, source), options, nil
+}
@@ -0,0 +1,36 @@
+package gostorage
+
+import (
+	"fmt"
+)
+
+// sameObjectPath report whether both paths address the same object, moving an object onto
+// itself must not delete it
+func sameObjectPath(a string, b string) bool {
+	return objectKey(a) == objectKey(b)
+}
+
+// objectDeleter is implemented by storages whose Delete may keep objects, e.g. in trash,
+// deleteObjects always delete them
+type objectDeleter interface {
+	deleteObjects(objectPaths ...string) error
+}
+
+// moveByCopy copy srcObjectPath to dstObjectPath then delete the source, the source is kept
+// when the copy fails
+func moveByCopy(storage Storage, srcObjectPath string, dstObjectPath string) error {
+	if sameObjectPath(srcObjectPath, dstObjectPath) {
+		return nil
+	}
+	if err := storage.Copy(srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+	deleteObjects := storage.Delete
+	if deleter, ok := storage.(objectDeleter); ok {
+		deleteObjects = deleter.deleteObjects
+	}
+	if err := deleteObjects(srcObjectPath); err != nil {
+		return fmt.Errorf("err moving %s to %s, copied but source not deleted: %w", srcObjectPath, dstObjectPath, err)
+	}
+	return nil
+}
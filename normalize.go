@@ -0,0 +1,36 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidObjectPath is returned by NormalizeObjectPath for paths not addressing an object
+var ErrInvalidObjectPath = errors.New("invalid object path")
+
+// NormalizeObjectPath return the key every storage use for objectPath: OS separators become slashes,
+// "." segments, ".." segments and duplicate slashes are resolved and leading and trailing slashes
+// are dropped, e.g. "/reports//2024/../2025/q1.csv" become "reports/2025/q1.csv".
+// Paths resolving to the root or above it, e.g. "../secret", fail with ErrInvalidObjectPath,
+// so applications can validate user supplied paths before using them.
+func NormalizeObjectPath(objectPath string) (string, error) {
+	relative := path.Clean(strings.TrimLeft(filepath.ToSlash(objectPath), "/"))
+	if relative == "." || relative == ".." || strings.HasPrefix(relative, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectPath, objectPath)
+	}
+	return relative, nil
+}
+
+// objectKey normalize objectPath like NormalizeObjectPath, ".." segments can't go above the root
+// so escaping paths are clamped instead of rejected
+func objectKey(objectPath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(objectPath)), "/")
+}
+
+// localPath return file of objectPath under dir, it can't resolve outside of dir
+func localPath(dir string, objectPath string) string {
+	return filepath.Join(dir, filepath.FromSlash(objectKey(objectPath)))
+}
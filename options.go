@@ -0,0 +1,341 @@
+package gostorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Option configure optional behaviour of a storage implementation
+type Option func(*storageOptions)
+
+type storageOptions struct {
+	disableACL            bool
+	skipURLExistenceCheck bool
+	urlExistenceCacheTTL  time.Duration
+	debug                 bool
+	logger                Logger
+	timeouts              OperationTimeouts
+	checkpointStore       CheckpointStore
+	persistCheckpoints    bool
+	readRetryAttempts     int
+	maxPartSize           int
+	uploadLimiter         *UploadMemoryLimiter
+	ossRegion             string
+	ossSignatureV4        bool
+	ossInternalEndpoint   bool
+	directoryMarkers      bool
+	putVerifyAttempts     int
+	putVerifyDelay        time.Duration
+	preflight             bool
+	s3Express             bool
+	urlExpiryBounds       bool
+	minURLExpiry          time.Duration
+	maxURLExpiry          time.Duration
+	urlExpiryClampHook    func(URLExpiryClamp)
+	hedgeDelay            time.Duration
+	retryBudget           *RetryBudget
+	copyConcurrency       int
+	stallTimeout          time.Duration
+	progress              func(transferred, total int64)
+	legalHolds            bool
+	legalHoldOverride     bool
+	putRules              []PutRule
+	s3Encryption          *S3Encryption
+	s3Endpoints           []string
+	s3EndpointOptions     S3EndpointOptions
+	trashPrefix           string
+	s3Endpoint            string
+	s3PathStyle           bool
+	s3InsecureSkipVerify  bool
+}
+
+// OperationTimeouts is deadline applied to an operation when the caller context has no deadline,
+// zero value means Default is used, and zero Default means no deadline
+type OperationTimeouts struct {
+	Default  time.Duration
+	Read     time.Duration // until the returned reader is closed
+	Put      time.Duration
+	Delete   time.Duration
+	Copy     time.Duration // Copy and Compose
+	Metadata time.Duration // Connect, Size, LastModified, Exist, visibility and ACL
+}
+
+type operation int
+
+const (
+	operationRead operation = iota
+	operationPut
+	operationDelete
+	operationCopy
+	operationMetadata
+)
+
+func (t OperationTimeouts) get(op operation) time.Duration {
+	var timeout time.Duration
+	switch op {
+	case operationRead:
+		timeout = t.Read
+	case operationPut:
+		timeout = t.Put
+	case operationDelete:
+		timeout = t.Delete
+	case operationCopy:
+		timeout = t.Copy
+	case operationMetadata:
+		timeout = t.Metadata
+	}
+
+	if timeout <= 0 {
+		return t.Default
+	}
+	return timeout
+}
+
+func newStorageOptions(opts []Option) storageOptions {
+	o := storageOptions{
+		logger: logrus.StandardLogger(),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	return o
+}
+
+// WithoutACL never send ACL/visibility on Put, the object will inherit
+// the default policy of the bucket as if ObjectVisibilityInherit is always given
+func WithoutACL() Option {
+	return func(o *storageOptions) {
+		o.disableACL = true
+	}
+}
+
+// WithoutURLExistenceCheck make local storage URL trust the caller and skip checking
+// the public file, useful for hot render paths or files published out-of-band
+func WithoutURLExistenceCheck() Option {
+	return func(o *storageOptions) {
+		o.skipURLExistenceCheck = true
+	}
+}
+
+// WithURLExistenceCache make local storage URL remember that a public file exists for ttl
+// instead of checking the disk on every call
+func WithURLExistenceCache(ttl time.Duration) Option {
+	return func(o *storageOptions) {
+		o.urlExistenceCacheTTL = ttl
+	}
+}
+
+// WithLogger replace the default logrus standard logger
+func WithLogger(logger Logger) Option {
+	return func(o *storageOptions) {
+		if logger != nil {
+			o.logger = logger
+		}
+	}
+}
+
+// WithDebug log sanitized summary (method, key, status, duration, request ID)
+// of every request sent to the backend through the configured logger
+func WithDebug() Option {
+	return func(o *storageOptions) {
+		o.debug = true
+	}
+}
+
+// WithOperationTimeout set default deadline per operation so a hung connection can't stall
+// the caller indefinitely. Alibaba OSS SDK has no context support, there the Default timeout
+// is used as connection read/write timeout instead.
+func WithOperationTimeout(timeouts OperationTimeouts) Option {
+	return func(o *storageOptions) {
+		o.timeouts = timeouts
+	}
+}
+
+// WithUploadCheckpointStore set where PutResumable keep its checkpoints, default is in memory
+func WithUploadCheckpointStore(store CheckpointStore) Option {
+	return func(o *storageOptions) {
+		o.checkpointStore = store
+	}
+}
+
+// WithPersistedUploadCheckpoints make PutResumable keep its checkpoints as hidden objects
+// inside the storage itself, so an upload can be resumed by any worker node
+func WithPersistedUploadCheckpoints() Option {
+	return func(o *storageOptions) {
+		o.persistCheckpoints = true
+	}
+}
+
+// newCheckpointStore return checkpoint store for storage based on the options
+func (o storageOptions) newCheckpointStore(storage Storage) CheckpointStore {
+	if o.persistCheckpoints {
+		return NewStorageCheckpointStore(storage)
+	} else if o.checkpointStore != nil {
+		return o.checkpointStore
+	}
+	return NewMemoryCheckpointStore()
+}
+
+// WithReadRetry make reader returned by Read transparently reconnect from the last offset
+// using ranged request when the stream breaks, at most attempts times
+func WithReadRetry(attempts int) Option {
+	return func(o *storageOptions) {
+		o.readRetryAttempts = attempts
+	}
+}
+
+// WithAdaptivePartSize make multipart uploads grow part size from the backend minimum (5MB)
+// up to maxPartSize while parts upload fast, and shrink it back on slow links.
+// Zero maxPartSize use default cap of 64MB.
+func WithAdaptivePartSize(maxPartSize int) Option {
+	return func(o *storageOptions) {
+		if maxPartSize <= 0 {
+			maxPartSize = defaultMaxPartSize
+		}
+		o.maxPartSize = maxPartSize
+	}
+}
+
+// WithUploadMemoryLimit bound total bytes of part buffers held by concurrent Put on the storage
+func WithUploadMemoryLimit(maxBytes int64) Option {
+	return WithUploadMemoryLimiter(NewUploadMemoryLimiter(maxBytes))
+}
+
+// WithUploadMemoryLimiter use limiter which may be shared with other storages
+func WithUploadMemoryLimiter(limiter *UploadMemoryLimiter) Option {
+	return func(o *storageOptions) {
+		o.uploadLimiter = limiter
+	}
+}
+
+// WithOSSSignatureV4 sign Alibaba OSS requests using V4 signature algorithm, region is required
+// by the algorithm, e.g. "cn-hangzhou"
+func WithOSSSignatureV4(region string) Option {
+	return func(o *storageOptions) {
+		o.ossRegion = region
+		o.ossSignatureV4 = true
+	}
+}
+
+// WithOSSInternalEndpoint use internal endpoint of the region when running inside Alibaba Cloud
+// (detected using ECS metadata service on first use) to avoid egress cost. The configured endpoint
+// is used otherwise, and when its region differs from the region of the instance.
+func WithOSSInternalEndpoint() Option {
+	return func(o *storageOptions) {
+		o.ossInternalEndpoint = true
+	}
+}
+
+// WithDirectoryMarkers enable Hadoop/S3A compatible mode, Put write zero-byte "dir/" marker
+// objects for every parent directory and Exist honor them, so Spark/S3A consumers see the
+// directories. Local storage already has real directories and ignore this option.
+func WithDirectoryMarkers() Option {
+	return func(o *storageOptions) {
+		o.directoryMarkers = true
+	}
+}
+
+// WithPutVerification fetch object metadata after every Put and compare size and checksum
+// with the uploaded data before returning success, up to attempts times waiting delay between
+// them to tolerate eventually consistent endpoints. Supported by S3 and OSS, checksum is compared
+// with the ETag so it must not be used on buckets encrypted with SSE-KMS.
+func WithPutVerification(attempts int, delay time.Duration) Option {
+	return func(o *storageOptions) {
+		o.putVerifyAttempts = attempts
+		o.putVerifyDelay = delay
+	}
+}
+
+// WithPreflight make Connect validate bucket region and every permission needed by the
+// storage, returning an actionable error instead of a 403 surfacing later. Supported by S3.
+func WithPreflight() Option {
+	return func(o *storageOptions) {
+		o.preflight = true
+	}
+}
+
+// WithS3Express use S3 Express One Zone directory bucket, bucket name must follow the directory
+// bucket naming e.g. "data--use1-az4--x-s3". Requests go to the zonal endpoint signed with session
+// credentials created by CreateSession. Directory buckets don't support ACLs so visibility is ignored.
+func WithS3Express() Option {
+	return func(o *storageOptions) {
+		o.s3Express = true
+		o.disableACL = true
+	}
+}
+
+// WithTemporaryURLExpiry bound expiry of URLs created by TemporaryURL, requested expiry outside of
+// [min, max] is clamped and zero means unbounded. It replaces driver defaults which raise expiry to at
+// least 24h on S3 and 1 minute on OSS.
+func WithTemporaryURLExpiry(min time.Duration, max time.Duration) Option {
+	return func(o *storageOptions) {
+		o.urlExpiryBounds = true
+		o.minURLExpiry = min
+		o.maxURLExpiry = max
+	}
+}
+
+// WithURLExpiryClampHook call hook whenever requested expiry of TemporaryURL is clamped,
+// e.g. to log a warning or count it in metrics
+func WithURLExpiryClampHook(hook func(URLExpiryClamp)) Option {
+	return func(o *storageOptions) {
+		o.urlExpiryClampHook = hook
+	}
+}
+
+// operationContext derive context with operation timeout if ctx has no deadline yet
+func (o storageOptions) operationContext(ctx context.Context, op operation) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	timeout := o.timeouts.get(op)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// putVisibility return visibility to be used on Put based on storage options
+func (o storageOptions) putVisibility(visibility ObjectVisibility) ObjectVisibility {
+	if o.disableACL {
+		return ObjectVisibilityInherit
+	}
+	return visibility
+}
+
+// URLExpiryClamp describe expiry of a TemporaryURL changed to fit configured bounds
+type URLExpiryClamp struct {
+	ObjectPath string
+	Requested  time.Duration
+	Applied    time.Duration
+}
+
+// clampURLExpiry fit expireIn into configured bounds, defaultMin is the driver minimum used
+// when bounds are not configured
+func (o storageOptions) clampURLExpiry(objectPath string, expireIn time.Duration, defaultMin time.Duration) time.Duration {
+	min, max := defaultMin, time.Duration(0)
+	if o.urlExpiryBounds {
+		min, max = o.minURLExpiry, o.maxURLExpiry
+	}
+
+	applied := expireIn
+	if min > 0 && applied < min {
+		applied = min
+	}
+	if max > 0 && applied > max {
+		applied = max
+	}
+
+	if applied != expireIn {
+		o.logger.Debugf("[url-expiry] %s requested %s, clamped to %s\n", objectPath, expireIn, applied)
+		if o.urlExpiryClampHook != nil {
+			o.urlExpiryClampHook(URLExpiryClamp{ObjectPath: objectPath, Requested: expireIn, Applied: applied})
+		}
+	}
+	return applied
+}
@@ -0,0 +1,66 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	alibabaMetadataRegionURL = "http://100.100.100.200/latest/meta-data/region-id"
+	alibabaMetadataTimeout   = 300 * time.Millisecond
+)
+
+// detectAlibabaRegion return region id of the ECS instance we're running on using
+// the metadata service, empty region is returned when not running inside Alibaba Cloud
+func detectAlibabaRegion() string {
+	ctx, cancel := context.WithTimeout(context.Background(), alibabaMetadataTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, alibabaMetadataRegionURL, nil)
+	if err != nil {
+		return ""
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(body))
+}
+
+// ossInternalEndpoint return internal (VPC) endpoint of region, traffic through it is free of egress cost
+func ossInternalEndpoint(region string) string {
+	return fmt.Sprintf("https://oss-%s-internal.aliyuncs.com", region)
+}
+
+// resolveOSSEndpoint switch to internal endpoint of the detected region when enabled, the configured
+// endpoint is kept when not running inside Alibaba Cloud or when it address another region, e.g. a
+// bucket in oss-eu-central-1 accessed from an instance in cn-hangzhou
+func resolveOSSEndpoint(endpoint string, options storageOptions) string {
+	if !options.ossInternalEndpoint {
+		return endpoint
+	}
+
+	region, ok := ossEndpointRegion(endpoint)
+	if !ok || (options.ossRegion != "" && options.ossRegion != region) {
+		return endpoint
+	}
+	if detected := detectAlibabaRegion(); detected != region {
+		return endpoint
+	}
+	return ossInternalEndpoint(region)
+}
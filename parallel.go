@@ -0,0 +1,60 @@
+package gostorage
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ParallelForEachObject call fn for every object listed under prefix with up to concurrency calls
+// running at once. The first failure cancel ctx given to running calls and stop listing, it's returned
+// once they finish. Cancelling ctx stop scheduling calls as well.
+func ParallelForEachObject(ctx context.Context, storage Storage, prefix string, concurrency int, fn func(ctx context.Context, object ObjectInfo) error) error {
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	group, groupCtx := newBoundedGroup(ctx, concurrency)
+	for groupCtx.Err() == nil && iterator.Next() {
+		object := iterator.Object()
+		group.Go(func() error {
+			return fn(groupCtx, object)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return iterator.Err()
+}
+
+// ParallelForEach call fn for every object path like ParallelForEachObject, for callers already
+// knowing which objects they need
+func ParallelForEach(ctx context.Context, objectPaths []string, concurrency int, fn func(ctx context.Context, objectPath string) error) error {
+	group, groupCtx := newBoundedGroup(ctx, concurrency)
+	for _, objectPath := range objectPaths {
+		if groupCtx.Err() != nil {
+			break
+		}
+		group.Go(func() error {
+			return fn(groupCtx, objectPath)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// newBoundedGroup create errgroup running up to concurrency goroutines, at least one
+func newBoundedGroup(ctx context.Context, concurrency int) (*errgroup.Group, context.Context) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(concurrency)
+	return group, groupCtx
+}
@@ -0,0 +1,89 @@
+package gostorage
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	defaultMaxPartSize         = 64 * 1024 * 1024 // 64MB
+	adaptivePartTargetDuration = 4 * time.Second  // desired duration for uploading a single part
+)
+
+// partSizer decide size of the next multipart part, in adaptive mode part size is doubled
+// while parts upload fast and halved when they get slow, bounded by [min, max]
+type partSizer struct {
+	min      int
+	max      int
+	current  int
+	adaptive bool
+	limiter  *UploadMemoryLimiter
+	acquired int64
+}
+
+func newPartSizer(minPartSize int, options storageOptions) *partSizer {
+	sizer := &partSizer{
+		min:      minPartSize,
+		max:      minPartSize,
+		current:  minPartSize,
+		adaptive: options.maxPartSize > minPartSize,
+		limiter:  options.uploadLimiter,
+	}
+	if sizer.adaptive {
+		sizer.max = options.maxPartSize
+	}
+	return sizer
+}
+
+// next return size of the next part
+func (p *partSizer) next() int {
+	return p.current
+}
+
+// observe adjust part size based on throughput of the last uploaded part
+func (p *partSizer) observe(size int, duration time.Duration) {
+	if !p.adaptive || size < p.current {
+		return
+	}
+
+	if duration < adaptivePartTargetDuration/2 && p.current < p.max {
+		p.current *= 2
+		if p.current > p.max {
+			p.current = p.max
+		}
+	} else if duration > adaptivePartTargetDuration*2 && p.current > p.min {
+		p.current /= 2
+		if p.current < p.min {
+			p.current = p.min
+		}
+	}
+}
+
+// buffer return buf if it's big enough for the next part otherwise allocate new one,
+// blocking until the upload memory limiter allow it
+func (p *partSizer) buffer(buf []byte) []byte {
+	if cap(buf) >= p.current {
+		return buf[:p.current]
+	}
+
+	p.limiter.release(p.acquired)
+	p.acquired = p.limiter.acquire(int64(p.current))
+	return make([]byte, p.current)
+}
+
+// release give back memory held for the part buffer, must be called once upload finished
+func (p *partSizer) release() {
+	p.limiter.release(p.acquired)
+	p.acquired = 0
+}
+
+// fillPart read a whole part from source, slow sources such as pipes are read until the buffer is
+// full or the source ends. last report the source ended so it must not be read again, a part
+// shorter than buffer is always last.
+func fillPart(source io.Reader, buffer []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(source, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
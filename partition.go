@@ -0,0 +1,76 @@
+package gostorage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExpandKeyTemplate build object path from a template, supported placeholders are
+// {yyyy} {mm} {dd} {hh} (taken from t in UTC), {unix} (unix seconds), {uuid} (random v4 uuid)
+// and {name} (given name), e.g. "events/{yyyy}/{mm}/{dd}/{uuid}.json"
+func ExpandKeyTemplate(template string, t time.Time, name string) (string, error) {
+	t = t.UTC()
+	replacements := []string{
+		"{yyyy}", fmt.Sprintf("%04d", t.Year()),
+		"{mm}", fmt.Sprintf("%02d", int(t.Month())),
+		"{dd}", fmt.Sprintf("%02d", t.Day()),
+		"{hh}", fmt.Sprintf("%02d", t.Hour()),
+		"{unix}", fmt.Sprintf("%d", t.Unix()),
+		"{name}", name,
+	}
+
+	if strings.Contains(template, "{uuid}") {
+		id, err := newUUID()
+		if err != nil {
+			return "", err
+		}
+		replacements = append(replacements, "{uuid}", id)
+	}
+
+	return strings.NewReplacer(replacements...).Replace(template), nil
+}
+
+// PartitionedWriter put objects into time partitioned prefixes following a key template
+type PartitionedWriter struct {
+	storage    Storage
+	template   string
+	visibility ObjectVisibility
+	now        func() time.Time
+}
+
+// NewPartitionedWriter create writer routing every Put into path built by ExpandKeyTemplate
+func NewPartitionedWriter(storage Storage, template string, visibility ObjectVisibility) *PartitionedWriter {
+	return &PartitionedWriter{
+		storage:    storage,
+		template:   template,
+		visibility: visibility,
+		now:        time.Now,
+	}
+}
+
+// Put store source under the partition of current time, return the object path used
+func (w *PartitionedWriter) Put(name string, source io.Reader) (string, error) {
+	objectPath, err := ExpandKeyTemplate(w.template, w.now(), name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := w.storage.Put(objectPath, source, w.visibility); err != nil {
+		return "", err
+	}
+	return objectPath, nil
+}
+
+// newUUID return random (version 4) uuid string
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
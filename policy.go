@@ -0,0 +1,161 @@
+package gostorage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrForbidden is returned when an operation is denied by a policy
+var ErrForbidden = errors.New("operation is forbidden by policy")
+
+type principalKey struct{}
+
+// ContextWithPrincipal return ctx carrying principal evaluated by policies
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext return principal stored by ContextWithPrincipal, empty when there is none
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// PolicyRequest describe an operation to authorize
+type PolicyRequest struct {
+	Principal  string
+	Operation  Operation
+	ObjectPath string
+}
+
+// PolicyFunc authorize request, returning error deny the operation
+type PolicyFunc func(ctx context.Context, request PolicyRequest) error
+
+// WithPolicy wrap storage so every operation is authorized by policy, denied operations fail with
+// ErrForbidden. The principal is taken from the context bound with BindContext.
+func WithPolicy(storage Storage, policy PolicyFunc) Storage {
+	return newGuardedStorage(storage, func(ctx context.Context, operation Operation, objectPath string) error {
+		request := PolicyRequest{
+			Principal:  PrincipalFromContext(ctx),
+			Operation:  operation,
+			ObjectPath: objectPath,
+		}
+		if err := policy(ctx, request); err != nil {
+			if errors.Is(err, ErrForbidden) {
+				return err
+			}
+			return fmt.Errorf("%w: %s", ErrForbidden, err)
+		}
+		return nil
+	})
+}
+
+// BindContext return storage whose authorization sees ctx, e.g. the principal of the current request,
+// storages not wrapped by WithPolicy or WithScopedToken are returned as is
+func BindContext(storage Storage, ctx context.Context) Storage {
+	if binder, ok := storage.(interface {
+		WithContext(ctx context.Context) Storage
+	}); ok {
+		return binder.WithContext(ctx)
+	}
+	return storage
+}
+
+// PolicyEffect is the decision of a matching rule
+type PolicyEffect string
+
+const (
+	PolicyAllow PolicyEffect = "allow"
+	PolicyDeny  PolicyEffect = "deny"
+)
+
+// PolicyRule match requests by principal, operation and object path prefix,
+// empty Principals or Operations match any
+type PolicyRule struct {
+	Effect     PolicyEffect
+	Principals []string
+	Operations []Operation
+	Prefix     string
+}
+
+func (r PolicyRule) match(request PolicyRequest) bool {
+	if !strings.HasPrefix(strings.TrimPrefix(request.ObjectPath, "/"), r.Prefix) {
+		return false
+	}
+
+	principalMatch := len(r.Principals) == 0
+	for _, principal := range r.Principals {
+		principalMatch = principalMatch || principal == request.Principal
+	}
+	operationMatch := len(r.Operations) == 0
+	for _, operation := range r.Operations {
+		operationMatch = operationMatch || operation == request.Operation
+	}
+	return principalMatch && operationMatch
+}
+
+// NewRulePolicy create policy evaluating rules in order, the first matching rule decide
+// and requests matching no rule are denied
+func NewRulePolicy(rules ...PolicyRule) PolicyFunc {
+	return func(ctx context.Context, request PolicyRequest) error {
+		for _, rule := range rules {
+			if !rule.match(request) {
+				continue
+			}
+			if rule.Effect == PolicyAllow {
+				return nil
+			}
+			break
+		}
+		return fmt.Errorf("%w: %s %s by %q", ErrForbidden, request.Operation, request.ObjectPath, request.Principal)
+	}
+}
+
+// ParsePolicyRules parse rules written one per line as "<allow|deny> <principals> <operations> <prefix>",
+// principals and operations are comma separated and "*" match any, blank lines and lines starting with
+// "#" are ignored, e.g.
+//
+//	allow thumbnailer read,write uploads/
+//	deny * delete invoices/
+//	allow admin * *
+func ParsePolicyRules(text string) ([]PolicyRule, error) {
+	var rules []PolicyRule
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("err policy line %d: expected 4 fields, got %d", lineNumber, len(fields))
+		}
+
+		rule := PolicyRule{Effect: PolicyEffect(fields[0])}
+		if rule.Effect != PolicyAllow && rule.Effect != PolicyDeny {
+			return nil, fmt.Errorf("err policy line %d: unknown effect %s", lineNumber, fields[0])
+		}
+		if fields[1] != "*" {
+			rule.Principals = strings.Split(fields[1], ",")
+		}
+		if fields[2] != "*" {
+			for _, operation := range strings.Split(fields[2], ",") {
+				switch Operation(operation) {
+				case OperationRead, OperationWrite, OperationDelete, OperationList:
+					rule.Operations = append(rule.Operations, Operation(operation))
+				default:
+					return nil, fmt.Errorf("err policy line %d: unknown operation %s", lineNumber, operation)
+				}
+			}
+		}
+		if fields[3] != "*" {
+			rule.Prefix = fields[3]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
@@ -0,0 +1,109 @@
+package gostorage
+
+import (
+	"io"
+	"os"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+)
+
+// WithProgress report progress of Put, Writer and Read transfers to fn, e.g. to render a progress bar.
+// transferred is number of bytes sent or received so far and total is size of the object, -1 when
+// unknown like for Put of a stream. fn is called from the goroutine transferring data, S3 uploads
+// report once per uploaded part.
+func WithProgress(fn func(transferred, total int64)) Option {
+	return func(o *storageOptions) {
+		o.progress = fn
+	}
+}
+
+// sourceSize return number of bytes left in source when known without reading it, -1 otherwise
+func sourceSize(source io.Reader) int64 {
+	switch v := source.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
+
+// transferProgress count transferred bytes and report them to the progress callback
+type transferProgress struct {
+	fn          func(transferred, total int64)
+	total       int64
+	transferred int64
+}
+
+// transferProgress start counting a transfer of total bytes, nil when progress isn't reported
+func (o storageOptions) transferProgress(total int64) *transferProgress {
+	if o.progress == nil {
+		return nil
+	}
+	return &transferProgress{fn: o.progress, total: total}
+}
+
+func (p *transferProgress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.transferred += n
+	p.fn(p.transferred, p.total)
+}
+
+// Write count bytes written, to be used with io.TeeReader
+func (p *transferProgress) Write(b []byte) (int, error) {
+	p.add(int64(len(b)))
+	return len(b), nil
+}
+
+// readProgress report bytes read from reader of total size when progress is reported
+func (o storageOptions) readProgress(reader io.ReadCloser, total int64) io.ReadCloser {
+	progress := o.transferProgress(total)
+	if progress == nil {
+		return reader
+	}
+	return &progressReadCloser{ReadCloser: reader, progress: progress}
+}
+
+type progressReadCloser struct {
+	io.ReadCloser
+	progress *transferProgress
+}
+
+func (r *progressReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.progress.add(int64(n))
+	}
+	return n, err
+}
+
+// ossProgressListener forward data events of OSS SDK to the progress callback, total is taken from
+// the source because SDK don't know size of wrapped readers
+type ossProgressListener struct {
+	fn    func(transferred, total int64)
+	total int64
+}
+
+// ossProgress return OSS option reporting upload progress of source, none when progress isn't reported
+func (o storageOptions) ossProgress(source io.Reader) []oss.Option {
+	if o.progress == nil {
+		return nil
+	}
+	return []oss.Option{oss.Progress(&ossProgressListener{fn: o.progress, total: sourceSize(source)})}
+}
+
+func (l *ossProgressListener) ProgressChanged(event *oss.ProgressEvent) {
+	if event.EventType == oss.TransferDataEvent {
+		l.fn(event.ConsumedBytes, l.total)
+	}
+}
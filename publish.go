@@ -0,0 +1,109 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	publishPointerName = "CURRENT"
+	publishVersionsDir = "versions"
+)
+
+// PublishFile is a single file of a published tree, Path is relative to the published prefix
+// and must not contain ".." segments
+type PublishFile struct {
+	Path       string
+	Source     io.Reader
+	Visibility ObjectVisibility
+}
+
+// PublishPointer is content of the "current" pointer object of a published prefix
+type PublishPointer struct {
+	Version     string    `json:"version"`
+	PublishedAt time.Time `json:"published_at"`
+	Files       []string  `json:"files"`
+}
+
+// ObjectPath return object path of file inside the version referenced by the pointer
+func (p *PublishPointer) ObjectPath(prefix string, filePath string) string {
+	return path.Join(prefix, publishVersionsDir, p.Version, filePath)
+}
+
+// PublishAtomic upload files under a new write-once version of prefix and then flip the
+// "current" pointer object to it, readers resolving files through the pointer never
+// observe a mixed old/new tree. Previous versions are kept for rollback.
+func PublishAtomic(storage Storage, prefix string, files []PublishFile) (*PublishPointer, error) {
+	filePaths := make([]string, len(files))
+	for i, file := range files {
+		filePath, err := publishFilePath(file.Path)
+		if err != nil {
+			return nil, err
+		}
+		filePaths[i] = filePath
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	pointer := &PublishPointer{
+		Version:     fmt.Sprintf("%s-%s", now.Format("20060102T150405Z"), id[:8]),
+		PublishedAt: now,
+	}
+
+	for i, file := range files {
+		if err := storage.Put(pointer.ObjectPath(prefix, filePaths[i]), file.Source, file.Visibility); err != nil {
+			return nil, err
+		}
+		pointer.Files = append(pointer.Files, filePaths[i])
+	}
+
+	if err := SetPublishedVersion(storage, prefix, pointer); err != nil {
+		return nil, err
+	}
+	return pointer, nil
+}
+
+// publishFilePath normalize path of a published file, ".." segments are rejected so a file
+// can't be written outside of its version, e.g. over the pointer object
+func publishFilePath(filePath string) (string, error) {
+	for _, segment := range strings.Split(filepath.ToSlash(filePath), "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: %q contains \"..\"", ErrInvalidObjectPath, filePath)
+		}
+	}
+	return NormalizeObjectPath(filePath)
+}
+
+// CurrentPublishedVersion return the pointer of the currently published version of prefix
+func CurrentPublishedVersion(storage Storage, prefix string) (*PublishPointer, error) {
+	reader, err := storage.Read(path.Join(prefix, publishPointerName))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var pointer PublishPointer
+	if err := json.NewDecoder(reader).Decode(&pointer); err != nil {
+		return nil, fmt.Errorf("err invalid publish pointer of %s: %s", prefix, err)
+	}
+	return &pointer, nil
+}
+
+// SetPublishedVersion flip the pointer of prefix, can be used to roll back to a previous version
+func SetPublishedVersion(storage Storage, prefix string, pointer *PublishPointer) error {
+	data, err := json.Marshal(pointer)
+	if err != nil {
+		return err
+	}
+	return storage.Put(path.Join(prefix, publishPointerName), bytes.NewReader(data), ObjectPrivate)
+}
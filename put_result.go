@@ -0,0 +1,45 @@
+package gostorage
+
+import (
+	"io"
+)
+
+var (
+	_ PutResultStorage = (*storageS3)(nil)
+	_ PutResultStorage = (*storageAlibabaOSS)(nil)
+	_ PutResultStorage = (*storageLocalFile)(nil)
+)
+
+// PutResult describe an object just written
+type PutResult struct {
+	ETag      string // without quotes, sha256 hex on local storage
+	VersionID string // empty when the bucket isn't versioned
+	Size      int64  // number of bytes written
+}
+
+// PutResultStorage is implemented by storages reporting what Put wrote without another request
+type PutResultStorage interface {
+	Storage
+
+	// PutWithResult is PutWithOptions returning ETag, version and size of the written object
+	PutWithResult(objectPath string, source io.Reader, options PutOptions) (PutResult, error)
+}
+
+// PutWithResult put source like PutWithOptions and return ETag, version and size of the written
+// object. Storages not implementing PutResultStorage, like wrappers, are asked the ETag with Stat
+// after the put, so it may belong to a later write, and report no version.
+func PutWithResult(storage Storage, objectPath string, source io.Reader, options PutOptions) (PutResult, error) {
+	if resultStorage, ok := storage.(PutResultStorage); ok {
+		return resultStorage.PutWithResult(objectPath, source, options)
+	}
+
+	digest := newPutDigest(source)
+	if err := storage.PutWithOptions(objectPath, digest, options); err != nil {
+		return PutResult{}, err
+	}
+	info, err := storage.Stat(objectPath)
+	if err != nil {
+		return PutResult{}, err
+	}
+	return PutResult{ETag: info.ETag, Size: digest.size}, nil
+}
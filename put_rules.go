@@ -0,0 +1,78 @@
+package gostorage
+
+import (
+	"io"
+	"path"
+	"strings"
+)
+
+// PutRule set visibility, cache control and storage class of objects put with a matching path or
+// content type, e.g. every PDF private and every image public with a year of caching:
+//
+//	WithPutRules(
+//		PutRule{Pattern: "*.pdf", Visibility: ObjectPrivate},
+//		PutRule{ContentType: "image/", Visibility: ObjectPublicRead, CacheControl: "public, max-age=31536000"},
+//	)
+type PutRule struct {
+	// Pattern match object path with path.Match, patterns without "/" match the base name so "*.pdf"
+	// match PDFs in every directory. Empty match any path, invalid patterns never match.
+	Pattern string
+
+	// ContentType match prefix of the content type given to Put, or detected when none is given,
+	// e.g. "image/". Empty match any content type.
+	ContentType string
+
+	// Visibility, CacheControl and StorageClass replace the ones given to Put when not empty
+	Visibility   ObjectVisibility
+	CacheControl string
+	StorageClass string
+}
+
+// WithPutRules apply the first rule matching path and content type of an object on Put, so upload
+// policies live in configuration instead of every caller. Rules replace values given to Put.
+func WithPutRules(rules ...PutRule) Option {
+	return func(o *storageOptions) {
+		o.putRules = append(o.putRules, rules...)
+	}
+}
+
+func (r PutRule) match(objectPath string, contentType string) bool {
+	if r.ContentType != "" && !strings.HasPrefix(contentType, r.ContentType) {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+
+	name := strings.TrimPrefix(objectPath, "/")
+	if !strings.Contains(r.Pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(r.Pattern, name)
+	return matched
+}
+
+// preparePut detect content type of options and apply the first matching put rule
+func (o storageOptions) preparePut(objectPath string, source io.Reader, options PutOptions) (io.Reader, PutOptions, error) {
+	source, options, err := detectContentType(objectPath, source, options)
+	if err != nil {
+		return nil, options, err
+	}
+
+	for _, rule := range o.putRules {
+		if !rule.match(objectPath, options.Headers.ContentType) {
+			continue
+		}
+		if rule.Visibility != "" {
+			options.Visibility = rule.Visibility
+		}
+		if rule.CacheControl != "" {
+			options.Headers.CacheControl = rule.CacheControl
+		}
+		if rule.StorageClass != "" {
+			options.StorageClass = rule.StorageClass
+		}
+		break
+	}
+	return source, options, nil
+}
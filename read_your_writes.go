@@ -0,0 +1,267 @@
+package gostorage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultReadYourWritesWindow  = 5 * time.Second
+	defaultReadYourWritesMaxSize = 8 * 1024 * 1024
+)
+
+// ReadYourWritesOptions configure WithReadYourWrites, zero value fields use sensible defaults
+type ReadYourWritesOptions struct {
+	// Window is how long after a write reads are served locally, it should cover the replication
+	// lag of the backend, default 5s
+	Window time.Duration
+
+	// MaxObjectSize is the largest object kept in memory, larger objects are read from the backend,
+	// default 8MB
+	MaxObjectSize int64
+}
+
+// recentWrite is an object written or deleted through the session less than a window ago
+type recentWrite struct {
+	data      []byte // nil for deletions
+	deleted   bool
+	writtenAt time.Time
+}
+
+type readYourWritesStorage struct {
+	Storage
+	options ReadYourWritesOptions
+	now     func() time.Time
+
+	mu     sync.Mutex
+	writes map[string]recentWrite
+}
+
+// WithReadYourWrites wrap storage so objects put or deleted through it are read back as written for
+// a short window, even when an eventually consistent backend still serve the previous state. Written
+// objects are kept in memory during the window, so the wrapper is meant for a session of a single
+// process, other processes don't see the writes any sooner.
+func WithReadYourWrites(storage Storage, options ReadYourWritesOptions) Storage {
+	if options.Window <= 0 {
+		options.Window = defaultReadYourWritesWindow
+	}
+	if options.MaxObjectSize <= 0 {
+		options.MaxObjectSize = defaultReadYourWritesMaxSize
+	}
+	return &readYourWritesStorage{
+		Storage: storage,
+		options: options,
+		now:     time.Now,
+		writes:  map[string]recentWrite{},
+	}
+}
+
+func (s *readYourWritesStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+// recent return write of objectPath made less than a window ago, expired writes are forgotten
+func (s *readYourWritesStorage) recent(objectPath string) (recentWrite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := objectKey(objectPath)
+	write, ok := s.writes[key]
+	if ok && s.now().Sub(write.writtenAt) >= s.options.Window {
+		delete(s.writes, key)
+		return recentWrite{}, false
+	}
+	return write, ok
+}
+
+// record remember write of objectPath, nil data forget it so reads go to the backend
+func (s *readYourWritesStorage) record(objectPath string, data []byte, deleted bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, write := range s.writes {
+		if now.Sub(write.writtenAt) >= s.options.Window {
+			delete(s.writes, key)
+		}
+	}
+	if data == nil && !deleted {
+		delete(s.writes, objectKey(objectPath))
+		return
+	}
+	s.writes[objectKey(objectPath)] = recentWrite{data: data, deleted: deleted, writtenAt: now}
+}
+
+func (s *readYourWritesStorage) Read(objectPath string) (io.ReadCloser, error) {
+	return s.ReadRange(objectPath, 0, -1)
+}
+
+func (s *readYourWritesStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	write, ok := s.recent(objectPath)
+	if !ok {
+		return s.Storage.ReadRange(objectPath, offset, length)
+	}
+	if write.deleted {
+		return nil, errRecentlyDeleted(objectPath)
+	}
+
+	data := write.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *readYourWritesStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	return s.PutWithOptions(objectPath, source, PutOptions{Visibility: visibility})
+}
+
+func (s *readYourWritesStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *readYourWritesStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	buffer := &cappedBuffer{max: s.options.MaxObjectSize}
+	if err := s.Storage.PutWithOptions(objectPath, io.TeeReader(source, buffer), options); err != nil {
+		s.record(objectPath, nil, false)
+		return err
+	}
+	s.record(objectPath, buffer.bytes(), false)
+	return nil
+}
+
+func (s *readYourWritesStorage) Delete(objectPaths ...string) error {
+	err := s.Storage.Delete(objectPaths...)
+	for _, objectPath := range objectPaths {
+		// objects a batch failed to delete may or may not be deleted
+		s.record(objectPath, nil, err == nil)
+	}
+	return err
+}
+
+// DeletePrefix mark objects written through the session under prefix deleted
+func (s *readYourWritesStorage) DeletePrefix(prefix string) error {
+	err := s.Storage.DeletePrefix(prefix)
+
+	s.mu.Lock()
+	var objectPaths []string
+	for key := range s.writes {
+		if strings.HasPrefix(key, trimPrefixRoot(prefix)) {
+			objectPaths = append(objectPaths, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, objectPath := range objectPaths {
+		s.record(objectPath, nil, err == nil)
+	}
+	return err
+}
+
+func (s *readYourWritesStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	write, _ := s.recent(srcObjectPath)
+	if err := s.Storage.Copy(srcObjectPath, dstObjectPath); err != nil {
+		s.record(dstObjectPath, nil, false)
+		return err
+	}
+	s.record(dstObjectPath, write.data, false)
+	return nil
+}
+
+func (s *readYourWritesStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if sameObjectPath(srcObjectPath, dstObjectPath) {
+		return s.Storage.Move(srcObjectPath, dstObjectPath)
+	}
+
+	write, _ := s.recent(srcObjectPath)
+	if err := s.Storage.Move(srcObjectPath, dstObjectPath); err != nil {
+		s.record(dstObjectPath, nil, false)
+		return err
+	}
+	s.record(srcObjectPath, nil, true)
+	s.record(dstObjectPath, write.data, false)
+	return nil
+}
+
+func (s *readYourWritesStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	// the composed object isn't known, read it from the backend
+	s.record(dstObjectPath, nil, false)
+	return s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *readYourWritesStorage) Exist(objectPath string) (bool, error) {
+	if write, ok := s.recent(objectPath); ok {
+		return !write.deleted, nil
+	}
+	return s.Storage.Exist(objectPath)
+}
+
+// ExistMany call Exist of the wrapper for every path
+func (s *readYourWritesStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	return existEach(s, objectPaths)
+}
+
+// Stat ask the backend, objects it doesn't know yet are described from the session
+func (s *readYourWritesStorage) Stat(objectPath string) (ObjectInfo, error) {
+	write, ok := s.recent(objectPath)
+	if ok && write.deleted {
+		return ObjectInfo{}, errRecentlyDeleted(objectPath)
+	}
+
+	info, err := s.Storage.Stat(objectPath)
+	if ok && errors.Is(err, ErrObjectNotExist) {
+		return ObjectInfo{ObjectPath: objectKey(objectPath), Size: int64(len(write.data)), LastModified: write.writtenAt}, nil
+	}
+	return info, err
+}
+
+func (s *readYourWritesStorage) Size(objectPath string) (int64, error) {
+	if write, ok := s.recent(objectPath); ok {
+		if write.deleted {
+			return 0, errRecentlyDeleted(objectPath)
+		}
+		return int64(len(write.data)), nil
+	}
+	return s.Storage.Size(objectPath)
+}
+
+func errRecentlyDeleted(objectPath string) error {
+	return fmt.Errorf("%w: %s was deleted", ErrObjectNotExist, objectPath)
+}
+
+// cappedBuffer keep data written to it until it exceed max, it never fail so a TeeReader writing
+// to it doesn't fail the read
+type cappedBuffer struct {
+	buffer   bytes.Buffer
+	max      int64
+	overflow bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if !b.overflow && int64(b.buffer.Len()+len(p)) <= b.max {
+		b.buffer.Write(p)
+	} else {
+		b.overflow = true
+		b.buffer = bytes.Buffer{}
+	}
+	return len(p), nil
+}
+
+// bytes return the written data, nil when it exceeded max
+func (b *cappedBuffer) bytes() []byte {
+	if b.overflow {
+		return nil
+	}
+	return append([]byte{}, b.buffer.Bytes()...)
+}
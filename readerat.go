@@ -0,0 +1,59 @@
+package gostorage
+
+import (
+	"fmt"
+	"io"
+)
+
+// ObjectReaderAt adapt an object to io.ReaderAt, every ReadAt is a range request,
+// e.g. reading a zip archive without downloading it
+//
+//	readerAt, err := gostorage.NewReaderAt(storage, "archive.zip")
+//	archive, err := zip.NewReader(readerAt, readerAt.Size())
+type ObjectReaderAt struct {
+	storage    Storage
+	objectPath string
+	size       int64
+}
+
+// NewReaderAt create ObjectReaderAt of objectPath, size of the object is fetched once
+func NewReaderAt(storage Storage, objectPath string) (*ObjectReaderAt, error) {
+	size, err := storage.Size(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectReaderAt{storage: storage, objectPath: objectPath, size: size}, nil
+}
+
+// Size return object size at the time the reader was created
+func (r *ObjectReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *ObjectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("err reading %s: negative offset %d", r.objectPath, off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	length := min(int64(len(p)), r.size-off)
+	reader, err := r.storage.ReadRange(r.objectPath, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	n, err := io.ReadFull(reader, p[:length])
+	if err != nil {
+		return n, err
+	}
+	if int64(len(p)) > length {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,70 @@
+package gostorage
+
+import "fmt"
+
+// ReloadableStorage forward operations to storage created from config. Reconfigure replace it with
+// storage created from a new config, e.g. to rotate credentials or move to another endpoint, while
+// operations already started finish with the previous storage.
+type ReloadableStorage struct {
+	*lazyStorage
+}
+
+// NewReloadableStorage create storage described by config which can be reconfigured while in use
+func NewReloadableStorage(config StorageConfig, opts ...Option) (*ReloadableStorage, error) {
+	storage, err := config.NewStorage(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ReloadableStorage{lazyStorage: &lazyStorage{storage: storage}}, nil
+}
+
+// Reconfigure create storage from config and use it for operations started afterwards,
+// current storage is kept when config is invalid
+func (s *ReloadableStorage) Reconfigure(config StorageConfig, opts ...Option) error {
+	storage, err := config.NewStorage(opts...)
+	if err != nil {
+		return err
+	}
+	s.swap(storage)
+	return nil
+}
+
+func (s *ReloadableStorage) swap(storage Storage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.storage = storage
+}
+
+// Reconfigure apply config to registered storages, reloadable storages are reconfigured in place and
+// other storages are replaced. Every storage is created before any is swapped, so an invalid config
+// leave the manager unchanged. Storages missing from config stay registered.
+func (m *Manager) Reconfigure(config Config, opts ...Option) error {
+	if config.Default != "" {
+		if _, ok := config.Storages[config.Default]; !ok {
+			return fmt.Errorf("err default storage %s is not configured", config.Default)
+		}
+	}
+
+	storages := make(map[string]Storage, len(config.Storages))
+	for name, storageConfig := range config.Storages {
+		storage, err := storageConfig.NewStorage(opts...)
+		if err != nil {
+			return fmt.Errorf("err storage %s: %s", name, err)
+		}
+		storages[name] = storage
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, storage := range storages {
+		if reloadable, ok := m.storages[name].(*ReloadableStorage); ok {
+			reloadable.swap(storage)
+			continue
+		}
+		m.storages[name] = storage
+	}
+	if config.Default != "" {
+		m.fallback = config.Default
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// ErrResidencyViolation returned when writing an object to a storage its residency rule doesn't allow
+var ErrResidencyViolation = errors.New("operation violates data residency rule")
+
+// ResidencyRule apply to every object path starting with Prefix, the longest matching prefix win
+type ResidencyRule struct {
+	Prefix   string
+	Regions  []string // allowed regions, matched with path.Match so "eu-*" allow every EU region, empty allow any
+	Backends []string // allowed backend names of ResidencyOptions.Backend, empty allow any
+}
+
+// ResidencyOptions configure WithResidency
+type ResidencyOptions struct {
+	Region  string // region of the storage, detected with StorageRegion when empty
+	Backend string // name of the storage checked against Backends of rules, e.g. "aws" or "on-premise"
+	Rules   []ResidencyRule
+}
+
+type residencyStorage struct {
+	Storage
+	options ResidencyOptions
+}
+
+// WithResidency wrap storage to reject writes of objects whose residency rule doesn't allow region or
+// backend of the storage with ErrResidencyViolation. It panics when a rule restrict regions and region
+// of the storage is neither given nor detected.
+func WithResidency(storage Storage, options ResidencyOptions) Storage {
+	if options.Region == "" {
+		options.Region, _ = StorageRegion(storage)
+	}
+	for _, rule := range options.Rules {
+		if len(rule.Regions) > 0 && options.Region == "" {
+			panic(fmt.Errorf("err residency rule of %q restrict regions but region of storage is unknown", rule.Prefix))
+		}
+		for _, pattern := range rule.Regions {
+			if _, err := path.Match(pattern, ""); err != nil {
+				panic(fmt.Errorf("err invalid residency region pattern %q: %s", pattern, err))
+			}
+		}
+	}
+
+	return &residencyStorage{
+		Storage: storage,
+		options: options,
+	}
+}
+
+// StorageRegion return region of S3, OBS, OCI and OSS storages from their configuration
+func StorageRegion(storage Storage) (string, bool) {
+	switch s := underlying(storage).(type) {
+	case *storageS3:
+		return aws.StringValue(s.awsSession.Config.Region), true
+	case *storageOCI:
+		return s.config.Region, true
+	case *storageAlibabaOSS:
+		return ossEndpointRegion(s.publicBucket.Client.Config.Endpoint)
+	}
+	return "", false
+}
+
+// ossEndpointRegion parse region of public and internal OSS endpoints, e.g. oss-eu-central-1.aliyuncs.com
+func ossEndpointRegion(endpoint string) (string, bool) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false
+	}
+
+	label := strings.Split(endpointURL.Hostname(), ".")[0]
+	if !strings.HasPrefix(label, "oss-") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(label, "oss-"), "-internal"), true
+}
+
+func (s *residencyStorage) rule(objectPath string) (ResidencyRule, bool) {
+	objectPath = objectKey(objectPath)
+	var matched ResidencyRule
+	found := false
+	for _, rule := range s.options.Rules {
+		if strings.HasPrefix(objectPath, trimPrefixRoot(rule.Prefix)) && (!found || len(rule.Prefix) > len(matched.Prefix)) {
+			matched = rule
+			found = true
+		}
+	}
+	return matched, found
+}
+
+func (s *residencyStorage) check(objectPath string) error {
+	rule, ok := s.rule(objectPath)
+	if !ok {
+		return nil
+	}
+
+	if len(rule.Regions) > 0 && !residencyRegionAllowed(rule.Regions, s.options.Region) {
+		return fmt.Errorf("%w: %s may only be stored in %s, storage region is %s", ErrResidencyViolation, objectPath, strings.Join(rule.Regions, ", "), s.options.Region)
+	}
+	if len(rule.Backends) > 0 && !residencyBackendAllowed(rule.Backends, s.options.Backend) {
+		return fmt.Errorf("%w: %s may only be stored in %s, storage backend is %q", ErrResidencyViolation, objectPath, strings.Join(rule.Backends, ", "), s.options.Backend)
+	}
+	return nil
+}
+
+func residencyRegionAllowed(patterns []string, region string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, region); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func residencyBackendAllowed(backends []string, backend string) bool {
+	for _, allowed := range backends {
+		if allowed == backend {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *residencyStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	if err := s.check(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.Put(objectPath, source, visibility)
+}
+
+func (s *residencyStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	if err := s.check(objectPath); err != nil {
+		return nil, err
+	}
+	return s.Storage.Writer(objectPath, visibility)
+}
+
+func (s *residencyStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	if err := s.check(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.PutWithOptions(objectPath, source, options)
+}
+
+func (s *residencyStorage) Touch(objectPath string) error {
+	if err := s.check(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.Touch(objectPath)
+}
+
+func (s *residencyStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	if err := s.check(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (s *residencyStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *residencyStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.check(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (s *residencyStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := s.check(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *residencyStorage) Unwrap() Storage {
+	return s.Storage
+}
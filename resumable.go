@@ -0,0 +1,203 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+)
+
+const (
+	uploadCheckpointPrefix = ".uploads"
+	resumablePartSize      = 5120 * 1024 // satisfy minimum part size of every backend
+)
+
+var (
+	_ ResumableStorage = (*storageS3)(nil)
+	_ ResumableStorage = (*storageAlibabaOSS)(nil)
+)
+
+// ResumableStorage is implemented by storages supporting multipart upload which can be
+// resumed after failure, possibly by another process sharing the checkpoint store
+type ResumableStorage interface {
+	Storage
+
+	// PutResumable upload source in parts, saving a checkpoint after each part. When a checkpoint
+	// already exists for objectPath the upload continue from its offset, source is seeked accordingly.
+	PutResumable(objectPath string, source io.ReadSeeker, visibility ObjectVisibility) error
+}
+
+// UploadCheckpoint is the state of an unfinished multipart upload
+type UploadCheckpoint struct {
+	ObjectPath string           `json:"object_path"`
+	UploadID   string           `json:"upload_id"`
+	Parts      []CheckpointPart `json:"parts"`
+	Offset     int64            `json:"offset"` // number of source bytes already uploaded
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// CheckpointPart is an uploaded part of a multipart upload
+type CheckpointPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// CheckpointStore persist upload checkpoints
+type CheckpointStore interface {
+	// Load return nil checkpoint if there's no unfinished upload for objectPath
+	Load(objectPath string) (*UploadCheckpoint, error)
+	Save(checkpoint *UploadCheckpoint) error
+	Remove(objectPath string) error
+}
+
+type memoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]UploadCheckpoint
+}
+
+// NewMemoryCheckpointStore keep checkpoints in process memory, upload can only be resumed by the same process
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{checkpoints: make(map[string]UploadCheckpoint)}
+}
+
+func (m *memoryCheckpointStore) Load(objectPath string) (*UploadCheckpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	checkpoint, ok := m.checkpoints[objectPath]
+	if !ok {
+		return nil, nil
+	}
+	checkpoint.Parts = append([]CheckpointPart(nil), checkpoint.Parts...)
+	return &checkpoint, nil
+}
+
+func (m *memoryCheckpointStore) Save(checkpoint *UploadCheckpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *checkpoint
+	saved.Parts = append([]CheckpointPart(nil), checkpoint.Parts...)
+	m.checkpoints[checkpoint.ObjectPath] = saved
+	return nil
+}
+
+func (m *memoryCheckpointStore) Remove(objectPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.checkpoints, objectPath)
+	return nil
+}
+
+type storageCheckpointStore struct {
+	storage Storage
+}
+
+// NewStorageCheckpointStore keep checkpoints as hidden objects inside storage,
+// so any worker node can resume an upload started by another node
+func NewStorageCheckpointStore(storage Storage) CheckpointStore {
+	return &storageCheckpointStore{storage: storage}
+}
+
+func (c *storageCheckpointStore) checkpointPath(objectPath string) string {
+	return path.Join(uploadCheckpointPrefix, objectPath+".checkpoint")
+}
+
+func (c *storageCheckpointStore) Load(objectPath string) (*UploadCheckpoint, error) {
+	checkpointPath := c.checkpointPath(objectPath)
+	exist, err := c.storage.Exist(checkpointPath)
+	if err != nil || !exist {
+		return nil, err
+	}
+
+	reader, err := c.storage.Read(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var checkpoint UploadCheckpoint
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("err invalid upload checkpoint %s: %s", checkpointPath, err)
+	}
+	return &checkpoint, nil
+}
+
+func (c *storageCheckpointStore) Save(checkpoint *UploadCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return c.storage.Put(c.checkpointPath(checkpoint.ObjectPath), bytes.NewReader(data), ObjectPrivate)
+}
+
+func (c *storageCheckpointStore) Remove(objectPath string) error {
+	return c.storage.Delete(c.checkpointPath(objectPath))
+}
+
+// multipartUploader is the backend specific part of a resumable upload
+type multipartUploader interface {
+	initiateUpload(objectPath string, visibility ObjectVisibility) (string, error)
+	uploadPart(objectPath string, uploadID string, partNumber int, data []byte) (string, error)
+	completeUpload(objectPath string, uploadID string, parts []CheckpointPart) error
+}
+
+// putResumable drive a multipart upload saving checkpoint after each uploaded part,
+// on failure the checkpoint is kept and the upload is not aborted so it can be resumed
+func putResumable(uploader multipartUploader, checkpoints CheckpointStore, sizer *partSizer, objectPath string, source io.ReadSeeker, visibility ObjectVisibility) error {
+	checkpoint, err := checkpoints.Load(objectPath)
+	if err != nil {
+		return err
+	}
+
+	if checkpoint == nil {
+		uploadID, err := uploader.initiateUpload(objectPath, visibility)
+		if err != nil {
+			return err
+		}
+		checkpoint = &UploadCheckpoint{ObjectPath: objectPath, UploadID: uploadID}
+	} else if _, err := source.Seek(checkpoint.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	var buffer []byte
+	defer sizer.release()
+	for last := false; !last; {
+		buffer = sizer.buffer(buffer)
+		var bytesRead int
+		var err error
+		bytesRead, last, err = fillPart(source, buffer)
+		if err != nil {
+			return err
+		}
+		// empty sources are uploaded as a single empty part, completing an upload require one
+		if bytesRead == 0 && len(checkpoint.Parts) > 0 {
+			break
+		}
+
+		partNumber := len(checkpoint.Parts) + 1
+		startedAt := time.Now()
+		etag, err := uploader.uploadPart(objectPath, checkpoint.UploadID, partNumber, buffer[:bytesRead])
+		if err != nil {
+			return err
+		}
+		sizer.observe(bytesRead, time.Since(startedAt))
+
+		checkpoint.Parts = append(checkpoint.Parts, CheckpointPart{Number: partNumber, ETag: etag, Size: int64(bytesRead)})
+		checkpoint.Offset += int64(bytesRead)
+		checkpoint.UpdatedAt = time.Now()
+		if err := checkpoints.Save(checkpoint); err != nil {
+			return err
+		}
+	}
+
+	if err := uploader.completeUpload(objectPath, checkpoint.UploadID, checkpoint.Parts); err != nil {
+		return err
+	}
+	return checkpoints.Remove(objectPath)
+}
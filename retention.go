@@ -0,0 +1,188 @@
+package gostorage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrRetained returned when deleting or overwriting an object younger than its retention minimum age
+var ErrRetained = errors.New("object is retained by retention policy")
+
+// ErrExpired returned when reading an object older than its retention maximum age, the object is deleted
+var ErrExpired = errors.New("object is expired by retention policy")
+
+// RetentionRule apply to every object path starting with Prefix, the longest matching prefix win
+type RetentionRule struct {
+	Prefix string
+	MinAge time.Duration // object can't be deleted or overwritten before reaching this age
+	MaxAge time.Duration // object is expired lazily on Read/Exist after this age, zero means never
+}
+
+type retentionStorage struct {
+	Storage
+	rules []RetentionRule
+	now   func() time.Time
+}
+
+// WithRetentionPolicy wrap storage to enforce retention rules client-side,
+// for backends which don't have native WORM support
+func WithRetentionPolicy(storage Storage, rules []RetentionRule) Storage {
+	return &retentionStorage{
+		Storage: storage,
+		rules:   rules,
+		now:     time.Now,
+	}
+}
+
+func (s *retentionStorage) Read(objectPath string) (io.ReadCloser, error) {
+	expired, err := s.expireIfNeeded(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrExpired
+	}
+	return s.Storage.Read(objectPath)
+}
+
+func (s *retentionStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	if err := s.checkRetained(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.Put(objectPath, source, visibility)
+}
+
+func (s *retentionStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *retentionStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	if err := s.checkRetained(objectPath); err != nil {
+		return err
+	}
+	return s.Storage.PutWithOptions(objectPath, source, options)
+}
+
+func (s *retentionStorage) Delete(objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		if err := s.checkRetained(objectPath); err != nil {
+			return err
+		}
+	}
+	return s.Storage.Delete(objectPaths...)
+}
+
+func (s *retentionStorage) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
+}
+
+func (s *retentionStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	if err := s.checkRetained(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Copy(srcObjectPath, dstObjectPath)
+}
+
+func (s *retentionStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *retentionStorage) Unwrap() Storage {
+	return s.Storage
+}
+
+func (s *retentionStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	if err := s.checkRetained(srcObjectPath); err != nil {
+		return err
+	}
+	if err := s.checkRetained(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Move(srcObjectPath, dstObjectPath)
+}
+
+func (s *retentionStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := s.checkRetained(dstObjectPath); err != nil {
+		return err
+	}
+	return s.Storage.Compose(dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *retentionStorage) Exist(objectPath string) (bool, error) {
+	expired, err := s.expireIfNeeded(objectPath)
+	if err != nil {
+		return false, err
+	}
+	if expired {
+		return false, nil
+	}
+	return s.Storage.Exist(objectPath)
+}
+
+// ExistMany call Exist of the wrapper for every path
+func (s *retentionStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	return existEach(s, objectPaths)
+}
+
+func (s *retentionStorage) rule(objectPath string) (RetentionRule, bool) {
+	var matched RetentionRule
+	found := false
+	for _, rule := range s.rules {
+		if strings.HasPrefix(objectPath, rule.Prefix) && (!found || len(rule.Prefix) > len(matched.Prefix)) {
+			matched = rule
+			found = true
+		}
+	}
+	return matched, found
+}
+
+// age return age of existing object, ok is false if object does not exist
+func (s *retentionStorage) age(objectPath string) (time.Duration, bool, error) {
+	exist, err := s.Storage.Exist(objectPath)
+	if err != nil || !exist {
+		return 0, false, err
+	}
+
+	lastModified, err := s.Storage.LastModified(objectPath)
+	if err != nil {
+		return 0, false, err
+	}
+	return s.now().Sub(lastModified), true, nil
+}
+
+func (s *retentionStorage) checkRetained(objectPath string) error {
+	rule, ok := s.rule(objectPath)
+	if !ok || rule.MinAge <= 0 {
+		return nil
+	}
+
+	age, exist, err := s.age(objectPath)
+	if err != nil {
+		return err
+	}
+	if exist && age < rule.MinAge {
+		return ErrRetained
+	}
+	return nil
+}
+
+func (s *retentionStorage) expireIfNeeded(objectPath string) (bool, error) {
+	rule, ok := s.rule(objectPath)
+	if !ok || rule.MaxAge <= 0 {
+		return false, nil
+	}
+
+	age, exist, err := s.age(objectPath)
+	if err != nil || !exist || age <= rule.MaxAge {
+		return false, err
+	}
+
+	if err := s.Storage.Delete(objectPath); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,145 @@
+package gostorage
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RetryBudgetOptions configure NewRetryBudget
+type RetryBudgetOptions struct {
+	MaxTokens     float64 // bucket capacity and initial tokens, default 100
+	RetryCost     float64 // tokens taken by a retry, default 1
+	SuccessRefill float64 // tokens added by a successful request, default 0.1
+}
+
+// RetryBudgetStats is snapshot of a retry budget
+type RetryBudgetStats struct {
+	Tokens    float64 `json:"tokens"`
+	Retries   int64   `json:"retries"`   // retries allowed by the budget
+	Exhausted int64   `json:"exhausted"` // retries denied because the budget was exhausted
+	Successes int64   `json:"successes"`
+}
+
+// RetryBudget is token bucket limiting retries, every retry take tokens and every successful request
+// refill a fraction of them. While the backend is healthy retries are always allowed, during an outage
+// the bucket drains and further retries are denied so they don't multiply load on the backend.
+// It implements http.Handler serving metrics in prometheus text exposition format.
+type RetryBudget struct {
+	options RetryBudgetOptions
+
+	mu    sync.Mutex
+	stats RetryBudgetStats
+}
+
+// NewRetryBudget create full retry budget
+func NewRetryBudget(options RetryBudgetOptions) *RetryBudget {
+	if options.MaxTokens <= 0 {
+		options.MaxTokens = 100
+	}
+	if options.RetryCost <= 0 {
+		options.RetryCost = 1
+	}
+	if options.SuccessRefill <= 0 {
+		options.SuccessRefill = 0.1
+	}
+	return &RetryBudget{
+		options: options,
+		stats:   RetryBudgetStats{Tokens: options.MaxTokens},
+	}
+}
+
+// WithRetryBudget limit retries of the storage with budget, it may be shared with other storages.
+// It covers S3 SDK request retries and stream reconnects of WithReadRetry on S3 and OSS.
+func WithRetryBudget(budget *RetryBudget) Option {
+	return func(o *storageOptions) {
+		o.retryBudget = budget
+	}
+}
+
+// AllowRetry take tokens of a retry, return false when the budget is exhausted
+func (b *RetryBudget) AllowRetry() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stats.Tokens < b.options.RetryCost {
+		b.stats.Exhausted++
+		return false
+	}
+	b.stats.Tokens -= b.options.RetryCost
+	b.stats.Retries++
+	return true
+}
+
+// Success refill the budget after a successful request
+func (b *RetryBudget) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stats.Successes++
+	b.stats.Tokens = min(b.stats.Tokens+b.options.SuccessRefill, b.options.MaxTokens)
+}
+
+// Stats return current state of the budget
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// ServeHTTP write metrics in prometheus text exposition format
+func (b *RetryBudget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	stats := b.Stats()
+	fmt.Fprintf(w, "# HELP gostorage_retry_budget_tokens Tokens left in the retry budget.\n# TYPE gostorage_retry_budget_tokens gauge\n")
+	fmt.Fprintf(w, "gostorage_retry_budget_tokens %g\n", stats.Tokens)
+	fmt.Fprintf(w, "# HELP gostorage_retry_budget_retries_total Retries allowed by the retry budget.\n# TYPE gostorage_retry_budget_retries_total counter\n")
+	fmt.Fprintf(w, "gostorage_retry_budget_retries_total %d\n", stats.Retries)
+	fmt.Fprintf(w, "# HELP gostorage_retry_budget_exhausted_total Retries denied because the retry budget was exhausted.\n# TYPE gostorage_retry_budget_exhausted_total counter\n")
+	fmt.Fprintf(w, "gostorage_retry_budget_exhausted_total %d\n", stats.Exhausted)
+}
+
+// useRetryBudget make AWS SDK requests of handlers consult budget before every retry and refill it on success
+func useRetryBudget(handlers *request.Handlers, budget *RetryBudget, logger Logger) {
+	// pushed in front of the SDK handler deciding whether the request is retried
+	handlers.AfterRetry.PushFrontNamed(request.NamedHandler{
+		Name: "gostorage.RetryBudget",
+		Fn: func(r *request.Request) {
+			if r.Error == nil {
+				return
+			}
+
+			retryable := aws.BoolValue(r.Retryable)
+			if r.Retryable == nil {
+				retryable = r.ShouldRetry(r)
+			}
+			if !retryable || r.RetryCount >= r.MaxRetries() {
+				return
+			}
+			if !budget.AllowRetry() {
+				logger.Debugf("[retry-budget] exhausted, not retrying %s: %s\n", r.Operation.Name, r.Error)
+				r.Retryable = aws.Bool(false)
+				return
+			}
+			r.Retryable = aws.Bool(true)
+		},
+	})
+	handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "gostorage.RetryBudgetRefill",
+		Fn: func(r *request.Request) {
+			if r.Error == nil {
+				budget.Success()
+			}
+		},
+	})
+}
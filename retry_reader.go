@@ -0,0 +1,78 @@
+package gostorage
+
+import (
+	"io"
+)
+
+// rangeOpener open object stream starting at offset
+type rangeOpener func(offset int64) (io.ReadCloser, error)
+
+// retryReader reopen the stream from the last read offset when it breaks mid-way,
+// e.g. connection reset or unexpected EOF on long downloads
+type retryReader struct {
+	open     rangeOpener
+	current  io.ReadCloser
+	offset   int64
+	attempts int
+	budget   *RetryBudget
+	logger   Logger
+	name     string
+}
+
+func newRetryReader(name string, current io.ReadCloser, open rangeOpener, attempts int, budget *RetryBudget, logger Logger) io.ReadCloser {
+	return &retryReader{
+		open:     open,
+		current:  current,
+		attempts: attempts,
+		budget:   budget,
+		logger:   logger,
+		name:     name,
+	}
+}
+
+func (r *retryReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.current.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF || r.attempts <= 0 {
+			return n, err
+		}
+		if !r.budget.AllowRetry() {
+			r.logger.Debugf("[%s] stream broken at offset %d, retry budget exhausted: %s\n", r.name, r.offset, err.Error())
+			return n, err
+		}
+
+		r.attempts--
+		r.logger.Debugf("[%s] stream broken at offset %d, reconnecting: %s\n", r.name, r.offset, err.Error())
+		_ = r.current.Close()
+
+		reader, openErr := r.open(r.offset)
+		if openErr != nil {
+			r.current = errReadCloser{err: err}
+			return n, err
+		}
+		r.current = reader
+		r.budget.Success()
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *retryReader) Close() error {
+	return r.current.Close()
+}
+
+// errReadCloser always fail reading with err, used after a failed reconnect
+type errReadCloser struct {
+	err error
+}
+
+func (e errReadCloser) Read(p []byte) (int, error) {
+	return 0, e.err
+}
+
+func (e errReadCloser) Close() error {
+	return nil
+}
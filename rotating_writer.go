@@ -0,0 +1,178 @@
+package gostorage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const defaultRotateMaxSize = 64 * 1024 * 1024
+
+// ErrWriterClosed returned when writing into a closed RotatingObjectWriter
+var ErrWriterClosed = errors.New("writer is closed")
+
+// RotatingWriterOptions configure RotatingObjectWriter, zero value fields use sensible defaults
+type RotatingWriterOptions struct {
+	MaxSize     int64            // uncompressed bytes per object, default 64MB
+	MaxDuration time.Duration    // maximum age of an object before it's rotated, zero disables time rotation
+	Gzip        bool             // gzip compress every object
+	Visibility  ObjectVisibility // default ObjectPrivate
+}
+
+// RotatingObjectWriter is an io.Writer buffering written data into objects named by a key
+// template (see ExpandKeyTemplate, {name} is the sequence number of the object), a new object
+// is started whenever the current one reach MaxSize or MaxDuration
+type RotatingObjectWriter struct {
+	mu       sync.Mutex
+	storage  Storage
+	template string
+	options  RotatingWriterOptions
+	now      func() time.Time
+
+	buffer    bytes.Buffer
+	gzip      *gzip.Writer
+	size      int64
+	startedAt time.Time
+	sequence  int
+	err       error
+	closed    bool
+	done      chan struct{}
+}
+
+// NewRotatingObjectWriter create writer, Close must be called to flush the last object
+func NewRotatingObjectWriter(storage Storage, template string, options RotatingWriterOptions) *RotatingObjectWriter {
+	if options.MaxSize <= 0 {
+		options.MaxSize = defaultRotateMaxSize
+	}
+	if options.Visibility == "" {
+		options.Visibility = ObjectPrivate
+	}
+
+	w := &RotatingObjectWriter{
+		storage:  storage,
+		template: template,
+		options:  options,
+		now:      time.Now,
+		done:     make(chan struct{}),
+	}
+	if options.MaxDuration > 0 {
+		go w.rotateLoop()
+	}
+	return w
+}
+
+// rotateLoop flush idle objects which would otherwise stay in memory until next write
+func (w *RotatingObjectWriter) rotateLoop() {
+	ticker := time.NewTicker(w.options.MaxDuration / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if w.size > 0 && w.now().Sub(w.startedAt) >= w.options.MaxDuration {
+				w.err = w.flush()
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *RotatingObjectWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.size > 0 && (w.size+int64(len(p)) > w.options.MaxSize ||
+		(w.options.MaxDuration > 0 && w.now().Sub(w.startedAt) >= w.options.MaxDuration)) {
+		if w.err = w.flush(); w.err != nil {
+			return 0, w.err
+		}
+	}
+
+	if w.size == 0 {
+		w.startedAt = w.now()
+	}
+
+	var writer io.Writer = &w.buffer
+	if w.options.Gzip {
+		if w.gzip == nil {
+			w.gzip = gzip.NewWriter(&w.buffer)
+		}
+		writer = w.gzip
+	}
+
+	n, err := writer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate flush the current object to storage immediately
+func (w *RotatingObjectWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.flush()
+	return w.err
+}
+
+// Close flush the last object and stop time based rotation
+func (w *RotatingObjectWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.flush()
+}
+
+func (w *RotatingObjectWriter) flush() error {
+	if w.size == 0 {
+		return nil
+	}
+
+	headers := ObjectHeaders{}
+	if w.gzip != nil {
+		if err := w.gzip.Close(); err != nil {
+			return err
+		}
+		w.gzip = nil
+		headers.ContentType = "application/gzip"
+	}
+
+	w.sequence++
+	objectPath, err := ExpandKeyTemplate(w.template, w.startedAt, fmt.Sprintf("%06d", w.sequence))
+	if err != nil {
+		return err
+	}
+
+	if err := putWithHeaders(w.storage, objectPath, bytes.NewReader(w.buffer.Bytes()), w.options.Visibility, headers); err != nil {
+		return err
+	}
+
+	w.buffer.Reset()
+	w.size = 0
+	return nil
+}
@@ -0,0 +1,441 @@
+package gostorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Route send every object path starting with Prefix to Storage
+type Route struct {
+	Prefix  string
+	Storage Storage
+}
+
+type routedStorage struct {
+	routes   []Route
+	fallback Storage
+}
+
+// NewRoutedStorage present several storages as one, each object path is served by the route
+// with the longest matching prefix, or by fallback when no route match (fallback may be nil).
+// Object paths are passed to the backend unchanged. Copy and Compose spanning different
+// backends are done by streaming through this process.
+func NewRoutedStorage(fallback Storage, routes ...Route) Storage {
+	sorted := append([]Route{}, routes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Prefix) > len(sorted[j].Prefix)
+	})
+	return &routedStorage{routes: sorted, fallback: fallback}
+}
+
+func (s *routedStorage) route(objectPath string) (Storage, error) {
+	trimmed := strings.TrimPrefix(objectPath, "/")
+	for _, route := range s.routes {
+		if strings.HasPrefix(trimmed, strings.TrimPrefix(route.Prefix, "/")) {
+			return route.Storage, nil
+		}
+	}
+	if s.fallback == nil {
+		return nil, fmt.Errorf("err no storage route for %s", objectPath)
+	}
+	return s.fallback, nil
+}
+
+// backends return every distinct storage, in routing order followed by fallback
+func (s *routedStorage) backends() []Storage {
+	var backends []Storage
+	seen := make(map[Storage]bool)
+	for _, route := range s.routes {
+		if !seen[route.Storage] {
+			seen[route.Storage] = true
+			backends = append(backends, route.Storage)
+		}
+	}
+	if s.fallback != nil && !seen[s.fallback] {
+		backends = append(backends, s.fallback)
+	}
+	return backends
+}
+
+// group object paths by the storage serving them, keeping their order
+func (s *routedStorage) group(objectPaths []string) (map[Storage][]string, []Storage, error) {
+	groups := make(map[Storage][]string)
+	var order []Storage
+	for _, objectPath := range objectPaths {
+		storage, err := s.route(objectPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := groups[storage]; !ok {
+			order = append(order, storage)
+		}
+		groups[storage] = append(groups[storage], objectPath)
+	}
+	return groups, order, nil
+}
+
+func (s *routedStorage) Connect(ctx context.Context) error {
+	for _, storage := range s.backends() {
+		if err := storage.Connect(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *routedStorage) Ping(ctx context.Context) error {
+	for _, storage := range s.backends() {
+		if err := storage.Ping(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *routedStorage) Read(objectPath string) (io.ReadCloser, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Read(objectPath)
+}
+
+func (s *routedStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return storage.ReadRange(objectPath, offset, length)
+}
+
+func (s *routedStorage) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return err
+	}
+	return storage.Put(objectPath, source, visibility)
+}
+
+func (s *routedStorage) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Writer(objectPath, visibility)
+}
+
+func (s *routedStorage) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return err
+	}
+	return storage.PutWithOptions(objectPath, source, options)
+}
+
+func (s *routedStorage) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return ObjectMetadata{}, err
+	}
+	return storage.GetMetadata(objectPath)
+}
+
+func (s *routedStorage) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return err
+	}
+	return storage.SetMetadata(objectPath, metadata)
+}
+
+func (s *routedStorage) Touch(objectPath string) error {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return err
+	}
+	return storage.Touch(objectPath)
+}
+
+func (s *routedStorage) Delete(objectPaths ...string) error {
+	groups, order, err := s.group(objectPaths)
+	if err != nil {
+		return err
+	}
+	// failures of a storage don't stop deleting objects of the others
+	var failures []DeleteFailure
+	for _, storage := range order {
+		err := storage.Delete(groups[storage]...)
+		var multiErr *MultiDeleteError
+		if errors.As(err, &multiErr) {
+			failures = append(failures, multiErr.Failures...)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(failures) > 0 {
+		return &MultiDeleteError{Failures: failures}
+	}
+	return nil
+}
+
+func (s *routedStorage) URL(objectPath string, storageResize *StorageResize) (string, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return storage.URL(objectPath, storageResize)
+}
+
+func (s *routedStorage) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return storage.TemporaryURL(objectPath, expireIn, storageResize)
+}
+
+func (s *routedStorage) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	groups, order, err := s.group(objectPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make(map[string]string, len(objectPaths))
+	for _, storage := range order {
+		signed, err := storage.TemporaryURLs(groups[storage], expireIn, storageResize)
+		if err != nil {
+			return nil, err
+		}
+		for objectPath, url := range signed {
+			urls[objectPath] = url
+		}
+	}
+	return urls, nil
+}
+
+// prefixRoute return storage of the route containing every object under prefix, nil when objects
+// under prefix may be routed to several storages
+func (s *routedStorage) prefixRoute(prefix string) Storage {
+	trimmed := strings.TrimPrefix(prefix, "/")
+	for _, route := range s.routes {
+		if strings.HasPrefix(trimmed, strings.TrimPrefix(route.Prefix, "/")) {
+			return route.Storage
+		}
+	}
+	return nil
+}
+
+func (s *routedStorage) DeletePrefix(prefix string) error {
+	if storage := s.prefixRoute(prefix); storage != nil {
+		return storage.DeletePrefix(prefix)
+	}
+	return deleteListed(s, prefix)
+}
+
+func (s *routedStorage) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	src, dst := s.prefixRoute(srcPrefix), s.prefixRoute(dstPrefix)
+	if src != nil && src == dst {
+		return src.CopyPrefix(srcPrefix, dstPrefix)
+	}
+	return copyListed(s, srcPrefix, dstPrefix, defaultCopyConcurrency)
+}
+
+func (s *routedStorage) Copy(srcObjectPath string, dstObjectPath string) error {
+	src, err := s.route(srcObjectPath)
+	if err != nil {
+		return err
+	}
+	dst, err := s.route(dstObjectPath)
+	if err != nil {
+		return err
+	}
+
+	if src == dst {
+		return src.Copy(srcObjectPath, dstObjectPath)
+	}
+	_, err = Transfer(src, srcObjectPath, dst, dstObjectPath)
+	return err
+}
+
+func (s *routedStorage) Move(srcObjectPath string, dstObjectPath string) error {
+	src, err := s.route(srcObjectPath)
+	if err != nil {
+		return err
+	}
+	dst, err := s.route(dstObjectPath)
+	if err != nil {
+		return err
+	}
+
+	if src == dst {
+		return src.Move(srcObjectPath, dstObjectPath)
+	}
+	return moveByCopy(s, srcObjectPath, dstObjectPath)
+}
+
+func (s *routedStorage) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	_, order, err := s.group(append([]string{dstObjectPath}, srcObjectPaths...))
+	if err != nil {
+		return err
+	}
+
+	if len(order) == 1 {
+		return order[0].Compose(dstObjectPath, visibility, srcObjectPaths...)
+	}
+	return Concat(s, dstObjectPath, visibility, srcObjectPaths...)
+}
+
+func (s *routedStorage) Size(objectPath string) (int64, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return 0, err
+	}
+	return storage.Size(objectPath)
+}
+
+func (s *routedStorage) LastModified(objectPath string) (time.Time, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return storage.LastModified(objectPath)
+}
+
+func (s *routedStorage) Stat(objectPath string) (ObjectInfo, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return storage.Stat(objectPath)
+}
+
+func (s *routedStorage) MimeType(objectPath string) (string, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return storage.MimeType(objectPath)
+}
+
+func (s *routedStorage) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return storage.Checksum(objectPath, algo)
+}
+
+func (s *routedStorage) Exist(objectPath string) (bool, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return false, err
+	}
+	return storage.Exist(objectPath)
+}
+
+// List query every backend which may hold objects under prefix, objects are listed backend by backend
+// so they are in lexical order only within a backend
+func (s *routedStorage) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	groups, order, err := s.group(objectPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(objectPaths))
+	for _, storage := range order {
+		exists, err := storage.ExistMany(groups[storage]...)
+		if err != nil {
+			return nil, err
+		}
+		for objectPath, exist := range exists {
+			result[objectPath] = exist
+		}
+	}
+	return result, nil
+}
+
+func (s *routedStorage) List(prefix string) (ObjectIterator, error) {
+	trimmed := strings.TrimPrefix(prefix, "/")
+	var backends []Storage
+	seen := make(map[Storage]bool)
+	for _, route := range s.routes {
+		routePrefix := strings.TrimPrefix(route.Prefix, "/")
+		if strings.HasPrefix(trimmed, routePrefix) {
+			// prefix is inside of a single route
+			return route.Storage.List(prefix)
+		}
+		if strings.HasPrefix(routePrefix, trimmed) && !seen[route.Storage] {
+			seen[route.Storage] = true
+			backends = append(backends, route.Storage)
+		}
+	}
+	if s.fallback != nil && !seen[s.fallback] {
+		backends = append(backends, s.fallback)
+	}
+
+	chained := &chainedObjectIterator{}
+	for _, storage := range backends {
+		iterator, err := storage.List(prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		// skip objects of a shared backend which are routed elsewhere
+		storage := storage
+		chained.iterators = append(chained.iterators, iterator)
+		chained.filters = append(chained.filters, func(object ObjectInfo) bool {
+			routed, err := s.route(object.ObjectPath)
+			return err == nil && routed == storage
+		})
+	}
+	return chained, nil
+}
+
+func (s *routedStorage) SetVisibility(objectPath string, visibility ObjectVisibility) error {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return err
+	}
+	return storage.SetVisibility(objectPath, visibility)
+}
+
+func (s *routedStorage) GetVisibility(objectPath string) (ObjectVisibility, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return storage.GetVisibility(objectPath)
+}
+
+func (s *routedStorage) GetACL(objectPath string) ([]Grant, error) {
+	storage, err := s.route(objectPath)
+	if err != nil {
+		return nil, err
+	}
+	return storage.GetACL(objectPath)
+}
+
+// Capabilities return features supported by every backend
+func (s *routedStorage) Capabilities() Capabilities {
+	backends := s.backends()
+	if len(backends) == 0 {
+		return Capabilities{}
+	}
+
+	capabilities := backends[0].Capabilities()
+	for _, storage := range backends[1:] {
+		other := storage.Capabilities()
+		capabilities.ResizeURL = capabilities.ResizeURL && other.ResizeURL
+		capabilities.Versioning = capabilities.Versioning && other.Versioning
+		capabilities.Tagging = capabilities.Tagging && other.Tagging
+		capabilities.PresignedUpload = capabilities.PresignedUpload && other.PresignedUpload
+		capabilities.Append = capabilities.Append && other.Append
+		capabilities.ConditionalWrite = capabilities.ConditionalWrite && other.ConditionalWrite
+	}
+	return capabilities
+}
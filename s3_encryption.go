@@ -0,0 +1,51 @@
+package gostorage
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Server side encryption algorithms of S3Encryption
+const (
+	S3EncryptionAES256  = "AES256"       // SSE-S3, keys managed by S3
+	S3EncryptionKMS     = "aws:kms"      // SSE-KMS
+	S3EncryptionDSSEKMS = "aws:kms:dsse" // DSSE-KMS, two layers of encryption with KMS keys
+)
+
+// S3Encryption configure server side encryption of objects written by S3 storage
+type S3Encryption struct {
+	Algorithm string // one of S3EncryptionAES256, S3EncryptionKMS and S3EncryptionDSSEKMS
+	KMSKeyID  string // KMS key of KMS algorithms, empty use the AWS managed key
+
+	// BucketKey use an S3 Bucket Key with SSE-KMS, so S3 request a data key from KMS per bucket
+	// instead of per object, cutting KMS requests and cost of high volume uploads. S3 don't support
+	// bucket keys with DSSE-KMS, it's ignored there.
+	BucketKey bool
+}
+
+// WithS3Encryption encrypt objects written by S3 storage, including multipart uploads, copies and
+// composed objects, instead of relying on the default encryption of the bucket
+func WithS3Encryption(encryption S3Encryption) Option {
+	return func(o *storageOptions) {
+		o.s3Encryption = &encryption
+	}
+}
+
+// s3EncryptionFields return server side encryption fields of S3 write requests, nil when not configured
+func (o storageOptions) s3EncryptionFields() (algorithm *string, kmsKeyID *string, bucketKey *bool) {
+	encryption := o.s3Encryption
+	if encryption == nil || encryption.Algorithm == "" {
+		return nil, nil, nil
+	}
+
+	algorithm = aws.String(encryption.Algorithm)
+	if encryption.Algorithm == S3EncryptionAES256 {
+		return algorithm, nil, nil
+	}
+	if encryption.KMSKeyID != "" {
+		kmsKeyID = aws.String(encryption.KMSKeyID)
+	}
+	if encryption.Algorithm == S3EncryptionKMS && encryption.BucketKey {
+		bucketKey = aws.Bool(true)
+	}
+	return algorithm, kmsKeyID, bucketKey
+}
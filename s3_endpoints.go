@@ -0,0 +1,185 @@
+package gostorage
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const defaultS3EndpointCooldown = 30 * time.Second
+
+// S3EndpointOptions configure failover between gateways of a self-hosted S3 compatible cluster
+type S3EndpointOptions struct {
+	// RoundRobin spread requests across healthy endpoints, by default the first healthy endpoint
+	// in the list serve every request and the others are only used on failure
+	RoundRobin bool
+
+	// Cooldown is how long an endpoint is skipped after a connection failure or a 502, 503 or 504
+	// response, default 30s. It's tried again by the next request after that.
+	Cooldown time.Duration
+
+	// OnStateChange is called when an endpoint is marked down or up again, it may be nil
+	OnStateChange func(endpoint string, healthy bool)
+}
+
+// WithS3Endpoints send requests of S3 storage to any of endpoints, e.g. gateways of a MinIO or Ceph
+// cluster, instead of the single configured endpoint. Failed requests are retried on another
+// endpoint by the SDK retries, so a gateway going down don't fail requests.
+func WithS3Endpoints(endpoints []string, options S3EndpointOptions) Option {
+	return func(o *storageOptions) {
+		o.s3Endpoints = endpoints
+		o.s3EndpointOptions = options
+	}
+}
+
+type s3Endpoint struct {
+	url       *url.URL
+	downUntil time.Time
+}
+
+// s3EndpointPool pick endpoint of each request attempt and track their health
+type s3EndpointPool struct {
+	mu        sync.Mutex
+	endpoints []*s3Endpoint
+	options   S3EndpointOptions
+	next      int
+}
+
+func newS3EndpointPool(endpoints []string, options S3EndpointOptions) (*s3EndpointPool, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("err S3 endpoints: at least one endpoint is required")
+	}
+	if options.Cooldown <= 0 {
+		options.Cooldown = defaultS3EndpointCooldown
+	}
+
+	pool := &s3EndpointPool{options: options}
+	for _, endpoint := range endpoints {
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		parsed, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+		if err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("err invalid S3 endpoint %s", endpoint)
+		}
+		pool.endpoints = append(pool.endpoints, &s3Endpoint{url: parsed})
+	}
+	return pool, nil
+}
+
+// pick return endpoint for a request attempt, when every endpoint is down the one coming back
+// first is used
+func (p *s3EndpointPool) pick() *url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	count := len(p.endpoints)
+	start := 0
+	if p.options.RoundRobin {
+		start = p.next
+		p.next = (p.next + 1) % count
+	}
+
+	var fallback *s3Endpoint
+	for i := 0; i < count; i++ {
+		endpoint := p.endpoints[(start+i)%count]
+		if !endpoint.downUntil.After(now) {
+			return endpoint.url
+		}
+		if fallback == nil || endpoint.downUntil.Before(fallback.downUntil) {
+			fallback = endpoint
+		}
+	}
+	return fallback.url
+}
+
+// mark record outcome of a request sent to host
+func (p *s3EndpointPool) mark(host string, healthy bool) {
+	p.mu.Lock()
+	var changed *s3Endpoint
+	for _, endpoint := range p.endpoints {
+		if endpoint.url.Host != host {
+			continue
+		}
+		wasHealthy := !endpoint.downUntil.After(time.Now())
+		if healthy {
+			if !endpoint.downUntil.IsZero() {
+				changed = endpoint
+			}
+			endpoint.downUntil = time.Time{}
+		} else {
+			if wasHealthy {
+				changed = endpoint
+			}
+			endpoint.downUntil = time.Now().Add(p.options.Cooldown)
+		}
+	}
+	p.mu.Unlock()
+
+	if changed != nil && p.options.OnStateChange != nil {
+		p.options.OnStateChange(changed.url.String(), healthy)
+	}
+}
+
+// s3EndpointHost return host of the endpoint a request was sent to, the bucket is dropped from
+// virtual hosted style hosts
+func s3EndpointHost(r *request.Request, bucketName string) string {
+	return strings.TrimPrefix(r.HTTPRequest.URL.Host, bucketName+".")
+}
+
+// useS3Endpoints route every request attempt through pool, the endpoint is set before signing so
+// the signature match the host the request is sent to
+func useS3Endpoints(handlers *request.Handlers, pool *s3EndpointPool, bucketName string) {
+	handlers.Sign.PushFrontNamed(request.NamedHandler{
+		Name: "gostorage.S3Endpoints",
+		Fn: func(r *request.Request) {
+			endpoint := pool.pick()
+			host := endpoint.Host
+			if strings.HasPrefix(r.HTTPRequest.URL.Host, bucketName+".") {
+				host = bucketName + "." + host
+			}
+			r.HTTPRequest.URL.Scheme = endpoint.Scheme
+			r.HTTPRequest.URL.Host = host
+			r.HTTPRequest.Host = ""
+		},
+	})
+	handlers.Retry.PushFrontNamed(request.NamedHandler{
+		Name: "gostorage.S3EndpointFailure",
+		Fn: func(r *request.Request) {
+			if isS3EndpointFailure(r) {
+				pool.mark(s3EndpointHost(r, bucketName), false)
+			}
+		},
+	})
+	handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "gostorage.S3EndpointSuccess",
+		Fn: func(r *request.Request) {
+			if r.HTTPResponse != nil && !isS3EndpointFailure(r) {
+				pool.mark(s3EndpointHost(r, bucketName), true)
+			}
+		},
+	})
+}
+
+// isS3EndpointFailure tell whether request failed because of the endpoint rather than the request,
+// connection failures and gateway errors are
+func isS3EndpointFailure(r *request.Request) bool {
+	if r.Error == nil {
+		return false
+	}
+	if r.HTTPResponse == nil || r.HTTPResponse.StatusCode == 0 {
+		// a canceled request say nothing about the endpoint
+		return r.Context().Err() == nil
+	}
+	switch r.HTTPResponse.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package gostorage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	s3ExpressBucketSuffix  = "--x-s3"
+	s3ExpressSigningName   = "s3express"
+	s3ExpressSessionHeader = "X-Amz-S3session-Token"
+	s3ExpressSessionWindow = time.Minute // renew session this long before it expires
+)
+
+// isS3ExpressBucket check whether bucketName is a directory bucket, e.g. "data--use1-az4--x-s3"
+func isS3ExpressBucket(bucketName string) bool {
+	return strings.HasSuffix(bucketName, s3ExpressBucketSuffix)
+}
+
+// s3ExpressEndpoint return zonal endpoint serving directory bucket
+func s3ExpressEndpoint(bucketName string, region string) (string, error) {
+	parts := strings.Split(strings.TrimSuffix(bucketName, s3ExpressBucketSuffix), "--")
+	if len(parts) < 2 || parts[len(parts)-1] == "" {
+		return "", fmt.Errorf("err invalid directory bucket name %s", bucketName)
+	}
+	return fmt.Sprintf("https://s3express-%s.%s.amazonaws.com", parts[len(parts)-1], region), nil
+}
+
+type createSessionResult struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"Credentials"`
+}
+
+// s3ExpressSessionProvider provide short lived session credentials of a directory bucket
+// obtained by CreateSession, signed with the long lived credentials
+type s3ExpressSessionProvider struct {
+	credentials.Expiry
+
+	mu         sync.Mutex
+	base       *credentials.Credentials
+	httpClient *http.Client
+	sessionURL string
+	region     string
+	token      string
+}
+
+func newS3ExpressSessionProvider(base *credentials.Credentials, endpoint string, bucketName string, region string, httpClient *http.Client) *s3ExpressSessionProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &s3ExpressSessionProvider{
+		base:       base,
+		httpClient: httpClient,
+		sessionURL: strings.Replace(endpoint, "://", "://"+bucketName+".", 1) + "/?session",
+		region:     region,
+	}
+}
+
+func (p *s3ExpressSessionProvider) Retrieve() (credentials.Value, error) {
+	req, err := http.NewRequest(http.MethodGet, p.sessionURL, nil)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if _, err := v4.NewSigner(p.base).Sign(req, nil, s3ExpressSigningName, p.region, time.Now()); err != nil {
+		return credentials.Value{}, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{}, fmt.Errorf("err creating directory bucket session: %d %s", resp.StatusCode, body)
+	}
+
+	var result createSessionResult
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.mu.Lock()
+	p.token = result.Credentials.SessionToken
+	p.mu.Unlock()
+	p.SetExpiration(result.Credentials.Expiration, s3ExpressSessionWindow)
+
+	// session token is sent in its own header instead of X-Amz-Security-Token
+	return credentials.Value{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		ProviderName:    "S3ExpressSessionProvider",
+	}, nil
+}
+
+func (p *s3ExpressSessionProvider) sessionToken() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.token
+}
+
+// useS3ExpressSession make svc sign requests as directory bucket requests using session credentials
+func useS3ExpressSession(svc *s3.S3, provider *s3ExpressSessionProvider) {
+	svc.Config.Credentials = credentials.NewCredentials(provider)
+	svc.ClientInfo.SigningName = s3ExpressSigningName
+	svc.Handlers.Sign.PushFront(func(r *request.Request) {
+		if _, err := r.Config.Credentials.Get(); err != nil {
+			r.Error = err
+			return
+		}
+		r.HTTPRequest.Header.Set(s3ExpressSessionHeader, provider.sessionToken())
+	})
+}
@@ -0,0 +1,591 @@
+package gostorage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3GatewayMaxKeys      = 1000
+	s3GatewayMaxClockSkew = 15 * time.Minute
+	s3GatewayMaxExpires   = 7 * 24 * time.Hour
+	s3GatewayTimeFormat   = "20060102T150405Z"
+	s3GatewayUnsigned     = "UNSIGNED-PAYLOAD"
+)
+
+// S3GatewayOptions configure NewS3Gateway
+type S3GatewayOptions struct {
+	Bucket      string            // bucket name clients must address
+	Region      string            // region clients sign for, default "us-east-1"
+	Credentials map[string]string // access key id to secret access key
+	Anonymous   bool              // accept unsigned requests, Credentials are ignored
+
+	// TokenSecret enable scoped tokens minted by MintScopedToken, a request carrying a token in
+	// X-Gostorage-Token header or query parameter is authorized by the token scope instead of signature
+	TokenSecret []byte
+
+	// Lister provide listings of ListObjectsV2, default to storage when it implements DirLister
+	Lister DirLister
+
+	Visibility ObjectVisibility // visibility of put objects without x-amz-acl, default private
+}
+
+type s3Gateway struct {
+	storage Storage
+	options S3GatewayOptions
+}
+
+// NewS3Gateway create http.Handler speaking a subset of the S3 API (GetObject, HeadObject, PutObject and
+// ListObjectsV2) with path style addressing on top of storage, requests are authenticated with
+// AWS signature v4 either in the Authorization header or presigned query parameters
+func NewS3Gateway(storage Storage, options S3GatewayOptions) http.Handler {
+	if options.Bucket == "" {
+		panic(fmt.Errorf("err S3 gateway require bucket"))
+	}
+	if !options.Anonymous && len(options.Credentials) == 0 && len(options.TokenSecret) == 0 {
+		panic(fmt.Errorf("err S3 gateway require credentials or token secret"))
+	}
+	if options.Region == "" {
+		options.Region = "us-east-1"
+	}
+	if options.Lister == nil {
+		options.Lister, _ = storage.(DirLister)
+	}
+	if options.Visibility == "" {
+		options.Visibility = ObjectPrivate
+	}
+
+	return &s3Gateway{
+		storage: storage,
+		options: options,
+	}
+}
+
+type s3GatewayError struct {
+	XMLName    xml.Name `xml:"Error"`
+	Code       string   `xml:"Code"`
+	Message    string   `xml:"Message"`
+	Resource   string   `xml:"Resource,omitempty"`
+	statusCode int
+}
+
+func (e *s3GatewayError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newS3GatewayError(statusCode int, code string, message string) *s3GatewayError {
+	return &s3GatewayError{Code: code, Message: message, statusCode: statusCode}
+}
+
+var (
+	errS3GatewayAccessDenied = newS3GatewayError(http.StatusForbidden, "AccessDenied", "Access Denied")
+	errS3GatewaySignature    = newS3GatewayError(http.StatusForbidden, "SignatureDoesNotMatch",
+		"The request signature we calculated does not match the signature you provided")
+	errS3GatewayNoSuchKey          = newS3GatewayError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	errS3GatewayPreconditionFailed = newS3GatewayError(http.StatusPreconditionFailed, "PreconditionFailed",
+		"At least one of the pre-conditions you specified did not hold")
+)
+
+func (g *s3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := g.serve(w, r); err != nil {
+		gatewayErr, ok := err.(*s3GatewayError)
+		if errors.Is(err, ErrTokenScope) || errors.Is(err, ErrTokenExpired) {
+			gatewayErr, ok = newS3GatewayError(http.StatusForbidden, "AccessDenied", err.Error()), true
+		}
+		if !ok {
+			gatewayErr = newS3GatewayError(http.StatusInternalServerError, "InternalError", err.Error())
+		}
+
+		resp := *gatewayErr
+		resp.Resource = r.URL.Path
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(resp.statusCode)
+		if r.Method != http.MethodHead {
+			_ = xml.NewEncoder(w).Encode(resp)
+		}
+	}
+}
+
+func (g *s3Gateway) serve(w http.ResponseWriter, r *http.Request) error {
+	storage := g.storage
+	var scope *TokenScope
+	if token := g.token(r); token != "" {
+		var err error
+		if scope, err = VerifyScopedToken(g.options.TokenSecret, token); err != nil {
+			return newS3GatewayError(http.StatusForbidden, "AccessDenied", err.Error())
+		}
+		storage = newScopedStorage(g.storage, *scope)
+	} else if !g.options.Anonymous {
+		if err := g.authenticate(r); err != nil {
+			return err
+		}
+	}
+
+	bucket, key := r.URL.Path, ""
+	bucket = strings.TrimPrefix(bucket, "/")
+	if slash := strings.Index(bucket, "/"); slash >= 0 {
+		bucket, key = bucket[:slash], bucket[slash+1:]
+	}
+	if bucket != g.options.Bucket {
+		return newS3GatewayError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		if scope != nil && !scope.Allow(OperationList, r.URL.Query().Get("prefix")) {
+			return errS3GatewayAccessDenied
+		}
+		return g.listObjectsV2(w, r)
+	case key != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		return g.getObject(w, r, storage, key)
+	case key != "" && r.Method == http.MethodPut:
+		return g.putObject(w, r, storage, key)
+	}
+	return newS3GatewayError(http.StatusNotImplemented, "NotImplemented", "A header or operation you provided implies functionality that is not implemented")
+}
+
+// token return scoped token of request when tokens are enabled
+func (g *s3Gateway) token(r *http.Request) string {
+	if len(g.options.TokenSecret) == 0 {
+		return ""
+	}
+	if token := r.Header.Get("X-Gostorage-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("x-gostorage-token")
+}
+
+func (g *s3Gateway) getObject(w http.ResponseWriter, r *http.Request, storage Storage, key string) error {
+	info, err := storage.Stat(key)
+	if errors.Is(err, ErrObjectNotExist) {
+		return errS3GatewayNoSuchKey
+	} else if err != nil {
+		return err
+	}
+
+	preconditions := RequestPreconditions(r)
+	if err := preconditions.evaluate(key, info, true, true); err != nil {
+		return g.preconditionError(w, info, err)
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if info.ETag != "" {
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+	}
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	// preconditions are passed to the backend too in case the object changed since Stat
+	reader, err := ReadWithOptions(storage, key, ReadOptions{Preconditions: preconditions})
+	if err != nil {
+		w.Header().Del("Content-Length")
+		return g.preconditionError(w, info, err)
+	}
+	defer reader.Close()
+
+	// headers are already sent, a failure can only abort the response
+	_, _ = io.Copy(w, reader)
+	return nil
+}
+
+// preconditionError answer not modified reads with 304 and failed preconditions with 412,
+// other errors are returned unchanged
+func (g *s3Gateway) preconditionError(w http.ResponseWriter, info ObjectInfo, err error) error {
+	switch {
+	case errors.Is(err, ErrNotModified):
+		if info.ETag != "" {
+			w.Header().Set("ETag", `"`+info.ETag+`"`)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	case errors.Is(err, ErrPreconditionFailed):
+		return errS3GatewayPreconditionFailed
+	}
+	return err
+}
+
+func (g *s3Gateway) putObject(w http.ResponseWriter, r *http.Request, storage Storage, key string) error {
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		return newS3GatewayError(http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported")
+	}
+
+	visibility := g.options.Visibility
+	switch r.Header.Get("X-Amz-Acl") {
+	case "private":
+		visibility = ObjectPrivate
+	case "public-read":
+		visibility = ObjectPublicRead
+	case "public-read-write":
+		visibility = ObjectPublicReadWrite
+	case "authenticated-read":
+		visibility = ObjectAuthenticatedRead
+	case "bucket-owner-full-control":
+		visibility = ObjectBucketOwnerFullControl
+	}
+
+	var body io.Reader = r.Body
+	contentHash := r.Header.Get("X-Amz-Content-Sha256")
+	if strings.HasPrefix(contentHash, "STREAMING-") {
+		return newS3GatewayError(http.StatusNotImplemented, "NotImplemented", "Chunked payload signing is not supported")
+	}
+	if !g.options.Anonymous && contentHash != "" && contentHash != s3GatewayUnsigned {
+		spooled, err := spoolVerifiedBody(r.Body, contentHash)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			spooled.Close()
+			os.Remove(spooled.Name())
+		}()
+		body = spooled
+	}
+
+	preconditions := RequestPreconditions(r)
+	err := storage.PutWithOptions(key, body, PutOptions{
+		Visibility:    visibility,
+		Preconditions: Preconditions{IfMatch: preconditions.IfMatch, IfNoneMatch: preconditions.IfNoneMatch},
+	})
+	if errors.Is(err, ErrPreconditionFailed) {
+		return errS3GatewayPreconditionFailed
+	} else if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// spoolVerifiedBody copy body into a temporary file while hashing it, so a body not matching
+// contentHash is rejected before the object is touched. The returned file is positioned at its start.
+func spoolVerifiedBody(body io.Reader, contentHash string) (*os.File, error) {
+	file, err := os.CreateTemp("", "s3-gateway-put-")
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hasher), body)
+	if err == nil && hex.EncodeToString(hasher.Sum(nil)) != contentHash {
+		err = newS3GatewayError(http.StatusBadRequest, "XAmzContentSHA256Mismatch",
+			"The provided 'x-amz-content-sha256' header does not match what was computed")
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+type s3GatewayObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3GatewayPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type s3GatewayListResult struct {
+	XMLName               xml.Name          `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	Delimiter             string            `xml:"Delimiter,omitempty"`
+	StartAfter            string            `xml:"StartAfter,omitempty"`
+	ContinuationToken     string            `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int               `xml:"KeyCount"`
+	MaxKeys               int               `xml:"MaxKeys"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	Contents              []s3GatewayObject `xml:"Contents"`
+	CommonPrefixes        []s3GatewayPrefix `xml:"CommonPrefixes"`
+}
+
+func (g *s3Gateway) listObjectsV2(w http.ResponseWriter, r *http.Request) error {
+	if g.options.Lister == nil {
+		return newS3GatewayError(http.StatusNotImplemented, "NotImplemented", "Listing is not supported by this storage")
+	}
+
+	query := r.URL.Query()
+	result := s3GatewayListResult{
+		Name:              g.options.Bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           s3GatewayMaxKeys,
+	}
+	if result.Delimiter != "" && result.Delimiter != "/" {
+		return newS3GatewayError(http.StatusNotImplemented, "NotImplemented", "Only \"/\" delimiter is supported")
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			return newS3GatewayError(http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+		}
+		if n < s3GatewayMaxKeys {
+			result.MaxKeys = n
+		}
+	}
+
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			return newS3GatewayError(http.StatusBadRequest, "InvalidArgument", "Invalid continuation token")
+		}
+		marker = string(token)
+	}
+
+	entries, err := g.listEntries(result.Prefix, result.Delimiter != "")
+	if err != nil {
+		return err
+	}
+
+	var lastKey string
+	for _, entry := range entries {
+		if entry.ObjectPath <= marker {
+			continue
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		result.KeyCount++
+		lastKey = entry.ObjectPath
+		if entry.commonPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3GatewayPrefix{Prefix: entry.ObjectPath})
+			continue
+		}
+		result.Contents = append(result.Contents, s3GatewayObject{
+			Key:          entry.ObjectPath,
+			LastModified: entry.LastModified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			Size:         entry.Size,
+			StorageClass: "STANDARD",
+		})
+	}
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(lastKey))
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = io.WriteString(w, xml.Header)
+	return xml.NewEncoder(w).Encode(result)
+}
+
+type s3GatewayEntry struct {
+	IndexedObject
+	commonPrefix bool
+}
+
+// listEntries return objects under prefix sorted by key, when delimited sub directories are
+// returned as common prefixes instead of being walked
+func (g *s3Gateway) listEntries(prefix string, delimited bool) ([]s3GatewayEntry, error) {
+	dir := ""
+	if slash := strings.LastIndex(prefix, "/"); slash >= 0 {
+		dir = prefix[:slash]
+	}
+
+	var entries []s3GatewayEntry
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		dirs, objects, err := g.options.Lister.ListDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, object := range objects {
+			if strings.HasPrefix(object.ObjectPath, prefix) {
+				entries = append(entries, s3GatewayEntry{IndexedObject: object})
+			}
+		}
+		for _, subDir := range dirs {
+			if !strings.HasPrefix(subDir, prefix) && !strings.HasPrefix(prefix, subDir) {
+				continue
+			}
+			if delimited && strings.HasPrefix(subDir, prefix) {
+				entries = append(entries, s3GatewayEntry{IndexedObject: IndexedObject{ObjectPath: subDir}, commonPrefix: true})
+				continue
+			}
+			if err := walk(strings.TrimSuffix(subDir, "/")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ObjectPath < entries[j].ObjectPath
+	})
+	return entries, nil
+}
+
+// authenticate verify AWS signature v4 of request
+func (g *s3Gateway) authenticate(r *http.Request) error {
+	query := r.URL.Query()
+	presigned := query.Get("X-Amz-Algorithm") != ""
+
+	var credential, signedHeaders, signature, amzDate, payloadHash string
+	if presigned {
+		if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+			return errS3GatewayAccessDenied
+		}
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		signature = query.Get("X-Amz-Signature")
+		amzDate = query.Get("X-Amz-Date")
+		payloadHash = s3GatewayUnsigned
+	} else {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+			return errS3GatewayAccessDenied
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch name {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				signature = value
+			}
+		}
+		amzDate = r.Header.Get("X-Amz-Date")
+		payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			payloadHash = s3GatewayUnsigned
+		}
+	}
+
+	signedAt, err := time.Parse(s3GatewayTimeFormat, amzDate)
+	if err != nil {
+		return errS3GatewayAccessDenied
+	}
+	if presigned {
+		expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+		if err != nil || expires < 0 || expires > int(s3GatewayMaxExpires/time.Second) {
+			return newS3GatewayError(http.StatusBadRequest, "AuthorizationQueryParametersError",
+				"X-Amz-Expires must be between 0 and 604800 seconds")
+		}
+		if time.Now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+			return newS3GatewayError(http.StatusForbidden, "AccessDenied", "Request has expired")
+		}
+	} else if skew := time.Since(signedAt); skew > s3GatewayMaxClockSkew || skew < -s3GatewayMaxClockSkew {
+		return newS3GatewayError(http.StatusForbidden, "RequestTimeTooSkewed",
+			"The difference between the request time and the server's time is too large")
+	}
+
+	// credential is <access key>/<date>/<region>/s3/aws4_request
+	scopeParts := strings.Split(credential, "/")
+	if len(scopeParts) != 5 || scopeParts[1] != amzDate[:8] || scopeParts[2] != g.options.Region ||
+		scopeParts[3] != "s3" || scopeParts[4] != "aws4_request" {
+		return errS3GatewayAccessDenied
+	}
+	secret, ok := g.options.Credentials[scopeParts[0]]
+	if !ok {
+		return newS3GatewayError(http.StatusForbidden, "InvalidAccessKeyId",
+			"The AWS Access Key Id you provided does not exist in our records")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		s3GatewayEscape(r.URL.Path, false),
+		s3GatewayCanonicalQuery(query),
+		s3GatewayCanonicalHeaders(r, signedHeaders),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join(scopeParts[1:], "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := []byte("AWS4" + secret)
+	for _, part := range append(scopeParts[1:], stringToSign) {
+		key = s3GatewayHMAC(key, part)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature)) {
+		return errS3GatewaySignature
+	}
+	return nil
+}
+
+func s3GatewayHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3GatewayEscape encode everything except unreserved characters as defined by signature v4,
+// slashes are kept unless encodeSlash is set
+func s3GatewayEscape(value string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			builder.WriteByte(c)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
+
+func s3GatewayCanonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		if key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, s3GatewayEscape(key, true)+"="+s3GatewayEscape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func s3GatewayCanonicalHeaders(r *http.Request, signedHeaders string) string {
+	var builder strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		default:
+			for _, value := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(value), " "))
+			}
+		}
+		builder.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+	return builder.String()
+}
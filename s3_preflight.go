@@ -0,0 +1,210 @@
+package gostorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+const preflightPrefix = ".gostorage-preflight"
+
+var _ Validator = (*storageS3)(nil)
+
+// Validator is implemented by storages able to check their configuration and permissions
+type Validator interface {
+	// Validate run every check and return the report, error is only returned when
+	// the checks themselves couldn't be run
+	Validate(ctx context.Context) (*PreflightReport, error)
+}
+
+// PreflightCheck is the result of checking a single permission
+type PreflightCheck struct {
+	Permission string   `json:"permission"` // e.g. s3:PutObject
+	Methods    []string `json:"methods"`    // storage methods requiring the permission
+	OK         bool     `json:"ok"`
+	Error      string   `json:"error,omitempty"`
+	Hint       string   `json:"hint,omitempty"`
+}
+
+// PreflightReport describe whether the storage is usable and what to fix if it's not
+type PreflightReport struct {
+	Bucket           string           `json:"bucket"`
+	Region           string           `json:"region"`        // configured region
+	BucketRegion     string           `json:"bucket_region"` // actual region of the bucket
+	BucketExists     bool             `json:"bucket_exists"`
+	BucketAccessible bool             `json:"bucket_accessible"`
+	Checks           []PreflightCheck `json:"checks"`
+}
+
+// OK return whether every check passed
+func (r *PreflightReport) OK() bool {
+	if !r.BucketExists || !r.BucketAccessible || r.BucketRegion != r.Region {
+		return false
+	}
+	for _, check := range r.Checks {
+		if !check.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// Err summarize failed checks into a single error, nil when every check passed
+func (r *PreflightReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+
+	var problems []string
+	switch {
+	case !r.BucketExists:
+		problems = append(problems, fmt.Sprintf("bucket %s does not exist", r.Bucket))
+	case r.BucketRegion != "" && r.BucketRegion != r.Region:
+		problems = append(problems, fmt.Sprintf("bucket %s is in region %s but storage is configured with %s", r.Bucket, r.BucketRegion, r.Region))
+	case !r.BucketAccessible:
+		problems = append(problems, fmt.Sprintf("bucket %s is not accessible, check s3:ListBucket permission and bucket policy", r.Bucket))
+	}
+	for _, check := range r.Checks {
+		if !check.OK {
+			problems = append(problems, fmt.Sprintf("%s (needed by %s): %s", check.Permission, strings.Join(check.Methods, ", "), check.Hint))
+		}
+	}
+	return fmt.Errorf("err storage preflight failed: %s", strings.Join(problems, "; "))
+}
+
+// Validate check bucket existence, region and every IAM permission used by the storage
+// by exercising them on a temporary object under ".gostorage-preflight/"
+func (s *storageS3) Validate(ctx context.Context) (*PreflightReport, error) {
+	ctx, cancel := s.options.operationContext(ctx, operationMetadata)
+	defer cancel()
+
+	report := &PreflightReport{
+		Bucket: s.bucketName,
+		Region: aws.StringValue(s.awsSession.Config.Region),
+	}
+
+	bucketRegion, err := s3manager.GetBucketRegionWithClient(ctx, s.s3, s.bucketName)
+	if err != nil {
+		var aerr awserr.Error
+		if errors.As(err, &aerr) && aerr.Code() == "NotFound" {
+			return report, nil
+		}
+		return nil, err
+	}
+	report.BucketExists = true
+	report.BucketRegion = bucketRegion
+	if bucketRegion != report.Region {
+		return report, nil
+	}
+
+	_, err = s.s3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: &s.bucketName})
+	report.BucketAccessible = err == nil
+	if err != nil {
+		return report, nil
+	}
+
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+	key := path.Join(preflightPrefix, id)
+	copyKey := key + ".copy"
+	missingKey := key + ".missing"
+
+	checks := []struct {
+		permission string
+		methods    []string
+		run        func() error
+	}{
+		{"s3:PutObject", []string{"Put", "PutResumable", "Compose"}, func() error {
+			input := &s3.PutObjectInput{
+				Bucket: &s.bucketName,
+				Key:    &key,
+				Body:   bytes.NewReader([]byte("preflight")),
+			}
+			input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+			_, err := s.s3.PutObjectWithContext(ctx, input)
+			return err
+		}},
+		{"s3:GetObject", []string{"Read", "Size", "LastModified", "Exist"}, func() error {
+			output, err := s.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: &s.bucketName, Key: &key})
+			if err != nil {
+				return err
+			}
+			return output.Body.Close()
+		}},
+		{"s3:ListBucket", []string{"Exist"}, func() error {
+			// without ListBucket, HEAD of a missing key return 403 instead of 404
+			exist, err := s.keyExists(missingKey)
+			if err == nil && exist {
+				return fmt.Errorf("unexpected object %s", missingKey)
+			}
+			return err
+		}},
+		{"s3:PutObjectAcl", []string{"SetVisibility"}, func() error {
+			_, err := s.s3.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+				Bucket: &s.bucketName,
+				Key:    &key,
+				ACL:    aws.String(s3.ObjectCannedACLPrivate),
+			})
+			return err
+		}},
+		{"s3:GetObjectAcl", []string{"GetVisibility", "GetACL"}, func() error {
+			_, err := s.s3.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{Bucket: &s.bucketName, Key: &key})
+			return err
+		}},
+		{"s3:PutObject (copy)", []string{"Copy", "Compose"}, func() error {
+			input := &s3.CopyObjectInput{
+				Bucket:     &s.bucketName,
+				Key:        &copyKey,
+				CopySource: aws.String(s3CopySource(s.bucketName, key)),
+			}
+			input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+			_, err := s.s3.CopyObjectWithContext(ctx, input)
+			return err
+		}},
+		{"s3:DeleteObject", []string{"Delete"}, func() error {
+			_, err := s.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket: &s.bucketName,
+				Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: &key}, {Key: &copyKey}}},
+			})
+			return err
+		}},
+	}
+
+	for _, check := range checks {
+		result := PreflightCheck{Permission: check.permission, Methods: check.methods, OK: true}
+		if err := check.run(); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+			result.Hint = preflightHint(check.permission, err)
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report, nil
+}
+
+func preflightHint(permission string, err error) string {
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return "request failed, check connectivity to the endpoint"
+	}
+
+	switch {
+	case reqErr.StatusCode() == http.StatusForbidden:
+		return fmt.Sprintf("access denied, grant %s on the bucket to the configured credentials", strings.TrimSuffix(permission, " (copy)"))
+	case reqErr.Code() == "AccessControlListNotSupported":
+		return "bucket has object ownership enforced, use WithoutACL"
+	default:
+		return fmt.Sprintf("unexpected %d %s", reqErr.StatusCode(), reqErr.Code())
+	}
+}
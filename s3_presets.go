@@ -0,0 +1,212 @@
+package gostorage
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// S3Preset describe how to talk to an S3 compatible provider, Endpoint and PublicURL
+// may contain {region} and {bucket} placeholders, PublicURL may also contain {endpoint}
+type S3Preset struct {
+	Name          string
+	Endpoint      string // empty means endpoint must be given in S3Credentials
+	DefaultRegion string
+	PathStyle     bool   // provider doesn't support virtual hosted bucket addressing
+	PublicURL     string // base URL of public objects, default "{endpoint}/{bucket}"
+	NoACL         bool   // provider doesn't support object ACLs
+}
+
+// S3Credentials is account specific configuration of an S3 compatible provider
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string // preset default region is used when empty
+	Endpoint        string // override preset endpoint
+}
+
+var (
+	s3PresetsMu sync.RWMutex
+	s3Presets   = map[string]S3Preset{
+		"wasabi": {
+			Name:          "wasabi",
+			Endpoint:      "https://s3.{region}.wasabisys.com",
+			DefaultRegion: "us-east-1",
+			PublicURL:     "https://s3.{region}.wasabisys.com/{bucket}",
+		},
+		"storj": {
+			Name:          "storj",
+			Endpoint:      "https://gateway.storjshare.io",
+			DefaultRegion: "us-1",
+			PathStyle:     true,
+			NoACL:         true,
+		},
+		"scaleway": {
+			Name:          "scaleway",
+			Endpoint:      "https://s3.{region}.scw.cloud",
+			DefaultRegion: "fr-par",
+			PublicURL:     "https://{bucket}.s3.{region}.scw.cloud",
+		},
+		"linode": {
+			Name:          "linode",
+			Endpoint:      "https://{region}.linodeobjects.com",
+			DefaultRegion: "us-east-1",
+			PublicURL:     "https://{bucket}.{region}.linodeobjects.com",
+		},
+		"idrive-e2": {
+			Name:          "idrive-e2",
+			DefaultRegion: "us-east-1",
+			PathStyle:     true,
+		},
+		"minio": {
+			Name:          "minio",
+			DefaultRegion: "us-east-1",
+			PathStyle:     true,
+			NoACL:         true,
+		},
+		"ceph": {
+			Name:          "ceph",
+			DefaultRegion: "us-east-1",
+			PathStyle:     true,
+		},
+		"localstack": {
+			Name:          "localstack",
+			Endpoint:      "http://localhost:4566",
+			DefaultRegion: "us-east-1",
+			PathStyle:     true,
+		},
+	}
+)
+
+// RegisterS3Preset add or replace preset, so NewS3CompatibleStorage can use it by name
+func RegisterS3Preset(preset S3Preset) {
+	s3PresetsMu.Lock()
+	defer s3PresetsMu.Unlock()
+	s3Presets[preset.Name] = preset
+}
+
+// LookupS3Preset return registered preset by name
+func LookupS3Preset(name string) (S3Preset, bool) {
+	s3PresetsMu.RLock()
+	defer s3PresetsMu.RUnlock()
+	preset, ok := s3Presets[name]
+	return preset, ok
+}
+
+// S3PresetNames return sorted names of registered presets
+func S3PresetNames() []string {
+	s3PresetsMu.RLock()
+	defer s3PresetsMu.RUnlock()
+
+	names := make([]string, 0, len(s3Presets))
+	for name := range s3Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewS3CompatibleStorage create storage backed by an S3 compatible provider using a registered
+// preset, e.g. "wasabi", "storj", "scaleway", "linode", "idrive-e2", "minio", "ceph" or "localstack"
+func NewS3CompatibleStorage(presetName string, creds S3Credentials, bucketName string, opts ...Option) Storage {
+	preset, ok := LookupS3Preset(presetName)
+	if !ok {
+		panic(fmt.Errorf("err unknown S3 preset %s", presetName))
+	}
+
+	region := creds.Region
+	if region == "" {
+		region = preset.DefaultRegion
+	}
+
+	endpoint := creds.Endpoint
+	if endpoint == "" {
+		endpoint = preset.Endpoint
+	}
+	if endpoint == "" {
+		panic(fmt.Errorf("err S3 preset %s require endpoint", presetName))
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	replacer := strings.NewReplacer("{region}", region, "{bucket}", bucketName)
+	endpoint = strings.TrimSuffix(replacer.Replace(endpoint), "/")
+
+	publicURL := preset.PublicURL
+	if publicURL == "" || creds.Endpoint != "" {
+		publicURL = "{endpoint}/{bucket}"
+	}
+	publicURL = strings.NewReplacer("{endpoint}", endpoint, "{region}", region, "{bucket}", bucketName).Replace(publicURL)
+
+	if preset.NoACL {
+		// copy opts, appending could write into the backing array of the caller
+		opts = append(append([]Option{}, opts...), WithoutACL())
+	}
+	options := newStorageOptions(opts)
+
+	config := &aws.Config{
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String(region),
+		Credentials:      credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken),
+		S3ForcePathStyle: aws.Bool(preset.PathStyle),
+	}
+	return newS3Storage(bucketName, config, publicURL, options)
+}
+
+// WithS3Endpoint make AWS S3 storage talk to endpoint instead of amazonaws.com, e.g. MinIO, Ceph RGW
+// or LocalStack. pathStyle address buckets as "<endpoint>/<bucket>" instead of "<bucket>.<endpoint>",
+// most self-hosted servers require it. URL build links on endpoint the same way.
+func WithS3Endpoint(endpoint string, pathStyle bool) Option {
+	return func(o *storageOptions) {
+		o.s3Endpoint = endpoint
+		o.s3PathStyle = pathStyle
+	}
+}
+
+// WithS3InsecureSkipVerify disable TLS certificate verification of S3 requests, for self-signed
+// certificates of development and test clusters only
+func WithS3InsecureSkipVerify() Option {
+	return func(o *storageOptions) {
+		o.s3InsecureSkipVerify = true
+	}
+}
+
+// s3PublicURL return base URL of objects of bucketName served by endpoint
+func s3PublicURL(endpoint string, bucketName string, pathStyle bool) (string, error) {
+	if pathStyle {
+		return endpoint + "/" + bucketName, nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("err invalid S3 endpoint %s: %w", endpoint, err)
+	}
+	parsed.Host = bucketName + "." + parsed.Host
+	return strings.TrimSuffix(parsed.String(), "/"), nil
+}
+
+// s3HTTPClient return client of S3 requests honoring debug and TLS options, nil when the default will do
+func (o storageOptions) s3HTTPClient() *http.Client {
+	if !o.debug && !o.s3InsecureSkipVerify {
+		return nil
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	if o.s3InsecureSkipVerify {
+		insecure := http.DefaultTransport.(*http.Transport).Clone()
+		insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		transport = insecure
+	}
+	if o.debug {
+		transport = &debugTransport{name: "S3", logger: o.logger, next: transport}
+	}
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,374 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSchedulerLockTTL = 5 * time.Minute
+
+// Schedule compute the next run time of a job
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parse a cron expression with 5 fields (minute hour day-of-month month day-of-week,
+// each supporting "*", "*/n", "a-b", "a-b/n" and comma separated lists, evaluated in UTC),
+// or one of the descriptors "@hourly", "@daily", "@weekly", "@monthly" and "@every <duration>"
+func ParseSchedule(expression string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	switch expression {
+	case "@hourly":
+		expression = "0 * * * *"
+	case "@daily", "@midnight":
+		expression = "0 0 * * *"
+	case "@weekly":
+		expression = "0 0 * * 0"
+	case "@monthly":
+		expression = "0 0 1 * *"
+	}
+
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimPrefix(expression, "@every "))
+		if err != nil {
+			return nil, fmt.Errorf("err invalid schedule %s: %s", expression, err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("err invalid schedule %s: interval must be positive", expression)
+		}
+		return everySchedule(interval), nil
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("err invalid schedule %s: expected 5 fields", expression)
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("err invalid schedule %s: %s", expression, err)
+		}
+		sets[i] = set
+	}
+
+	return &cronSchedule{
+		minute:     sets[0],
+		hour:       sets[1],
+		dayOfMonth: sets[2],
+		month:      sets[3],
+		dayOfWeek:  sets[4],
+		anyDom:     fields[2] == "*",
+		anyDow:     fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.Index(part, "/"); slash >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[slash+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %s", part)
+			}
+			part = part[:slash]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %s", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %s", part)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("value %s out of range %d-%d", part, min, max)
+		}
+		for value := from; value <= to; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	anyDom, anyDow                             bool
+}
+
+func (s *cronSchedule) matchDay(t time.Time) bool {
+	domMatch := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	// like cron, when both day fields are restricted either of them may match
+	if !s.anyDom && !s.anyDow {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// give up after 5 years, the expression can never match (e.g. 30th of February)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// ScheduledJob is a unit of work run by the Scheduler, usually a sync or snapshot of storage
+type ScheduledJob struct {
+	Name       string
+	Schedule   string // see ParseSchedule
+	Run        func(ctx context.Context) error
+	Retries    int           // additional attempts after a failed run
+	RetryDelay time.Duration // wait between attempts
+
+	// Bandwidth throttle transfers of the job, it's set on the run context, see BandwidthFromContext
+	Bandwidth *BandwidthLimiter
+}
+
+// JobResult is reported after every scheduled or manual run of a job
+type JobResult struct {
+	Name       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Attempts   int
+	Skipped    bool // another run of the job was still holding the lock
+	Err        error
+}
+
+type scheduledJob struct {
+	ScheduledJob
+	schedule Schedule
+}
+
+// Scheduler run jobs on their schedules, every run hold an object lock in storage so
+// overlapping runs, even from other processes sharing the storage, are skipped
+type Scheduler struct {
+	mu         sync.Mutex
+	storage    Storage
+	lockPrefix string
+	lockTTL    time.Duration
+	jobs       map[string]*scheduledJob
+	onResult   []func(JobResult)
+	logger     Logger
+}
+
+// NewScheduler create scheduler keeping job locks under lockPrefix of storage, only logger options are used
+func NewScheduler(storage Storage, lockPrefix string, opts ...Option) *Scheduler {
+	return &Scheduler{
+		storage:    storage,
+		lockPrefix: lockPrefix,
+		lockTTL:    defaultSchedulerLockTTL,
+		jobs:       make(map[string]*scheduledJob),
+		logger:     newStorageOptions(opts).logger,
+	}
+}
+
+// SetLockTTL change the lease of job locks, locks are renewed while the job is running so
+// ttl only bound how long a crashed run block the next ones
+func (s *Scheduler) SetLockTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockTTL = ttl
+}
+
+// OnResult register hook called after every run
+func (s *Scheduler) OnResult(hook func(JobResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onResult = append(s.onResult, hook)
+}
+
+// AddJob register job, it must be added before Run is called
+func (s *Scheduler) AddJob(job ScheduledJob) error {
+	if job.Name == "" || job.Run == nil {
+		return fmt.Errorf("err invalid job: name and run are required")
+	}
+
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("err job %s already exists", job.Name)
+	}
+	s.jobs[job.Name] = &scheduledJob{ScheduledJob: job, schedule: schedule}
+	return nil
+}
+
+// Run block running jobs on their schedules until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := make([]*scheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *scheduledJob) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+// RunNow run job immediately regardless of its schedule
+func (s *Scheduler) RunNow(ctx context.Context, name string) (JobResult, error) {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return JobResult{}, fmt.Errorf("err job %s not found", name)
+	}
+	return s.run(ctx, job), nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *scheduledJob) {
+	for {
+		next := job.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Debugf("[Scheduler] job %s will never run again\n", job.Name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.run(ctx, job)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job *scheduledJob) JobResult {
+	s.mu.Lock()
+	ttl := s.lockTTL
+	s.mu.Unlock()
+
+	result := JobResult{Name: job.Name, StartedAt: time.Now()}
+	lock, err := AcquireObjectLock(s.storage, path.Join(s.lockPrefix, job.Name), ttl)
+	if err != nil {
+		result.Skipped = err == ErrLockHeld
+		if !result.Skipped {
+			result.Err = err
+		}
+		result.FinishedAt = time.Now()
+		s.report(result)
+		return result
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	if job.Bandwidth != nil {
+		runCtx = ContextWithBandwidth(runCtx, job.Bandwidth)
+	}
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		s.renewLock(runCtx, cancel, lock, ttl)
+	}()
+
+	for result.Attempts = 1; ; result.Attempts++ {
+		result.Err = job.Run(runCtx)
+		if result.Err == nil || result.Attempts > job.Retries || runCtx.Err() != nil {
+			break
+		}
+
+		s.logger.Debugf("[Scheduler] job %s attempt %d failed: %s\n", job.Name, result.Attempts, result.Err)
+		select {
+		case <-runCtx.Done():
+		case <-time.After(job.RetryDelay):
+		}
+	}
+
+	cancel()
+	<-renewDone
+	if err := lock.Release(); err != nil && result.Err == nil {
+		result.Err = err
+	}
+
+	result.FinishedAt = time.Now()
+	s.report(result)
+	return result
+}
+
+// renewLock keep the lease alive while the job is running, the job is cancelled when the lock is lost
+func (s *Scheduler) renewLock(ctx context.Context, cancel context.CancelFunc, lock *ObjectLock, ttl time.Duration) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lock.Renew(ttl); err != nil {
+				s.logger.Debugf("[Scheduler] error renewing lock: %s\n", err)
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (s *Scheduler) report(result JobResult) {
+	s.mu.Lock()
+	hooks := append([]func(JobResult){}, s.onResult...)
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook(result)
+	}
+}
@@ -0,0 +1,47 @@
+package gostorage
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	_ SignedURLStorage = (*storageS3)(nil)
+	_ SignedURLStorage = (*storageAlibabaOSS)(nil)
+)
+
+// ErrSignedURLOptionsUnsupported is returned when signing query parameters or headers
+// is requested from a storage which can't sign them
+var ErrSignedURLOptionsUnsupported = errors.New("storage doesn't support signed URL options")
+
+// SignedURLOptions customize URL created by TemporaryURLWithOptions
+type SignedURLOptions struct {
+	Resize *StorageResize
+
+	// Query is added to the URL and covered by the signature where the backend signs it,
+	// e.g. "versionId", "response-content-disposition" or OSS "x-oss-process"
+	Query map[string]string
+
+	// Headers must be sent with exactly these values by whoever use the URL
+	Headers map[string]string
+}
+
+// SignedURLStorage is implemented by storages able to sign custom query parameters and headers
+type SignedURLStorage interface {
+	Storage
+
+	// TemporaryURLWithOptions behave like TemporaryURL and additionally sign options
+	TemporaryURLWithOptions(objectPath string, expireIn time.Duration, options SignedURLOptions) (string, error)
+}
+
+// TemporaryURLWithOptions create temporary URL signing custom query parameters and headers,
+// storages without support fail with ErrSignedURLOptionsUnsupported unless there are none
+func TemporaryURLWithOptions(storage Storage, objectPath string, expireIn time.Duration, options SignedURLOptions) (string, error) {
+	if signer, ok := storage.(SignedURLStorage); ok {
+		return signer.TemporaryURLWithOptions(objectPath, expireIn, options)
+	}
+	if len(options.Query) > 0 || len(options.Headers) > 0 {
+		return "", ErrSignedURLOptionsUnsupported
+	}
+	return storage.TemporaryURL(objectPath, expireIn, options.Resize)
+}
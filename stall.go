@@ -0,0 +1,186 @@
+package gostorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// ErrStreamStalled returned when a stream transferred no bytes for the timeout set by WithStallTimeout
+var ErrStreamStalled = errors.New("stream stalled")
+
+// WithStallTimeout abort reads and uploads of S3 and OSS which transfer no bytes for timeout,
+// independently of operation timeouts, so a dead connection is dropped early. Aborted streams return
+// ErrStreamStalled. Time spent by callers between Read calls doesn't count, time spent waiting for
+// data of a Put source does.
+func WithStallTimeout(timeout time.Duration) Option {
+	return func(o *storageOptions) {
+		o.stallTimeout = timeout
+	}
+}
+
+// stallReader close reader when a Read call get no bytes for timeout, unblocking it
+type stallReader struct {
+	io.ReadCloser
+	timeout time.Duration
+	stalled atomic.Bool
+}
+
+// stallReader wrap reader with stall detection when enabled
+func (o storageOptions) stallReader(reader io.ReadCloser) io.ReadCloser {
+	if o.stallTimeout <= 0 {
+		return reader
+	}
+	return &stallReader{ReadCloser: reader, timeout: o.stallTimeout}
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.stalled.Load() {
+		return 0, r.err()
+	}
+
+	timer := time.AfterFunc(r.timeout, func() {
+		r.stalled.Store(true)
+		_ = r.ReadCloser.Close()
+	})
+	n, err := r.ReadCloser.Read(p)
+	if !timer.Stop() && r.stalled.Load() {
+		return n, r.err()
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	if r.stalled.Load() {
+		return nil
+	}
+	return r.ReadCloser.Close()
+}
+
+func (r *stallReader) err() error {
+	return fmt.Errorf("%w: no bytes read for %s", ErrStreamStalled, r.timeout)
+}
+
+// stallGuard cancel context of an upload when it makes no progress for timeout,
+// progress is reported by touch. Nil guard is disabled.
+type stallGuard struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	timeout time.Duration
+	stalled bool
+	cancel  context.CancelFunc
+}
+
+// stallContext derive context cancelled by returned guard when upload stall, guard is nil when disabled
+func (o storageOptions) stallContext(ctx context.Context) (context.Context, *stallGuard) {
+	if o.stallTimeout <= 0 {
+		return ctx, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	g := &stallGuard{timeout: o.stallTimeout, cancel: cancel}
+	g.timer = time.AfterFunc(o.stallTimeout, func() {
+		g.mu.Lock()
+		g.stalled = true
+		g.mu.Unlock()
+		cancel()
+	})
+	return ctx, g
+}
+
+func (g *stallGuard) touch() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.stalled {
+		g.timer.Reset(g.timeout)
+	}
+}
+
+// stop release the guard once the upload finished
+func (g *stallGuard) stop() {
+	if g == nil {
+		return
+	}
+	g.timer.Stop()
+	g.cancel()
+}
+
+// err return ErrStreamStalled wrapping err of an upload aborted by the guard
+func (g *stallGuard) err(err error) error {
+	if g == nil || err == nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.stalled {
+		return err
+	}
+	return fmt.Errorf("%w: no bytes transferred for %s: %s", ErrStreamStalled, g.timeout, err)
+}
+
+// reader report progress of reads from source
+func (g *stallGuard) reader(source io.Reader) io.Reader {
+	if g == nil {
+		return source
+	}
+	return &progressReader{Reader: source, guard: g}
+}
+
+// requestOptions report progress of sending request body of AWS SDK requests
+func (g *stallGuard) requestOptions() []request.Option {
+	if g == nil {
+		return nil
+	}
+	return []request.Option{func(r *request.Request) {
+		r.Handlers.Build.PushBack(func(r *request.Request) {
+			if r.Body != nil {
+				r.SetReaderBody(&progressReadSeeker{ReadSeeker: r.Body, guard: g})
+			}
+		})
+	}}
+}
+
+type progressReader struct {
+	io.Reader
+	guard *stallGuard
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.guard.touch()
+	}
+	return n, err
+}
+
+type progressReadSeeker struct {
+	io.ReadSeeker
+	guard *stallGuard
+}
+
+func (r *progressReadSeeker) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	if n > 0 {
+		r.guard.touch()
+	}
+	return n, err
+}
+
+// stallError match connection timeouts of SDKs enforcing the stall timeout themselves with ErrStreamStalled
+func (o storageOptions) stallError(err error) error {
+	var netErr net.Error
+	if o.stallTimeout > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+		return withSentinel(ErrStreamStalled, err)
+	}
+	return err
+}
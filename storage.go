@@ -1,6 +1,7 @@
 package gostorage
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"time"
@@ -12,8 +13,52 @@ const (
 	ObjectPrivate         ObjectVisibility = "private"
 	ObjectPublicReadWrite ObjectVisibility = "public-read-write"
 	ObjectPublicRead      ObjectVisibility = "public-read"
+
+	// ObjectAuthenticatedRead grant read to any authenticated user of the backend, not supported by OSS.
+	// Local storage doesn't publish such objects, they're only served by temporary URLs.
+	ObjectAuthenticatedRead ObjectVisibility = "authenticated-read"
+
+	// ObjectBucketOwnerFullControl grant full control to the bucket owner, for objects uploaded to
+	// buckets of another account. OSS and local storage treat it as private, their objects always
+	// belong to the bucket owner.
+	ObjectBucketOwnerFullControl ObjectVisibility = "bucket-owner-full-control"
+
+	// ObjectVisibilityInherit send no ACL/visibility at all, object follow the default policy of the bucket
+	ObjectVisibilityInherit ObjectVisibility = "inherit"
+)
+
+type GranteeType string
+
+const (
+	GranteeCanonicalUser GranteeType = "canonical-user"
+	GranteeEmail         GranteeType = "email"
+	GranteeGroup         GranteeType = "group"
+)
+
+type GrantPermission string
+
+const (
+	PermissionFullControl GrantPermission = "FULL_CONTROL"
+	PermissionRead        GrantPermission = "READ"
+	PermissionWrite       GrantPermission = "WRITE"
+	PermissionReadACP     GrantPermission = "READ_ACP"
+	PermissionWriteACP    GrantPermission = "WRITE_ACP"
 )
 
+// GroupAllUsers is grantee URI representing everyone (anonymous access)
+const GroupAllUsers = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// GroupAuthenticatedUsers is grantee URI representing any authenticated user of the backend
+const GroupAuthenticatedUsers = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+
+// Grant is a single access control entry of an object
+type Grant struct {
+	GranteeType GranteeType     `json:"grantee_type"`
+	GranteeID   string          `json:"grantee_id,omitempty"`  // canonical user id or email address
+	GranteeURI  string          `json:"grantee_uri,omitempty"` // group uri
+	Permission  GrantPermission `json:"permission"`
+}
+
 type StorageResize struct {
 	MaxHeight *int `json:"max_height"` // in px
 }
@@ -31,40 +76,133 @@ func (s *StorageResize) ConvertForOss() string {
 	return result
 }
 
+// ObjectInfo describe a stored object, fields the backend doesn't report are left empty
+type ObjectInfo struct {
+	ObjectPath   string           `json:"object_path"`
+	Size         int64            `json:"size"`
+	LastModified time.Time        `json:"last_modified"`
+	ContentType  string           `json:"content_type,omitempty"`
+	ETag         string           `json:"etag,omitempty"`       // without quotes, sha256 hex on local storage
+	Visibility   ObjectVisibility `json:"visibility,omitempty"` // only reported by local storage, S3 and OSS need GetVisibility
+}
+
+// Capabilities describe which optional features are supported by a storage implementation,
+// generic code should check it before relying on a feature instead of failing at runtime
+type Capabilities struct {
+	ResizeURL       bool `json:"resize_url"`       // URL and TemporaryURL honor StorageResize
+	Versioning      bool `json:"versioning"`       // backend can keep multiple versions of an object
+	Tagging         bool `json:"tagging"`          // backend can attach key/value tags to an object
+	PresignedUpload bool `json:"presigned_upload"` // backend can sign URLs for uploading directly
+	Append          bool `json:"append"`           // backend can append data to an existing object
+	LegalHold       bool `json:"legal_hold"`       // backend can place objects under legal hold, see LegalHoldStorage
+
+	// ConditionalWrite report PutWithOptions evaluate IfMatch and IfNoneMatch atomically with the
+	// write, local storage only within the process
+	ConditionalWrite bool `json:"conditional_write"`
+}
+
 // Storage is an abstraction for persistence storage mechanism,
 // remember that all object path used here should be specified
 // relative to the root location configured for each implementation
 type Storage interface {
+	// Connect validate configuration and connectivity to the backend
+	Connect(ctx context.Context) error
+
+	// Ping check credentials and reachability of the bucket or base directory without side effects,
+	// e.g. for readiness probes
+	Ping(ctx context.Context) error
+
 	// Read return reader to stream data from source
 	Read(objectPath string) (io.ReadCloser, error)
 
+	// ReadRange read length bytes starting at offset, negative length read until the end of the object.
+	// It uses HTTP Range requests on S3 and OSS and seeks local files.
+	ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error)
+
 	// Put store source stream into
 	Put(objectPath string, source io.Reader, visibility ObjectVisibility) error
 
+	// Writer return writer streaming data into object, committed on Close and discarded on CloseWithError
+	Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error)
+
+	// PutWithOptions behave like Put and additionally store headers and user metadata with the object
+	PutWithOptions(objectPath string, source io.Reader, options PutOptions) error
+
+	// GetMetadata return headers and user metadata of object
+	GetMetadata(objectPath string) (ObjectMetadata, error)
+
+	// SetMetadata replace headers and user metadata of object, keeping its content and visibility
+	SetMetadata(objectPath string, metadata ObjectMetadata) error
+
+	// Touch create an empty private object, or bump last modified time of an existing object keeping
+	// its content, metadata and visibility, e.g. for marker files
+	Touch(objectPath string) error
+
 	// Delete object by objectPath
 	Delete(objectPaths ...string) error
 
+	// DeletePrefix delete every object whose path start with prefix, empty prefix is rejected.
+	// Use CountPrefix to know how many objects would be deleted.
+	DeletePrefix(prefix string) error
+
 	// URL return object url
 	URL(objectPath string, storageResize *StorageResize) (string, error)
 
 	// TemporaryURL give temporary access to an object using returned signed url
 	TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error)
 
+	// TemporaryURLs sign many object paths at once, return map of object path to signed url
+	TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error)
+
 	// Copy source to destination
 	Copy(srcObjectPath string, dstObjectPath string) error
 
+	// CopyPrefix copy every object under srcPrefix to the same relative path under dstPrefix,
+	// destination inside of source is rejected
+	CopyPrefix(srcPrefix string, dstPrefix string) error
+
+	// Move rename object keeping its content, metadata and visibility
+	Move(srcObjectPath string, dstObjectPath string) error
+
+	// Compose merge source objects back-to-back into destination, server-side where supported
+	Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error
+
 	// Size return object size
 	Size(objectPath string) (int64, error)
 
 	// LastModified 	return last modified time of object
 	LastModified(objectPath string) (time.Time, error)
 
+	// Stat return size, last modified time, content type, ETag and visibility of object using a single backend call
+	Stat(objectPath string) (ObjectInfo, error)
+
+	// MimeType return content type of object, stored with the object on S3 and OSS and sniffed from
+	// its first 512 bytes on local storage
+	MimeType(objectPath string) (string, error)
+
+	// Checksum return checksum of object using algo, taken from object metadata where the backend
+	// report it and computed by streaming the object otherwise
+	Checksum(objectPath string, algo ChecksumAlgo) (string, error)
+
 	// Exist check whether object exists
 	Exist(objectPath string) (bool, error)
 
+	// ExistMany check whether objects exist with parallel requests, or a single listing when many paths
+	// share a prefix. Result has an entry for every path.
+	ExistMany(objectPaths ...string) (map[string]bool, error)
+
+	// List iterate over objects whose path start with prefix in lexical order, pagination is handled internally
+	List(prefix string) (ObjectIterator, error)
+
 	// SetVisibility update object visibility for a given object path
 	SetVisibility(objectPath string, visibility ObjectVisibility) error
 
 	// GetVisibility return object visibility for a given object path
 	GetVisibility(objectPath string) (ObjectVisibility, error)
+
+	// GetACL return full list of grants for a given object path
+	GetACL(objectPath string) ([]Grant, error)
+
+	// Capabilities return optional features supported by the storage
+	Capabilities() Capabilities
 }
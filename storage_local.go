@@ -1,24 +1,106 @@
 package gostorage
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 // LocalStorageSignedURLBuilder is used to serve file temporarily in private directory mode
 type LocalStorageSignedURLBuilder func(absoluteFilePath string, objectPath string, expireIn time.Duration) (string, error)
 
+// localConditionalMu serialize conditional puts of the process, so their preconditions can't be
+// invalidated between checking and writing
+var localConditionalMu sync.Mutex
+
 type storageLocalFile struct {
+	options          storageOptions
 	baseDir          string
 	publicBaseDir    string
 	publicBaseURL    string
 	signedURLBuilder LocalStorageSignedURLBuilder
+	existenceCache   *existenceCache
+}
+
+// existenceCache remember public files known to exist until its ttl expired
+type existenceCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]time.Time
+}
+
+func newExistenceCache(ttl time.Duration) *existenceCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &existenceCache{
+		ttl:     ttl,
+		entries: make(map[string]time.Time),
+	}
+}
+
+func (c *existenceCache) exists(filePath string) bool {
+	if c == nil {
+		return isFileExists(filePath)
+	}
+
+	c.mu.Lock()
+	expireAt, ok := c.entries[filePath]
+	c.mu.Unlock()
+	if ok && time.Now().Before(expireAt) {
+		return true
+	}
+
+	if !isFileExists(filePath) {
+		c.forget(filePath)
+		return false
+	}
+
+	c.mu.Lock()
+	c.entries[filePath] = time.Now().Add(c.ttl)
+	c.mu.Unlock()
+	return true
+}
+
+// forgetDir forget every file under dir
+func (c *existenceCache) forgetDir(dir string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	for filePath := range c.entries {
+		if strings.HasPrefix(filePath, dir+string(filepath.Separator)) {
+			delete(c.entries, filePath)
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *existenceCache) forget(filePath string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.entries, filePath)
+	c.mu.Unlock()
 }
 
 // NewLocalStorage create local file storage
@@ -31,23 +113,91 @@ func NewLocalStorage(
 	baseDir string,
 	publicBaseDir string,
 	publicBaseURL string,
-	signedURLBuilder LocalStorageSignedURLBuilder) Storage {
+	signedURLBuilder LocalStorageSignedURLBuilder,
+	opts ...Option) Storage {
 	if signedURLBuilder == nil {
 		signedURLBuilder = func(absoluteFilePath string, objectPath string, expireIn time.Duration) (string, error) {
 			return "", fmt.Errorf("[local-storage] unsupported signed url builder")
 		}
 	}
 
+	options := newStorageOptions(opts)
 	return &storageLocalFile{
+		options:          options,
 		baseDir:          baseDir,
 		publicBaseDir:    publicBaseDir,
 		publicBaseURL:    publicBaseURL,
 		signedURLBuilder: signedURLBuilder,
+		existenceCache:   newExistenceCache(options.urlExistenceCacheTTL),
+	}
+}
+
+func (s *storageLocalFile) Connect(ctx context.Context) error {
+	if err := mkdirIfNotExists(s.baseDir); err != nil {
+		return err
+	}
+	return mkdirIfNotExists(s.publicBaseDir)
+}
+
+// Ping check base directories exist, unlike Connect it doesn't create them
+func (s *storageLocalFile) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, dir := range []string{s.baseDir, s.publicBaseDir} {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return localError(err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("[local-storage] err ping, not a directory: %s", dir)
+		}
 	}
+	return nil
 }
 
 func (s *storageLocalFile) Read(objectPath string) (io.ReadCloser, error) {
-	return os.Open(filepath.Join(s.baseDir, objectPath))
+	file, err := os.Open(localPath(s.baseDir, objectPath))
+	if err != nil {
+		return nil, localError(err)
+	}
+	return s.options.readProgress(file, sourceSize(file)), nil
+}
+
+func (s *storageLocalFile) ReadWithOptions(objectPath string, options ReadOptions) (io.ReadCloser, error) {
+	if err := checkPreconditions(s, objectPath, options.Preconditions, true); err != nil {
+		return nil, err
+	}
+	return s.Read(objectPath)
+}
+
+func (s *storageLocalFile) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(localPath(s.baseDir, objectPath))
+	if err != nil {
+		return nil, localError(err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	total := sourceSize(file)
+	if length < 0 {
+		return s.options.readProgress(file, total), nil
+	}
+	if total > length {
+		total = length
+	}
+	return s.options.readProgress(&limitedReadCloser{Reader: io.LimitReader(file, length), Closer: file}, total), nil
+}
+
+// errLocalObjectNotFound return error of action on missing objectPath matching ErrObjectNotExist
+func errLocalObjectNotFound(action string, objectPath string) error {
+	return withSentinel(ErrObjectNotExist, fmt.Errorf("[local-storage] err %s, object not found: %s", action, objectPath))
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
 }
 
 func checkAndCreateParentDirectory(filePath string) error {
@@ -56,58 +206,357 @@ func checkAndCreateParentDirectory(filePath string) error {
 }
 
 func (s *storageLocalFile) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
-	filePath := filepath.Join(s.baseDir, objectPath)
+	return s.PutWithOptions(objectPath, source, PutOptions{Visibility: visibility})
+}
+
+func (s *storageLocalFile) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	_, err := s.PutWithResult(objectPath, source, options)
+	return err
+}
+
+// PutWithResult write source to the file of objectPath, ETag is the sha256 hex of its content
+func (s *storageLocalFile) PutWithResult(objectPath string, source io.Reader, options PutOptions) (PutResult, error) {
+	if err := checkLegalHolds(s, objectPath); err != nil {
+		return PutResult{}, err
+	}
+	if !options.Preconditions.empty() {
+		localConditionalMu.Lock()
+		defer localConditionalMu.Unlock()
+	}
+	if err := checkPreconditions(s, objectPath, options.Preconditions, false); err != nil {
+		return PutResult{}, err
+	}
+
+	filePath := localPath(s.baseDir, objectPath)
 	if err := checkAndCreateParentDirectory(filePath); err != nil {
-		return err
+		return PutResult{}, err
 	}
 
 	file, err := os.Create(filePath)
 	if err != nil {
-		return err
+		return PutResult{}, localError(err)
 	}
 	defer file.Close()
 
-	_, err = io.Copy(file, source)
+	if progress := s.options.transferProgress(sourceSize(source)); progress != nil {
+		source = io.TeeReader(source, progress)
+	}
+	source, options, err = s.options.preparePut(objectPath, source, options)
+	if err != nil {
+		return PutResult{}, err
+	}
 
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), source)
+	if err != nil {
+		return PutResult{}, err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if err := s.putMetadata(objectPath, checksum, size, options); err != nil {
+		return PutResult{}, err
+	}
+	return PutResult{ETag: checksum, Size: size}, nil
+}
+
+// putMetadata publish stored object according to options visibility and write its sidecar
+func (s *storageLocalFile) putMetadata(objectPath string, checksum string, size int64, options PutOptions) error {
+	visibility := s.options.putVisibility(options.Visibility)
 	if visibility == ObjectPublicRead || visibility == ObjectPublicReadWrite {
-		return s.makeObjectPublic(objectPath)
+		if err := s.makeObjectPublic(objectPath); err != nil {
+			return err
+		}
 	}
 
-	return err
+	meta := &localMetadata{
+		Visibility: s.linkedVisibility(objectPath, visibility),
+		SHA256:     checksum,
+		Size:       size,
+	}
+	meta.setObjectMetadata(objectPath, options.ObjectMetadata)
+	return s.writeMetadata(objectPath, meta)
+}
+
+// Writer write into temporary file hidden from List, renamed to objectPath on Close
+func (s *storageLocalFile) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	tmpDir := localPath(s.baseDir, localMetadataDir)
+	if err := mkdirIfNotExists(tmpDir); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(tmpDir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &localObjectWriter{
+		storage:    s,
+		objectPath: objectPath,
+		visibility: visibility,
+		file:       file,
+		hash:       sha256.New(),
+		progress:   s.options.transferProgress(-1),
+	}, nil
+}
+
+type localObjectWriter struct {
+	storage    *storageLocalFile
+	objectPath string
+	visibility ObjectVisibility
+	file       *os.File
+	hash       hash.Hash
+	progress   *transferProgress
+	size       int64
+	closed     bool
+	result     error
+}
+
+func (w *localObjectWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	n, err := w.file.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	w.progress.add(int64(n))
+	return n, err
+}
+
+func (w *localObjectWriter) Close() error {
+	if w.closed {
+		return w.result
+	}
+	w.closed = true
+	w.result = w.commit()
+	return w.result
+}
+
+func (w *localObjectWriter) commit() error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	if err := checkLegalHolds(w.storage, w.objectPath); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+
+	filePath := localPath(w.storage.baseDir, w.objectPath)
+	if err := checkAndCreateParentDirectory(filePath); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	if err := os.Rename(w.file.Name(), filePath); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return w.storage.putMetadata(w.objectPath, hex.EncodeToString(w.hash.Sum(nil)), w.size, PutOptions{Visibility: w.visibility})
+}
+
+func (w *localObjectWriter) CloseWithError(err error) error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.result = err
+	if w.result == nil {
+		w.result = ErrWriteAborted
+	}
+
+	w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
+func (s *storageLocalFile) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	if !isFileExists(localPath(s.baseDir, objectPath)) {
+		return ObjectMetadata{}, errLocalObjectNotFound("get metadata", objectPath)
+	}
+
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return ObjectMetadata{}, localError(err)
+	}
+	return meta.objectMetadata(), nil
+}
+
+func (s *storageLocalFile) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	if !isFileExists(localPath(s.baseDir, objectPath)) {
+		return errLocalObjectNotFound("set metadata", objectPath)
+	}
+
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return localError(err)
+	}
+	meta.setObjectMetadata(objectPath, metadata)
+	return s.writeMetadata(objectPath, meta)
+}
+
+func (s *storageLocalFile) Touch(objectPath string) error {
+	if !isFileExists(localPath(s.baseDir, objectPath)) {
+		return s.Put(objectPath, bytes.NewReader(nil), ObjectPrivate)
+	}
+	return s.SetLastModified(objectPath, time.Now())
+}
+
+func (s *storageLocalFile) SetLastModified(objectPath string, lastModified time.Time) error {
+	return localError(os.Chtimes(localPath(s.baseDir, objectPath), lastModified, lastModified))
+}
+
+// linkedVisibility return visibility of objectPath based on its public link, unlinked objects keep
+// visibility when it's one not granting anonymous access
+func (s *storageLocalFile) linkedVisibility(objectPath string, visibility ObjectVisibility) ObjectVisibility {
+	if isFileExists(localPath(s.publicBaseDir, objectPath)) {
+		return ObjectPublicRead
+	}
+	if visibility == ObjectAuthenticatedRead || visibility == ObjectBucketOwnerFullControl {
+		return visibility
+	}
+	return ObjectPrivate
+}
+
+// Delete refuse to delete anything when one of objectPaths is under legal hold, objects are moved
+// to trash when enabled, see WithTrash
 func (s *storageLocalFile) Delete(objectPaths ...string) error {
+	objectPaths, err := s.options.moveToTrash(s, objectPaths)
+	if err != nil {
+		return err
+	}
+	return s.deleteObjects(objectPaths...)
+}
+
+func (s *storageLocalFile) deleteObjects(objectPaths ...string) error {
+	if err := checkLegalHolds(s, objectPaths...); err != nil {
+		return err
+	}
+
 	for _, objectPath := range objectPaths {
-		publicPath := filepath.Join(s.publicBaseDir, objectPath)
+		publicPath := localPath(s.publicBaseDir, objectPath)
+		s.existenceCache.forget(publicPath)
 		if isFileExists(publicPath) {
 			if err := os.Remove(publicPath); err != nil {
 				return err
 			}
 		}
 
-		privatePath := filepath.Join(s.baseDir, objectPath)
+		privatePath := localPath(s.baseDir, objectPath)
 		if isFileExists(privatePath) {
 			if err := os.Remove(privatePath); err != nil {
 				return err
 			}
 		}
+
+		if err := s.deleteMetadata(objectPath); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// DeletePrefix remove whole directories when prefix end with a slash, other prefixes match file
+// names partially so listed objects are deleted one by one
+func (s *storageLocalFile) DeletePrefix(prefix string) error {
+	// trashed objects are moved one by one
+	if !strings.HasSuffix(filepath.ToSlash(prefix), "/") || (s.options.trashPrefix != "" && !s.options.inTrash(prefix)) {
+		return deleteListed(s, prefix)
+	}
+	if err := checkDeletePrefix(prefix); err != nil {
+		return err
+	}
+	if err := s.checkPrefixLegalHolds(prefix); err != nil {
+		return err
+	}
+
+	publicDir := localPath(s.publicBaseDir, prefix)
+	s.existenceCache.forgetDir(publicDir)
+	for _, dir := range []string{publicDir, localPath(s.baseDir, prefix), localPath(filepath.Join(s.baseDir, localMetadataDir), prefix)} {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkPrefixLegalHolds return LegalHoldError listing objects under prefix which are under legal hold
+func (s *storageLocalFile) checkPrefixLegalHolds(prefix string) error {
+	iterator, err := s.List(prefix)
+	if err != nil {
+		return err
+	}
+	var objectPaths []string
+	for iterator.Next() {
+		objectPaths = append(objectPaths, iterator.Object().ObjectPath)
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	return checkLegalHolds(s, objectPaths...)
+}
+
+// LegalHold is kept in the sidecar, held objects can't be deleted, overwritten or moved
+func (s *storageLocalFile) LegalHold(objectPath string) (bool, error) {
+	data, err := os.ReadFile(s.metadataPath(objectPath))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var meta localMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return false, fmt.Errorf("[local-storage] err invalid metadata of %s: %s", objectPath, err)
+	}
+	return meta.LegalHold, nil
+}
+
+func (s *storageLocalFile) SetLegalHold(objectPath string, hold bool) error {
+	if !isFileExists(localPath(s.baseDir, objectPath)) {
+		return errLocalObjectNotFound("setting legal hold", objectPath)
+	}
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return err
+	}
+	meta.LegalHold = hold
+	return s.writeMetadata(objectPath, meta)
+}
+
+func (s *storageLocalFile) ForceDelete(objectPath string, override LegalHoldOverride) error {
+	if err := s.options.checkOverride(objectPath, override); err != nil {
+		return err
+	}
+	if err := s.SetLegalHold(objectPath, false); err != nil && !errors.Is(err, ErrObjectNotExist) {
+		return err
+	}
+	return s.Delete(objectPath)
+}
+
+// Copy keep metadata and visibility of the source
 func (s *storageLocalFile) Copy(srcObjectPath string, dstObjectPath string) error {
-	sourceFilePath := filepath.Join(s.baseDir, srcObjectPath)
+	return s.CopyWithOptions(srcObjectPath, dstObjectPath, CopyOptions{})
+}
+
+// CopyWithOptions apply metadata and visibility options, storage class and tags are ignored
+func (s *storageLocalFile) CopyWithOptions(srcObjectPath string, dstObjectPath string, options CopyOptions) error {
+	if options.SourceBucket != "" {
+		return ErrCopyOptionsUnsupported
+	}
+	if err := checkLegalHolds(s, dstObjectPath); err != nil {
+		return err
+	}
+
+	sourceFilePath := localPath(s.baseDir, srcObjectPath)
 	if err := checkAndCreateParentDirectory(sourceFilePath); err != nil {
 		return err
 	}
 
 	sourceStream, err := os.Open(sourceFilePath)
 	if err != nil {
-		return err
+		return localError(err)
 	}
 	defer sourceStream.Close()
 
-	destFilePath := filepath.Join(s.baseDir, dstObjectPath)
+	destFilePath := localPath(s.baseDir, dstObjectPath)
 	if err := checkAndCreateParentDirectory(destFilePath); err != nil {
 		return err
 	}
@@ -118,8 +567,108 @@ func (s *storageLocalFile) Copy(srcObjectPath string, dstObjectPath string) erro
 	}
 	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceStream)
-	return err
+	if _, err = io.Copy(destFile, sourceStream); err != nil {
+		return err
+	}
+
+	meta, err := s.readMetadata(srcObjectPath)
+	if err != nil {
+		return err
+	}
+	visibility := options.Visibility
+	if visibility == "" {
+		visibility = meta.Visibility
+	}
+	if options.MetadataDirective == MetadataReplace {
+		meta.setObjectMetadata(dstObjectPath, ObjectMetadata{Headers: options.Headers, Metadata: options.Metadata})
+	}
+	if err := s.writeMetadata(dstObjectPath, meta); err != nil {
+		return err
+	}
+	return s.SetVisibility(dstObjectPath, s.options.putVisibility(visibility))
+}
+
+// CopyPrefix copy files of the directory tree one by one, so sidecars and public links follow
+func (s *storageLocalFile) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, s.options.copyWorkers())
+}
+
+// Restore move the latest trashed copy of objectPath back, see WithTrash
+func (s *storageLocalFile) Restore(objectPath string) error {
+	return s.options.restoreFromTrash(s, objectPath)
+}
+
+// PurgeTrash delete objects trashed more than olderThan ago for good
+func (s *storageLocalFile) PurgeTrash(olderThan time.Duration) error {
+	return s.options.purgeTrash(s, olderThan)
+}
+
+// Move rename file and its sidecar, public link is recreated for the new path.
+// Renames across devices fall back to copy and delete.
+func (s *storageLocalFile) Move(srcObjectPath string, dstObjectPath string) error {
+	if sameObjectPath(srcObjectPath, dstObjectPath) {
+		return nil
+	}
+	if err := checkLegalHolds(s, srcObjectPath, dstObjectPath); err != nil {
+		return err
+	}
+
+	meta, err := s.readMetadata(srcObjectPath)
+	if err != nil {
+		return localError(err)
+	}
+
+	dstFilePath := localPath(s.baseDir, dstObjectPath)
+	if err := checkAndCreateParentDirectory(dstFilePath); err != nil {
+		return err
+	}
+	if err := os.Rename(localPath(s.baseDir, srcObjectPath), dstFilePath); err != nil {
+		if !errors.Is(err, syscall.EXDEV) {
+			return localError(err)
+		}
+		return moveByCopy(s, srcObjectPath, dstObjectPath)
+	}
+
+	for _, objectPath := range []string{srcObjectPath, dstObjectPath} {
+		publicPath := localPath(s.publicBaseDir, objectPath)
+		s.existenceCache.forget(publicPath)
+		// symlink of the source is dangling after the rename
+		if err := os.Remove(publicPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if meta.Visibility == ObjectPublicRead || meta.Visibility == ObjectPublicReadWrite {
+		if err := s.makeObjectPublic(dstObjectPath); err != nil {
+			return err
+		}
+	}
+
+	if err := s.deleteMetadata(srcObjectPath); err != nil {
+		return err
+	}
+	meta.Visibility = s.linkedVisibility(dstObjectPath, meta.Visibility)
+	return s.writeMetadata(dstObjectPath, meta)
+}
+
+// Compose stream sources into a temporary file renamed to dstObjectPath once complete,
+// so dstObjectPath may be one of the sources
+func (s *storageLocalFile) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	if err := checkLegalHolds(s, dstObjectPath); err != nil {
+		return err
+	}
+
+	writer, err := s.Writer(dstObjectPath, visibility)
+	if err != nil {
+		return err
+	}
+	reader := ConcatReaders(s, srcObjectPaths...)
+	defer reader.Close()
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.CloseWithError(err)
+		return err
+	}
+	return writer.Close()
 }
 
 func (s *storageLocalFile) URL(objectPath string, storageResize *StorageResize) (string, error) {
@@ -127,9 +676,11 @@ func (s *storageLocalFile) URL(objectPath string, storageResize *StorageResize)
 		return "", nil
 	}
 
-	filePath := filepath.Join(s.publicBaseDir, objectPath)
-	if !isFileExists(filePath) {
-		return "", fmt.Errorf("[local-storage] file not found in given public path")
+	if !s.options.skipURLExistenceCheck {
+		filePath := localPath(s.publicBaseDir, objectPath)
+		if !s.existenceCache.exists(filePath) {
+			return "", fmt.Errorf("[local-storage] file not found in given public path")
+		}
 	}
 
 	u, err := url.Parse(s.publicBaseURL)
@@ -145,9 +696,9 @@ func (s *storageLocalFile) TemporaryURL(objectPath string, expireIn time.Duratio
 		return "", nil
 	}
 
-	filePath := filepath.Join(s.baseDir, objectPath)
+	filePath := localPath(s.baseDir, objectPath)
 	if isFileExists(filePath) {
-		return s.signedURLBuilder(filePath, objectPath, expireIn)
+		return s.signedURLBuilder(filePath, objectPath, s.options.clampURLExpiry(objectPath, expireIn, 0))
 	}
 
 	publicURL, err := s.URL(objectPath, storageResize)
@@ -158,26 +709,78 @@ func (s *storageLocalFile) TemporaryURL(objectPath string, expireIn time.Duratio
 	return publicURL, nil
 }
 
+func (s *storageLocalFile) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	return signURLs(objectPaths, func(objectPath string) (string, error) {
+		return s.TemporaryURL(objectPath, expireIn, storageResize)
+	})
+}
+
 func (s *storageLocalFile) Size(objectPath string) (int64, error) {
-	info, err := os.Stat(filepath.Join(s.baseDir, objectPath))
+	info, err := os.Stat(localPath(s.baseDir, objectPath))
 	if err != nil {
-		return 0, err
+		return 0, localError(err)
 	}
 
 	return info.Size(), nil
 }
 
 func (s *storageLocalFile) LastModified(objectPath string) (time.Time, error) {
-	info, err := os.Stat(filepath.Join(s.baseDir, objectPath))
+	info, err := os.Stat(localPath(s.baseDir, objectPath))
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, localError(err)
 	}
 
 	return info.ModTime(), nil
 }
 
+func (s *storageLocalFile) Stat(objectPath string) (ObjectInfo, error) {
+	info, err := os.Stat(localPath(s.baseDir, objectPath))
+	if err != nil {
+		return ObjectInfo{}, localError(err)
+	}
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		ObjectPath:   strings.TrimPrefix(filepath.ToSlash(objectPath), "/"),
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		ContentType:  meta.ContentType,
+		ETag:         meta.SHA256,
+		Visibility:   meta.Visibility,
+	}, nil
+}
+
+func (s *storageLocalFile) MimeType(objectPath string) (string, error) {
+	file, err := os.Open(localPath(s.baseDir, objectPath))
+	if err != nil {
+		return "", localError(err)
+	}
+	defer file.Close()
+	return sniffContentType(file)
+}
+
+// Checksum use sha256 recorded in the sidecar, other checksums are computed by reading the file
+func (s *storageLocalFile) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	if algo == ChecksumSHA256 {
+		if !isFileExists(localPath(s.baseDir, objectPath)) {
+			return "", errLocalObjectNotFound("checksum", objectPath)
+		}
+		meta, err := s.readMetadata(objectPath)
+		if err != nil {
+			return "", localError(err)
+		}
+		if meta.SHA256 != "" {
+			return meta.SHA256, nil
+		}
+	}
+	return streamChecksum(s, objectPath, algo)
+}
+
 func (s *storageLocalFile) Exist(objectPath string) (bool, error) {
-	info, err := os.Stat(filepath.Join(s.baseDir, objectPath))
+	info, err := os.Stat(localPath(s.baseDir, objectPath))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -189,38 +792,116 @@ func (s *storageLocalFile) Exist(objectPath string) (bool, error) {
 	return !info.IsDir(), nil
 }
 
+func (s *storageLocalFile) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	result := make(map[string]bool, len(objectPaths))
+	for _, objectPath := range objectPaths {
+		exist, err := s.Exist(objectPath)
+		if err != nil {
+			return nil, err
+		}
+		result[objectPath] = exist
+	}
+	return result, nil
+}
+
+func (s *storageLocalFile) List(prefix string) (ObjectIterator, error) {
+	prefix = strings.TrimPrefix(filepath.ToSlash(prefix), "/")
+	root := s.baseDir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = localPath(s.baseDir, prefix[:i])
+	}
+
+	return newPagedObjectIterator(func(token string) ([]ObjectInfo, string, error) {
+		var objects []ObjectInfo
+		err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(s.baseDir, filePath)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if rel == localMetadataDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			objectPath := filepath.ToSlash(rel)
+			if strings.HasPrefix(objectPath, prefix) {
+				objects = append(objects, ObjectInfo{ObjectPath: objectPath, Size: info.Size(), LastModified: info.ModTime()})
+			}
+			return nil
+		})
+		// Walk visit "a/b" before "a.txt", keys are listed in byte-wise order like S3 and OSS
+		sort.Slice(objects, func(i, j int) bool {
+			return objects[i].ObjectPath < objects[j].ObjectPath
+		})
+		return objects, "", err
+	})
+}
+
 func (s *storageLocalFile) SetVisibility(objectPath string, visibility ObjectVisibility) error {
-	publicPath := filepath.Join(s.publicBaseDir, objectPath)
-	if visibility == ObjectPrivate {
+	publicPath := localPath(s.publicBaseDir, objectPath)
+	if visibility == ObjectPrivate || visibility == ObjectAuthenticatedRead || visibility == ObjectBucketOwnerFullControl {
+		s.existenceCache.forget(publicPath)
 		if isFileExists(publicPath) {
-			return os.Remove(publicPath)
+			if err := os.Remove(publicPath); err != nil {
+				return err
+			}
 		}
 	} else if visibility == ObjectPublicRead || visibility == ObjectPublicReadWrite {
 		if !isFileExists(publicPath) {
-			return s.makeObjectPublic(objectPath)
+			if err := s.makeObjectPublic(objectPath); err != nil {
+				return err
+			}
 		}
-	} else {
+	} else if visibility != ObjectVisibilityInherit {
 		return fmt.Errorf("[local-storage] err invalid object visibility: %s", visibility)
 	}
-	return nil
+
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return err
+	}
+	meta.Visibility = s.linkedVisibility(objectPath, visibility)
+	return s.writeMetadata(objectPath, meta)
 }
 
 func (s *storageLocalFile) GetVisibility(objectPath string) (ObjectVisibility, error) {
-	publicPath := filepath.Join(s.publicBaseDir, objectPath)
-	if isFileExists(publicPath) {
-		return ObjectPublicRead, nil
+	filePath := localPath(s.baseDir, objectPath)
+	if !isFileExists(filePath) {
+		return "", errLocalObjectNotFound("get visibility", objectPath)
 	}
 
-	filePath := filepath.Join(s.baseDir, objectPath)
-	if isFileExists(filePath) {
-		return ObjectPrivate, nil
-	} else {
-		return "", fmt.Errorf("[local-storage] err get visibility, object not found: %s", objectPath)
+	meta, err := s.readMetadata(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return meta.Visibility, nil
+}
+
+func (s *storageLocalFile) GetACL(objectPath string) ([]Grant, error) {
+	visibility, err := s.GetVisibility(objectPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return visibilityGrants("", visibility), nil
+}
+
+func (s *storageLocalFile) Capabilities() Capabilities {
+	return Capabilities{
+		LegalHold:        true,
+		ConditionalWrite: true,
 	}
 }
 
 func (s *storageLocalFile) makeObjectPublic(objectPath string) error {
-	publicPath := filepath.Join(s.publicBaseDir, objectPath)
+	publicPath := localPath(s.publicBaseDir, objectPath)
 	if err := checkAndCreateParentDirectory(publicPath); err != nil {
 		return err
 	}
@@ -231,7 +912,7 @@ func (s *storageLocalFile) makeObjectPublic(objectPath string) error {
 		}
 	}
 
-	filePath := filepath.Join(s.baseDir, objectPath)
+	filePath := localPath(s.baseDir, objectPath)
 
 	if runtime.GOOS == "linux" {
 		absFilePath, err := filepath.Abs(filepath.ToSlash(filePath))
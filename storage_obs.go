@@ -0,0 +1,59 @@
+package gostorage
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const obsDefaultRegion = "cn-north-4"
+
+// NewHuaweiOBSStorage create storage backed by Huawei Cloud OBS using its S3 compatible API,
+// endpoint is the regional endpoint e.g. "obs.ap-southeast-3.myhuaweicloud.com"
+func NewHuaweiOBSStorage(
+	endpoint string,
+	accessKeyID string,
+	secretAccessKey string,
+	bucketName string,
+	opts ...Option) Storage {
+	options := newStorageOptions(opts)
+
+	endpointURL, err := obsEndpointURL(endpoint)
+	if err != nil {
+		panic(err)
+	}
+
+	config := &aws.Config{
+		Endpoint:    aws.String(endpointURL.String()),
+		Region:      aws.String(obsRegion(endpointURL.Host)),
+		Credentials: credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+	}
+
+	publicBaseURL := fmt.Sprintf("%s://%s.%s", endpointURL.Scheme, bucketName, endpointURL.Host)
+	return newS3Storage(bucketName, config, publicBaseURL, options)
+}
+
+func obsEndpointURL(endpoint string) (*url.URL, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return nil, fmt.Errorf("err invalid OBS endpoint %s", endpoint)
+	}
+	endpointURL.Path = ""
+	return endpointURL, nil
+}
+
+// obsRegion extract region from endpoint host, e.g. "obs.ap-southeast-3.myhuaweicloud.com"
+func obsRegion(host string) string {
+	parts := strings.Split(host, ".")
+	if len(parts) >= 3 && parts[0] == "obs" {
+		return parts[1]
+	}
+	return obsDefaultRegion
+}
@@ -0,0 +1,222 @@
+package gostorage
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// OCIConfig configure Oracle Cloud Object Storage
+type OCIConfig struct {
+	Namespace string
+	Region    string // e.g. "ap-singapore-1"
+	Bucket    string
+
+	// customer secret key used by the S3 compatible API
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// API signing key used to create pre-authenticated requests for TemporaryURL,
+	// when empty TemporaryURL fall back to S3 presigned URL
+	TenancyOCID    string
+	UserOCID       string
+	KeyFingerprint string
+	PrivateKeyPEM  []byte
+}
+
+type storageOCI struct {
+	*storageS3
+	config     OCIConfig
+	privateKey *rsa.PrivateKey
+	httpClient *http.Client
+}
+
+// NewOracleOCIStorage create storage backed by Oracle Cloud Object Storage using its S3 compatible
+// API, TemporaryURL create pre-authenticated requests when API signing key is configured.
+// Object Storage has no object ACLs so visibility is ignored.
+func NewOracleOCIStorage(config OCIConfig, opts ...Option) Storage {
+	// copy opts, appending could write into the backing array of the caller
+	options := newStorageOptions(append(append([]Option{}, opts...), WithoutACL()))
+
+	awsConfig := &aws.Config{
+		Endpoint:         aws.String(fmt.Sprintf("https://%s.compat.objectstorage.%s.oraclecloud.com", config.Namespace, config.Region)),
+		Region:           aws.String(config.Region),
+		Credentials:      credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, ""),
+		S3ForcePathStyle: aws.Bool(true),
+	}
+
+	publicBaseURL := fmt.Sprintf("%s/n/%s/b/%s/o", ociNativeEndpoint(config.Region), config.Namespace, config.Bucket)
+	storage := &storageOCI{
+		storageS3:  newS3Storage(config.Bucket, awsConfig, publicBaseURL, options),
+		config:     config,
+		httpClient: http.DefaultClient,
+	}
+	if options.debug {
+		storage.httpClient = newDebugHTTPClient("OCI", options.logger)
+	}
+
+	if len(config.PrivateKeyPEM) > 0 {
+		privateKey, err := parseRSAPrivateKey(config.PrivateKeyPEM)
+		if err != nil {
+			panic(err)
+		}
+		storage.privateKey = privateKey
+	}
+	return storage
+}
+
+func ociNativeEndpoint(region string) string {
+	return fmt.Sprintf("https://objectstorage.%s.oraclecloud.com", region)
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("err invalid private key pem")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("err invalid private key: %s", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("err private key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+type ociPreauthenticatedRequest struct {
+	Name        string    `json:"name"`
+	AccessType  string    `json:"accessType"`
+	ObjectName  string    `json:"objectName"`
+	TimeExpires time.Time `json:"timeExpires"`
+}
+
+// TemporaryURL create a pre-authenticated request named "gostorage-<random id>" expiring with the URL.
+// Every call create a new one and they are never deleted, OCI stop honoring them once expired but keep
+// listing them until removed, e.g. by a lifecycle job deleting expired "gostorage-" requests.
+func (s *storageOCI) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
+	if s.privateKey == nil {
+		return s.storageS3.TemporaryURL(objectPath, expireIn, storageResize)
+	}
+
+	objectPath = cleanS3ObjectPath(objectPath)
+	expireIn = s.options.clampURLExpiry(objectPath, expireIn, 0)
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(ociPreauthenticatedRequest{
+		Name:        "gostorage-" + id,
+		AccessType:  "ObjectRead",
+		ObjectName:  objectPath,
+		TimeExpires: time.Now().Add(expireIn).UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := ociNativeEndpoint(s.config.Region)
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/n/%s/b/%s/p/", endpoint,
+		url.PathEscape(s.config.Namespace), url.PathEscape(s.config.Bucket)), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := s.signRequest(req, body); err != nil {
+		return "", err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("err creating pre-authenticated request: %d %s", resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		AccessURI string `json:"accessUri"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", err
+	}
+	return endpoint + result.AccessURI, nil
+}
+
+// TemporaryURLWithOptions create pre-authenticated request when there are no options to sign,
+// PAR can't carry them so S3 presigned URL is used otherwise
+func (s *storageOCI) TemporaryURLWithOptions(objectPath string, expireIn time.Duration, options SignedURLOptions) (string, error) {
+	if len(options.Query) == 0 && len(options.Headers) == 0 {
+		return s.TemporaryURL(objectPath, expireIn, options.Resize)
+	}
+	return s.storageS3.TemporaryURLWithOptions(objectPath, expireIn, options)
+}
+
+func (s *storageOCI) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	return signURLs(objectPaths, func(objectPath string) (string, error) {
+		return s.TemporaryURL(objectPath, expireIn, storageResize)
+	})
+}
+
+// signRequest sign native API request using OCI HTTP signature scheme
+func (s *storageOCI) signRequest(req *http.Request, body []byte) error {
+	bodyHash := sha256.Sum256(body)
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Content-Sha256", base64.StdEncoding.EncodeToString(bodyHash[:]))
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+
+	headers := []string{"(request-target)", "date", "host", "x-content-sha256", "content-type", "content-length"}
+	lines := make([]string, len(headers))
+	for i, header := range headers {
+		value := req.Header.Get(header)
+		if header == "(request-target)" {
+			value = fmt.Sprintf("%s %s", strings.ToLower(req.Method), req.URL.RequestURI())
+		}
+		lines[i] = fmt.Sprintf("%s: %s", header, value)
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	signature, err := rsa.SignPKCS1v15(nil, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		`Signature version="1",keyId="%s/%s/%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		s.config.TenancyOCID, s.config.UserOCID, s.config.KeyFingerprint,
+		strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+	return nil
+}
+
+func (s *storageOCI) Capabilities() Capabilities {
+	return Capabilities{
+		PresignedUpload: true,
+	}
+}
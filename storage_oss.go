@@ -1,6 +1,8 @@
 package gostorage
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,16 +11,33 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 )
 
-const ossSignedURLExpire = 1 * time.Minute // 1 Minute
+const (
+	ossSignedURLExpire = 1 * time.Minute // 1 Minute
+	ossMinPartSize     = 100 * 1024      // 100KB is minimum oss part size
+	ossMaxParts        = 10000
+	ossMaxPartCopySize = 5 * 1024 * 1024 * 1024 // 5GB is maximum size of a part copied with UploadPartCopy
+
+	ossDefaultConnectTimeout = 30 // seconds, same as the SDK default
+)
 
 type storageAlibabaOSS struct {
-	client *oss.Client
-	bucket *oss.Bucket
+	options      storageOptions
+	publicBucket *oss.Bucket // bucket accessed through public endpoint, used to build URLs
+	checkpoints  CheckpointStore
+
+	// client and bucket use the internal endpoint once resolved, access them with ossClient and ossBucket
+	endpointOnce  sync.Once
+	client        *oss.Client
+	bucket        *oss.Bucket
+	accessID      string
+	accessSecret  string
+	clientOptions []oss.ClientOption
 }
 
 // NewAlibabaOSSStorage create storage backed by alibaba oss
@@ -26,61 +45,597 @@ func NewAlibabaOSSStorage(
 	bucketName string,
 	endpoint string,
 	accessID string,
-	accessSecret string) Storage {
+	accessSecret string,
+	opts ...Option) Storage {
+	options := newStorageOptions(opts)
+
+	var clientOptions []oss.ClientOption
+	if options.debug {
+		clientOptions = append(clientOptions, oss.HTTPClient(newDebugHTTPClient("OSS", options.logger)))
+	}
+	if timeout := int64(options.timeouts.Default / time.Second); timeout > 0 || options.stallTimeout > 0 {
+		clientOptions = append(clientOptions, ossTimeout(timeout, options.stallTimeout))
+	}
+	if options.ossSignatureV4 {
+		clientOptions = append(clientOptions, oss.Region(options.ossRegion), oss.AuthVersion(oss.AuthV4))
+	}
 
-	client, err := oss.New(endpoint, accessID, accessSecret)
+	publicClient, err := oss.New(endpoint, accessID, accessSecret, clientOptions...)
 	if err != nil {
 		panic(err)
 	}
 
-	bucket, err := client.Bucket(bucketName)
+	publicBucket, err := publicClient.Bucket(bucketName)
 	if err != nil {
 		panic(err)
 	}
 
-	return &storageAlibabaOSS{
-		client: client,
-		bucket: bucket,
+	storage := &storageAlibabaOSS{
+		options:       options,
+		client:        publicClient,
+		bucket:        publicBucket,
+		publicBucket:  publicBucket,
+		accessID:      accessID,
+		accessSecret:  accessSecret,
+		clientOptions: clientOptions,
+	}
+	storage.checkpoints = options.newCheckpointStore(storage)
+	return storage
+}
+
+// ossTimeout return client option of connect timeout in seconds, SDK default when zero, and read/write
+// timeout of connections, which time out when no bytes are transferred for stallTimeout
+func ossTimeout(timeout int64, stallTimeout time.Duration) oss.ClientOption {
+	if timeout <= 0 {
+		timeout = ossDefaultConnectTimeout
+	}
+	readWriteTimeout := timeout
+	if stallTimeout > 0 {
+		// the SDK count whole seconds
+		readWriteTimeout = int64((stallTimeout + time.Second - 1) / time.Second)
 	}
+	return oss.Timeout(timeout, readWriteTimeout)
+}
+
+// resolveEndpoint switch client and bucket to the internal endpoint on first use when
+// WithOSSInternalEndpoint is enabled, so constructing the storage doesn't query ECS metadata
+func (s *storageAlibabaOSS) resolveEndpoint() {
+	s.endpointOnce.Do(func() {
+		endpoint := s.publicBucket.Client.Config.Endpoint
+		resolved := resolveOSSEndpoint(endpoint, s.options)
+		if resolved == endpoint {
+			return
+		}
+
+		client, err := oss.New(resolved, s.accessID, s.accessSecret, s.clientOptions...)
+		if err != nil {
+			s.options.logger.Debugf("[OSS] error using internal endpoint %s: %s\n", resolved, err)
+			return
+		}
+		bucket, err := client.Bucket(s.publicBucket.BucketName)
+		if err != nil {
+			s.options.logger.Debugf("[OSS] error using internal endpoint %s: %s\n", resolved, err)
+			return
+		}
+		s.client, s.bucket = client, bucket
+	})
+}
+
+func (s *storageAlibabaOSS) ossClient() *oss.Client {
+	s.resolveEndpoint()
+	return s.client
+}
+
+func (s *storageAlibabaOSS) ossBucket() *oss.Bucket {
+	s.resolveEndpoint()
+	return s.bucket
 }
 
 func cleanOSSObjectPath(objectPath string) string {
-	return path.Clean(filepath.ToSlash(objectPath))
+	return objectKey(objectPath)
+}
+
+func (s *storageAlibabaOSS) Connect(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.ossClient().GetBucketInfo(s.ossBucket().BucketName)
+	return ossError(err)
+}
+
+func (s *storageAlibabaOSS) Ping(ctx context.Context) error {
+	return s.Connect(ctx)
 }
 
 func (s *storageAlibabaOSS) Read(objectPath string) (io.ReadCloser, error) {
-	return s.bucket.GetObject(cleanOSSObjectPath(objectPath))
+	return s.ReadVersion(objectPath, "")
+}
+
+func (s *storageAlibabaOSS) ReadVersion(objectPath string, versionID string) (io.ReadCloser, error) {
+	return s.read(objectPath, versionID, Preconditions{})
+}
+
+func (s *storageAlibabaOSS) ReadWithOptions(objectPath string, options ReadOptions) (io.ReadCloser, error) {
+	return s.read(objectPath, "", options.Preconditions)
+}
+
+func (s *storageAlibabaOSS) read(objectPath string, versionID string, preconditions Preconditions) (io.ReadCloser, error) {
+	objectPath = cleanOSSObjectPath(objectPath)
+	var versionOptions []oss.Option
+	if versionID != "" {
+		versionOptions = append(versionOptions, oss.VersionId(versionID))
+	}
+
+	getOptions := append(ossPreconditions(preconditions), versionOptions...)
+	value, _, err := s.options.hedge(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return s.ossBucket().DoGetObject(&oss.GetObjectRequest{ObjectKey: objectPath}, getOptions)
+	}, func(value interface{}) {
+		value.(*oss.GetObjectResult).Response.Close()
+	})
+	if err != nil {
+		return nil, ossError(err)
+	}
+	result := value.(*oss.GetObjectResult)
+	if s.options.readRetryAttempts <= 0 {
+		return s.options.readProgress(s.options.stallReader(result.Response), ossContentLength(result.Response.Headers)), nil
+	}
+
+	etag := result.Response.Headers.Get(oss.HTTPHeaderEtag)
+	reader := s.options.stallReader(newRetryReader("OSS", result.Response, func(offset int64) (io.ReadCloser, error) {
+		rangeOptions := append([]oss.Option{oss.NormalizedRange(fmt.Sprintf("%d-", offset)), oss.IfMatch(etag)}, versionOptions...)
+		return s.ossBucket().GetObject(objectPath, rangeOptions...)
+	}, s.options.readRetryAttempts, s.options.retryBudget, s.options.logger))
+	return s.options.readProgress(reader, ossContentLength(result.Response.Headers)), nil
+}
+
+func (s *storageAlibabaOSS) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("%d-%d", offset, offset+length-1)
+	}
+	result, err := s.ossBucket().DoGetObject(&oss.GetObjectRequest{ObjectKey: cleanOSSObjectPath(objectPath)}, []oss.Option{oss.NormalizedRange(byteRange)})
+	if err != nil {
+		return nil, ossError(err)
+	}
+	return s.options.readProgress(s.options.stallReader(result.Response), ossContentLength(result.Response.Headers)), nil
+}
+
+// ossContentLength return size of a response body, -1 when unknown
+func ossContentLength(headers http.Header) int64 {
+	size, err := strconv.ParseInt(headers.Get(oss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+func (s *storageAlibabaOSS) CurrentVersion(objectPath string) (string, error) {
+	meta, err := s.ossBucket().GetObjectMeta(cleanOSSObjectPath(objectPath))
+	if err != nil {
+		return "", err
+	}
+	return meta.Get("X-Oss-Version-Id"), nil
+}
+
+func (s *storageAlibabaOSS) URLVersion(objectPath string, versionID string) (string, error) {
+	objectURL, err := s.URL(objectPath, nil)
+	if err != nil || objectURL == "" {
+		return objectURL, err
+	}
+	return withVersionQuery(objectURL, versionID)
+}
+
+func (s *storageAlibabaOSS) TemporaryURLVersion(objectPath string, versionID string, expireIn time.Duration) (string, error) {
+	options := SignedURLOptions{}
+	if versionID != "" {
+		options.Query = map[string]string{"versionId": versionID}
+	}
+	return s.TemporaryURLWithOptions(objectPath, expireIn, options)
 }
 
 func (s *storageAlibabaOSS) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
-	var ossOptions []oss.Option
-	if acl, err := getACLOSSOrError(visibility); err == nil {
+	return s.PutWithHeaders(objectPath, source, visibility, ObjectHeaders{})
+}
+
+// Writer stream written data as chunked upload, discarded by OSS on CloseWithError
+func (s *storageAlibabaOSS) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *storageAlibabaOSS) PutWithHeaders(objectPath string, source io.Reader, visibility ObjectVisibility, headers ObjectHeaders) error {
+	return s.PutWithOptions(objectPath, source, PutOptions{Visibility: visibility, ObjectMetadata: ObjectMetadata{Headers: headers}})
+}
+
+func (s *storageAlibabaOSS) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	_, err := s.PutWithResult(objectPath, source, options)
+	return err
+}
+
+// PutWithResult put source in a single request, ETag and version are read from its response
+func (s *storageAlibabaOSS) PutWithResult(objectPath string, source io.Reader, options PutOptions) (PutResult, error) {
+	ossOptions := s.options.ossProgress(source)
+	source, options, err := s.options.preparePut(objectPath, source, options)
+	if err != nil {
+		return PutResult{}, s.options.stallError(err)
+	}
+
+	visibility := s.options.putVisibility(options.Visibility)
+	if acl, err := getACLOSSOrError(visibility); err != nil {
+		return PutResult{}, err
+	} else if visibility != ObjectVisibilityInherit {
 		ossOptions = append(ossOptions, oss.ObjectACL(acl))
-	} else {
+	}
+	if options.StorageClass != "" {
+		ossOptions = append(ossOptions, oss.ObjectStorageClass(oss.StorageClassType(options.StorageClass)))
+	}
+	ossOptions = append(ossOptions, ossMetadataOptions(options.ObjectMetadata)...)
+
+	objectPath = cleanOSSObjectPath(objectPath)
+	// OSS only enforce IfNoneMatch "*" on put, other preconditions are checked with a HEAD beforehand
+	if err := checkPreconditions(s, objectPath, options.Preconditions, false); err != nil {
+		return PutResult{}, err
+	}
+	if options.IfNoneMatch == "*" {
+		ossOptions = append(ossOptions, oss.ForbidOverWrite(true))
+	}
+	var respHeader http.Header
+	ossOptions = append(ossOptions, oss.GetResponseHeader(&respHeader))
+
+	// wrapping source hide its length from the SDK, so it's only done when needed
+	size := sourceSize(source)
+	var digest *putDigest
+	if s.options.putVerifyAttempts > 0 || size < 0 {
+		digest = newPutDigest(source)
+		source = digest
+	}
+	if err := s.ossBucket().PutObject(objectPath, source, ossOptions...); err != nil {
+		return PutResult{}, s.options.stallError(ossError(err))
+	}
+	if digest != nil {
+		size = digest.size
+		if err := s.options.verifyPut(objectPath, digest.size, digest.etag(), s.head(objectPath)); err != nil {
+			return PutResult{}, err
+		}
+	}
+	if err := s.putDirectoryMarkers(objectPath); err != nil {
+		return PutResult{}, err
+	}
+	return PutResult{
+		ETag:      strings.Trim(respHeader.Get(oss.HTTPHeaderEtag), `"`),
+		VersionID: oss.GetVersionId(respHeader),
+		Size:      size,
+	}, nil
+}
+
+func (s *storageAlibabaOSS) PutResumable(objectPath string, source io.ReadSeeker, visibility ObjectVisibility) error {
+	objectPath = cleanOSSObjectPath(objectPath)
+	if err := putResumable(s, s.checkpoints, newPartSizer(resumablePartSize, s.options), objectPath, source, visibility); err != nil {
 		return err
 	}
+	return s.putDirectoryMarkers(objectPath)
+}
+
+func (s *storageAlibabaOSS) head(objectPath string) objectHead {
+	return func() (int64, string, error) {
+		header, err := s.ossBucket().GetObjectDetailedMeta(objectPath)
+		if err != nil {
+			return 0, "", err
+		}
+
+		size, err := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+		if err != nil {
+			return 0, "", err
+		}
+		return size, header.Get(oss.HTTPHeaderEtag), nil
+	}
+}
+
+func (s *storageAlibabaOSS) putDirectoryMarkers(objectPath string) error {
+	if !s.options.directoryMarkers {
+		return nil
+	}
 
-	return s.bucket.PutObject(cleanOSSObjectPath(objectPath), source, ossOptions...)
+	exist := func(key string) (bool, error) {
+		return s.ossBucket().IsObjectExist(key)
+	}
+	return ensureDirectoryMarkers(objectPath, exist, func(key string) error {
+		return s.ossBucket().PutObject(key, bytes.NewReader(nil))
+	})
 }
 
+func (s *storageAlibabaOSS) initiateUpload(objectPath string, visibility ObjectVisibility) (string, error) {
+	var ossOptions []oss.Option
+	visibility = s.options.putVisibility(visibility)
+	if acl, err := getACLOSSOrError(visibility); err != nil {
+		return "", err
+	} else if visibility != ObjectVisibilityInherit {
+		ossOptions = append(ossOptions, oss.ObjectACL(acl))
+	}
+
+	imur, err := s.ossBucket().InitiateMultipartUpload(objectPath, ossOptions...)
+	if err != nil {
+		return "", err
+	}
+	return imur.UploadID, nil
+}
+
+func (s *storageAlibabaOSS) uploadPart(objectPath string, uploadID string, partNumber int, data []byte) (string, error) {
+	part, err := s.ossBucket().UploadPart(s.multipartUpload(objectPath, uploadID), bytes.NewReader(data), int64(len(data)), partNumber)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (s *storageAlibabaOSS) completeUpload(objectPath string, uploadID string, parts []CheckpointPart) error {
+	var uploadParts []oss.UploadPart
+	for _, part := range parts {
+		uploadParts = append(uploadParts, oss.UploadPart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	_, err := s.ossBucket().CompleteMultipartUpload(s.multipartUpload(objectPath, uploadID), uploadParts)
+	return err
+}
+
+func (s *storageAlibabaOSS) abortUpload(objectPath string, uploadID string) error {
+	return ossError(s.ossBucket().AbortMultipartUpload(s.multipartUpload(objectPath, uploadID)))
+}
+
+func (s *storageAlibabaOSS) listUploadedParts(objectPath string, uploadID string) ([]CheckpointPart, error) {
+	var parts []CheckpointPart
+	var options []oss.Option
+	for {
+		result, err := s.ossBucket().ListUploadedParts(s.multipartUpload(objectPath, uploadID), options...)
+		if err != nil {
+			return nil, ossError(err)
+		}
+		for _, part := range result.UploadedParts {
+			parts = append(parts, CheckpointPart{Number: part.PartNumber, ETag: part.ETag, Size: int64(part.Size)})
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker, err := strconv.Atoi(result.NextPartNumberMarker)
+		if err != nil {
+			return nil, err
+		}
+		options = []oss.Option{oss.PartNumberMarker(marker)}
+	}
+}
+
+func (s *storageAlibabaOSS) signPartURL(objectPath string, uploadID string, partNumber int, expireIn time.Duration) (string, error) {
+	return s.ossBucket().SignURL(objectPath, oss.HTTPPut, int64(expireIn.Seconds()), oss.AddParam("partNumber", strconv.Itoa(partNumber)), oss.AddParam("uploadId", uploadID))
+}
+
+func (s *storageAlibabaOSS) multipartUpload(objectPath string, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{
+		Bucket:   s.ossBucket().BucketName,
+		Key:      objectPath,
+		UploadID: uploadID,
+	}
+}
+
+// Delete move objects to trash when enabled, see WithTrash
 func (s *storageAlibabaOSS) Delete(objectPaths ...string) error {
+	objectPaths, err := s.options.moveToTrash(s, objectPaths)
+	if err != nil {
+		return err
+	}
+	return s.deleteObjects(objectPaths...)
+}
+
+func (s *storageAlibabaOSS) deleteObjects(objectPaths ...string) error {
 	switch len(objectPaths) {
 	case 0:
 		return nil
 	case 1:
-		return s.bucket.DeleteObject(cleanOSSObjectPath(objectPaths[0]))
+		return ossError(s.ossBucket().DeleteObject(cleanOSSObjectPath(objectPaths[0])))
 	}
 
 	var cleanedPaths []string
 	for _, objectPath := range objectPaths {
 		cleanedPaths = append(cleanedPaths, cleanOSSObjectPath(objectPath))
 	}
-	_, err := s.bucket.DeleteObjects(objectPaths)
-	return err
+	result, err := s.ossBucket().DeleteObjects(cleanedPaths)
+	if err != nil {
+		return ossError(err)
+	}
+
+	// OSS report only deleted keys, the others failed without a reason
+	deleted := make(map[string]bool, len(result.DeletedObjects))
+	for _, key := range result.DeletedObjects {
+		deleted[key] = true
+	}
+	var failures []DeleteFailure
+	for _, key := range cleanedPaths {
+		if !deleted[key] {
+			failures = append(failures, DeleteFailure{ObjectPath: key, Code: "NotDeleted", Message: "object not reported as deleted"})
+		}
+	}
+	return newMultiDeleteError(objectPaths, cleanOSSObjectPath, failures)
+}
+
+func (s *storageAlibabaOSS) ListVersions(prefix string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	options := []oss.Option{oss.Prefix(trimPrefixRoot(prefix))}
+	for {
+		result, err := s.ossBucket().ListObjectVersions(options...)
+		if err != nil {
+			return nil, ossError(err)
+		}
+		for _, version := range result.ObjectVersions {
+			versions = append(versions, ObjectVersion{ObjectPath: version.Key, VersionID: version.VersionId})
+		}
+		for _, marker := range result.ObjectDeleteMarkers {
+			versions = append(versions, ObjectVersion{ObjectPath: marker.Key, VersionID: marker.VersionId, DeleteMarker: true})
+		}
+		if !result.IsTruncated {
+			return versions, nil
+		}
+		options = []oss.Option{
+			oss.Prefix(trimPrefixRoot(prefix)),
+			oss.KeyMarker(result.NextKeyMarker),
+			oss.VersionIdMarker(result.NextVersionIdMarker),
+		}
+	}
+}
+
+func (s *storageAlibabaOSS) DeleteVersions(versions ...ObjectVersion) error {
+	var failures []DeleteFailure
+	for start := 0; start < len(versions); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(versions) {
+			end = len(versions)
+		}
+
+		objects := make([]oss.DeleteObject, 0, end-start)
+		for _, version := range versions[start:end] {
+			objects = append(objects, oss.DeleteObject{Key: cleanOSSObjectPath(version.ObjectPath), VersionId: version.VersionID})
+		}
+		result, err := s.ossBucket().DeleteObjectVersions(objects)
+		if err != nil {
+			return ossError(err)
+		}
+
+		// OSS report only deleted versions, the others failed without a reason
+		deleted := make(map[oss.DeleteObject]bool, len(result.DeletedObjectsDetail))
+		for _, info := range result.DeletedObjectsDetail {
+			deleted[oss.DeleteObject{Key: info.Key, VersionId: info.VersionId}] = true
+		}
+		for _, object := range objects {
+			if !deleted[object] {
+				failures = append(failures, DeleteFailure{ObjectPath: object.Key, Code: "NotDeleted", Message: fmt.Sprintf("version %s not reported as deleted", object.VersionId)})
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return &MultiDeleteError{Failures: failures}
+	}
+	return nil
+}
+
+// DeletePrefix page through listed objects deleting them in batches
+func (s *storageAlibabaOSS) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
 }
 
+// Copy keep metadata and visibility of the source
 func (s *storageAlibabaOSS) Copy(srcObjectPath string, dstObjectPath string) error {
-	_, err := s.bucket.CopyObject(cleanOSSObjectPath(srcObjectPath), cleanOSSObjectPath(dstObjectPath))
+	return s.CopyWithOptions(srcObjectPath, dstObjectPath, CopyOptions{})
+}
+
+func (s *storageAlibabaOSS) CopyWithOptions(srcObjectPath string, dstObjectPath string, options CopyOptions) error {
+	var copyOptions []oss.Option
+
+	srcBucket := s.ossBucket()
+	if options.SourceBucket != "" {
+		var err error
+		if srcBucket, err = s.ossClient().Bucket(options.SourceBucket); err != nil {
+			return err
+		}
+	}
+
+	visibility := options.Visibility
+	if visibility == "" && !s.options.disableACL {
+		var err error
+		if visibility, err = ossVisibility(srcBucket, srcObjectPath); err != nil {
+			return err
+		}
+	}
+	acl, err := getACLOSSOrError(s.options.putVisibility(visibility))
+	if err != nil {
+		return err
+	}
+	copyOptions = append(copyOptions, oss.ObjectACL(acl))
+
+	if options.MetadataDirective == MetadataReplace {
+		copyOptions = append(copyOptions, oss.MetadataDirective(oss.MetaReplace))
+		copyOptions = append(copyOptions, ossMetadataOptions(ObjectMetadata{Headers: options.Headers, Metadata: options.Metadata})...)
+	}
+	if options.StorageClass != "" {
+		copyOptions = append(copyOptions, oss.ObjectStorageClass(oss.StorageClassType(options.StorageClass)))
+	}
+	if options.ReplaceTags {
+		copyOptions = append(copyOptions, oss.TaggingDirective(oss.TaggingReplace))
+		if len(options.Tags) > 0 {
+			tagging := oss.Tagging{}
+			for _, key := range sortedTagKeys(options.Tags) {
+				tagging.Tags = append(tagging.Tags, oss.Tag{Key: key, Value: options.Tags[key]})
+			}
+			copyOptions = append(copyOptions, oss.SetTagging(tagging))
+		}
+	}
+
+	if srcBucket != s.ossBucket() {
+		_, err = s.ossBucket().CopyObjectFrom(srcBucket.BucketName, cleanOSSObjectPath(srcObjectPath), cleanOSSObjectPath(dstObjectPath), copyOptions...)
+		return ossError(err)
+	}
+	_, err = s.ossBucket().CopyObject(cleanOSSObjectPath(srcObjectPath), cleanOSSObjectPath(dstObjectPath), copyOptions...)
+	return ossError(err)
+}
+
+// CopyPrefix copy listed objects server-side using WithCopyConcurrency parallel requests
+func (s *storageAlibabaOSS) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, s.options.copyWorkers())
+}
+
+// Restore move the latest trashed copy of objectPath back, see WithTrash
+func (s *storageAlibabaOSS) Restore(objectPath string) error {
+	return s.options.restoreFromTrash(s, objectPath)
+}
+
+// PurgeTrash delete objects trashed more than olderThan ago for good
+func (s *storageAlibabaOSS) PurgeTrash(olderThan time.Duration) error {
+	return s.options.purgeTrash(s, olderThan)
+}
+
+// Move copy server-side then delete the source
+func (s *storageAlibabaOSS) Move(srcObjectPath string, dstObjectPath string) error {
+	return moveByCopy(s, srcObjectPath, dstObjectPath)
+}
+
+func (s *storageAlibabaOSS) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	sizes := make([]int64, len(srcObjectPaths))
+	for i, srcObjectPath := range srcObjectPaths {
+		size, err := s.Size(srcObjectPath)
+		if err != nil {
+			return err
+		}
+		sizes[i] = size
+	}
+
+	// small parts can't be copied server-side, stream them instead
+	parts, ok := composeParts(sizes, ossMinPartSize, ossMaxPartCopySize, ossMaxParts)
+	if !ok {
+		return Concat(s, dstObjectPath, visibility, srcObjectPaths...)
+	}
+
+	var ossOptions []oss.Option
+	visibility = s.options.putVisibility(visibility)
+	if acl, err := getACLOSSOrError(visibility); err != nil {
+		return err
+	} else if visibility != ObjectVisibilityInherit {
+		ossOptions = append(ossOptions, oss.ObjectACL(acl))
+	}
+
+	imur, err := s.ossBucket().InitiateMultipartUpload(cleanOSSObjectPath(dstObjectPath), ossOptions...)
+	if err != nil {
+		return err
+	}
+
+	var uploadParts []oss.UploadPart
+	for i, part := range parts {
+		uploadPart, err := s.ossBucket().UploadPartCopy(imur, s.ossBucket().BucketName, cleanOSSObjectPath(srcObjectPaths[part.source]), part.offset, part.length, i+1)
+		if err != nil {
+			_ = s.ossBucket().AbortMultipartUpload(imur)
+			return err
+		}
+		uploadParts = append(uploadParts, uploadPart)
+	}
+
+	_, err = s.ossBucket().CompleteMultipartUpload(imur, uploadParts)
 	return err
 }
 
@@ -89,7 +644,7 @@ func (s *storageAlibabaOSS) URL(objectPath string, storageResize *StorageResize)
 		return "", nil
 	}
 	objectPath = cleanOSSObjectPath(objectPath)
-	endpoint := removeSchemeFromEndpoint(s.bucket.GetConfig().Endpoint)
+	endpoint := removeSchemeFromEndpoint(s.publicBucket.GetConfig().Endpoint)
 
 	rawQuery := ""
 	if storageResize != nil {
@@ -99,7 +654,7 @@ func (s *storageAlibabaOSS) URL(objectPath string, storageResize *StorageResize)
 
 	u := url.URL{
 		Scheme:   "https",
-		Path:     path.Join(fmt.Sprintf("%s.%s", s.bucket.BucketName, endpoint), objectPath),
+		Path:     path.Join(fmt.Sprintf("%s.%s", s.ossBucket().BucketName, endpoint), objectPath),
 		RawQuery: rawQuery,
 	}
 
@@ -107,29 +662,53 @@ func (s *storageAlibabaOSS) URL(objectPath string, storageResize *StorageResize)
 }
 
 func (s *storageAlibabaOSS) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
-	if expireIn < ossSignedURLExpire {
-		expireIn = ossSignedURLExpire
-	}
+	return s.TemporaryURLWithOptions(objectPath, expireIn, SignedURLOptions{Resize: storageResize})
+}
+
+// TemporaryURLWithOptions sign query parameters which are OSS sub-resources (e.g. versionId,
+// response-* and x-oss-process), others are added to the URL unsigned
+func (s *storageAlibabaOSS) TemporaryURLWithOptions(objectPath string, expireIn time.Duration, options SignedURLOptions) (string, error) {
+	objectPath = cleanOSSObjectPath(objectPath)
+	expireIn = s.options.clampURLExpiry(objectPath, expireIn, ossSignedURLExpire)
 
 	expireInSec := int64(expireIn / time.Second)
-	storageResizeQuery := storageResize.ConvertForOss()
-	return s.bucket.SignURL(objectPath, oss.HTTPGet, expireInSec, oss.Process(storageResizeQuery))
+	signOptions := []oss.Option{oss.Process(options.Resize.ConvertForOss())}
+	for key, value := range options.Query {
+		if key == "x-oss-process" {
+			// custom style replace the resize process
+			signOptions[0] = oss.Process(value)
+			continue
+		}
+		signOptions = append(signOptions, oss.AddParam(key, value))
+	}
+	for key, value := range options.Headers {
+		signOptions = append(signOptions, oss.SetHeader(key, value))
+	}
+	return s.publicBucket.SignURL(objectPath, oss.HTTPGet, expireInSec, signOptions...)
+}
+
+func (s *storageAlibabaOSS) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	return signURLs(objectPaths, func(objectPath string) (string, error) {
+		return s.TemporaryURL(objectPath, expireIn, storageResize)
+	})
 }
 
 func (s *storageAlibabaOSS) Size(objectPath string) (int64, error) {
-	r, err := s.bucket.GetObjectMeta(cleanOSSObjectPath(objectPath))
+	value, _, err := s.options.hedge(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return s.ossBucket().GetObjectMeta(cleanOSSObjectPath(objectPath))
+	}, nil)
 	if err != nil {
-		return 0, err
+		return 0, ossError(err)
 	}
 
-	sizeStr := r.Get("Content-Length")
+	sizeStr := value.(http.Header).Get("Content-Length")
 	return strconv.ParseInt(sizeStr, 10, 64)
 }
 
 func (s *storageAlibabaOSS) LastModified(objectPath string) (time.Time, error) {
-	r, err := s.bucket.GetObjectMeta(cleanOSSObjectPath(objectPath))
+	r, err := s.ossBucket().GetObjectMeta(cleanOSSObjectPath(objectPath))
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, ossError(err)
 	}
 
 	LastModified, err := http.ParseTime(r.Get("Last-Modified"))
@@ -140,22 +719,196 @@ func (s *storageAlibabaOSS) LastModified(objectPath string) (time.Time, error) {
 	return LastModified, nil
 }
 
+func (s *storageAlibabaOSS) Stat(objectPath string) (ObjectInfo, error) {
+	objectPath = cleanOSSObjectPath(objectPath)
+	value, _, err := s.options.hedge(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return s.ossBucket().GetObjectDetailedMeta(objectPath)
+	}, nil)
+	if err != nil {
+		return ObjectInfo{}, ossError(err)
+	}
+
+	header := value.(http.Header)
+	size, err := strconv.ParseInt(header.Get(oss.HTTPHeaderContentLength), 10, 64)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	lastModified, err := http.ParseTime(header.Get(oss.HTTPHeaderLastModified))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		ObjectPath:   objectPath,
+		Size:         size,
+		LastModified: lastModified,
+		ContentType:  header.Get(oss.HTTPHeaderContentType),
+		ETag:         strings.Trim(header.Get(oss.HTTPHeaderEtag), `"`),
+	}, nil
+}
+
+// MimeType return Content-Type stored with the object
+func (s *storageAlibabaOSS) MimeType(objectPath string) (string, error) {
+	info, err := s.Stat(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return info.ContentType, nil
+}
+
+// Checksum use Content-MD5 and x-oss-hash-crc64ecma headers where present, other checksums are computed
+// by reading the object
+func (s *storageAlibabaOSS) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	if algo == ChecksumMD5 || algo == ChecksumCRC64ECMA {
+		header, err := s.ossBucket().GetObjectDetailedMeta(cleanOSSObjectPath(objectPath))
+		if err != nil {
+			return "", ossError(err)
+		}
+		if sum, ok := contentMD5(header.Get(oss.HTTPHeaderContentMD5)); ok && algo == ChecksumMD5 {
+			return sum, nil
+		}
+		if crc := header.Get(oss.HTTPHeaderOssCRC64); crc != "" && algo == ChecksumCRC64ECMA {
+			return crc, nil
+		}
+	}
+	return streamChecksum(s, objectPath, algo)
+}
+
+func (s *storageAlibabaOSS) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	value, _, err := s.options.hedge(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return s.ossBucket().GetObjectDetailedMeta(cleanOSSObjectPath(objectPath))
+	}, nil)
+	if err != nil {
+		return ObjectMetadata{}, ossError(err)
+	}
+
+	header := value.(http.Header)
+	metadata := make(map[string]string)
+	for key := range header {
+		if strings.HasPrefix(strings.ToLower(key), strings.ToLower(oss.HTTPHeaderOssMetaPrefix)) {
+			metadata[strings.ToLower(key[len(oss.HTTPHeaderOssMetaPrefix):])] = header.Get(key)
+		}
+	}
+
+	return ObjectMetadata{
+		Headers: ObjectHeaders{
+			ContentType:        header.Get(oss.HTTPHeaderContentType),
+			ContentDisposition: header.Get(oss.HTTPHeaderContentDisposition),
+			CacheControl:       header.Get(oss.HTTPHeaderCacheControl),
+		},
+		Metadata: lowerMetadata(metadata),
+	}, nil
+}
+
+// SetMetadata copy the object onto itself replacing its metadata
+func (s *storageAlibabaOSS) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	return s.CopyWithOptions(objectPath, objectPath, CopyOptions{
+		MetadataDirective: MetadataReplace,
+		Headers:           metadata.Headers,
+		Metadata:          metadata.Metadata,
+	})
+}
+
+// Touch copy existing objects onto themselves
+func (s *storageAlibabaOSS) Touch(objectPath string) error {
+	return touchObject(s, objectPath)
+}
+
+// ossMetadataOptions return options setting headers and user metadata
+func ossMetadataOptions(metadata ObjectMetadata) []oss.Option {
+	var options []oss.Option
+	if metadata.Headers.ContentType != "" {
+		options = append(options, oss.ContentType(metadata.Headers.ContentType))
+	}
+	if metadata.Headers.ContentDisposition != "" {
+		options = append(options, oss.ContentDisposition(metadata.Headers.ContentDisposition))
+	}
+	if metadata.Headers.CacheControl != "" {
+		options = append(options, oss.CacheControl(metadata.Headers.CacheControl))
+	}
+	for _, key := range sortedTagKeys(metadata.Metadata) {
+		options = append(options, oss.Meta(key, metadata.Metadata[key]))
+	}
+	return options
+}
+
 func (s *storageAlibabaOSS) Exist(objectPath string) (bool, error) {
-	return s.bucket.IsObjectExist(cleanOSSObjectPath(objectPath))
+	objectPath = cleanOSSObjectPath(objectPath)
+	value, _, err := s.options.hedge(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return s.ossBucket().IsObjectExist(objectPath)
+	}, nil)
+	exist, _ := value.(bool)
+	if err != nil || exist || !s.options.directoryMarkers {
+		return exist, ossError(err)
+	}
+
+	exist, err = s.ossBucket().IsObjectExist(objectPath + "/")
+	return exist, ossError(err)
+}
+
+// ExistMany list common prefix of many paths instead of sending a HEAD request per path
+func (s *storageAlibabaOSS) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	if s.options.directoryMarkers {
+		return existEach(s, objectPaths)
+	}
+	return existMany(s, objectPaths)
+}
+
+func (s *storageAlibabaOSS) List(prefix string) (ObjectIterator, error) {
+	return s.listAfter(prefix, "")
+}
+
+// listAfter list objects under prefix whose path sort after startAfter
+func (s *storageAlibabaOSS) listAfter(prefix string, startAfter string) (ObjectIterator, error) {
+	prefix = strings.TrimPrefix(filepath.ToSlash(prefix), "/")
+	return newPagedObjectIterator(func(token string) ([]ObjectInfo, string, error) {
+		// marker of OSS is the key listing start after
+		if token == "" {
+			token = startAfter
+		}
+		result, err := s.ossBucket().ListObjects(oss.Prefix(prefix), oss.Marker(token))
+		if err != nil {
+			return nil, "", ossError(err)
+		}
+
+		objects := make([]ObjectInfo, 0, len(result.Objects))
+		for _, object := range result.Objects {
+			if strings.HasSuffix(object.Key, "/") {
+				// directory marker
+				continue
+			}
+			objects = append(objects, ObjectInfo{
+				ObjectPath:   object.Key,
+				Size:         object.Size,
+				LastModified: object.LastModified,
+				ETag:         strings.Trim(object.ETag, `"`),
+			})
+		}
+
+		if !result.IsTruncated {
+			return objects, "", nil
+		}
+		return objects, result.NextMarker, nil
+	})
 }
 
 func (s *storageAlibabaOSS) SetVisibility(objectPath string, visibility ObjectVisibility) error {
 	if acl, err := getACLOSSOrError(visibility); err == nil {
-		return s.bucket.SetObjectACL(cleanOSSObjectPath(objectPath), acl)
+		return ossError(s.ossBucket().SetObjectACL(cleanOSSObjectPath(objectPath), acl))
 	} else {
 		return err
 	}
 }
 
 func (s *storageAlibabaOSS) GetVisibility(objectPath string) (ObjectVisibility, error) {
-	result, err := s.bucket.GetObjectACL(cleanOSSObjectPath(objectPath))
+	return ossVisibility(s.ossBucket(), objectPath)
+}
+
+// ossVisibility return visibility of objectPath in bucket, which may differ from the storage bucket
+func ossVisibility(bucket *oss.Bucket, objectPath string) (ObjectVisibility, error) {
+	result, err := bucket.GetObjectACL(cleanOSSObjectPath(objectPath))
 	if err != nil {
-		return "", err
+		return "", ossError(err)
 	}
 
 	aclType := oss.ACLType(result.ACL)
@@ -165,18 +918,62 @@ func (s *storageAlibabaOSS) GetVisibility(objectPath string) (ObjectVisibility,
 		return ObjectPublicRead, nil
 	} else if aclType == oss.ACLPublicReadWrite {
 		return ObjectPublicReadWrite, nil
+	} else if aclType == oss.ACLDefault {
+		return ObjectVisibilityInherit, nil
 	}
 
 	return "", fmt.Errorf("invalid returned ACL value")
 }
 
+func (s *storageAlibabaOSS) GetACL(objectPath string) ([]Grant, error) {
+	result, err := s.ossBucket().GetObjectACL(cleanOSSObjectPath(objectPath))
+	if err != nil {
+		return nil, ossError(err)
+	}
+
+	aclType := oss.ACLType(result.ACL)
+	if aclType == oss.ACLDefault {
+		bucketACL, err := s.ossClient().GetBucketACL(s.ossBucket().BucketName)
+		if err != nil {
+			return nil, ossError(err)
+		}
+		aclType = oss.ACLType(bucketACL.ACL)
+	}
+
+	switch aclType {
+	case oss.ACLPrivate:
+		return visibilityGrants(result.Owner.ID, ObjectPrivate), nil
+	case oss.ACLPublicRead:
+		return visibilityGrants(result.Owner.ID, ObjectPublicRead), nil
+	case oss.ACLPublicReadWrite:
+		return visibilityGrants(result.Owner.ID, ObjectPublicReadWrite), nil
+	}
+
+	return nil, fmt.Errorf("invalid returned ACL value")
+}
+
+func (s *storageAlibabaOSS) Capabilities() Capabilities {
+	return Capabilities{
+		ResizeURL:       true,
+		Versioning:      true,
+		Tagging:         true,
+		PresignedUpload: true,
+		Append:          true,
+	}
+}
+
 func getACLOSSOrError(visibility ObjectVisibility) (oss.ACLType, error) {
 	if visibility == ObjectPublicRead {
 		return oss.ACLPublicRead, nil
 	} else if visibility == ObjectPublicReadWrite {
 		return oss.ACLPublicReadWrite, nil
-	} else if visibility == ObjectPrivate {
+	} else if visibility == ObjectPrivate || visibility == ObjectBucketOwnerFullControl {
+		// objects always belong to the bucket owner
 		return oss.ACLPrivate, nil
+	} else if visibility == ObjectVisibilityInherit {
+		return oss.ACLDefault, nil
+	} else if visibility == ObjectAuthenticatedRead {
+		return "", fmt.Errorf("err object visibility %s is not supported by OSS", visibility)
 	} else {
 		return "", fmt.Errorf("err invalid object visibility: %s", visibility)
 	}
@@ -2,29 +2,39 @@ package gostorage
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
-	"path"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/sirupsen/logrus"
 )
 
 const (
 	maxRetry          = 3           // maximum retry for uploading part
 	s3PartSize        = 5120 * 1024 // 5MB is minimum s3 part size upload
+	s3MaxParts        = 10000
+	s3MaxPartCopySize = 5 * 1024 * 1024 * 1024 // 5GB is maximum size of a part copied with UploadPartCopy
 	s3SignedURLExpire = 24 * time.Hour
 )
 
 type storageS3 struct {
-	awsSession *session.Session
-	s3         *s3.S3
-	bucketName string
+	options       storageOptions
+	awsSession    *session.Session
+	s3            *s3.S3
+	bucketName    string
+	publicBaseURL string
+	checkpoints   CheckpointStore
 }
 
 // NewAWSS3Storage create new storage backed by AWS S3
@@ -33,115 +43,452 @@ func NewAWSS3Storage(
 	region string,
 	accessKeyID string,
 	secretAccessKey string,
-	sessionToken string) Storage {
-	sess, err := session.NewSession(&aws.Config{
+	sessionToken string,
+	opts ...Option) Storage {
+	options := newStorageOptions(opts)
+	publicBaseURL := ""
+	config := &aws.Config{
 		Region: aws.String(region),
 		Credentials: credentials.NewStaticCredentials(
 			accessKeyID,
 			secretAccessKey,
 			sessionToken,
 		),
-	})
+	}
+	if options.s3Express {
+		if !isS3ExpressBucket(bucketName) {
+			panic(fmt.Errorf("err %s is not a directory bucket name", bucketName))
+		}
+		endpoint, err := s3ExpressEndpoint(bucketName, region)
+		if err != nil {
+			panic(err)
+		}
+		config.Endpoint = aws.String(endpoint)
+	} else if options.s3Endpoint != "" {
+		endpoint := options.s3Endpoint
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "https://" + endpoint
+		}
+		endpoint = strings.TrimSuffix(endpoint, "/")
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(options.s3PathStyle)
+
+		var err error
+		if publicBaseURL, err = s3PublicURL(endpoint, bucketName, options.s3PathStyle); err != nil {
+			panic(err)
+		}
+	}
+
+	storage := newS3Storage(bucketName, config, publicBaseURL, options)
+	if options.s3Express {
+		useS3ExpressSession(storage.s3, newS3ExpressSessionProvider(config.Credentials, aws.StringValue(config.Endpoint), bucketName, region, config.HTTPClient))
+	}
+	return storage
+}
+
+// newS3Storage create storage talking S3 API, shared by every S3 compatible backend.
+// publicBaseURL is prefix of object URL, empty means AWS S3 virtual hosted URL.
+func newS3Storage(bucketName string, config *aws.Config, publicBaseURL string, options storageOptions) *storageS3 {
+	if config.HTTPClient == nil {
+		config.HTTPClient = options.s3HTTPClient()
+	}
+
+	sess, err := session.NewSession(config)
 	if err != nil {
 		panic(err)
 	}
 
-	svc := s3.New(sess)
-	return &storageS3{
-		awsSession: sess,
-		s3:         svc,
-		bucketName: bucketName,
+	if options.retryBudget != nil {
+		useRetryBudget(&sess.Handlers, options.retryBudget, options.logger)
+	}
+	useSentinelErrors(&sess.Handlers)
+	if len(options.s3Endpoints) > 0 {
+		pool, err := newS3EndpointPool(options.s3Endpoints, options.s3EndpointOptions)
+		if err != nil {
+			panic(err)
+		}
+		useS3Endpoints(&sess.Handlers, pool, bucketName)
 	}
+
+	storage := &storageS3{
+		options:       options,
+		awsSession:    sess,
+		s3:            s3.New(sess),
+		bucketName:    bucketName,
+		publicBaseURL: strings.TrimSuffix(publicBaseURL, "/"),
+	}
+	storage.checkpoints = options.newCheckpointStore(storage)
+	return storage
 }
 
 func cleanS3ObjectPath(objectPath string) string {
-	return path.Clean(filepath.ToSlash(objectPath))
+	return objectKey(objectPath)
+}
+
+func (s *storageS3) Connect(ctx context.Context) error {
+	if s.options.preflight {
+		report, err := s.Validate(ctx)
+		if err != nil {
+			return err
+		}
+		return report.Err()
+	}
+
+	ctx, cancel := s.options.operationContext(ctx, operationMetadata)
+	defer cancel()
+
+	_, err := s.s3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: &s.bucketName,
+	})
+	return err
+}
+
+func (s *storageS3) Ping(ctx context.Context) error {
+	ctx, cancel := s.options.operationContext(ctx, operationMetadata)
+	defer cancel()
+
+	_, err := s.s3.HeadBucketWithContext(ctx, &s3.HeadBucketInput{
+		Bucket: &s.bucketName,
+	})
+	return err
 }
 
 func (s *storageS3) Read(objectPath string) (io.ReadCloser, error) {
+	return s.ReadVersion(objectPath, "")
+}
+
+func (s *storageS3) ReadVersion(objectPath string, versionID string) (io.ReadCloser, error) {
+	return s.read(objectPath, versionID, Preconditions{})
+}
+
+func (s *storageS3) ReadWithOptions(objectPath string, options ReadOptions) (io.ReadCloser, error) {
+	return s.read(objectPath, "", options.Preconditions)
+}
+
+func (s *storageS3) read(objectPath string, versionID string, preconditions Preconditions) (io.ReadCloser, error) {
 	objectPath = cleanS3ObjectPath(objectPath)
-	output, err := s.s3.GetObject(&s3.GetObjectInput{
-		Bucket: &s.bucketName,
-		Key:    &objectPath,
+	ctx, cancelOperation := s.options.operationContext(context.Background(), operationRead)
+	value, cancelAttempt, err := s.options.hedge(ctx, func(ctx context.Context) (interface{}, error) {
+		input := &s3.GetObjectInput{
+			Bucket:    &s.bucketName,
+			Key:       &objectPath,
+			VersionId: s3VersionID(versionID),
+		}
+		s3ReadPreconditions(input, preconditions)
+		return s.s3.GetObjectWithContext(ctx, input)
+	}, func(value interface{}) {
+		value.(*s3.GetObjectOutput).Body.Close()
 	})
 
 	if err != nil {
+		cancelOperation()
 		return nil, err
 	}
+	output := value.(*s3.GetObjectOutput)
+	cancel := func() {
+		cancelAttempt()
+		cancelOperation()
+	}
 
-	return output.Body, nil
+	body := output.Body
+	if s.options.readRetryAttempts > 0 {
+		body = newRetryReader("S3", body, func(offset int64) (io.ReadCloser, error) {
+			output, err := s.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+				Bucket:    &s.bucketName,
+				Key:       &objectPath,
+				VersionId: s3VersionID(versionID),
+				Range:     aws.String(fmt.Sprintf("bytes=%d-", offset)),
+				IfMatch:   output.ETag,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return output.Body, nil
+		}, s.options.readRetryAttempts, s.options.retryBudget, s.options.logger)
+	}
+
+	body = s.options.readProgress(s.options.stallReader(body), aws.Int64Value(output.ContentLength))
+	return &cancelOnCloseReader{ReadCloser: body, cancel: cancel}, nil
+}
+
+func (s *storageS3) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationRead)
+	output, err := s.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: &s.bucketName,
+		Key:    &objectPath,
+		Range:  aws.String(httpRange(offset, length)),
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	body := s.options.readProgress(s.options.stallReader(output.Body), aws.Int64Value(output.ContentLength))
+	return &cancelOnCloseReader{ReadCloser: body, cancel: cancel}, nil
 }
 
 func (s *storageS3) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	return s.PutWithHeaders(objectPath, source, visibility, ObjectHeaders{})
+}
+
+// Writer stream written data as multipart upload, aborted on CloseWithError
+func (s *storageS3) Writer(objectPath string, visibility ObjectVisibility) (ObjectWriter, error) {
+	return newPipeObjectWriter(func(source io.Reader) error {
+		return s.Put(objectPath, source, visibility)
+	}), nil
+}
+
+func (s *storageS3) PutWithHeaders(objectPath string, source io.Reader, visibility ObjectVisibility, headers ObjectHeaders) error {
+	return s.PutWithOptions(objectPath, source, PutOptions{Visibility: visibility, ObjectMetadata: ObjectMetadata{Headers: headers}})
+}
+
+func (s *storageS3) PutWithOptions(objectPath string, source io.Reader, options PutOptions) error {
+	_, err := s.PutWithResult(objectPath, source, options)
+	return err
+}
+
+// PutWithResult upload source in parts, ETag and version are the ones of the completed upload
+func (s *storageS3) PutWithResult(objectPath string, source io.Reader, options PutOptions) (PutResult, error) {
 	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationPut)
+	defer cancel()
+
+	if err := checkPreconditions(s, objectPath, options.Preconditions, false); err != nil {
+		return PutResult{}, err
+	}
 
-	acl, err := getS3ACLOrError(visibility)
+	progress := s.options.transferProgress(sourceSize(source))
+	ctx, stall := s.options.stallContext(ctx)
+	defer stall.stop()
+	source, options, err := s.options.preparePut(objectPath, stall.reader(source), options)
 	if err != nil {
-		return err
+		return PutResult{}, stall.err(err)
+	}
+	acl, err := getS3ACLOrError(s.options.putVisibility(options.Visibility))
+	if err != nil {
+		return PutResult{}, err
 	}
 
 	expireAt := time.Now().Add(time.Hour * 6)
-	createdResp, err := s.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+	input := &s3.CreateMultipartUploadInput{
 		ACL:     acl,
 		Bucket:  &s.bucketName,
 		Key:     &objectPath,
 		Expires: &expireAt,
-	})
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = aws.String(options.StorageClass)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+	if headers := options.Headers; headers.ContentType != "" {
+		input.ContentType = aws.String(headers.ContentType)
+	}
+	if headers := options.Headers; headers.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(headers.ContentDisposition)
+	}
+	if headers := options.Headers; headers.CacheControl != "" {
+		input.CacheControl = aws.String(headers.CacheControl)
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+
+	createdResp, err := s.s3.CreateMultipartUploadWithContext(ctx, input)
 
 	if err != nil {
-		return err
+		return PutResult{}, stall.err(err)
 	}
+	stall.touch()
 
 	var partNumber int64 = 1
 	var completedParts []*s3.CompletedPart
-	buffer := make([]byte, s3PartSize)
-	for {
+	var partMD5s [][]byte
+	var size int64
+	var buffer []byte
+	sizer := newPartSizer(s3PartSize, s.options)
+	defer sizer.release()
+	for last := false; !last; {
+		buffer = sizer.buffer(buffer)
+		var bytesRead int
+		bytesRead, last, err = fillPart(source, buffer)
 
-		bytesRead, err := source.Read(buffer)
-
-		if err != nil && err != io.EOF {
-			if err := abortMultipartUpload(s.s3, createdResp); err != nil {
-				logrus.Debugf("[S3] error aborting multipart upload, while reading data: %s\n", err.Error())
-				return err
+		if err != nil {
+			if err := abortMultipartUpload(ctx, s.s3, createdResp); err != nil {
+				s.options.logger.Debugf("[S3] error aborting multipart upload, while reading data: %s\n", err.Error())
+				return PutResult{}, stall.err(err)
 			}
-			return err
+			return PutResult{}, stall.err(err)
 		}
 
-		if bytesRead <= 0 {
+		// empty sources are uploaded as a single empty part, completing an upload require one
+		if bytesRead == 0 && len(completedParts) > 0 {
 			break
 		}
 
-		completed, err := uploadMultipart(s.s3, createdResp, buffer[:bytesRead], partNumber)
+		startedAt := time.Now()
+		completed, err := uploadMultipart(ctx, s.s3, s.options.logger, createdResp, buffer[:bytesRead], partNumber, stall.requestOptions()...)
 		if err != nil {
-			if err := abortMultipartUpload(s.s3, createdResp); err != nil {
-				logrus.Debugf("[S3] error aborting multipart upload: %s\n", err.Error())
-				return err
+			if err := abortMultipartUpload(ctx, s.s3, createdResp); err != nil {
+				s.options.logger.Debugf("[S3] error aborting multipart upload: %s\n", err.Error())
+				return PutResult{}, stall.err(err)
 			}
-			return err
+			return PutResult{}, stall.err(err)
 		}
 
+		sizer.observe(bytesRead, time.Since(startedAt))
 		partNumber++
 		completedParts = append(completedParts, completed)
+		size += int64(bytesRead)
+		progress.add(int64(bytesRead))
+		if s.options.putVerifyAttempts > 0 {
+			sum := md5.Sum(buffer[:bytesRead])
+			partMD5s = append(partMD5s, sum[:])
+		}
 	}
 
-	completionResp, err := s.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+	completed, err := s.s3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
 		Bucket:   createdResp.Bucket,
 		Key:      createdResp.Key,
 		UploadId: createdResp.UploadId,
 		MultipartUpload: &s3.CompletedMultipartUpload{
 			Parts: completedParts,
 		},
-	})
+	}, s3PreconditionHeaders(options.Preconditions)...)
 
 	if err != nil {
+		return PutResult{}, stall.err(err)
+	}
+	stall.stop()
+
+	s.options.logger.Debugf("[S3] upload success: %s (%d parts)\n", objectPath, len(completedParts))
+	if err := s.options.verifyPut(objectPath, size, multipartETag(partMD5s), s.head(objectPath)); err != nil {
+		return PutResult{}, err
+	}
+	if err := s.putDirectoryMarkers(objectPath); err != nil {
+		return PutResult{}, err
+	}
+	return PutResult{
+		ETag:      strings.Trim(aws.StringValue(completed.ETag), `"`),
+		VersionID: aws.StringValue(completed.VersionId),
+		Size:      size,
+	}, nil
+}
+
+func (s *storageS3) PutResumable(objectPath string, source io.ReadSeeker, visibility ObjectVisibility) error {
+	objectPath = cleanS3ObjectPath(objectPath)
+	if err := putResumable(s, s.checkpoints, newPartSizer(resumablePartSize, s.options), objectPath, source, visibility); err != nil {
 		return err
 	}
+	return s.putDirectoryMarkers(objectPath)
+}
 
-	logrus.Debugf("[S3] Upload success: %s\n", completionResp.String())
-	return nil
+func (s *storageS3) initiateUpload(objectPath string, visibility ObjectVisibility) (string, error) {
+	acl, err := getS3ACLOrError(s.options.putVisibility(visibility))
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := s.options.operationContext(context.Background(), operationPut)
+	defer cancel()
+
+	input := &s3.CreateMultipartUploadInput{
+		ACL:    acl,
+		Bucket: &s.bucketName,
+		Key:    &objectPath,
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+	createdResp, err := s.s3.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(createdResp.UploadId), nil
+}
+
+func (s *storageS3) uploadPart(objectPath string, uploadID string, partNumber int, data []byte) (string, error) {
+	ctx, cancel := s.options.operationContext(context.Background(), operationPut)
+	defer cancel()
+
+	completed, err := uploadMultipart(ctx, s.s3, s.options.logger, &s3.CreateMultipartUploadOutput{
+		Bucket:   &s.bucketName,
+		Key:      &objectPath,
+		UploadId: &uploadID,
+	}, data, int64(partNumber))
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(completed.ETag), nil
+}
+
+func (s *storageS3) completeUpload(objectPath string, uploadID string, parts []CheckpointPart) error {
+	ctx, cancel := s.options.operationContext(context.Background(), operationPut)
+	defer cancel()
+
+	var completedParts []*s3.CompletedPart
+	for _, part := range parts {
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		})
+	}
+
+	_, err := s.s3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   &s.bucketName,
+		Key:      &objectPath,
+		UploadId: &uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	return err
+}
+
+func (s *storageS3) abortUpload(objectPath string, uploadID string) error {
+	ctx, cancel := s.options.operationContext(context.Background(), operationDelete)
+	defer cancel()
+
+	return abortMultipartUpload(ctx, s.s3, &s3.CreateMultipartUploadOutput{
+		Bucket:   &s.bucketName,
+		Key:      &objectPath,
+		UploadId: &uploadID,
+	})
+}
+
+func (s *storageS3) listUploadedParts(objectPath string, uploadID string) ([]CheckpointPart, error) {
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	var parts []CheckpointPart
+	err := s.s3.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{
+		Bucket:   &s.bucketName,
+		Key:      &objectPath,
+		UploadId: &uploadID,
+	}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			parts = append(parts, CheckpointPart{
+				Number: int(aws.Int64Value(part.PartNumber)),
+				ETag:   aws.StringValue(part.ETag),
+				Size:   aws.Int64Value(part.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+func (s *storageS3) signPartURL(objectPath string, uploadID string, partNumber int, expireIn time.Duration) (string, error) {
+	req, _ := s.s3.UploadPartRequest(&s3.UploadPartInput{
+		Bucket:     &s.bucketName,
+		Key:        &objectPath,
+		UploadId:   &uploadID,
+		PartNumber: aws.Int64(int64(partNumber)),
+	})
+	return req.Presign(expireIn)
 }
 
-func uploadMultipart(service *s3.S3, resp *s3.CreateMultipartUploadOutput, data []byte, partNumber int64) (*s3.CompletedPart, error) {
+func uploadMultipart(ctx context.Context, service *s3.S3, logger Logger, resp *s3.CreateMultipartUploadOutput, data []byte, partNumber int64, opts ...request.Option) (*s3.CompletedPart, error) {
 	uploadInput := &s3.UploadPartInput{
 		Bucket:        resp.Bucket,
 		Key:           resp.Key,
@@ -153,16 +500,16 @@ func uploadMultipart(service *s3.S3, resp *s3.CreateMultipartUploadOutput, data
 
 	var retry int
 	for retry < maxRetry {
-		logrus.Debugf("[S3] uploading (%d bytes) part %d - %s\n", len(data), partNumber, *resp.Key)
-		uploadResp, err := service.UploadPart(uploadInput)
+		logger.Debugf("[S3] uploading (%d bytes) part %d - %s\n", len(data), partNumber, *resp.Key)
+		uploadResp, err := service.UploadPartWithContext(ctx, uploadInput, opts...)
 
 		if err != nil {
 			retry++
-			if retry >= maxRetry {
+			if retry >= maxRetry || ctx.Err() != nil {
 				return nil, err
 			}
 			time.Sleep(time.Second * 2)
-			logrus.Debugf("[S3] retrying part %d - %s, err: %s\n", partNumber, *resp.Key, err.Error())
+			logger.Debugf("[S3] retrying part %d - %s, err: %s\n", partNumber, *resp.Key, err.Error())
 			continue
 		}
 
@@ -174,8 +521,8 @@ func uploadMultipart(service *s3.S3, resp *s3.CreateMultipartUploadOutput, data
 	return nil, nil
 }
 
-func abortMultipartUpload(service *s3.S3, resp *s3.CreateMultipartUploadOutput) error {
-	_, err := service.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+func abortMultipartUpload(ctx context.Context, service *s3.S3, resp *s3.CreateMultipartUploadOutput) error {
+	_, err := service.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
 		Bucket:   resp.Bucket,
 		Key:      resp.Key,
 		UploadId: resp.UploadId,
@@ -183,13 +530,31 @@ func abortMultipartUpload(service *s3.S3, resp *s3.CreateMultipartUploadOutput)
 	return err
 }
 
+// Delete move objects to trash when enabled, see WithTrash
 func (s *storageS3) Delete(objectPaths ...string) error {
+	objectPaths, err := s.options.moveToTrash(s, objectPaths)
+	if err != nil {
+		return err
+	}
+	return s.deleteObjects(objectPaths...)
+}
+
+func (s *storageS3) deleteObjects(objectPaths ...string) error {
+	if s.options.legalHolds {
+		if err := checkLegalHolds(s, objectPaths...); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := s.options.operationContext(context.Background(), operationDelete)
+	defer cancel()
+
 	switch len(objectPaths) {
 	case 0:
 		return nil
 	case 1:
 		objectPath := cleanS3ObjectPath(objectPaths[0])
-		_, err := s.s3.DeleteObject(&s3.DeleteObjectInput{
+		_, err := s.s3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 			Bucket: &s.bucketName,
 			Key:    &objectPath,
 		})
@@ -203,31 +568,329 @@ func (s *storageS3) Delete(objectPaths ...string) error {
 		})
 	}
 
-	_, err := s.s3.DeleteObjects(&s3.DeleteObjectsInput{
+	output, err := s.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
 		Bucket: &s.bucketName,
 		Delete: &s3.Delete{
 			Objects: objectIdentifiers,
+			Quiet:   aws.Bool(true),
 		},
 	})
+	if err != nil {
+		return err
+	}
+
+	var failures []DeleteFailure
+	for _, deleteErr := range output.Errors {
+		failures = append(failures, DeleteFailure{
+			ObjectPath: aws.StringValue(deleteErr.Key),
+			Code:       aws.StringValue(deleteErr.Code),
+			Message:    aws.StringValue(deleteErr.Message),
+		})
+	}
+	return newMultiDeleteError(objectPaths, cleanS3ObjectPath, failures)
+}
+
+func (s *storageS3) ListVersions(prefix string) ([]ObjectVersion, error) {
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	var versions []ObjectVersion
+	err := s.s3.ListObjectVersionsPagesWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket: &s.bucketName,
+		Prefix: aws.String(trimPrefixRoot(prefix)),
+	}, func(page *s3.ListObjectVersionsOutput, lastPage bool) bool {
+		for _, version := range page.Versions {
+			versions = append(versions, ObjectVersion{
+				ObjectPath: aws.StringValue(version.Key),
+				VersionID:  aws.StringValue(version.VersionId),
+			})
+		}
+		for _, marker := range page.DeleteMarkers {
+			versions = append(versions, ObjectVersion{
+				ObjectPath:   aws.StringValue(marker.Key),
+				VersionID:    aws.StringValue(marker.VersionId),
+				DeleteMarker: true,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (s *storageS3) DeleteVersions(versions ...ObjectVersion) error {
+	ctx, cancel := s.options.operationContext(context.Background(), operationDelete)
+	defer cancel()
+
+	var failures []DeleteFailure
+	for start := 0; start < len(versions); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(versions) {
+			end = len(versions)
+		}
+
+		var objectIdentifiers []*s3.ObjectIdentifier
+		for _, version := range versions[start:end] {
+			objectIdentifiers = append(objectIdentifiers, &s3.ObjectIdentifier{
+				Key:       aws.String(cleanS3ObjectPath(version.ObjectPath)),
+				VersionId: s3VersionID(version.VersionID),
+			})
+		}
+		output, err := s.s3.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: &s.bucketName,
+			Delete: &s3.Delete{
+				Objects: objectIdentifiers,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, deleteErr := range output.Errors {
+			failures = append(failures, DeleteFailure{
+				ObjectPath: aws.StringValue(deleteErr.Key),
+				Code:       aws.StringValue(deleteErr.Code),
+				Message:    fmt.Sprintf("version %s: %s", aws.StringValue(deleteErr.VersionId), aws.StringValue(deleteErr.Message)),
+			})
+		}
+	}
+	if len(failures) > 0 {
+		return &MultiDeleteError{Failures: failures}
+	}
+	return nil
+}
+
+// LegalHold return false for objects of buckets without object lock
+func (s *storageS3) LegalHold(objectPath string) (bool, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	output, err := s.s3.GetObjectLegalHoldWithContext(ctx, &s3.GetObjectLegalHoldInput{
+		Bucket: &s.bucketName,
+		Key:    &objectPath,
+	})
+	var aerr awserr.Error
+	if (errors.As(err, &aerr) && aerr.Code() == "NoSuchObjectLockConfiguration") || errors.Is(err, ErrObjectNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return output.LegalHold != nil && aws.StringValue(output.LegalHold.Status) == s3.ObjectLockLegalHoldStatusOn, nil
+}
+
+// SetLegalHold require object lock enabled on the bucket
+func (s *storageS3) SetLegalHold(objectPath string, hold bool) error {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	status := s3.ObjectLockLegalHoldStatusOff
+	if hold {
+		status = s3.ObjectLockLegalHoldStatusOn
+	}
+	_, err := s.s3.PutObjectLegalHoldWithContext(ctx, &s3.PutObjectLegalHoldInput{
+		Bucket:    &s.bucketName,
+		Key:       &objectPath,
+		LegalHold: &s3.ObjectLockLegalHold{Status: aws.String(status)},
+	})
+	return err
+}
+
+func (s *storageS3) ForceDelete(objectPath string, override LegalHoldOverride) error {
+	if err := s.options.checkOverride(objectPath, override); err != nil {
+		return err
+	}
+	hold, err := s.LegalHold(objectPath)
+	if err != nil {
+		return err
+	}
+	if hold {
+		if err := s.SetLegalHold(objectPath, false); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := s.options.operationContext(context.Background(), operationDelete)
+	defer cancel()
+	objectPath = cleanS3ObjectPath(objectPath)
+	_, err = s.s3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: &s.bucketName,
+		Key:    &objectPath,
+	})
 	return err
 }
 
+// DeletePrefix page through listed objects deleting them in batches
+func (s *storageS3) DeletePrefix(prefix string) error {
+	return deleteListed(s, prefix)
+}
+
+// Copy keep metadata and visibility of the source
 func (s *storageS3) Copy(srcObjectPath string, dstObjectPath string) error {
+	return s.CopyWithOptions(srcObjectPath, dstObjectPath, CopyOptions{})
+}
+
+func (s *storageS3) CopyWithOptions(srcObjectPath string, dstObjectPath string, options CopyOptions) error {
 	srcObjectPath = cleanS3ObjectPath(srcObjectPath)
 	dstObjectPath = cleanS3ObjectPath(dstObjectPath)
+	srcBucketName := s.bucketName
+	if options.SourceBucket != "" {
+		srcBucketName = options.SourceBucket
+	}
+
+	visibility := options.Visibility
+	if visibility == "" && !s.options.disableACL {
+		var err error
+		if visibility, err = s.bucketVisibility(srcBucketName, srcObjectPath); err != nil {
+			return err
+		}
+	}
+	acl, err := getS3ACLOrError(s.options.putVisibility(visibility))
+	if err != nil {
+		return err
+	}
 
-	out, err := s.s3.CopyObject(&s3.CopyObjectInput{
+	input := &s3.CopyObjectInput{
 		Bucket:     &s.bucketName,
 		Key:        &dstObjectPath,
-		CopySource: &srcObjectPath,
-	})
+		CopySource: aws.String(s3CopySource(srcBucketName, srcObjectPath)),
+		ACL:        acl,
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+	if options.MetadataDirective == MetadataReplace {
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+		if options.Headers.ContentType != "" {
+			input.ContentType = aws.String(options.Headers.ContentType)
+		}
+		if options.Headers.ContentDisposition != "" {
+			input.ContentDisposition = aws.String(options.Headers.ContentDisposition)
+		}
+		if options.Headers.CacheControl != "" {
+			input.CacheControl = aws.String(options.Headers.CacheControl)
+		}
+		if len(options.Metadata) > 0 {
+			input.Metadata = aws.StringMap(options.Metadata)
+		}
+	}
+	if options.StorageClass != "" {
+		input.StorageClass = aws.String(options.StorageClass)
+	}
+	if options.ReplaceTags {
+		input.TaggingDirective = aws.String(s3.TaggingDirectiveReplace)
+		input.Tagging = aws.String(encodeTags(options.Tags))
+	}
+
+	ctx, cancel := s.options.operationContext(context.Background(), operationCopy)
+	defer cancel()
+	_, err = s.s3.CopyObjectWithContext(ctx, input)
+	return err
+}
+
+// CopyPrefix copy listed objects server-side using WithCopyConcurrency parallel requests
+func (s *storageS3) CopyPrefix(srcPrefix string, dstPrefix string) error {
+	return copyListed(s, srcPrefix, dstPrefix, s.options.copyWorkers())
+}
 
+// Restore move the latest trashed copy of objectPath back, see WithTrash
+func (s *storageS3) Restore(objectPath string) error {
+	return s.options.restoreFromTrash(s, objectPath)
+}
+
+// PurgeTrash delete objects trashed more than olderThan ago for good
+func (s *storageS3) PurgeTrash(olderThan time.Duration) error {
+	return s.options.purgeTrash(s, olderThan)
+}
+
+// Move copy server-side then delete the source
+func (s *storageS3) Move(srcObjectPath string, dstObjectPath string) error {
+	return moveByCopy(s, srcObjectPath, dstObjectPath)
+}
+
+func (s *storageS3) Compose(dstObjectPath string, visibility ObjectVisibility, srcObjectPaths ...string) error {
+	sizes := make([]int64, len(srcObjectPaths))
+	for i, srcObjectPath := range srcObjectPaths {
+		size, err := s.Size(srcObjectPath)
+		if err != nil {
+			return err
+		}
+		sizes[i] = size
+	}
+
+	// small parts can't be copied server-side, stream them instead
+	parts, ok := composeParts(sizes, s3PartSize, s3MaxPartCopySize, s3MaxParts)
+	if !ok {
+		return Concat(s, dstObjectPath, visibility, srcObjectPaths...)
+	}
+
+	dstObjectPath = cleanS3ObjectPath(dstObjectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationCopy)
+	defer cancel()
+
+	acl, err := getS3ACLOrError(s.options.putVisibility(visibility))
 	if err != nil {
 		return err
 	}
 
-	logrus.Debug(out)
-	return nil
+	input := &s3.CreateMultipartUploadInput{
+		ACL:    acl,
+		Bucket: &s.bucketName,
+		Key:    &dstObjectPath,
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+	createdResp, err := s.s3.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	var completedParts []*s3.CompletedPart
+	for i, part := range parts {
+		partNumber := int64(i + 1)
+		copyInput := &s3.UploadPartCopyInput{
+			Bucket:     createdResp.Bucket,
+			Key:        createdResp.Key,
+			UploadId:   createdResp.UploadId,
+			PartNumber: aws.Int64(partNumber),
+			CopySource: aws.String(s3CopySource(s.bucketName, cleanS3ObjectPath(srcObjectPaths[part.source]))),
+		}
+		if !part.whole {
+			copyInput.CopySourceRange = aws.String(fmt.Sprintf("bytes=%d-%d", part.offset, part.offset+part.length-1))
+		}
+		copyResp, err := s.s3.UploadPartCopyWithContext(ctx, copyInput)
+		if err != nil {
+			if err := abortMultipartUpload(ctx, s.s3, createdResp); err != nil {
+				s.options.logger.Debugf("[S3] error aborting multipart compose: %s\n", err.Error())
+			}
+			return err
+		}
+
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       copyResp.CopyPartResult.ETag,
+			PartNumber: aws.Int64(partNumber),
+		})
+	}
+
+	_, err = s.s3.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   createdResp.Bucket,
+		Key:      createdResp.Key,
+		UploadId: createdResp.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	return err
+}
+
+// s3CopySource build copy source header value "bucket/key", every path segment is url encoded
+// while separators are kept
+func s3CopySource(bucketName string, objectPath string) string {
+	segments := strings.Split(bucketName+"/"+objectPath, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.QueryEscape(segment), "+", "%20")
+	}
+	return strings.Join(segments, "/")
 }
 
 func (s *storageS3) URL(objectPath string, storageResize *StorageResize) (string, error) {
@@ -235,41 +898,104 @@ func (s *storageS3) URL(objectPath string, storageResize *StorageResize) (string
 		return "", nil
 	}
 	objectPath = cleanS3ObjectPath(objectPath)
+	if s.publicBaseURL != "" {
+		return fmt.Sprintf("%s/%s", s.publicBaseURL, objectPath), nil
+	}
 	return fmt.Sprintf("https://%s.s3-%s.amazonaws.com/%s", s.bucketName, *s.awsSession.Config.Region, objectPath), nil
 }
 
 func (s *storageS3) TemporaryURL(objectPath string, expireIn time.Duration, storageResize *StorageResize) (string, error) {
-	if expireIn < s3SignedURLExpire {
-		expireIn = s3SignedURLExpire
-	}
+	return s.TemporaryURLWithOptions(objectPath, expireIn, SignedURLOptions{Resize: storageResize})
+}
+
+func (s *storageS3) TemporaryURLWithOptions(objectPath string, expireIn time.Duration, options SignedURLOptions) (string, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	expireIn = s.options.clampURLExpiry(objectPath, expireIn, s3SignedURLExpire)
 
 	req, _ := s.s3.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: &s.bucketName,
 		Key:    &objectPath,
 	})
 
+	// the request isn't built yet, building merge the input into this query and signing cover both
+	if len(options.Query) > 0 {
+		query := req.HTTPRequest.URL.Query()
+		for key, value := range options.Query {
+			query.Set(key, value)
+		}
+		req.HTTPRequest.URL.RawQuery = query.Encode()
+	}
+	for key, value := range options.Headers {
+		req.HTTPRequest.Header.Set(key, value)
+	}
+
 	return req.Presign(expireIn)
 }
 
-func (s *storageS3) Size(objectPath string) (int64, error) {
+func (s *storageS3) CurrentVersion(objectPath string) (string, error) {
 	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
 
-	output, err := s.s3.HeadObject(&s3.HeadObjectInput{
+	output, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: &s.bucketName,
 		Key:    &objectPath,
 	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.VersionId), nil
+}
+
+func (s *storageS3) URLVersion(objectPath string, versionID string) (string, error) {
+	objectURL, err := s.URL(objectPath, nil)
+	if err != nil || objectURL == "" {
+		return objectURL, err
+	}
+	return withVersionQuery(objectURL, versionID)
+}
+
+func (s *storageS3) TemporaryURLVersion(objectPath string, versionID string, expireIn time.Duration) (string, error) {
+	options := SignedURLOptions{}
+	if versionID != "" {
+		options.Query = map[string]string{"versionId": versionID}
+	}
+	return s.TemporaryURLWithOptions(objectPath, expireIn, options)
+}
+
+// s3VersionID return nil for empty versionID, empty version ID is rejected by S3
+func s3VersionID(versionID string) *string {
+	if versionID == "" {
+		return nil
+	}
+	return aws.String(versionID)
+}
+
+func (s *storageS3) TemporaryURLs(objectPaths []string, expireIn time.Duration, storageResize *StorageResize) (map[string]string, error) {
+	return signURLs(objectPaths, func(objectPath string) (string, error) {
+		return s.TemporaryURL(objectPath, expireIn, storageResize)
+	})
+}
+
+func (s *storageS3) Size(objectPath string) (int64, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	output, err := s.hedgedHead(ctx, objectPath)
 	if err != nil {
 		return 0, err
 	}
 
-	logrus.Debug(output)
 	return *output.ContentLength, nil
 }
 
 func (s *storageS3) LastModified(objectPath string) (time.Time, error) {
 	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
 
-	output, err := s.s3.HeadObject(&s3.HeadObjectInput{
+	output, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: &s.bucketName,
 		Key:    &objectPath,
 	})
@@ -280,25 +1006,228 @@ func (s *storageS3) LastModified(objectPath string) (time.Time, error) {
 	return *output.LastModified, nil
 }
 
+func (s *storageS3) Stat(objectPath string) (ObjectInfo, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	output, err := s.hedgedHead(ctx, objectPath)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		ObjectPath:   objectPath,
+		Size:         aws.Int64Value(output.ContentLength),
+		LastModified: aws.TimeValue(output.LastModified),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         strings.Trim(aws.StringValue(output.ETag), `"`),
+	}, nil
+}
+
+func (s *storageS3) MimeType(objectPath string) (string, error) {
+	info, err := s.Stat(objectPath)
+	if err != nil {
+		return "", err
+	}
+	return info.ContentType, nil
+}
+
+// Checksum use ETag as md5 of single part unencrypted uploads, other checksums are computed by reading the object
+func (s *storageS3) Checksum(objectPath string, algo ChecksumAlgo) (string, error) {
+	if algo == ChecksumMD5 {
+		ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+		defer cancel()
+
+		output, err := s.hedgedHead(ctx, cleanS3ObjectPath(objectPath))
+		if err != nil {
+			return "", err
+		}
+		algorithm := aws.StringValue(output.ServerSideEncryption)
+		encrypted := algorithm == S3EncryptionKMS || algorithm == S3EncryptionDSSEKMS || output.SSECustomerAlgorithm != nil
+		if sum, ok := etagMD5(aws.StringValue(output.ETag)); ok && !encrypted {
+			return sum, nil
+		}
+	}
+	return streamChecksum(s, objectPath, algo)
+}
+
+func (s *storageS3) GetMetadata(objectPath string) (ObjectMetadata, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	output, err := s.hedgedHead(ctx, objectPath)
+	if err != nil {
+		return ObjectMetadata{}, err
+	}
+
+	return ObjectMetadata{
+		Headers: ObjectHeaders{
+			ContentType:        aws.StringValue(output.ContentType),
+			ContentDisposition: aws.StringValue(output.ContentDisposition),
+			CacheControl:       aws.StringValue(output.CacheControl),
+		},
+		Metadata: lowerMetadata(aws.StringValueMap(output.Metadata)),
+	}, nil
+}
+
+// SetMetadata copy the object onto itself replacing its metadata, the storage class is reset to the bucket default
+func (s *storageS3) SetMetadata(objectPath string, metadata ObjectMetadata) error {
+	return s.CopyWithOptions(objectPath, objectPath, CopyOptions{
+		MetadataDirective: MetadataReplace,
+		Headers:           metadata.Headers,
+		Metadata:          metadata.Metadata,
+	})
+}
+
+// Touch copy existing objects onto themselves, the storage class is reset to the bucket default
+func (s *storageS3) Touch(objectPath string) error {
+	return touchObject(s, objectPath)
+}
+
 func (s *storageS3) Exist(objectPath string) (bool, error) {
 	objectPath = cleanS3ObjectPath(objectPath)
-	output, err := s.s3.HeadObject(&s3.HeadObjectInput{
-		Bucket: &s.bucketName,
-		Key:    &objectPath,
+	exist, err := s.keyExists(objectPath)
+	if err != nil || exist || !s.options.directoryMarkers {
+		return exist, err
+	}
+
+	return s.keyExists(objectPath + "/")
+}
+
+// ExistMany list common prefix of many paths instead of sending a HEAD request per path
+func (s *storageS3) ExistMany(objectPaths ...string) (map[string]bool, error) {
+	if s.options.directoryMarkers {
+		return existEach(s, objectPaths)
+	}
+	return existMany(s, objectPaths)
+}
+
+func (s *storageS3) List(prefix string) (ObjectIterator, error) {
+	return s.listAfter(prefix, "")
+}
+
+// listAfter list objects under prefix whose path sort after startAfter
+func (s *storageS3) listAfter(prefix string, startAfter string) (ObjectIterator, error) {
+	prefix = strings.TrimPrefix(filepath.ToSlash(prefix), "/")
+	return newPagedObjectIterator(func(token string) ([]ObjectInfo, string, error) {
+		ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+		defer cancel()
+
+		input := &s3.ListObjectsV2Input{
+			Bucket: &s.bucketName,
+			Prefix: &prefix,
+		}
+		if token != "" {
+			input.ContinuationToken = &token
+		} else if startAfter != "" {
+			input.StartAfter = &startAfter
+		}
+		output, err := s.s3.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return nil, "", err
+		}
+
+		objects := make([]ObjectInfo, 0, len(output.Contents))
+		for _, object := range output.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasSuffix(key, "/") {
+				// directory marker
+				continue
+			}
+			objects = append(objects, ObjectInfo{
+				ObjectPath:   key,
+				Size:         aws.Int64Value(object.Size),
+				LastModified: aws.TimeValue(object.LastModified),
+				ETag:         strings.Trim(aws.StringValue(object.ETag), `"`),
+			})
+		}
+
+		if !aws.BoolValue(output.IsTruncated) {
+			return objects, "", nil
+		}
+		return objects, aws.StringValue(output.NextContinuationToken), nil
 	})
+}
+
+// keyExists check raw key without cleaning it, so directory marker keys can be checked
+func (s *storageS3) keyExists(key string) (bool, error) {
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+	output, err := s.hedgedHead(ctx, key)
 
 	if err != nil {
+		if errors.Is(err, ErrObjectNotExist) {
+			return false, nil
+		}
 		return false, err
 	}
 
 	return output.LastModified != nil, nil
 }
 
+// hedgedHead send HeadObject of raw key, hedged when hedged reads are enabled
+func (s *storageS3) hedgedHead(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	value, cancel, err := s.options.hedge(ctx, func(ctx context.Context) (interface{}, error) {
+		return s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: &s.bucketName,
+			Key:    &key,
+		})
+	}, nil)
+	defer cancel()
+	if err != nil {
+		return nil, err
+	}
+	return value.(*s3.HeadObjectOutput), nil
+}
+
+func (s *storageS3) head(objectPath string) objectHead {
+	return func() (int64, string, error) {
+		ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+		defer cancel()
+
+		output, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+			Bucket: &s.bucketName,
+			Key:    &objectPath,
+		})
+		if err != nil {
+			return 0, "", err
+		}
+		return aws.Int64Value(output.ContentLength), aws.StringValue(output.ETag), nil
+	}
+}
+
+func (s *storageS3) putDirectoryMarkers(objectPath string) error {
+	if !s.options.directoryMarkers {
+		return nil
+	}
+
+	return ensureDirectoryMarkers(objectPath, s.keyExists, func(key string) error {
+		ctx, cancel := s.options.operationContext(context.Background(), operationPut)
+		defer cancel()
+
+		input := &s3.PutObjectInput{
+			Bucket: &s.bucketName,
+			Key:    &key,
+			Body:   bytes.NewReader(nil),
+		}
+		input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = s.options.s3EncryptionFields()
+		_, err := s.s3.PutObjectWithContext(ctx, input)
+		return err
+	})
+}
+
 func (s *storageS3) SetVisibility(objectPath string, visibility ObjectVisibility) error {
 	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
 
 	if acl, err := getS3ACLOrError(visibility); err == nil {
-		_, err = s.s3.PutObjectAcl(&s3.PutObjectAclInput{
+		if acl == nil {
+			return nil
+		}
+		_, err = s.s3.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
 			Bucket: &s.bucketName,
 			Key:    &objectPath,
 			ACL:    acl,
@@ -310,24 +1239,29 @@ func (s *storageS3) SetVisibility(objectPath string, visibility ObjectVisibility
 }
 
 func (s *storageS3) GetVisibility(objectPath string) (ObjectVisibility, error) {
-	output, err := s.s3.GetObjectAcl(&s3.GetObjectAclInput{
-		Bucket: &s.bucketName,
-		Key:    &objectPath,
-	})
+	return s.bucketVisibility(s.bucketName, objectPath)
+}
+
+// bucketVisibility return visibility of objectPath in bucketName, which may differ from the storage bucket
+func (s *storageS3) bucketVisibility(bucketName string, objectPath string) (ObjectVisibility, error) {
+	grants, err := s.bucketACL(bucketName, objectPath)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Println(output)
-
-	hasRead, hasWrite := false, false
-	for _, grant := range output.Grants {
-		if aws.StringValue(grant.Grantee.URI) == "http://acs.amazonaws.com/groups/global/AllUsers" {
-			if aws.StringValue(grant.Permission) == s3.PermissionRead {
+	hasRead, hasWrite, hasAuthenticatedRead := false, false, false
+	fullControls := map[string]bool{}
+	for _, grant := range grants {
+		if grant.GranteeURI == GroupAllUsers {
+			if grant.Permission == PermissionRead {
 				hasRead = true
-			} else if aws.StringValue(grant.Permission) == s3.PermissionWrite {
+			} else if grant.Permission == PermissionWrite {
 				hasWrite = true
 			}
+		} else if grant.GranteeURI == GroupAuthenticatedUsers && grant.Permission == PermissionRead {
+			hasAuthenticatedRead = true
+		} else if grant.GranteeType == GranteeCanonicalUser && grant.Permission == PermissionFullControl {
+			fullControls[grant.GranteeID] = true
 		}
 	}
 
@@ -335,8 +1269,65 @@ func (s *storageS3) GetVisibility(objectPath string) (ObjectVisibility, error) {
 		return ObjectPublicReadWrite, nil
 	} else if hasRead {
 		return ObjectPublicRead, nil
+	} else if hasAuthenticatedRead {
+		return ObjectAuthenticatedRead, nil
+	} else if len(fullControls) > 1 {
+		// object owner and bucket owner are different accounts
+		return ObjectBucketOwnerFullControl, nil
 	} else {
-		return "", err
+		return ObjectPrivate, nil
+	}
+}
+
+func (s *storageS3) GetACL(objectPath string) ([]Grant, error) {
+	return s.bucketACL(s.bucketName, objectPath)
+}
+
+func (s *storageS3) bucketACL(bucketName string, objectPath string) ([]Grant, error) {
+	objectPath = cleanS3ObjectPath(objectPath)
+	ctx, cancel := s.options.operationContext(context.Background(), operationMetadata)
+	defer cancel()
+
+	output, err := s.s3.GetObjectAclWithContext(ctx, &s3.GetObjectAclInput{
+		Bucket: &bucketName,
+		Key:    &objectPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var grants []Grant
+	for _, grant := range output.Grants {
+		if grant.Grantee == nil {
+			continue
+		}
+
+		result := Grant{Permission: GrantPermission(aws.StringValue(grant.Permission))}
+		switch aws.StringValue(grant.Grantee.Type) {
+		case s3.TypeCanonicalUser:
+			result.GranteeType = GranteeCanonicalUser
+			result.GranteeID = aws.StringValue(grant.Grantee.ID)
+		case s3.TypeAmazonCustomerByEmail:
+			result.GranteeType = GranteeEmail
+			result.GranteeID = aws.StringValue(grant.Grantee.EmailAddress)
+		case s3.TypeGroup:
+			result.GranteeType = GranteeGroup
+			result.GranteeURI = aws.StringValue(grant.Grantee.URI)
+		default:
+			result.GranteeType = GranteeType(aws.StringValue(grant.Grantee.Type))
+		}
+		grants = append(grants, result)
+	}
+	return grants, nil
+}
+
+func (s *storageS3) Capabilities() Capabilities {
+	return Capabilities{
+		Versioning:       true,
+		Tagging:          true,
+		PresignedUpload:  true,
+		LegalHold:        true,
+		ConditionalWrite: true,
 	}
 }
 
@@ -347,6 +1338,12 @@ func getS3ACLOrError(visibility ObjectVisibility) (*string, error) {
 		return aws.String(s3.BucketCannedACLPublicReadWrite), nil
 	} else if visibility == ObjectPrivate {
 		return aws.String(s3.BucketCannedACLPrivate), nil
+	} else if visibility == ObjectAuthenticatedRead {
+		return aws.String(s3.ObjectCannedACLAuthenticatedRead), nil
+	} else if visibility == ObjectBucketOwnerFullControl {
+		return aws.String(s3.ObjectCannedACLBucketOwnerFullControl), nil
+	} else if visibility == ObjectVisibilityInherit {
+		return nil, nil
 	} else {
 		return nil, fmt.Errorf("err invalid object visibility: %s", visibility)
 	}
@@ -0,0 +1,164 @@
+package gostorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type SyncEventType string
+
+const (
+	SyncEventScanned SyncEventType = "scanned"
+	SyncEventCopied  SyncEventType = "copied"
+	SyncEventSkipped SyncEventType = "skipped"
+	SyncEventDeleted SyncEventType = "deleted"
+	SyncEventErrored SyncEventType = "errored"
+)
+
+// SyncEvent describe progress of Sync on a single object, events can be encoded as JSON lines to
+// build reports of long migrations
+type SyncEvent struct {
+	Type          SyncEventType `json:"type"`
+	SrcObjectPath string        `json:"src_object_path,omitempty"` // empty for deletions
+	DstObjectPath string        `json:"dst_object_path"`
+	Size          int64         `json:"size"`
+	Checksum      string        `json:"checksum,omitempty"` // sha256 hex of copied content
+	Reason        string        `json:"reason,omitempty"`   // why the object was skipped or deleted, error message
+	Err           error         `json:"-"`
+	At            time.Time     `json:"at"`
+}
+
+// SyncObserver receive events of Sync, it's called from the goroutine running Sync
+type SyncObserver func(event SyncEvent)
+
+// SyncOptions configure Sync
+type SyncOptions struct {
+	// Delete remove objects under dstPrefix missing under srcPrefix
+	Delete bool
+
+	// Observer receive an event for each scanned, copied, skipped, deleted and errored object, it may be nil
+	Observer SyncObserver
+}
+
+// SyncResult count objects by outcome of Sync
+type SyncResult struct {
+	Scanned int
+	Copied  int
+	Skipped int
+	Deleted int
+	Errored int
+	Bytes   int64 // size of copied objects
+}
+
+// Sync transfer objects under srcPrefix of src missing or changed under dstPrefix of dst. Objects
+// with the same size and a destination modified after the source are skipped, so an interrupted
+// sync resume where it stopped. Failures of single objects are reported to the observer and sync
+// continue, the returned error summarize them. Listing failures and ctx cancellation stop the sync.
+// Transfers are throttled by the bandwidth limiter of ctx, see ContextWithBandwidth.
+func Sync(ctx context.Context, src Storage, srcPrefix string, dst Storage, dstPrefix string, options SyncOptions) (SyncResult, error) {
+	var result SyncResult
+	srcPrefix, dstPrefix = trimPrefixRoot(srcPrefix), trimPrefixRoot(dstPrefix)
+
+	emit := func(event SyncEvent) {
+		switch event.Type {
+		case SyncEventScanned:
+			result.Scanned++
+		case SyncEventCopied:
+			result.Copied++
+			result.Bytes += event.Size
+		case SyncEventSkipped:
+			result.Skipped++
+		case SyncEventDeleted:
+			result.Deleted++
+		case SyncEventErrored:
+			result.Errored++
+			event.Reason = event.Err.Error()
+		}
+		if options.Observer != nil {
+			event.At = time.Now()
+			options.Observer(event)
+		}
+	}
+
+	existing, err := listSyncObjects(dst, dstPrefix)
+	if err != nil {
+		return result, fmt.Errorf("err sync listing %s: %w", dstPrefix, err)
+	}
+
+	iterator, err := src.List(srcPrefix)
+	if err != nil {
+		return result, fmt.Errorf("err sync listing %s: %w", srcPrefix, err)
+	}
+	for iterator.Next() {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		object := iterator.Object()
+		relPath := strings.TrimPrefix(object.ObjectPath, srcPrefix)
+		event := SyncEvent{SrcObjectPath: object.ObjectPath, DstObjectPath: dstPrefix + relPath, Size: object.Size}
+		emit(withSyncEventType(event, SyncEventScanned, ""))
+
+		dstObject, exist := existing[relPath]
+		delete(existing, relPath)
+		if exist && dstObject.Size == object.Size && !dstObject.LastModified.Before(object.LastModified) {
+			emit(withSyncEventType(event, SyncEventSkipped, "unchanged"))
+			continue
+		}
+
+		checksum, err := transfer(ctx, src, object.ObjectPath, dst, event.DstObjectPath)
+		if err != nil {
+			event.Err = err
+			emit(withSyncEventType(event, SyncEventErrored, ""))
+			continue
+		}
+		event.Checksum = checksum
+		emit(withSyncEventType(event, SyncEventCopied, ""))
+	}
+	if err := iterator.Err(); err != nil {
+		return result, fmt.Errorf("err sync listing %s: %w", srcPrefix, err)
+	}
+
+	if options.Delete {
+		for relPath, object := range existing {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+
+			event := SyncEvent{DstObjectPath: object.ObjectPath, Size: object.Size}
+			if err := dst.Delete(object.ObjectPath); err != nil {
+				event.Err = err
+				emit(withSyncEventType(event, SyncEventErrored, ""))
+				continue
+			}
+			emit(withSyncEventType(event, SyncEventDeleted, "missing in source: "+srcPrefix+relPath))
+		}
+	}
+
+	if result.Errored > 0 {
+		return result, fmt.Errorf("err sync %s to %s: %d objects failed", srcPrefix, dstPrefix, result.Errored)
+	}
+	return result, nil
+}
+
+func withSyncEventType(event SyncEvent, eventType SyncEventType, reason string) SyncEvent {
+	event.Type = eventType
+	event.Reason = reason
+	return event
+}
+
+// listSyncObjects return objects under prefix by path relative to prefix
+func listSyncObjects(storage Storage, prefix string) (map[string]ObjectInfo, error) {
+	iterator, err := storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	objects := map[string]ObjectInfo{}
+	for iterator.Next() {
+		object := iterator.Object()
+		objects[strings.TrimPrefix(object.ObjectPath, prefix)] = object
+	}
+	return objects, iterator.Err()
+}
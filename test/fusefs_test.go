@@ -0,0 +1,68 @@
+//go:build linux || darwin
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gostorage "github.com/kevinangkajaya/go-storage"
+	"github.com/kevinangkajaya/go-storage/fusefs"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FuseMount(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("hello"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("docs/b.txt", strings.NewReader("nested"), gostorage.ObjectPrivate))
+
+	mountPoint, err := filepath.Abs("storage-test/mnt")
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(mountPoint, os.ModePerm))
+	server, err := fusefs.Mount(storage, mountPoint, fusefs.Options{CacheDir: "storage-test/cache"})
+	if err != nil {
+		cleanTestDir()
+		t.Skipf("FUSE is not available: %s", err)
+	}
+	defer cleanTestDir()
+	defer server.Unmount()
+
+	// objects are read through the mount
+	data, err := ioutil.ReadFile(filepath.Join(mountPoint, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	// without DirLister directories are only known once created through the mount
+	_, err = os.Stat(filepath.Join(mountPoint, "docs"))
+	require.True(t, os.IsNotExist(err))
+	require.NoError(t, os.Mkdir(filepath.Join(mountPoint, "docs"), 0755))
+	data, err = ioutil.ReadFile(filepath.Join(mountPoint, "docs", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "nested", string(data))
+
+	// written files are uploaded on close
+	require.NoError(t, ioutil.WriteFile(filepath.Join(mountPoint, "docs", "c.txt"), []byte("written"), 0644))
+	reader, err := storage.Read("docs/c.txt")
+	require.NoError(t, err)
+	data, err = ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, "written", string(data))
+
+	// rename and unlink apply to the objects
+	require.NoError(t, os.Rename(filepath.Join(mountPoint, "docs", "c.txt"), filepath.Join(mountPoint, "d.txt")))
+	exist, err := storage.Exist("docs/c.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = storage.Exist("d.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	require.NoError(t, os.Remove(filepath.Join(mountPoint, "d.txt")))
+	exist, err = storage.Exist("d.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+}
@@ -0,0 +1,253 @@
+//go:build integration
+
+package test
+
+// Integration tests run the conformance suite against real protocol implementations, start them with
+//
+//	docker compose -f test/docker-compose.yml up -d
+//	go test -tags integration ./test/ -run Integration
+//
+// Endpoints default to the compose services and can be overridden by environment variables.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gostorage "github.com/kevinangkajaya/go-storage"
+	"github.com/stretchr/testify/require"
+)
+
+const integrationBucket = "gostorage-integration"
+
+// conformanceBackend describe storage under test and protocol features it supports
+type conformanceBackend struct {
+	storage gostorage.Storage
+	acl     bool // backend store object ACLs
+}
+
+func integrationEnv(key string, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// createS3Bucket create bucket on a fresh emulator, existing bucket is reused
+func createS3Bucket(t *testing.T, endpoint string, accessKeyID string, secretAccessKey string, bucket string) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(endpoint),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+	})
+	require.NoError(t, err)
+
+	client := s3.New(sess)
+	if _, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err == nil {
+		return
+	}
+	_, err = client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	require.NoError(t, err)
+}
+
+func Test_IntegrationMinIO(t *testing.T) {
+	endpoint := integrationEnv("GOSTORAGE_IT_MINIO_ENDPOINT", "http://localhost:9000")
+	accessKeyID := integrationEnv("GOSTORAGE_IT_MINIO_ACCESS_KEY", "minioadmin")
+	secretAccessKey := integrationEnv("GOSTORAGE_IT_MINIO_SECRET_KEY", "minioadmin")
+	createS3Bucket(t, endpoint, accessKeyID, secretAccessKey, integrationBucket)
+	createS3Bucket(t, endpoint, accessKeyID, secretAccessKey, integrationBucket+"-source")
+
+	// MinIO accept canned ACLs but doesn't store them
+	gostorage.RegisterS3Preset(gostorage.S3Preset{Name: "it-minio", DefaultRegion: "us-east-1", PathStyle: true, NoACL: true})
+	newStorage := func(bucket string) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("it-minio", gostorage.S3Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			Endpoint:        endpoint,
+		}, bucket)
+	}
+	storage := newStorage(integrationBucket)
+	runConformance(t, conformanceBackend{storage: storage})
+
+	t.Run("CopySourceBucket", func(t *testing.T) {
+		prefix := fmt.Sprintf("copy-%d/", time.Now().UnixNano())
+		src := prefix + "dir with space/ünïcode+a&b=c?.txt"
+		source := newStorage(integrationBucket + "-source")
+		require.NoError(t, source.Put(src, strings.NewReader("from source bucket"), gostorage.ObjectPrivate))
+		defer source.Delete(src)
+
+		require.NoError(t, gostorage.CopyWithOptions(storage, src, prefix+"copy.txt", gostorage.CopyOptions{SourceBucket: integrationBucket + "-source"}))
+		defer storage.Delete(prefix + "copy.txt")
+		require.Equal(t, "from source bucket", readAllString(t, storage, prefix+"copy.txt"))
+
+		exist, err := storage.Exist(src)
+		require.NoError(t, err)
+		require.False(t, exist)
+	})
+}
+
+func Test_IntegrationLocalStack(t *testing.T) {
+	endpoint := integrationEnv("GOSTORAGE_IT_LOCALSTACK_ENDPOINT", "http://localhost:4566")
+	createS3Bucket(t, endpoint, "test", "test", integrationBucket)
+
+	gostorage.RegisterS3Preset(gostorage.S3Preset{Name: "it-localstack", DefaultRegion: "us-east-1", PathStyle: true})
+	runConformance(t, conformanceBackend{
+		storage: gostorage.NewS3CompatibleStorage("it-localstack", gostorage.S3Credentials{
+			AccessKeyID:     "test",
+			SecretAccessKey: "test",
+			Endpoint:        endpoint,
+		}, integrationBucket),
+		acl: true,
+	})
+}
+
+// Test_IntegrationOSS run against any endpoint speaking the OSS protocol, e.g. an emulator or a
+// dedicated test bucket, there is no official OSS emulator image to start with docker compose
+func Test_IntegrationOSS(t *testing.T) {
+	endpoint := os.Getenv("GOSTORAGE_IT_OSS_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("GOSTORAGE_IT_OSS_ENDPOINT is not set")
+	}
+
+	runConformance(t, conformanceBackend{
+		storage: gostorage.NewAlibabaOSSStorage(
+			integrationEnv("GOSTORAGE_IT_OSS_BUCKET", integrationBucket),
+			endpoint,
+			os.Getenv("GOSTORAGE_IT_OSS_ACCESS_KEY"),
+			os.Getenv("GOSTORAGE_IT_OSS_SECRET_KEY"),
+		),
+		acl: true,
+	})
+}
+
+func Test_IntegrationLocal(t *testing.T) {
+	runConformance(t, conformanceBackend{storage: getLocalStorage(), acl: true})
+	cleanTestDir()
+}
+
+func readAllString(t *testing.T, storage gostorage.Storage, objectPath string) string {
+	reader, err := storage.Read(objectPath)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	return string(content)
+}
+
+// runConformance check behavior every backend must share, objects are written under a unique prefix
+func runConformance(t *testing.T, backend conformanceBackend) {
+	storage := backend.storage
+	prefix := fmt.Sprintf("conformance-%d/", time.Now().UnixNano())
+
+	t.Run("PutRead", func(t *testing.T) {
+		require.NoError(t, storage.Put(prefix+"hello.txt", strings.NewReader("hello world"), gostorage.ObjectPrivate))
+		require.Equal(t, "hello world", readAllString(t, storage, prefix+"hello.txt"))
+
+		exist, err := storage.Exist(prefix + "hello.txt")
+		require.NoError(t, err)
+		require.True(t, exist)
+		exist, err = storage.Exist(prefix + "missing.txt")
+		require.NoError(t, err)
+		require.False(t, exist)
+
+		info, err := storage.Stat(prefix + "hello.txt")
+		require.NoError(t, err)
+		require.Equal(t, int64(11), info.Size)
+		require.NotEmpty(t, info.ETag)
+		require.WithinDuration(t, time.Now(), info.LastModified, time.Hour)
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		require.NoError(t, storage.PutWithOptions(prefix+"report.dat", strings.NewReader("a,b"), gostorage.PutOptions{
+			Visibility: gostorage.ObjectPrivate,
+			ObjectMetadata: gostorage.ObjectMetadata{
+				Headers:  gostorage.ObjectHeaders{ContentType: "text/csv", CacheControl: "max-age=60"},
+				Metadata: map[string]string{"owner": "billing"},
+			},
+		}))
+		metadata, err := storage.GetMetadata(prefix + "report.dat")
+		require.NoError(t, err)
+		require.Equal(t, "text/csv", metadata.Headers.ContentType)
+		require.Equal(t, "max-age=60", metadata.Headers.CacheControl)
+		require.Equal(t, "billing", metadata.Metadata["owner"])
+	})
+
+	t.Run("DownloadRange", func(t *testing.T) {
+		content := strings.Repeat("0123456789", 100)
+		require.NoError(t, storage.Put(prefix+"ranged.txt", strings.NewReader(content), gostorage.ObjectPrivate))
+
+		var buffer strings.Builder
+		written, err := gostorage.DownloadTo(storage, prefix+"ranged.txt", &buffer, gostorage.DownloadOptions{PartSize: 64, Concurrency: 3})
+		require.NoError(t, err)
+		require.Equal(t, int64(len(content)), written)
+		require.Equal(t, content, buffer.String())
+	})
+
+	t.Run("CopyEncodedKey", func(t *testing.T) {
+		src := prefix + "dir with space/a+b&c.txt"
+		require.NoError(t, storage.Put(src, strings.NewReader("copied"), gostorage.ObjectPrivate))
+		require.NoError(t, storage.Copy(src, prefix+"copy.txt"))
+		require.Equal(t, "copied", readAllString(t, storage, prefix+"copy.txt"))
+	})
+
+	t.Run("Writer", func(t *testing.T) {
+		writer, err := storage.Writer(prefix+"written.txt", gostorage.ObjectPrivate)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte("streamed"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.Equal(t, "streamed", readAllString(t, storage, prefix+"written.txt"))
+
+		writer, err = storage.Writer(prefix+"aborted.txt", gostorage.ObjectPrivate)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte("partial"))
+		require.NoError(t, err)
+		require.NoError(t, writer.CloseWithError(nil))
+		exist, err := storage.Exist(prefix + "aborted.txt")
+		require.NoError(t, err)
+		require.False(t, exist)
+	})
+
+	t.Run("Visibility", func(t *testing.T) {
+		if !backend.acl {
+			t.Skip("backend doesn't store object ACLs")
+		}
+		require.NoError(t, storage.Put(prefix+"public.txt", strings.NewReader("public"), gostorage.ObjectPublicRead))
+		visibility, err := storage.GetVisibility(prefix + "public.txt")
+		require.NoError(t, err)
+		require.Equal(t, gostorage.ObjectPublicRead, visibility)
+
+		require.NoError(t, storage.SetVisibility(prefix+"public.txt", gostorage.ObjectPrivate))
+		visibility, err = storage.GetVisibility(prefix + "public.txt")
+		require.NoError(t, err)
+		require.Equal(t, gostorage.ObjectPrivate, visibility)
+	})
+
+	t.Run("ListDelete", func(t *testing.T) {
+		iterator, err := storage.List(prefix)
+		require.NoError(t, err)
+		var listed []string
+		for iterator.Next() {
+			listed = append(listed, iterator.Object().ObjectPath)
+		}
+		require.NoError(t, iterator.Err())
+		require.Contains(t, listed, prefix+"hello.txt")
+		require.Contains(t, listed, prefix+"written.txt")
+		require.NotContains(t, listed, prefix+"aborted.txt")
+
+		require.NoError(t, storage.Delete(listed...))
+		iterator, err = storage.List(prefix)
+		require.NoError(t, err)
+		require.False(t, iterator.Next())
+		require.NoError(t, iterator.Err())
+	})
+}
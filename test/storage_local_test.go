@@ -1,11 +1,37 @@
 package test
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 	gostorage "github.com/kevinangkajaya/go-storage"
 	"github.com/stretchr/testify/require"
 )
@@ -93,3 +119,4677 @@ func Test_CopyFile(t *testing.T) {
 	// Clean up
 	cleanTestDir()
 }
+
+func Test_PutInheritVisibility(t *testing.T) {
+	storage := getLocalStorage()
+	objectPath := "inherit/sample.txt"
+
+	// Save data without sending any visibility
+	err := storage.Put(objectPath, strings.NewReader("inherit"), gostorage.ObjectVisibilityInherit)
+	require.NoError(t, err)
+
+	// Object should not be published
+	visibility, err := storage.GetVisibility(objectPath)
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPrivate, visibility)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_URLWithoutExistenceCheck(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage(
+		"storage-test/private",
+		"storage-test/public",
+		"http://localhost:8000/files",
+		nil,
+		gostorage.WithoutURLExistenceCheck())
+
+	// Object published out-of-band should still get url
+	publicURL, err := storage.URL("out-of-band/sample.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8000/files/out-of-band/sample.txt", publicURL)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ObjectLock(t *testing.T) {
+	storage := getLocalStorage()
+	objectPath := "exports/data.csv"
+
+	// Acquire lock
+	lock, err := gostorage.AcquireObjectLock(storage, objectPath, time.Minute)
+	require.NoError(t, err)
+
+	// Another worker should not be able to acquire it
+	_, err = gostorage.AcquireObjectLock(storage, objectPath, time.Minute)
+	require.Equal(t, gostorage.ErrLockHeld, err)
+
+	// Renew and release
+	require.NoError(t, lock.Renew(time.Minute))
+	require.NoError(t, lock.Release())
+
+	// Lock should be free again
+	lock, err = gostorage.AcquireObjectLock(storage, objectPath, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+
+	// Only one of concurrent workers win the conditional create
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = gostorage.AcquireObjectLock(storage, "exports/contended.csv", time.Minute)
+		}(i)
+	}
+	wg.Wait()
+	owners := 0
+	for _, err := range errs {
+		if err == nil {
+			owners++
+			continue
+		}
+		require.Equal(t, gostorage.ErrLockHeld, err)
+	}
+	require.Equal(t, 1, owners)
+
+	// An expired lease taken over by another worker is lost
+	expired, err := gostorage.AcquireObjectLock(storage, "exports/expired.csv", -time.Second)
+	require.NoError(t, err)
+	lock, err = gostorage.AcquireObjectLock(storage, "exports/expired.csv", time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ErrLockLost, expired.Renew(time.Minute))
+	require.Equal(t, gostorage.ErrLockLost, expired.Release())
+	require.NoError(t, lock.Renew(time.Minute))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_TransactionCommit(t *testing.T) {
+	storage := getLocalStorage()
+
+	tx, err := gostorage.BeginTransaction(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("dataset/data.csv", strings.NewReader("a,b"), gostorage.ObjectPrivate))
+	require.NoError(t, tx.Put("dataset/index.json", strings.NewReader("{}"), gostorage.ObjectPublicRead))
+
+	// Nothing should be visible before commit
+	exist, err := storage.Exist("dataset/data.csv")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	require.NoError(t, tx.Commit())
+
+	manifest, err := gostorage.ReadTransactionManifest(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dataset/data.csv", "dataset/index.json"}, manifest.Objects)
+
+	indexPath, ok := manifest.ObjectPath("dataset/index.json")
+	require.True(t, ok)
+	visibility, err := storage.GetVisibility(indexPath)
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+
+	// A second transaction stays invisible until its manifest replace the first one
+	readData := func() string {
+		reader, err := gostorage.ReadTransactionObject(storage, "dataset/MANIFEST", "dataset/data.csv")
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		_ = reader.Close()
+		return string(content)
+	}
+	tx, err = gostorage.BeginTransaction(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("dataset/data.csv", strings.NewReader("c,d"), gostorage.ObjectPrivate))
+	require.NoError(t, tx.Delete("dataset/index.json"))
+	require.Equal(t, "a,b", readData())
+	require.NoError(t, tx.Commit())
+	require.Equal(t, "c,d", readData())
+	_, err = gostorage.ReadTransactionObject(storage, "dataset/MANIFEST", "dataset/index.json")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	// Transactions open at the same time build on the manifest current at their commit
+	first, err := gostorage.BeginTransaction(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.NoError(t, first.Put("dataset/data.csv", strings.NewReader("e,f"), gostorage.ObjectPrivate))
+	second, err := gostorage.BeginTransaction(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.NoError(t, second.Put("dataset/data.csv", strings.NewReader("g,h"), gostorage.ObjectPrivate))
+	require.NoError(t, first.Commit())
+	require.NoError(t, second.Commit())
+	require.Equal(t, "g,h", readData())
+	manifest, err = gostorage.ReadTransactionManifest(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dataset/data.csv"}, manifest.Objects)
+
+	// only objects of the latest manifest are kept, replaced, deleted and rolled back ones are removed
+	dataPath, ok := manifest.ObjectPath("dataset/data.csv")
+	require.True(t, ok)
+	require.Equal(t, []string{dataPath}, listObjectPaths(t, storage, ".transactions/"))
+	tx, err = gostorage.BeginTransaction(storage, "dataset/MANIFEST")
+	require.NoError(t, err)
+	require.NoError(t, tx.Put("dataset/other.csv", strings.NewReader("i,j"), gostorage.ObjectPrivate))
+	require.NoError(t, tx.Rollback())
+	require.Equal(t, []string{dataPath}, listObjectPaths(t, storage, ".transactions/"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ConcatReaders(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("export/part-1.csv", strings.NewReader("a,1\n"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("export/part-2.csv", strings.NewReader(""), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("export/part-3.csv", strings.NewReader("b,2\n"), gostorage.ObjectPrivate))
+
+	reader := gostorage.ConcatReaders(storage, "export/part-1.csv", "export/part-2.csv", "export/part-3.csv")
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "a,1\nb,2\n", string(content))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_RetentionPolicy(t *testing.T) {
+	storage := gostorage.WithRetentionPolicy(getLocalStorage(), []gostorage.RetentionRule{
+		{Prefix: "audit/", MinAge: time.Hour},
+	})
+	objectPath := "audit/2021.log"
+
+	require.NoError(t, storage.Put(objectPath, strings.NewReader("entry"), gostorage.ObjectPrivate))
+
+	// Young object can't be deleted nor overwritten
+	require.Equal(t, gostorage.ErrRetained, storage.Delete(objectPath))
+	require.Equal(t, gostorage.ErrRetained, storage.Put(objectPath, strings.NewReader("changed"), gostorage.ObjectPrivate))
+
+	// Objects outside rule prefix are not affected
+	require.NoError(t, storage.Put("tmp/file.txt", strings.NewReader("tmp"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Delete("tmp/file.txt"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_LazyStorage(t *testing.T) {
+	created := 0
+	storage := gostorage.NewLazyStorage(func() (gostorage.Storage, error) {
+		created++
+		return getLocalStorage(), nil
+	})
+	require.Equal(t, 0, created)
+
+	require.NoError(t, storage.Connect(context.Background()))
+	exist, err := storage.Exist("missing.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	require.Equal(t, 1, created)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_MetadataIndex(t *testing.T) {
+	index, err := gostorage.OpenMetadataIndex("storage-test-index/index.db")
+	require.NoError(t, err)
+	defer os.RemoveAll("storage-test-index")
+	defer index.Close()
+
+	storage := gostorage.WithMetadataIndex(getLocalStorage(), index, "gallery/")
+	require.NoError(t, storage.Put("gallery/a.jpg", strings.NewReader("a"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("gallery/2021/b.jpg", strings.NewReader("bb"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("gallery/2021/c.jpg", strings.NewReader("ccc"), gostorage.ObjectPrivate))
+
+	dirs, objects, err := index.ListDir("gallery")
+	require.NoError(t, err)
+	require.Equal(t, []string{"gallery/2021/"}, dirs)
+	require.Len(t, objects, 1)
+	require.Equal(t, "gallery/a.jpg", objects[0].ObjectPath)
+
+	size, err := storage.Size("gallery/2021/c.jpg")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), size)
+
+	require.NoError(t, storage.Delete("gallery/a.jpg"))
+	object, err := index.Get("gallery/a.jpg")
+	require.NoError(t, err)
+	require.Nil(t, object)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_MetadataIndexSearch(t *testing.T) {
+	index, err := gostorage.OpenMetadataIndex("storage-test-index/index.db")
+	require.NoError(t, err)
+	defer os.RemoveAll("storage-test-index")
+	defer index.Close()
+
+	storage := gostorage.WithMetadataIndex(getLocalStorage(), index, "")
+	require.NoError(t, storage.Put("docs/Report-2021.pdf", strings.NewReader("report"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("docs/logo.png", strings.NewReader("png"), gostorage.ObjectPrivate))
+
+	objects, err := index.Search(gostorage.IndexQuery{Prefix: "docs/", Contains: "report"})
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, "docs/Report-2021.pdf", objects[0].ObjectPath)
+
+	objects, err = index.Search(gostorage.IndexQuery{ContentType: "image/"})
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	require.Equal(t, "docs/logo.png", objects[0].ObjectPath)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_PushPullArtifact(t *testing.T) {
+	storage := getLocalStorage()
+	defer os.RemoveAll("storage-test-artifact")
+
+	require.NoError(t, os.MkdirAll("storage-test-artifact/src/weights", os.ModePerm))
+	require.NoError(t, ioutil.WriteFile("storage-test-artifact/src/config.json", []byte("{}"), 0644))
+	require.NoError(t, ioutil.WriteFile("storage-test-artifact/src/weights/layer-1.bin", []byte("0101"), 0644))
+
+	manifest, err := gostorage.PushArtifact(storage, "storage-test-artifact/src", "models/v1")
+	require.NoError(t, err)
+	require.Len(t, manifest.Files, 2)
+
+	_, err = gostorage.PullArtifact(storage, "models/v1", "storage-test-artifact/dst")
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadFile("storage-test-artifact/dst/weights/layer-1.bin")
+	require.NoError(t, err)
+	require.Equal(t, "0101", string(content))
+
+	// Tampered file should fail verification
+	require.NoError(t, storage.Put("models/v1/config.json", strings.NewReader("{\"x\":1}"), gostorage.ObjectPrivate))
+	_, err = gostorage.PullArtifact(storage, "models/v1", "storage-test-artifact/dst")
+	require.True(t, errors.Is(err, gostorage.ErrArtifactCorrupted))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_DeployAssets(t *testing.T) {
+	storage := getLocalStorage()
+	defer os.RemoveAll("storage-test-site")
+
+	require.NoError(t, os.MkdirAll("storage-test-site/assets", os.ModePerm))
+	require.NoError(t, ioutil.WriteFile("storage-test-site/index.html", []byte("<html></html>"), 0644))
+	require.NoError(t, ioutil.WriteFile("storage-test-site/assets/app.3f2a9b1c.js", []byte("console.log(1)"), 0644))
+	require.NoError(t, ioutil.WriteFile("storage-test-site/assets/old.css", []byte("body{}"), 0644))
+
+	result, err := gostorage.DeployAssets(storage, "storage-test-site", "site", gostorage.DeployOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "site/index.html", result.Uploaded[len(result.Uploaded)-1])
+
+	require.NoError(t, os.Remove("storage-test-site/assets/old.css"))
+	result, err = gostorage.DeployAssets(storage, "storage-test-site", "site", gostorage.DeployOptions{DeleteRemoved: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"site/assets/old.css"}, result.Deleted)
+
+	exist, err := storage.Exist("site/assets/old.css")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_RotatingObjectWriter(t *testing.T) {
+	storage := getLocalStorage()
+
+	writer := gostorage.NewRotatingObjectWriter(storage, "logs/access-{name}.log", gostorage.RotatingWriterOptions{MaxSize: 10})
+	_, err := writer.Write([]byte("line-0001\n"))
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("line-0002\n"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	for i, expected := range []string{"line-0001\n", "line-0002\n"} {
+		reader, err := storage.Read(fmt.Sprintf("logs/access-%06d.log", i+1))
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+		require.Equal(t, expected, string(content))
+	}
+
+	_, err = writer.Write([]byte("late"))
+	require.Equal(t, gostorage.ErrWriterClosed, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ParseSchedule(t *testing.T) {
+	now := time.Date(2024, 1, 31, 10, 7, 30, 0, time.UTC)
+
+	schedule, err := gostorage.ParseSchedule("*/15 2 * * *")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 2, 1, 2, 0, 0, 0, time.UTC), schedule.Next(now))
+
+	schedule, err = gostorage.ParseSchedule("@every 1h")
+	require.NoError(t, err)
+	require.Equal(t, now.Add(time.Hour), schedule.Next(now))
+
+	_, err = gostorage.ParseSchedule("61 * * * *")
+	require.Error(t, err)
+}
+
+func Test_SchedulerOverlap(t *testing.T) {
+	storage := getLocalStorage()
+	scheduler := gostorage.NewScheduler(storage, "locks/jobs")
+
+	var results []gostorage.JobResult
+	scheduler.OnResult(func(result gostorage.JobResult) {
+		results = append(results, result)
+	})
+
+	attempts := 0
+	require.NoError(t, scheduler.AddJob(gostorage.ScheduledJob{
+		Name:     "backup",
+		Schedule: "@daily",
+		Retries:  1,
+		Run: func(ctx context.Context) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("transient")
+			}
+			return nil
+		},
+	}))
+
+	result, err := scheduler.RunNow(context.Background(), "backup")
+	require.NoError(t, err)
+	require.NoError(t, result.Err)
+	require.Equal(t, 2, result.Attempts)
+
+	// Held lock should skip the run
+	lock, err := gostorage.AcquireObjectLock(storage, "locks/jobs/backup", time.Minute)
+	require.NoError(t, err)
+	result, err = scheduler.RunNow(context.Background(), "backup")
+	require.NoError(t, err)
+	require.True(t, result.Skipped)
+	require.NoError(t, lock.Release())
+	require.Len(t, results, 2)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_LoadConfig(t *testing.T) {
+	defer os.RemoveAll("storage-test-config")
+	require.NoError(t, os.MkdirAll("storage-test-config", os.ModePerm))
+
+	content := `
+default: uploads
+storages:
+  uploads:
+    driver: local
+    base_dir: storage-test-config/private
+    public_base_dir: storage-test-config/public
+    public_base_url: http://localhost/public
+    skip_url_existence_check: true
+`
+	require.NoError(t, ioutil.WriteFile("storage-test-config/storages.yaml", []byte(content), 0644))
+
+	manager, err := gostorage.LoadConfig("storage-test-config/storages.yaml", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"uploads"}, manager.Names())
+
+	storage, err := manager.Default()
+	require.NoError(t, err)
+	url, err := storage.URL("a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost/public/a.txt", url)
+
+	// Encrypted config is decrypted before being parsed
+	reversed := []byte(`{"storages": {"tmp": {"driver": "local", "base_dir": "storage-test-config/tmp"}}}`)
+	for i, j := 0, len(reversed)-1; i < j; i, j = i+1, j-1 {
+		reversed[i], reversed[j] = reversed[j], reversed[i]
+	}
+	require.NoError(t, ioutil.WriteFile("storage-test-config/storages.json.enc", reversed, 0644))
+
+	manager, err = gostorage.LoadConfig("storage-test-config/storages.json.enc", gostorage.ConfigDecrypterFunc(func(data []byte) ([]byte, error) {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return data, nil
+	}))
+	require.NoError(t, err)
+	_, err = manager.Get("tmp")
+	require.NoError(t, err)
+}
+
+func Test_FromEnv(t *testing.T) {
+	os.Setenv("GOSTORAGE_LOCAL_DIR", "storage-test-env/private")
+	os.Setenv("GOSTORAGE_LOCAL_PUBLIC_URL", "http://localhost/public")
+	os.Setenv("GOSTORAGE_SKIP_URL_EXISTENCE_CHECK", "true")
+	defer func() {
+		os.Unsetenv("GOSTORAGE_LOCAL_DIR")
+		os.Unsetenv("GOSTORAGE_LOCAL_PUBLIC_URL")
+		os.Unsetenv("GOSTORAGE_SKIP_URL_EXISTENCE_CHECK")
+		os.RemoveAll("storage-test-env")
+	}()
+
+	storage, err := gostorage.FromEnv()
+	require.NoError(t, err)
+
+	url, err := storage.URL("a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost/public/a.txt", url)
+}
+
+func Test_RoutedStorage(t *testing.T) {
+	media := getLocalStorage()
+	tmp := gostorage.NewLocalStorage("storage-test/tmp", "storage-test/tmp-public", "http://localhost:8000/tmp", nil)
+	storage := gostorage.NewRoutedStorage(media, gostorage.Route{Prefix: "tmp/", Storage: tmp})
+
+	require.NoError(t, storage.Put("tmp/upload.txt", strings.NewReader("draft"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Copy("tmp/upload.txt", "media/final.txt"))
+
+	exist, err := tmp.Exist("tmp/upload.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	exist, err = media.Exist("media/final.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	exist, err = tmp.Exist("media/final.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_S3CompatiblePresetURL(t *testing.T) {
+	storage := gostorage.NewS3CompatibleStorage("scaleway", gostorage.S3Credentials{Region: "nl-ams"}, "assets")
+	url, err := storage.URL("img/a.png", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://assets.s3.nl-ams.scw.cloud/img/a.png", url)
+
+	storage = gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{}, "assets")
+	url, err = storage.URL("img/a.png", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://gateway.storjshare.io/assets/img/a.png", url)
+}
+
+func Test_Ingestor(t *testing.T) {
+	storage := getLocalStorage()
+	defer os.RemoveAll("storage-test-drop")
+	require.NoError(t, os.MkdirAll("storage-test-drop/in", os.ModePerm))
+	require.NoError(t, ioutil.WriteFile("storage-test-drop/in/existing.csv", []byte("a,b"), 0644))
+
+	results := make(chan gostorage.IngestResult, 4)
+	ingestor := gostorage.NewIngestor("storage-test-drop/in", storage, gostorage.IngestOptions{
+		Prefix:         "ingest",
+		Debounce:       20 * time.Millisecond,
+		StableInterval: 20 * time.Millisecond,
+		AfterUpload:    gostorage.IngestMove,
+		MoveDir:        "storage-test-drop/done",
+		OnResult: func(result gostorage.IngestResult) {
+			results <- result
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ingestor.Run(ctx) }()
+
+	result := <-results
+	require.NoError(t, result.Err)
+	require.Equal(t, "ingest/existing.csv", result.ObjectPath)
+	require.FileExists(t, "storage-test-drop/done/existing.csv")
+
+	require.NoError(t, ioutil.WriteFile("storage-test-drop/in/new.csv", []byte("c,d"), 0644))
+	result = <-results
+	require.NoError(t, result.Err)
+	require.Equal(t, "ingest/new.csv", result.ObjectPath)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	exist, err := storage.Exist("ingest/new.csv")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_BrowseHandler(t *testing.T) {
+	index, err := gostorage.OpenMetadataIndex("storage-test-index/index.db")
+	require.NoError(t, err)
+	defer os.RemoveAll("storage-test-index")
+	defer index.Close()
+
+	cleanTestDir()
+	local := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost:8000/files",
+		func(absoluteFilePath string, objectPath string, expireIn time.Duration) (string, error) {
+			return "http://localhost:8000/signed/" + objectPath, nil
+		})
+	storage := gostorage.WithMetadataIndex(local, index, "")
+	require.NoError(t, storage.Put("builds/app-1.0.zip", strings.NewReader("zip"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("builds/nightly/app.zip", strings.NewReader("zip"), gostorage.ObjectPrivate))
+
+	handler := gostorage.NewBrowseHandler(storage, "builds", gostorage.BrowseOptions{
+		Lister: index,
+		Auth: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "secret" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		},
+	})
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve("/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `href="nightly/"`)
+	require.Contains(t, rec.Body.String(), `href="app-1.0.zip"`)
+
+	rec = serve("/app-1.0.zip")
+	require.Equal(t, http.StatusFound, rec.Code)
+	require.Contains(t, rec.Header().Get("Location"), "builds/app-1.0.zip")
+
+	require.Equal(t, http.StatusMovedPermanently, serve("/nightly").Code)
+	require.Equal(t, http.StatusNotFound, serve("/missing/").Code)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_S3Gateway(t *testing.T) {
+	index, err := gostorage.OpenMetadataIndex("storage-test-index/index.db")
+	require.NoError(t, err)
+	defer os.RemoveAll("storage-test-index")
+	defer index.Close()
+
+	storage := gostorage.WithMetadataIndex(getLocalStorage(), index, "")
+	server := httptest.NewServer(gostorage.NewS3Gateway(storage, gostorage.S3GatewayOptions{
+		Bucket:      "files",
+		Credentials: map[string]string{"AKID": "SECRET"},
+		Lister:      index,
+	}))
+	defer server.Close()
+
+	client := s3.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:         aws.String(server.URL),
+		Region:           aws.String("us-east-1"),
+		Credentials:      credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		S3ForcePathStyle: aws.Bool(true),
+	})))
+
+	for _, key := range []string{"docs/a.txt", "docs/b.txt", "docs/nested/c.txt", "other.txt"} {
+		_, err := client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("files"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader("content of " + key),
+		})
+		require.NoError(t, err)
+	}
+
+	obj, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("docs/a.txt")})
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(obj.Body)
+	require.NoError(t, err)
+	require.Equal(t, "content of docs/a.txt", string(content))
+
+	list, err := client.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:    aws.String("files"),
+		Prefix:    aws.String("docs/"),
+		Delimiter: aws.String("/"),
+	})
+	require.NoError(t, err)
+	require.Len(t, list.Contents, 2)
+	require.Len(t, list.CommonPrefixes, 1)
+	require.Equal(t, "docs/nested/", *list.CommonPrefixes[0].Prefix)
+
+	var keys []string
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String("files"), MaxKeys: aws.Int64(3)},
+		func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+			for _, object := range page.Contents {
+				keys = append(keys, *object.Key)
+			}
+			return true
+		})
+	require.NoError(t, err)
+	require.Equal(t, []string{"docs/a.txt", "docs/b.txt", "docs/nested/c.txt", "other.txt"}, keys)
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("other.txt")})
+	signedURL, err := req.Presign(time.Minute)
+	require.NoError(t, err)
+	resp, err := http.Get(signedURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(strings.Replace(signedURL, "other.txt", "docs/a.txt", 1))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Expiry longer than 7 days is rejected like S3
+	resp, err = http.Get(strings.Replace(signedURL, "X-Amz-Expires=60", "X-Amz-Expires=604801", 1))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// A body not matching its signed hash is rejected without touching the object
+	putReq, _ := client.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String("files"),
+		Key:    aws.String("other.txt"),
+		Body:   strings.NewReader("content of other.txt"),
+	})
+	require.NoError(t, putReq.Sign())
+	putReq.HTTPRequest.Body = ioutil.NopCloser(strings.NewReader("CONTENT OF OTHER.TXT"))
+	resp, err = http.DefaultClient.Do(putReq.HTTPRequest)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	obj, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("files"), Key: aws.String("other.txt")})
+	require.NoError(t, err)
+	content, err = ioutil.ReadAll(obj.Body)
+	require.NoError(t, err)
+	require.Equal(t, "content of other.txt", string(content))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ScopedToken(t *testing.T) {
+	secret := []byte("delegation-secret")
+	token, err := gostorage.MintScopedToken(secret, gostorage.TokenScope{
+		Subject:    "thumbnailer",
+		Prefix:     "uploads/tenant-42/",
+		Operations: []gostorage.Operation{gostorage.OperationWrite},
+		ExpiresAt:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	storage, err := gostorage.WithScopedToken(getLocalStorage(), secret, token)
+	require.NoError(t, err)
+
+	require.NoError(t, storage.Put("uploads/tenant-42/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate))
+	require.ErrorIs(t, storage.Put("uploads/tenant-43/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate), gostorage.ErrTokenScope)
+	require.ErrorIs(t, storage.Put("uploads/tenant-42/../tenant-43/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate), gostorage.ErrTokenScope)
+	_, err = storage.Read("uploads/tenant-42/a.txt")
+	require.ErrorIs(t, err, gostorage.ErrTokenScope)
+
+	// prefix end at a directory boundary, siblings sharing its name are other tenants
+	sibling, err := gostorage.MintScopedToken(secret, gostorage.TokenScope{
+		Prefix:     "uploads/tenant-42",
+		Operations: []gostorage.Operation{gostorage.OperationWrite, gostorage.OperationList},
+		ExpiresAt:  time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	scope, err := gostorage.VerifyScopedToken(secret, sibling)
+	require.NoError(t, err)
+	require.True(t, scope.Allow(gostorage.OperationWrite, "uploads/tenant-42/a.txt"))
+	require.False(t, scope.Allow(gostorage.OperationWrite, "uploads/tenant-420/a.txt"))
+	require.False(t, scope.Allow(gostorage.OperationWrite, "uploads/tenant-42.txt"))
+	require.True(t, scope.Allow(gostorage.OperationList, "uploads/tenant-42/"))
+	require.False(t, scope.Allow(gostorage.OperationList, "uploads/tenant-42"))
+	siblingStorage, err := gostorage.WithScopedToken(getLocalStorage(), secret, sibling)
+	require.NoError(t, err)
+	require.ErrorIs(t, siblingStorage.Put("uploads/tenant-420/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate), gostorage.ErrTokenScope)
+
+	_, err = gostorage.WithScopedToken(getLocalStorage(), []byte("other-secret"), token)
+	require.ErrorIs(t, err, gostorage.ErrTokenInvalid)
+
+	expired, err := gostorage.MintScopedToken(secret, gostorage.TokenScope{
+		Prefix:     "uploads/",
+		Operations: []gostorage.Operation{gostorage.OperationRead},
+		ExpiresAt:  time.Now().Add(-time.Second),
+	})
+	require.NoError(t, err)
+	_, err = gostorage.VerifyScopedToken(secret, expired)
+	require.ErrorIs(t, err, gostorage.ErrTokenExpired)
+
+	// Gateway authorize requests carrying a token by its scope
+	server := httptest.NewServer(gostorage.NewS3Gateway(getLocalStorage(), gostorage.S3GatewayOptions{
+		Bucket:      "files",
+		TokenSecret: secret,
+	}))
+	defer server.Close()
+
+	put := func(key string) int {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/files/"+key, strings.NewReader("data"))
+		require.NoError(t, err)
+		req.Header.Set("X-Gostorage-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, put("uploads/tenant-42/b.txt"))
+	require.Equal(t, http.StatusForbidden, put("uploads/tenant-43/b.txt"))
+	require.Equal(t, http.StatusForbidden, put("uploads/tenant-420/b.txt"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_AuditLog(t *testing.T) {
+	secret := []byte("audit-secret")
+	local := getLocalStorage()
+	storage := gostorage.WithAuditLog(local, gostorage.AuditOptions{Secret: secret, Actor: "billing"})
+
+	require.NoError(t, storage.Put("invoices/1.pdf", strings.NewReader("v1"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("invoices/1.pdf", strings.NewReader("v2"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.SetVisibility("invoices/1.pdf", gostorage.ObjectPublicRead))
+	require.NoError(t, storage.Delete("invoices/1.pdf"))
+	require.ErrorIs(t, storage.Delete(".audit/anything.jsonl"), gostorage.ErrAuditImmutable)
+	require.ErrorIs(t, storage.Delete("x/../.audit/anything.jsonl"), gostorage.ErrAuditImmutable)
+	require.ErrorIs(t, storage.Put("./.audit/anything.jsonl", strings.NewReader("forged"), gostorage.ObjectPrivate), gostorage.ErrAuditImmutable)
+
+	// Touch can't create objects in the log prefix and touching an existing object is an overwrite
+	require.ErrorIs(t, storage.Touch(".audit/anything.jsonl"), gostorage.ErrAuditImmutable)
+	require.NoError(t, storage.Touch("invoices/2.pdf"))
+	require.NoError(t, storage.Touch("invoices/2.pdf"))
+
+	logPath := gostorage.AuditLogPath(".audit", time.Now())
+	records, err := gostorage.VerifyAuditLog(local, secret, logPath)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, gostorage.AuditOverwrite, records[0].Operation)
+	require.Equal(t, gostorage.AuditSetVisibility, records[1].Operation)
+	require.Equal(t, gostorage.AuditDelete, records[2].Operation)
+	require.Equal(t, "billing", records[2].Actor)
+	require.Equal(t, gostorage.AuditOverwrite, records[3].Operation)
+
+	// Drop the middle record
+	reader, err := local.Read(logPath)
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	_ = reader.Close()
+	lines := strings.SplitAfter(string(content), "\n")
+	require.NoError(t, local.Put(logPath, strings.NewReader(lines[0]+lines[2]), gostorage.ObjectPrivate))
+
+	_, err = gostorage.VerifyAuditLog(local, secret, logPath)
+	require.ErrorIs(t, err, gostorage.ErrAuditTampered)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Policy(t *testing.T) {
+	rules, err := gostorage.ParsePolicyRules(`
+# billing may only manage invoices
+deny * delete invoices/archive/
+allow billing read,write,delete invoices/
+allow admin * *
+`)
+	require.NoError(t, err)
+
+	storage := gostorage.WithPolicy(getLocalStorage(), gostorage.NewRulePolicy(rules...))
+	billing := gostorage.BindContext(storage, gostorage.ContextWithPrincipal(context.Background(), "billing"))
+	admin := gostorage.BindContext(storage, gostorage.ContextWithPrincipal(context.Background(), "admin"))
+
+	require.NoError(t, billing.Put("invoices/1.pdf", strings.NewReader("1"), gostorage.ObjectPrivate))
+	require.NoError(t, billing.Put("invoices/archive/0.pdf", strings.NewReader("0"), gostorage.ObjectPrivate))
+	require.ErrorIs(t, billing.Put("reports/1.pdf", strings.NewReader("1"), gostorage.ObjectPrivate), gostorage.ErrForbidden)
+	require.ErrorIs(t, billing.Delete("invoices/archive/0.pdf"), gostorage.ErrForbidden)
+	require.ErrorIs(t, admin.Delete("invoices/archive/0.pdf"), gostorage.ErrForbidden)
+	require.NoError(t, admin.Put("reports/1.pdf", strings.NewReader("1"), gostorage.ObjectPrivate))
+
+	// non-canonical paths are matched as the key they resolve to
+	for _, objectPath := range []string{"./invoices/archive/0.pdf", "//invoices/archive/0.pdf", "x/../invoices/archive/0.pdf", "invoices/./archive//0.pdf"} {
+		require.ErrorIs(t, admin.Delete(objectPath), gostorage.ErrForbidden, objectPath)
+	}
+	require.ErrorIs(t, billing.Put("invoices/../reports/2.pdf", strings.NewReader("2"), gostorage.ObjectPrivate), gostorage.ErrForbidden)
+	exist, err := admin.Exist("invoices/archive/0.pdf")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// No principal bound
+	_, err = storage.Exist("invoices/1.pdf")
+	require.ErrorIs(t, err, gostorage.ErrForbidden)
+
+	_, err = gostorage.ParsePolicyRules("allow billing rename invoices/")
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_DiskCachePinning(t *testing.T) {
+	local := getLocalStorage()
+	cache, err := gostorage.NewDiskCache(local, gostorage.DiskCacheOptions{
+		Dir:        "storage-test/cache",
+		MaxBytes:   20,
+		Priorities: map[string]int{"assets/": 10},
+	})
+	require.NoError(t, err)
+
+	read := func(objectPath string) string {
+		reader, err := cache.Read(objectPath)
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		_ = reader.Close()
+		return string(content)
+	}
+
+	require.NoError(t, local.Put("fonts/inter.woff2", strings.NewReader("font-data"), gostorage.ObjectPrivate)) // 9 bytes
+	require.NoError(t, local.Put("assets/app.js", strings.NewReader("app-js"), gostorage.ObjectPrivate))        // 6 bytes
+	for i := 0; i < 3; i++ {
+		require.NoError(t, local.Put(fmt.Sprintf("media/%d.jpg", i), strings.NewReader("jpeg"), gostorage.ObjectPrivate))
+	}
+
+	require.NoError(t, cache.Pin("fonts/inter.woff2"))
+	require.Equal(t, "app-js", read("assets/app.js"))
+	for i := 0; i < 3; i++ {
+		require.Equal(t, "jpeg", read(fmt.Sprintf("media/%d.jpg", i)))
+	}
+
+	// Bulk media cycle through while pinned and high priority objects stay
+	require.True(t, cache.Cached("fonts/inter.woff2"))
+	require.True(t, cache.Cached("assets/app.js"))
+	require.False(t, cache.Cached("media/0.jpg"))
+	require.True(t, cache.Cached("media/2.jpg"))
+
+	// Pinned content is served even if the backend copy disappeared
+	require.NoError(t, local.Delete("fonts/inter.woff2"))
+	require.Equal(t, "font-data", read("fonts/inter.woff2"))
+
+	cache.Unpin("fonts/inter.woff2")
+	require.NoError(t, cache.Put("media/3.jpg", strings.NewReader("jpeg"), gostorage.ObjectPrivate))
+	require.Equal(t, "jpeg", read("media/3.jpg"))
+	require.Equal(t, "jpeg", read("media/1.jpg"))
+	require.False(t, cache.Cached("fonts/inter.woff2"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+type existCountingStorage struct {
+	gostorage.Storage
+	calls int
+}
+
+func (s *existCountingStorage) Exist(objectPath string) (bool, error) {
+	s.calls++
+	return s.Storage.Exist(objectPath)
+}
+
+func Test_DiskCacheNegativeCaching(t *testing.T) {
+	backend := &existCountingStorage{Storage: getLocalStorage()}
+	cache, err := gostorage.NewDiskCache(backend, gostorage.DiskCacheOptions{
+		Dir:         "storage-test/cache",
+		MaxBytes:    1024,
+		NegativeTTL: time.Minute,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		exist, err := cache.Exist("wp-login.php")
+		require.NoError(t, err)
+		require.False(t, exist)
+	}
+	require.Equal(t, 1, backend.calls)
+
+	// Writing through the cache drop the negative entry
+	require.NoError(t, cache.Put("wp-login.php", strings.NewReader("<?php"), gostorage.ObjectPrivate))
+	exist, err := cache.Exist("wp-login.php")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, 2, backend.calls)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_TemporaryURLExpiryClamp(t *testing.T) {
+	var clamps []gostorage.URLExpiryClamp
+	hook := gostorage.WithURLExpiryClampHook(func(clamp gostorage.URLExpiryClamp) {
+		clamps = append(clamps, clamp)
+	})
+
+	// Driver default raise S3 expiry to 24h
+	storage := gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "", hook)
+	signedURL, err := storage.TemporaryURL("a.txt", time.Hour, nil)
+	require.NoError(t, err)
+	require.Contains(t, signedURL, "X-Amz-Expires=86400")
+	require.Len(t, clamps, 1)
+
+	storage = gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "", hook,
+		gostorage.WithTemporaryURLExpiry(0, 2*time.Hour))
+	signedURL, err = storage.TemporaryURL("a.txt", time.Hour, nil)
+	require.NoError(t, err)
+	require.Contains(t, signedURL, "X-Amz-Expires=3600")
+	signedURL, err = storage.TemporaryURL("a.txt", 3*time.Hour, nil)
+	require.NoError(t, err)
+	require.Contains(t, signedURL, "X-Amz-Expires=7200")
+
+	require.Len(t, clamps, 2)
+	require.Equal(t, gostorage.URLExpiryClamp{ObjectPath: "a.txt", Requested: 3 * time.Hour, Applied: 2 * time.Hour}, clamps[1])
+}
+
+func Test_TemporaryURLWithOptions(t *testing.T) {
+	storage := gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "")
+	signedURL, err := gostorage.TemporaryURLWithOptions(storage, "report.pdf", time.Hour, gostorage.SignedURLOptions{
+		Query:   map[string]string{"response-content-disposition": "attachment"},
+		Headers: map[string]string{"If-Match": "\"etag\""},
+	})
+	require.NoError(t, err)
+	require.Contains(t, signedURL, "response-content-disposition=attachment")
+	require.Contains(t, signedURL, "X-Amz-SignedHeaders=host%3Bif-match")
+
+	_, err = gostorage.TemporaryURLWithOptions(getLocalStorage(), "report.pdf", time.Hour, gostorage.SignedURLOptions{
+		Query: map[string]string{"versionId": "1"},
+	})
+	require.ErrorIs(t, err, gostorage.ErrSignedURLOptionsUnsupported)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_VersionPinnedURLs(t *testing.T) {
+	storage, ok := gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "").(gostorage.VersionedStorage)
+	require.True(t, ok)
+
+	objectURL, err := storage.URLVersion("contracts/42.pdf", "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY")
+	require.NoError(t, err)
+	require.Equal(t, "https://bucket.s3-us-east-1.amazonaws.com/contracts/42.pdf?versionId=3HL4kqtJlcpXroDTDmJ%2BrmSpXd3dIbrHY", objectURL)
+
+	signedURL, err := storage.TemporaryURLVersion("contracts/42.pdf", "v1", time.Hour)
+	require.NoError(t, err)
+	require.Contains(t, signedURL, "versionId=v1")
+}
+
+func Test_DownloadTo(t *testing.T) {
+	storage := getLocalStorage()
+	content := strings.Repeat("0123456789abcdef", 1000)
+	require.NoError(t, storage.Put("large.bin", strings.NewReader(content), gostorage.ObjectPrivate))
+
+	var buf strings.Builder
+	written, err := gostorage.DownloadTo(storage, "large.bin", &buf, gostorage.DownloadOptions{PartSize: 1000, Concurrency: 3})
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), written)
+	require.Equal(t, content, buf.String())
+
+	rangeReader, ok := storage.(gostorage.RangeReader)
+	require.True(t, ok)
+	reader, err := rangeReader.ReadRange("large.bin", 16, 4)
+	require.NoError(t, err)
+	part, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "0123", string(part))
+
+	_, err = gostorage.DownloadTo(storage, "missing.bin", &buf, gostorage.DownloadOptions{})
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_HedgedReads(t *testing.T) {
+	requests := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		if len(requests) == 1 {
+			// the first request hangs until the hedged one win and cancel it
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithHedgedReads(50*time.Millisecond))
+
+	start := time.Now()
+	reader, err := storage.Read("small.txt")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "hello", string(data))
+	require.Less(t, time.Since(start), 2*time.Second)
+	require.Equal(t, 2, len(requests))
+}
+
+func Test_RetryBudget(t *testing.T) {
+	var requests int
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	budget := gostorage.NewRetryBudget(gostorage.RetryBudgetOptions{MaxTokens: 2})
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithRetryBudget(budget))
+
+	_, err := storage.Size("a.txt")
+	require.Error(t, err)
+	_, err = storage.Size("b.txt")
+	require.Error(t, err)
+
+	// the first request drain the budget with two retries, the second isn't retried
+	require.Equal(t, 4, requests)
+	stats := budget.Stats()
+	require.Equal(t, int64(2), stats.Retries)
+	require.Equal(t, int64(2), stats.Exhausted)
+
+	recorder := httptest.NewRecorder()
+	budget.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Contains(t, recorder.Body.String(), "gostorage_retry_budget_exhausted_total 2")
+}
+
+func Test_List(t *testing.T) {
+	storage := getLocalStorage()
+	for _, objectPath := range []string{"docs/a.txt", "docs/b/c.txt", "docs/ab.txt", "images/d.png"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader(objectPath), gostorage.ObjectPrivate))
+	}
+
+	listed := func(storage gostorage.Storage, prefix string) []string {
+		iterator, err := storage.List(prefix)
+		require.NoError(t, err)
+		var objectPaths []string
+		for iterator.Next() {
+			object := iterator.Object()
+			require.Equal(t, int64(len(object.ObjectPath)), object.Size)
+			require.False(t, object.LastModified.IsZero())
+			objectPaths = append(objectPaths, object.ObjectPath)
+		}
+		require.NoError(t, iterator.Err())
+		return objectPaths
+	}
+
+	require.Equal(t, []string{"docs/a.txt", "docs/ab.txt", "docs/b/c.txt"}, listed(storage, "docs/"))
+	require.Equal(t, []string{"docs/a.txt", "docs/ab.txt"}, listed(storage, "/docs/a"))
+	require.Empty(t, listed(storage, "missing/"))
+
+	// backend shared by a route and fallback is listed once
+	routed := gostorage.NewRoutedStorage(storage, gostorage.Route{Prefix: "images/", Storage: storage})
+	require.Equal(t, []string{"docs/a.txt", "docs/ab.txt", "docs/b/c.txt", "images/d.png"}, listed(routed, ""))
+	require.Equal(t, []string{"images/d.png"}, listed(routed, "images/"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_LocalMetadataSidecar(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("docs/a.txt", strings.NewReader("hello"), gostorage.ObjectPublicRead))
+
+	data, err := ioutil.ReadFile("storage-test/private/.gostorage-meta/docs/a.txt.json")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"version":1,"visibility":"public-read","content_type":"text/plain; charset=utf-8",
+		"sha256":"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824","size":5}`, string(data))
+
+	require.NoError(t, storage.SetVisibility("docs/a.txt", gostorage.ObjectPrivate))
+	visibility, err := storage.GetVisibility("docs/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPrivate, visibility)
+
+	// object stored before sidecars existed is migrated when read
+	require.NoError(t, ioutil.WriteFile("storage-test/private/legacy.json", []byte("{}"), 0644))
+	count, err := gostorage.MigrateLocalMetadata(storage)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	data, err = ioutil.ReadFile("storage-test/private/.gostorage-meta/legacy.json.json")
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"visibility":"private","content_type":"application/json"`)
+
+	// sidecars are hidden from listing and removed with their object
+	iterator, err := storage.List("")
+	require.NoError(t, err)
+	for iterator.Next() {
+		require.NotContains(t, iterator.Object().ObjectPath, ".gostorage-meta")
+	}
+	require.NoError(t, storage.Delete("docs/a.txt"))
+	_, err = os.Stat("storage-test/private/.gostorage-meta/docs/a.txt.json")
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, ioutil.WriteFile("storage-test/private/.gostorage-meta/legacy.json.json", []byte(`{"version":99}`), 0644))
+	_, err = storage.GetVisibility("legacy.json")
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Stat(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("docs/a.txt", strings.NewReader("hello"), gostorage.ObjectPublicRead))
+
+	info, err := storage.Stat("docs/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "docs/a.txt", info.ObjectPath)
+	require.Equal(t, int64(5), info.Size)
+	require.False(t, info.LastModified.IsZero())
+	require.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", info.ETag)
+	require.Equal(t, gostorage.ObjectPublicRead, info.Visibility)
+
+	_, err = storage.Stat("docs/missing.txt")
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_StatS3SingleRequest(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, http.MethodHead, r.Method)
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"5d41402abc4b2a76b9719d911017c592"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+
+	info, err := storage.Stat("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+	require.Equal(t, gostorage.ObjectInfo{
+		ObjectPath:   "a.txt",
+		Size:         5,
+		LastModified: time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC),
+		ContentType:  "text/plain",
+		ETag:         "5d41402abc4b2a76b9719d911017c592",
+	}, info)
+}
+
+func Test_CopyWithOptions(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("src.txt", strings.NewReader("hello"), gostorage.ObjectPublicRead))
+
+	// plain copy keep visibility of the source
+	require.NoError(t, storage.Copy("src.txt", "copy.txt"))
+	visibility, err := storage.GetVisibility("copy.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+
+	require.NoError(t, gostorage.CopyWithOptions(storage, "src.txt", "replaced.bin", gostorage.CopyOptions{
+		MetadataDirective: gostorage.MetadataReplace,
+		Headers:           gostorage.ObjectHeaders{ContentType: "application/x-custom"},
+		Visibility:        gostorage.ObjectPrivate,
+	}))
+	info, err := storage.Stat("replaced.bin")
+	require.NoError(t, err)
+	require.Equal(t, "application/x-custom", info.ContentType)
+	require.Equal(t, gostorage.ObjectPrivate, info.Visibility)
+
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+	}))
+	defer server.Close()
+
+	gostorage.RegisterS3Preset(gostorage.S3Preset{Name: "test-acl", DefaultRegion: "us-east-1", PathStyle: true})
+	s3Storage := gostorage.NewS3CompatibleStorage("test-acl", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, gostorage.CopyWithOptions(s3Storage, "src.txt", "dst.txt", gostorage.CopyOptions{
+		MetadataDirective: gostorage.MetadataReplace,
+		Metadata:          map[string]string{"owner": "billing"},
+		Visibility:        gostorage.ObjectPublicRead,
+		StorageClass:      "STANDARD_IA",
+		ReplaceTags:       true,
+		Tags:              map[string]string{"team": "finance"},
+	}))
+	require.Equal(t, "REPLACE", header.Get("X-Amz-Metadata-Directive"))
+	require.Equal(t, "billing", header.Get("X-Amz-Meta-Owner"))
+	require.Equal(t, "public-read", header.Get("X-Amz-Acl"))
+	require.Equal(t, "STANDARD_IA", header.Get("X-Amz-Storage-Class"))
+	require.Equal(t, "REPLACE", header.Get("X-Amz-Tagging-Directive"))
+	require.Equal(t, "team=finance", header.Get("X-Amz-Tagging"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_PutWithOptions(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.PutWithOptions("report.dat", strings.NewReader("hello"), gostorage.PutOptions{
+		Visibility: gostorage.ObjectPublicRead,
+		ObjectMetadata: gostorage.ObjectMetadata{
+			Headers: gostorage.ObjectHeaders{
+				ContentType:        "text/csv",
+				ContentDisposition: `attachment; filename="report.csv"`,
+				CacheControl:       "max-age=60",
+			},
+			Metadata: map[string]string{"Owner": "billing"},
+		},
+	}))
+
+	metadata, err := storage.GetMetadata("report.dat")
+	require.NoError(t, err)
+	require.Equal(t, "text/csv", metadata.Headers.ContentType)
+	require.Equal(t, `attachment; filename="report.csv"`, metadata.Headers.ContentDisposition)
+	require.Equal(t, "max-age=60", metadata.Headers.CacheControl)
+	require.Equal(t, map[string]string{"owner": "billing"}, metadata.Metadata)
+
+	require.NoError(t, storage.SetMetadata("report.dat", gostorage.ObjectMetadata{
+		Headers:  gostorage.ObjectHeaders{ContentType: "application/json"},
+		Metadata: map[string]string{"owner": "finance"},
+	}))
+	info, err := storage.Stat("report.dat")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", info.ContentType)
+	require.Equal(t, gostorage.ObjectPublicRead, info.Visibility)
+	metadata, err = storage.GetMetadata("report.dat")
+	require.NoError(t, err)
+	require.Empty(t, metadata.Headers.CacheControl)
+	require.Equal(t, "finance", metadata.Metadata["owner"])
+
+	cleanTestDir()
+}
+
+func Test_S3CopySource(t *testing.T) {
+	var copySources []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		copySources = append(copySources, r.Header.Get("X-Amz-Copy-Source"))
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, storage.Copy("/reports/2024 q1+final.csv", "copy.csv"))
+	require.NoError(t, gostorage.CopyWithOptions(storage, "shared/a&b.txt", "copy.txt", gostorage.CopyOptions{
+		SourceBucket: "archive",
+	}))
+	require.Equal(t, []string{
+		"bucket/reports/2024%20q1%2Bfinal.csv",
+		"archive/shared/a%26b.txt",
+	}, copySources)
+
+	// local storage has no buckets
+	local := getLocalStorage()
+	require.NoError(t, local.Put("src.txt", strings.NewReader("hello"), gostorage.ObjectPrivate))
+	err := gostorage.CopyWithOptions(local, "src.txt", "dst.txt", gostorage.CopyOptions{SourceBucket: "archive"})
+	require.ErrorIs(t, err, gostorage.ErrCopyOptionsUnsupported)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Writer(t *testing.T) {
+	storage := getLocalStorage()
+	writer, err := storage.Writer("exports/report.csv", gostorage.ObjectPublicRead)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err := writer.Write([]byte("row\n"))
+		require.NoError(t, err)
+	}
+	exist, err := storage.Exist("exports/report.csv")
+	require.NoError(t, err)
+	require.False(t, exist)
+	require.NoError(t, writer.Close())
+
+	reader, err := storage.Read("exports/report.csv")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, "row\nrow\nrow\n", string(content))
+	visibility, err := storage.GetVisibility("exports/report.csv")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+
+	// aborted writes leave nothing behind
+	writer, err = storage.Writer("exports/aborted.csv", gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, writer.CloseWithError(nil))
+	exist, err = storage.Exist("exports/aborted.csv")
+	require.NoError(t, err)
+	require.False(t, exist)
+	iterator, err := storage.List("")
+	require.NoError(t, err)
+	var listed []string
+	for iterator.Next() {
+		listed = append(listed, iterator.Object().ObjectPath)
+	}
+	require.NoError(t, iterator.Err())
+	require.Equal(t, []string{"exports/report.csv"}, listed)
+
+	// escaping paths stay inside the base directory
+	writer, err = storage.Writer("../../escape.txt", gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.True(t, fileExists("storage-test/private/escape.txt"))
+	require.False(t, fileExists("storage-test/escape.txt"))
+	require.False(t, fileExists("escape.txt"))
+
+	// S3 abort the multipart upload
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RawQuery)
+		mu.Unlock()
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>report.csv</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	writer, err = s3Storage.Writer("report.csv", gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	_, err = writer.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, writer.CloseWithError(nil))
+	require.Equal(t, []string{"POST uploads=", "DELETE uploadId=upload-1"}, requests)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ReaderAt(t *testing.T) {
+	storage := getLocalStorage()
+
+	var archive strings.Builder
+	zipWriter := zip.NewWriter(&archive)
+	file, err := zipWriter.Create("footer.txt")
+	require.NoError(t, err)
+	_, err = file.Write([]byte("read through ranges"))
+	require.NoError(t, err)
+	require.NoError(t, zipWriter.Close())
+	require.NoError(t, storage.Put("archive.zip", strings.NewReader(archive.String()), gostorage.ObjectPrivate))
+
+	readerAt, err := gostorage.NewReaderAt(storage, "archive.zip")
+	require.NoError(t, err)
+	require.Equal(t, int64(archive.Len()), readerAt.Size())
+	zipReader, err := zip.NewReader(readerAt, readerAt.Size())
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 1)
+	entry, err := zipReader.File[0].Open()
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(entry)
+	require.NoError(t, err)
+	require.Equal(t, "read through ranges", string(content))
+
+	// reads crossing the end are short with io.EOF
+	buffer := make([]byte, 10)
+	n, err := readerAt.ReadAt(buffer, readerAt.Size()-4)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 4, n)
+	require.Equal(t, archive.String()[archive.Len()-4:], string(buffer[:n]))
+	_, err = readerAt.ReadAt(buffer, readerAt.Size())
+	require.Equal(t, io.EOF, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Move(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.PutWithOptions("inbox/photo.jpg", strings.NewReader("image"), gostorage.PutOptions{
+		Visibility:     gostorage.ObjectPublicRead,
+		ObjectMetadata: gostorage.ObjectMetadata{Metadata: map[string]string{"owner": "alice"}},
+	}))
+
+	require.NoError(t, storage.Move("inbox/photo.jpg", "archive/photo.jpg"))
+	exist, err := storage.Exist("inbox/photo.jpg")
+	require.NoError(t, err)
+	require.False(t, exist)
+	_, err = os.Lstat("storage-test/public/inbox/photo.jpg")
+	require.True(t, os.IsNotExist(err))
+
+	reader, err := storage.Read("archive/photo.jpg")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, "image", string(content))
+	visibility, err := storage.GetVisibility("archive/photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+	public, err := ioutil.ReadFile("storage-test/public/archive/photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "image", string(public))
+	metadata, err := storage.GetMetadata("archive/photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "alice", metadata.Metadata["owner"])
+
+	// moving onto itself keep the object
+	require.NoError(t, storage.Move("archive/photo.jpg", "/archive/photo.jpg"))
+	exist, err = storage.Exist("archive/photo.jpg")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// S3 copy server-side then delete the source
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPut {
+			w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, s3Storage.Move("inbox/photo.jpg", "archive/photo.jpg"))
+	require.Equal(t, "PUT /bucket/archive/photo.jpg", requests[0])
+	require.Equal(t, "DELETE /bucket/inbox/photo.jpg", requests[len(requests)-1])
+
+	// Clean up
+	cleanTestDir()
+}
+
+var objectPathSeeds = []string{
+	"a.txt",
+	"/reports//2024/../2025/q1.csv",
+	"dir/./file",
+	"trailing/",
+	"../escape.txt",
+	"a/../../b",
+	"..",
+	"/",
+	"",
+	"with space/a+b&c%20.txt",
+}
+
+func FuzzNormalizeObjectPath(f *testing.F) {
+	for _, seed := range objectPathSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, objectPath string) {
+		normalized, err := gostorage.NormalizeObjectPath(objectPath)
+		if err != nil {
+			require.ErrorIs(t, err, gostorage.ErrInvalidObjectPath)
+			return
+		}
+
+		// stable once normalized, whatever separators surround it
+		again, err := gostorage.NormalizeObjectPath(normalized)
+		require.NoError(t, err)
+		require.Equal(t, normalized, again)
+		rooted, err := gostorage.NormalizeObjectPath("/" + objectPath + "/")
+		require.NoError(t, err)
+		require.Equal(t, normalized, rooted)
+
+		// never escape the root
+		require.NotEmpty(t, normalized)
+		require.True(t, strings.HasPrefix(path.Join("root", normalized), "root/"))
+		for _, segment := range strings.Split(normalized, "/") {
+			require.NotContains(t, []string{"", ".", ".."}, segment)
+		}
+	})
+}
+
+func Test_NormalizeObjectPathConsistency(t *testing.T) {
+	var headPaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headPaths = append(headPaths, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+
+	for _, objectPath := range objectPathSeeds {
+		normalized, err := gostorage.NormalizeObjectPath(objectPath)
+		if err != nil {
+			continue
+		}
+
+		// local storage store the object under its normalized path
+		storage := getLocalStorage()
+		require.NoError(t, storage.Put(objectPath, strings.NewReader("content"), gostorage.ObjectPrivate))
+		iterator, err := storage.List("")
+		require.NoError(t, err)
+		require.True(t, iterator.Next())
+		require.Equal(t, normalized, iterator.Object().ObjectPath)
+		require.False(t, iterator.Next())
+
+		// S3 address the same key
+		headPaths = nil
+		_, err = s3Storage.Exist(objectPath)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/bucket/" + normalized}, headPaths)
+
+		// and sign URLs of that key
+		signedURL, err := s3Storage.TemporaryURL(objectPath, time.Hour, nil)
+		require.NoError(t, err)
+		parsed, err := url.Parse(signedURL)
+		require.NoError(t, err)
+		require.Equal(t, "/bucket/"+normalized, parsed.Path)
+	}
+
+	// escaping paths are clamped to the root by drivers
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("../../escape.txt", strings.NewReader("content"), gostorage.ObjectPrivate))
+	require.True(t, fileExists("storage-test/private/escape.txt"))
+	require.False(t, fileExists("storage-test/escape.txt"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func fileExists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
+
+func Test_DeletePrefix(t *testing.T) {
+	storage := getLocalStorage()
+	for _, objectPath := range []string{"tenant/1.txt", "tenant/2.txt", "tenant/sub/3.txt", "tenant-archive/4.txt"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader("content"), gostorage.ObjectPublicRead))
+	}
+
+	count, err := gostorage.CountPrefix(storage, "tenant/")
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	_, err = gostorage.CountPrefix(storage, "/")
+	require.Error(t, err)
+	require.Error(t, storage.DeletePrefix(""))
+
+	require.NoError(t, storage.DeletePrefix("tenant/"))
+	require.False(t, fileExists("storage-test/private/tenant"))
+	require.False(t, fileExists("storage-test/public/tenant"))
+	count, err = gostorage.CountPrefix(storage, "tenant")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// partial names delete listed objects
+	require.NoError(t, storage.DeletePrefix("tenant"))
+	exist, err := storage.Exist("tenant-archive/4.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// S3 list then delete in batch
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RawQuery)
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`<ListBucketResult><Contents><Key>tenant/1.txt</Key><Size>7</Size></Contents><Contents><Key>tenant/2.txt</Key><Size>7</Size></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`))
+			return
+		}
+		w.Write([]byte(`<DeleteResult></DeleteResult>`))
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, s3Storage.DeletePrefix("tenant/"))
+	require.Len(t, requests, 2)
+	require.Contains(t, requests[0], "prefix=tenant%2F")
+	require.Equal(t, "POST delete=", requests[1])
+
+	// Clean up
+	cleanTestDir()
+}
+
+// multipartServer is fake S3 endpoint recording multipart uploads
+type multipartServer struct {
+	mu        sync.Mutex
+	parts     map[string]string
+	initiated int
+	completed bool
+	aborted   bool
+}
+
+func (m *multipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		m.initiated++
+		w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>piped.bin</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		body, _ := ioutil.ReadAll(r.Body)
+		m.parts[query.Get("partNumber")] = string(body)
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%s"`, query.Get("partNumber")))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		m.completed = true
+		w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodDelete:
+		m.aborted = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func Test_PutPipeSource(t *testing.T) {
+	newServer := func() (*multipartServer, gostorage.Storage, func()) {
+		fake := &multipartServer{parts: make(map[string]string)}
+		server := httptest.NewServer(fake)
+		storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket")
+		return fake, storage, server.Close
+	}
+
+	// slow producer writing small chunks across a part boundary
+	fake, storage, closeServer := newServer()
+	content := strings.Repeat("0123456789abcdef", 6*1024*1024/16)
+	reader, writer := io.Pipe()
+	go func() {
+		for offset := 0; offset < len(content); offset += 100 * 1024 {
+			if offset%(1024*1024) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			writer.Write([]byte(content[offset:min(offset+100*1024, len(content))]))
+		}
+		writer.Close()
+	}()
+	require.NoError(t, storage.Put("piped.bin", reader, gostorage.ObjectPrivate))
+	require.True(t, fake.completed)
+	require.Len(t, fake.parts, 2)
+	require.Equal(t, content, fake.parts["1"]+fake.parts["2"])
+	closeServer()
+
+	// empty source is uploaded as one empty part
+	fake, storage, closeServer = newServer()
+	reader, writer = io.Pipe()
+	writer.Close()
+	require.NoError(t, storage.Put("piped.bin", reader, gostorage.ObjectPrivate))
+	require.True(t, fake.completed)
+	require.Equal(t, map[string]string{"1": ""}, fake.parts)
+	closeServer()
+
+	// failing producer abort the upload
+	fake, storage, closeServer = newServer()
+	reader, writer = io.Pipe()
+	go func() {
+		writer.Write([]byte("partial"))
+		writer.CloseWithError(errors.New("producer failed"))
+	}()
+	require.EqualError(t, storage.Put("piped.bin", reader, gostorage.ObjectPrivate), "producer failed")
+	require.False(t, fake.completed)
+	require.True(t, fake.aborted)
+	closeServer()
+}
+
+func Test_CopyPrefix(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("site/index.html", strings.NewReader("index"), gostorage.ObjectPublicRead))
+	require.NoError(t, storage.Put("site/assets/app.js", strings.NewReader("app"), gostorage.ObjectPrivate))
+
+	require.NoError(t, storage.CopyPrefix("site/", "release/v1/"))
+	index, err := ioutil.ReadFile("storage-test/public/release/v1/index.html")
+	require.NoError(t, err)
+	require.Equal(t, "index", string(index))
+	visibility, err := storage.GetVisibility("release/v1/assets/app.js")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPrivate, visibility)
+	exist, err := storage.Exist("site/assets/app.js")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	require.Error(t, storage.CopyPrefix("site/", "site/backup/"))
+	require.Error(t, storage.CopyPrefix("", "backup/"))
+
+	// S3 copies run in parallel, bounded by WithCopyConcurrency
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	var copied []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			var contents strings.Builder
+			for i := 0; i < 6; i++ {
+				fmt.Fprintf(&contents, "<Contents><Key>site/%d.txt</Key><Size>1</Size></Contents>", i)
+			}
+			fmt.Fprintf(w, "<ListBucketResult>%s<IsTruncated>false</IsTruncated></ListBucketResult>", contents.String())
+			return
+		}
+
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		copied = append(copied, r.Header.Get("X-Amz-Copy-Source")+" "+r.URL.Path)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(`<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`))
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithCopyConcurrency(2))
+	require.NoError(t, s3Storage.CopyPrefix("/site/", "release/"))
+	require.Len(t, copied, 6)
+	require.Contains(t, copied, "bucket/site/3.txt /bucket/release/3.txt")
+	require.Equal(t, 2, maxInFlight)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_SDKAccessors(t *testing.T) {
+	local := getLocalStorage()
+	wrapped := gostorage.NewLazyStorage(func() (gostorage.Storage, error) {
+		return gostorage.WithCostEstimation(local, gostorage.NewCostEstimator(gostorage.PricingTable{}, 1)), nil
+	})
+	baseDir, publicBaseDir, ok := gostorage.LocalBaseDir(wrapped)
+	require.True(t, ok)
+	require.Equal(t, "storage-test/private", baseDir)
+	require.Equal(t, "storage-test/public", publicBaseDir)
+	_, _, ok = gostorage.S3Client(wrapped)
+	require.False(t, ok)
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        "http://localhost:1",
+	}, "bucket")
+	client, bucketName, ok := gostorage.S3Client(s3Storage)
+	require.True(t, ok)
+	require.NotNil(t, client)
+	require.Equal(t, "bucket", bucketName)
+	_, ok = gostorage.OSSBucket(s3Storage)
+	require.False(t, ok)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_RegisterBackend(t *testing.T) {
+	cleanTestDir()
+	gostorage.Register("test-backend", func(config gostorage.StorageConfig, opts ...gostorage.Option) (gostorage.Storage, error) {
+		if config.Params["dir"] == "" {
+			return nil, errors.New("dir param is required")
+		}
+		return gostorage.NewLocalStorage(config.Params["dir"], "storage-test/public", "http://localhost:8000/files", nil, opts...), nil
+	})
+	require.Contains(t, gostorage.Drivers(), "test-backend")
+	require.Contains(t, gostorage.Drivers(), gostorage.DriverS3)
+	require.Panics(t, func() {
+		gostorage.Register(gostorage.DriverS3, func(gostorage.StorageConfig, ...gostorage.Option) (gostorage.Storage, error) { return nil, nil })
+	})
+
+	manager, err := gostorage.Config{
+		Default: "custom",
+		Storages: map[string]gostorage.StorageConfig{
+			"custom": {Driver: "test-backend", Params: map[string]string{"dir": "storage-test/custom"}},
+		},
+	}.NewManager()
+	require.NoError(t, err)
+	storage, err := manager.Default()
+	require.NoError(t, err)
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("custom"), gostorage.ObjectPrivate))
+	require.True(t, fileExists("storage-test/custom/a.txt"))
+
+	_, err = gostorage.StorageConfig{Driver: "test-backend"}.NewStorage()
+	require.EqualError(t, err, "dir param is required")
+
+	t.Setenv("GOSTORAGE_DRIVER", "test-backend")
+	t.Setenv("GOSTORAGE_PARAM_DIR", "storage-test/env")
+	storage, err = gostorage.FromEnv()
+	require.NoError(t, err)
+	require.NoError(t, storage.Put("b.txt", strings.NewReader("env"), gostorage.ObjectPrivate))
+	require.True(t, fileExists("storage-test/env/b.txt"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_SentinelErrors(t *testing.T) {
+	storage := getLocalStorage()
+	_, err := storage.Read("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = storage.Stat("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+	_, err = storage.GetMetadata("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+	_, err = storage.GetVisibility("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status int
+		var code string
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/denied.txt"):
+			status, code = http.StatusForbidden, "AccessDenied"
+		case strings.HasPrefix(r.URL.Path, "/bucket/"):
+			status, code = http.StatusNotFound, "NoSuchKey"
+		default:
+			status, code = http.StatusNotFound, "NoSuchBucket"
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		if r.Method != http.MethodHead {
+			fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+		}
+	}))
+	defer server.Close()
+
+	newS3 := func(bucket string) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, bucket)
+	}
+	s3Storage := newS3("bucket")
+
+	_, err = s3Storage.Read("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+	var aerr awserr.Error
+	require.True(t, errors.As(err, &aerr))
+	require.Equal(t, "NoSuchKey", aerr.Code())
+
+	// HEAD responses carry only the status
+	_, err = s3Storage.Stat("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	_, err = s3Storage.Read("denied.txt")
+	require.ErrorIs(t, err, gostorage.ErrPermissionDenied)
+	require.NotErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	_, err = newS3("other").Read("a.txt")
+	require.ErrorIs(t, err, gostorage.ErrBucketNotExist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Checksum(t *testing.T) {
+	storage := getLocalStorage()
+	content := "checksum me"
+	require.NoError(t, storage.Put("sum.txt", strings.NewReader(content), gostorage.ObjectPrivate))
+
+	md5Sum := md5.Sum([]byte(content))
+	sha256Sum := sha256.Sum256([]byte(content))
+	checksums := map[gostorage.ChecksumAlgo]string{
+		gostorage.ChecksumMD5:    hex.EncodeToString(md5Sum[:]),
+		gostorage.ChecksumSHA256: hex.EncodeToString(sha256Sum[:]),
+		gostorage.ChecksumCRC32C: fmt.Sprintf("%08x", crc32.Checksum([]byte(content), crc32.MakeTable(crc32.Castagnoli))),
+	}
+	for algo, expected := range checksums {
+		sum, err := storage.Checksum("sum.txt", algo)
+		require.NoError(t, err)
+		require.Equal(t, expected, sum, algo)
+	}
+
+	_, err := storage.Checksum("sum.txt", "sha1")
+	require.EqualError(t, err, "err unsupported checksum algorithm: sha1")
+	_, err = storage.Checksum("missing.txt", gostorage.ChecksumSHA256)
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	// single part ETag is used as md5 without downloading the object
+	var gets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+strings.ToUpper(checksums[gostorage.ChecksumMD5])+`"`)
+		if r.Method == http.MethodHead {
+			return
+		}
+		gets++
+		_, _ = io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	sum, err := s3Storage.Checksum("sum.txt", gostorage.ChecksumMD5)
+	require.NoError(t, err)
+	require.Equal(t, checksums[gostorage.ChecksumMD5], sum)
+	require.Equal(t, 0, gets)
+
+	sum, err = s3Storage.Checksum("sum.txt", gostorage.ChecksumSHA256)
+	require.NoError(t, err)
+	require.Equal(t, checksums[gostorage.ChecksumSHA256], sum)
+	require.Equal(t, 1, gets)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ReloadableStorage(t *testing.T) {
+	storage, err := gostorage.NewReloadableStorage(gostorage.StorageConfig{Driver: gostorage.DriverLocal, BaseDir: "storage-test/old"})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("old"), gostorage.ObjectPrivate))
+
+	// reader opened before reconfiguring keep reading from the old storage
+	reader, err := storage.Read("a.txt")
+	require.NoError(t, err)
+	require.NoError(t, storage.Reconfigure(gostorage.StorageConfig{Driver: gostorage.DriverLocal, BaseDir: "storage-test/new"}))
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "old", string(content))
+
+	require.NoError(t, storage.Put("b.txt", strings.NewReader("new"), gostorage.ObjectPrivate))
+	require.True(t, fileExists("storage-test/new/b.txt"))
+	baseDir, _, ok := gostorage.LocalBaseDir(storage)
+	require.True(t, ok)
+	require.Equal(t, "storage-test/new", baseDir)
+
+	require.EqualError(t, storage.Reconfigure(gostorage.StorageConfig{Driver: gostorage.DriverLocal}), "base_dir is required")
+	exist, err := storage.Exist("b.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	manager := gostorage.NewManager()
+	manager.Register("files", storage)
+	require.Error(t, manager.Reconfigure(gostorage.Config{Storages: map[string]gostorage.StorageConfig{
+		"files":  {Driver: gostorage.DriverLocal, BaseDir: "storage-test/rotated"},
+		"broken": {Driver: gostorage.DriverLocal},
+	}}))
+	baseDir, _, _ = gostorage.LocalBaseDir(storage)
+	require.Equal(t, "storage-test/new", baseDir)
+
+	require.NoError(t, manager.Reconfigure(gostorage.Config{Default: "files", Storages: map[string]gostorage.StorageConfig{
+		"files":  {Driver: gostorage.DriverLocal, BaseDir: "storage-test/rotated"},
+		"images": {Driver: gostorage.DriverLocal, BaseDir: "storage-test/images"},
+	}}))
+	registered, err := manager.Default()
+	require.NoError(t, err)
+	require.Same(t, storage, registered)
+	baseDir, _, _ = gostorage.LocalBaseDir(storage)
+	require.Equal(t, "storage-test/rotated", baseDir)
+	require.Equal(t, []string{"files", "images"}, manager.Names())
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ParallelForEachObject(t *testing.T) {
+	storage := getLocalStorage()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, storage.Put(fmt.Sprintf("batch/%02d.txt", i), strings.NewReader("x"), gostorage.ObjectPrivate))
+	}
+
+	var mu sync.Mutex
+	var visited []string
+	var running, maxRunning int
+	err := gostorage.ParallelForEachObject(context.Background(), storage, "batch/", 3, func(ctx context.Context, object gostorage.ObjectInfo) error {
+		mu.Lock()
+		visited = append(visited, object.ObjectPath)
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, visited, 20)
+	require.LessOrEqual(t, maxRunning, 3)
+
+	// the first failure cancel running calls and stop scheduling new ones
+	var calls int
+	failure := errors.New("failed")
+	err = gostorage.ParallelForEachObject(context.Background(), storage, "batch/", 2, func(ctx context.Context, object gostorage.ObjectInfo) error {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if object.ObjectPath == "batch/00.txt" {
+			return failure
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, failure)
+	require.Less(t, calls, 20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = gostorage.ParallelForEach(ctx, []string{"batch/00.txt", "batch/01.txt"}, 2, func(ctx context.Context, objectPath string) error {
+		return nil
+	})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ExistMany(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("docs/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate))
+	exists, err := storage.ExistMany("docs/a.txt", "docs/b.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"docs/a.txt": true, "docs/b.txt": false}, exists)
+
+	infos, err := gostorage.StatMany(storage, "docs/a.txt", "docs/b.txt")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	require.Equal(t, int64(1), infos["docs/a.txt"].Size)
+
+	// S3 list the common prefix of many paths instead of sending a HEAD request per path
+	var mu sync.Mutex
+	var heads, lists int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodHead {
+			heads++
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		lists++
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated>`)
+		for i := 0; i < 40; i += 2 {
+			fmt.Fprintf(w, `<Contents><Key>docs/%02d.txt</Key><Size>1</Size></Contents>`, i)
+		}
+		fmt.Fprint(w, `</ListBucketResult>`)
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	var objectPaths []string
+	for i := 0; i < 20; i++ {
+		objectPaths = append(objectPaths, fmt.Sprintf("/docs/%02d.txt", i))
+	}
+	exists, err = s3Storage.ExistMany(objectPaths...)
+	require.NoError(t, err)
+	require.Len(t, exists, 20)
+	require.True(t, exists["/docs/00.txt"])
+	require.False(t, exists["/docs/01.txt"])
+	require.Equal(t, 1, lists)
+	require.Equal(t, 0, heads)
+
+	// few paths are checked one by one
+	exists, err = s3Storage.ExistMany("docs/00.txt", "docs/01.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"docs/00.txt": false, "docs/01.txt": false}, exists)
+	require.Equal(t, 2, heads)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_StallTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait := func() {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		switch {
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/stalled.txt"):
+			w.Header().Set("Content-Length", "10")
+			_, _ = io.WriteString(w, "hello")
+			w.(http.Flusher).Flush()
+			wait()
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Length", "10")
+			for i := 0; i < 10; i++ {
+				_, _ = io.WriteString(w, "x")
+				w.(http.Flusher).Flush()
+				time.Sleep(20 * time.Millisecond)
+			}
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>up.txt</Key><UploadId>1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			_, _ = io.Copy(io.Discard, r.Body)
+			wait()
+		}
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithStallTimeout(150*time.Millisecond))
+
+	start := time.Now()
+	reader, err := storage.Read("stalled.txt")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.ErrorIs(t, err, gostorage.ErrStreamStalled)
+	require.Equal(t, "hello", string(content))
+	require.NoError(t, reader.Close())
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	// slow streams keep going as long as bytes arrive, time between caller reads doesn't count
+	reader, err = storage.Read("slow.txt")
+	require.NoError(t, err)
+	buffer := make([]byte, 1)
+	_, err = io.ReadFull(reader, buffer)
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond)
+	content, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("x", 9), string(content))
+	require.NoError(t, reader.Close())
+
+	start = time.Now()
+	err = storage.Put("up.txt", strings.NewReader("data"), gostorage.ObjectPrivate)
+	require.ErrorIs(t, err, gostorage.ErrStreamStalled)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func Test_AccessStats(t *testing.T) {
+	local := getLocalStorage()
+	var flushed []gostorage.AccessStat
+	stats := gostorage.NewAccessStats(gostorage.AccessStatsOptions{
+		MaxKeys:    2,
+		OnFlush:    func(snapshot []gostorage.AccessStat) { flushed = snapshot },
+		Storage:    local,
+		ObjectPath: "stats/access.json",
+	})
+	storage := gostorage.WithAccessStats(local, stats)
+	for _, objectPath := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader(objectPath), gostorage.ObjectPrivate))
+	}
+
+	readAll := func(objectPath string) {
+		reader, err := storage.Read(objectPath)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+	}
+	readAll("a.txt")
+	readAll("/a.txt")
+	readAll("b.txt")
+	_, err := storage.Read("missing.txt")
+	require.Error(t, err)
+
+	stat, ok := stats.Get("a.txt")
+	require.True(t, ok)
+	require.Equal(t, int64(2), stat.Reads)
+	require.WithinDuration(t, time.Now(), stat.LastAccess, time.Minute)
+
+	// c.txt evict the least recently read a.txt
+	reader, err := storage.ReadRange("c.txt", 0, 1)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	_, ok = stats.Get("a.txt")
+	require.False(t, ok)
+
+	require.NoError(t, storage.Move("c.txt", "e.txt"))
+	require.NoError(t, storage.Delete("b.txt"))
+	require.NoError(t, stats.Flush())
+	require.Equal(t, []gostorage.AccessStat{{ObjectPath: "e.txt", Reads: 1, LastAccess: flushed[0].LastAccess}}, flushed)
+	require.True(t, fileExists("storage-test/private/stats/access.json"))
+
+	unused, err := stats.UnusedObjects(local, "", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	var unusedPaths []string
+	for _, object := range unused {
+		unusedPaths = append(unusedPaths, object.ObjectPath)
+	}
+	require.Equal(t, []string{"a.txt", "d.txt", "stats/access.json"}, unusedPaths)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Residency(t *testing.T) {
+	rules := []gostorage.ResidencyRule{
+		{Prefix: "eu/", Regions: []string{"eu-*"}},
+		{Prefix: "us/", Regions: []string{"us-*"}},
+		{Prefix: "eu/onprem/", Backends: []string{"on-premise"}},
+	}
+	storage := gostorage.WithResidency(getLocalStorage(), gostorage.ResidencyOptions{Region: "eu-west-1", Backend: "aws", Rules: rules})
+
+	require.NoError(t, storage.Put("eu/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("other/b.txt", strings.NewReader("b"), gostorage.ObjectPrivate))
+	err := storage.Put("us/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate)
+	require.ErrorIs(t, err, gostorage.ErrResidencyViolation)
+	require.ErrorIs(t, storage.Put("/us/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate), gostorage.ErrResidencyViolation)
+	require.EqualError(t, err, "operation violates data residency rule: us/a.txt may only be stored in us-*, storage region is eu-west-1")
+	require.ErrorIs(t, storage.Put("eu/onprem/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate), gostorage.ErrResidencyViolation)
+	require.ErrorIs(t, storage.Copy("eu/a.txt", "us/a.txt"), gostorage.ErrResidencyViolation)
+	require.ErrorIs(t, storage.Move("other/b.txt", "us/b.txt"), gostorage.ErrResidencyViolation)
+	require.ErrorIs(t, storage.CopyPrefix("other/", "us/"), gostorage.ErrResidencyViolation)
+	_, err = storage.Writer("us/c.txt", gostorage.ObjectPrivate)
+	require.ErrorIs(t, err, gostorage.ErrResidencyViolation)
+	require.False(t, fileExists("storage-test/private/us/b.txt"))
+
+	region, ok := gostorage.StorageRegion(gostorage.NewAWSS3Storage("bucket", "eu-central-1", "AKID", "SECRET", ""))
+	require.True(t, ok)
+	require.Equal(t, "eu-central-1", region)
+	region, ok = gostorage.StorageRegion(gostorage.NewAlibabaOSSStorage("bucket", "https://oss-eu-central-1.aliyuncs.com", "AKID", "SECRET"))
+	require.True(t, ok)
+	require.Equal(t, "eu-central-1", region)
+
+	// region of local storage can't be detected
+	require.Panics(t, func() {
+		gostorage.WithResidency(getLocalStorage(), gostorage.ResidencyOptions{Rules: rules})
+	})
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Progress(t *testing.T) {
+	var mu sync.Mutex
+	var transferred, total []int64
+	record := func(n, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		transferred = append(transferred, n)
+		total = append(total, size)
+	}
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		transferred, total = nil, nil
+	}
+	last := func() (int64, int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		require.NotEmpty(t, transferred)
+		return transferred[len(transferred)-1], total[len(total)-1]
+	}
+
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil, gostorage.WithProgress(record))
+
+	// sizes of readers with Len are known upfront, streams report -1
+	content := strings.Repeat("x", 100*1024)
+	require.NoError(t, storage.Put("a.txt", strings.NewReader(content), gostorage.ObjectPrivate))
+	n, size := last()
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, int64(len(content)), size)
+
+	reset()
+	require.NoError(t, storage.Put("b.txt", io.MultiReader(strings.NewReader(content)), gostorage.ObjectPrivate))
+	n, size = last()
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, int64(-1), size)
+
+	reset()
+	reader, err := storage.Read("a.txt")
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	n, size = last()
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, int64(len(content)), size)
+
+	reset()
+	reader, err = storage.ReadRange("a.txt", 10, 20)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	n, size = last()
+	require.Equal(t, int64(20), n)
+	require.Equal(t, int64(20), size)
+
+	// S3 uploads report once per part, downloads use Content-Length
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Length", "5")
+			_, _ = io.WriteString(w, "hello")
+		case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>up.txt</Key><UploadId>1</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>up.txt</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithProgress(record))
+
+	reset()
+	require.NoError(t, s3Storage.Put("up.txt", strings.NewReader(content), gostorage.ObjectPrivate))
+	n, size = last()
+	require.Equal(t, int64(len(content)), n)
+	require.Equal(t, int64(len(content)), size)
+
+	reset()
+	reader, err = s3Storage.Read("hello.txt")
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	n, size = last()
+	require.Equal(t, int64(5), n)
+	require.Equal(t, int64(5), size)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_MultiDeleteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Query().Has("delete") {
+			fmt.Fprint(w, `<DeleteResult>
+				<Error><Key>b.txt</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>
+				<Error><Key>dir/c.txt</Key><Code>InternalError</Code><Message>We encountered an internal error.</Message></Error>
+			</DeleteResult>`)
+		}
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+
+	err := storage.Delete("a.txt", "/b.txt", "dir/c.txt")
+	var multiErr *gostorage.MultiDeleteError
+	require.ErrorAs(t, err, &multiErr)
+	require.ErrorIs(t, err, gostorage.ErrPermissionDenied)
+	require.NotErrorIs(t, err, gostorage.ErrObjectNotExist)
+	require.Equal(t, []string{"/b.txt", "dir/c.txt"}, multiErr.ObjectPaths())
+	require.Equal(t, "InternalError", multiErr.Failures[1].Code)
+	require.Equal(t, "err deleting 2 objects, first failure /b.txt: AccessDenied: Access Denied", err.Error())
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_EraseSubjectData(t *testing.T) {
+	cleanTestDir()
+	primary := gostorage.NewLocalStorage("storage-test/private/primary", "storage-test/public/primary", "http://localhost/public", nil)
+	backup := gostorage.NewLocalStorage("storage-test/private/backup", "storage-test/public/backup", "http://localhost/public", nil)
+	cache, err := gostorage.NewDiskCache(primary, gostorage.DiskCacheOptions{Dir: "storage-test/cache", MaxBytes: 1 << 20})
+	require.NoError(t, err)
+
+	for _, storage := range []gostorage.Storage{primary, backup} {
+		for _, objectPath := range []string{"users/42/avatar.png", "users/42/invoices/1.pdf", "users/420/avatar.png", "exports/42.csv", "exports/43.csv"} {
+			require.NoError(t, storage.Put(objectPath, strings.NewReader("data"), gostorage.ObjectPrivate))
+		}
+	}
+	reader, err := cache.Read("users/42/avatar.png")
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, reader)
+	require.NoError(t, reader.Close())
+	require.True(t, cache.Cached("users/42/avatar.png"))
+
+	manager := gostorage.NewManager()
+	manager.Register("primary", cache)
+	manager.Register("backup", backup)
+
+	secret := []byte("secret")
+	report, err := manager.EraseSubjectData(gostorage.ErasureRequest{
+		Subject:     "ticket-1",
+		Prefixes:    []string{"users/42/"},
+		ObjectPaths: []string{"/exports/42.csv"},
+	}, secret)
+	require.NoError(t, err)
+	require.Equal(t, "ticket-1", report.Subject)
+	require.Empty(t, report.Failures)
+	require.Len(t, report.Objects, 6)
+	require.Equal(t, gostorage.ErasedObject{Storage: "backup", ObjectPath: "exports/42.csv", Verified: true}, report.Objects[0])
+	require.Equal(t, "primary", report.Objects[3].Storage)
+	require.False(t, cache.Cached("users/42/avatar.png"))
+
+	for _, storage := range []gostorage.Storage{primary, backup} {
+		for objectPath, expected := range map[string]bool{"users/42/avatar.png": false, "users/42/invoices/1.pdf": false, "exports/42.csv": false, "users/420/avatar.png": true, "exports/43.csv": true} {
+			exist, err := storage.Exist(objectPath)
+			require.NoError(t, err)
+			require.Equal(t, expected, exist, objectPath)
+		}
+	}
+
+	// report is signed, any change is detected
+	require.NoError(t, gostorage.VerifyErasureReport(report, secret))
+	report.Objects = report.Objects[1:]
+	require.ErrorIs(t, gostorage.VerifyErasureReport(report, secret), gostorage.ErrErasureReportInvalid)
+
+	_, err = manager.EraseSubjectData(gostorage.ErasureRequest{Prefixes: []string{"/"}}, secret)
+	require.Error(t, err)
+
+	// trash is bypassed, copies trashed before and by the erasure are deleted for good
+	trashed := gostorage.NewLocalStorage("storage-test/private/trashed", "storage-test/public/trashed", "http://localhost/public", nil, gostorage.WithTrash(""))
+	for _, objectPath := range []string{"users/42/avatar.png", "users/42/old.png", "users/420/avatar.png"} {
+		require.NoError(t, trashed.Put(objectPath, strings.NewReader("data"), gostorage.ObjectPrivate))
+	}
+	require.NoError(t, trashed.Delete("users/42/old.png", "users/420/avatar.png"))
+	manager.Register("trashed", trashed)
+	report, err = manager.EraseSubjectData(gostorage.ErasureRequest{
+		Subject:  "ticket-2",
+		Prefixes: []string{"users/42/"},
+		Storages: []string{"trashed"},
+	}, secret)
+	require.NoError(t, err)
+	require.Len(t, report.Objects, 3) // the object and both trashed copies
+	for _, object := range report.Objects {
+		require.True(t, object.Verified, object.ObjectPath)
+	}
+	remaining := listObjectPaths(t, trashed, "")
+	require.Len(t, remaining, 1)
+	require.True(t, strings.HasPrefix(remaining[0], ".trash/"))
+	require.True(t, strings.HasSuffix(remaining[0], "/users/420/avatar.png"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_LegalHold(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil)
+	held, ok := storage.(gostorage.LegalHoldStorage)
+	require.True(t, ok)
+	require.True(t, storage.Capabilities().LegalHold)
+
+	require.NoError(t, storage.Put("records/a.txt", strings.NewReader("a"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("records/b.txt", strings.NewReader("b"), gostorage.ObjectPrivate))
+	require.NoError(t, held.SetLegalHold("records/a.txt", true))
+	require.ErrorIs(t, held.SetLegalHold("records/missing.txt", true), gostorage.ErrObjectNotExist)
+
+	hold, err := held.LegalHold("records/a.txt")
+	require.NoError(t, err)
+	require.True(t, hold)
+
+	// nothing is deleted when one of the objects is held
+	err = storage.Delete("records/b.txt", "records/a.txt")
+	var holdErr *gostorage.LegalHoldError
+	require.ErrorAs(t, err, &holdErr)
+	require.ErrorIs(t, err, gostorage.ErrLegalHold)
+	require.Equal(t, []string{"records/a.txt"}, holdErr.ObjectPaths)
+	require.True(t, fileExists("storage-test/private/records/b.txt"))
+
+	require.ErrorIs(t, storage.DeletePrefix("records/"), gostorage.ErrLegalHold)
+	require.ErrorIs(t, storage.Put("records/a.txt", strings.NewReader("x"), gostorage.ObjectPrivate), gostorage.ErrLegalHold)
+	require.ErrorIs(t, storage.Move("records/a.txt", "records/c.txt"), gostorage.ErrLegalHold)
+	require.ErrorIs(t, storage.Copy("records/b.txt", "records/a.txt"), gostorage.ErrLegalHold)
+
+	// force delete require the override option and a reason
+	err = held.ForceDelete("records/a.txt", gostorage.LegalHoldOverride{Actor: "dpo", Reason: "case closed"})
+	require.ErrorIs(t, err, gostorage.ErrPermissionDenied)
+
+	admin := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil, gostorage.WithLegalHoldOverride()).(gostorage.LegalHoldStorage)
+	require.Error(t, admin.ForceDelete("records/a.txt", gostorage.LegalHoldOverride{Actor: "dpo"}))
+	require.NoError(t, admin.ForceDelete("records/a.txt", gostorage.LegalHoldOverride{Actor: "dpo", Reason: "case closed"}))
+	require.False(t, fileExists("storage-test/private/records/a.txt"))
+	require.NoError(t, storage.DeletePrefix("records/"))
+
+	// S3 check holds before Delete when enabled
+	var deleted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Has("legal-hold"):
+			status := "OFF"
+			if strings.HasSuffix(r.URL.Path, "/held.txt") {
+				status = "ON"
+			}
+			fmt.Fprintf(w, `<LegalHold><Status>%s</Status></LegalHold>`, status)
+		case r.Method == http.MethodDelete:
+			deleted = true
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithLegalHolds())
+
+	require.ErrorIs(t, s3Storage.Delete("held.txt"), gostorage.ErrLegalHold)
+	require.False(t, deleted)
+	require.NoError(t, s3Storage.Delete("free.txt"))
+	require.True(t, deleted)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Touch(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil)
+
+	// missing objects are created empty
+	require.NoError(t, storage.Touch("markers/done"))
+	size, err := storage.Size("markers/done")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), size)
+
+	// existing objects keep their content and metadata
+	require.NoError(t, storage.PutWithOptions("a.txt", strings.NewReader("content"), gostorage.PutOptions{
+		Visibility:     gostorage.ObjectPublicRead,
+		ObjectMetadata: gostorage.ObjectMetadata{Metadata: map[string]string{"owner": "42"}},
+	}))
+	past := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	require.NoError(t, storage.(gostorage.LastModifiedStorage).SetLastModified("a.txt", past))
+	lastModified, err := storage.LastModified("a.txt")
+	require.NoError(t, err)
+	require.True(t, lastModified.Equal(past))
+
+	require.NoError(t, storage.Touch("a.txt"))
+	lastModified, err = storage.LastModified("a.txt")
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), lastModified, time.Minute)
+	reader, err := storage.Read("a.txt")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "content", string(content))
+	metadata, err := storage.GetMetadata("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, "42", metadata.Metadata["owner"])
+	visibility, err := storage.GetVisibility("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+
+	require.ErrorIs(t, storage.(gostorage.LastModifiedStorage).SetLastModified("missing.txt", past), gostorage.ErrObjectNotExist)
+
+	// S3 copy existing objects onto themselves with their metadata
+	var copyRequest *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodHead:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Amz-Meta-Owner", "42")
+		case http.MethodPut:
+			copyRequest = r
+			fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithoutACL())
+	require.NoError(t, s3Storage.Touch("a.txt"))
+	require.NotNil(t, copyRequest)
+	require.Equal(t, "/bucket/a.txt", copyRequest.URL.Path)
+	require.Equal(t, "bucket/a.txt", copyRequest.Header.Get("X-Amz-Copy-Source"))
+	require.Equal(t, "REPLACE", copyRequest.Header.Get("X-Amz-Metadata-Directive"))
+	require.Equal(t, "text/plain", copyRequest.Header.Get("Content-Type"))
+	require.Equal(t, "42", copyRequest.Header.Get("X-Amz-Meta-Owner"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ClientUploads(t *testing.T) {
+	var mu sync.Mutex
+	var completed, aborted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			uploadID := strings.TrimPrefix(r.URL.Path, "/bucket/")
+			fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, uploadID, uploadID)
+		case r.Method == http.MethodGet && query.Has("uploadId"):
+			fmt.Fprint(w, `<ListPartsResult><Part><PartNumber>1</PartNumber><ETag>"etag-1"</ETag><Size>5242880</Size></Part><Part><PartNumber>2</PartNumber><ETag>"etag-2"</ETag><Size>10</Size></Part></ListPartsResult>`)
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			completed = append(completed, query.Get("uploadId"))
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		case r.Method == http.MethodDelete && query.Has("uploadId"):
+			aborted = append(aborted, query.Get("uploadId"))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	var onComplete []gostorage.ClientUpload
+	uploads, err := gostorage.NewClientUploads(storage, gostorage.ClientUploadOptions{
+		Timeout:    time.Hour,
+		OnComplete: func(upload gostorage.ClientUpload) { onComplete = append(onComplete, upload) },
+	})
+	require.NoError(t, err)
+
+	upload, err := uploads.Start("/videos/a.mp4", 2, gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	require.Equal(t, "videos/a.mp4", upload.ObjectPath)
+	require.Len(t, upload.PartURLs, 2)
+	require.Contains(t, upload.PartURLs[1], "partNumber=2")
+	require.Contains(t, upload.PartURLs[1], "X-Amz-Signature=")
+
+	// callbacks are received through the handler, reported ETags are checked against the backend
+	callback := func(action string, body string) int {
+		recorder := httptest.NewRecorder()
+		uploads.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/uploads/"+action, strings.NewReader(body)))
+		return recorder.Code
+	}
+	require.Equal(t, http.StatusConflict, callback("part", `{"upload_id":"videos/a.mp4","part_number":1,"etag":"forged"}`))
+	require.Equal(t, http.StatusNoContent, callback("part", `{"upload_id":"videos/a.mp4","part_number":1,"etag":"\"etag-1\""}`))
+	require.Equal(t, http.StatusConflict, callback("complete", `{"upload_id":"videos/a.mp4"}`))
+	require.Empty(t, completed)
+
+	require.Equal(t, http.StatusNoContent, callback("part", `{"upload_id":"videos/a.mp4","part_number":2,"etag":"etag-2"}`))
+	require.Equal(t, []string{"videos/a.mp4"}, completed)
+	require.Len(t, onComplete, 1)
+	require.Len(t, onComplete[0].Parts, 2)
+	_, ok := uploads.Get("videos/a.mp4")
+	require.False(t, ok)
+	require.Equal(t, http.StatusNotFound, callback("part", `{"upload_id":"videos/a.mp4","part_number":2,"etag":"etag-2"}`))
+	require.Equal(t, http.StatusBadRequest, callback("abort", `{}`))
+
+	// abandoned uploads are aborted by Sweep once idle for the timeout
+	_, err = uploads.Start("videos/b.mp4", 3, gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	require.NoError(t, uploads.Sweep())
+	require.Empty(t, aborted)
+
+	expired, err := gostorage.NewClientUploads(storage, gostorage.ClientUploadOptions{Timeout: time.Nanosecond})
+	require.NoError(t, err)
+	_, err = expired.Start("videos/c.mp4", 3, gostorage.ObjectPrivate)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	require.NoError(t, expired.Sweep())
+	require.Equal(t, []string{"videos/c.mp4"}, aborted)
+
+	_, err = gostorage.NewClientUploads(gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil), gostorage.ClientUploadOptions{})
+	require.Error(t, err)
+
+	// wrappers would be bypassed by parts going straight to the bucket
+	_, err = gostorage.NewClientUploads(gostorage.WithRetentionPolicy(storage, nil), gostorage.ClientUploadOptions{})
+	require.EqualError(t, err, "err client multipart uploads bypass storage wrappers, pass the S3 or OSS storage itself")
+	_, err = gostorage.NewClientUploads(gostorage.WithResidency(storage, gostorage.ResidencyOptions{}), gostorage.ClientUploadOptions{})
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ConditionalReadWrite(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil)
+
+	require.NoError(t, storage.PutWithOptions("a.txt", strings.NewReader("v1"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfNoneMatch: "*"},
+	}))
+	info, err := storage.Stat("a.txt")
+	require.NoError(t, err)
+
+	// reads
+	reader, err := gostorage.ReadWithOptions(storage, "a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: `"` + info.ETag + `"`},
+	})
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "v1", string(content))
+
+	_, err = gostorage.ReadWithOptions(storage, "a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: "other"},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+	_, err = gostorage.ReadWithOptions(storage, "a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfNoneMatch: info.ETag},
+	})
+	require.ErrorIs(t, err, gostorage.ErrNotModified)
+	_, err = gostorage.ReadWithOptions(storage, "a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfModifiedSince: time.Now().Add(time.Hour)},
+	})
+	require.ErrorIs(t, err, gostorage.ErrNotModified)
+	_, err = gostorage.ReadWithOptions(storage, "a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfUnmodifiedSince: time.Now().Add(-time.Hour)},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+
+	// writes
+	err = storage.PutWithOptions("a.txt", strings.NewReader("v2"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfNoneMatch: "*"},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+	err = storage.PutWithOptions("a.txt", strings.NewReader("v2"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: "stale"},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+	require.NoError(t, storage.PutWithOptions("a.txt", strings.NewReader("v2"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: info.ETag},
+	}))
+	err = storage.PutWithOptions("missing.txt", strings.NewReader("v1"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: info.ETag},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+
+	// gateway pass conditional GET through
+	gateway := httptest.NewServer(gostorage.NewS3Gateway(storage, gostorage.S3GatewayOptions{Bucket: "files", Anonymous: true}))
+	defer gateway.Close()
+	resp, err := http.Get(gateway.URL + "/files/a.txt")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	req, err := http.NewRequest(http.MethodGet, gateway.URL+"/files/a.txt", nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	req, err = http.NewRequest(http.MethodPut, gateway.URL+"/files/a.txt", strings.NewReader("v3"))
+	require.NoError(t, err)
+	req.Header.Set("If-Match", `"stale"`)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+
+	// S3 evaluate read preconditions with GetObject and send ETag preconditions when completing puts
+	var completeIfMatch string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodGet && r.Header.Get("If-None-Match") == `"etag"`:
+			w.WriteHeader(http.StatusNotModified)
+		case r.Method == http.MethodGet && r.Header.Get("If-Match") != `"etag"`:
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>`)
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, "v1")
+		case r.Method == http.MethodHead:
+			w.Header().Set("ETag", `"etag"`)
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			completeIfMatch = r.Header.Get("If-Match")
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><ETag>"new"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithoutACL())
+	conditional := s3Storage.(gostorage.ConditionalReadStorage)
+	reader, err = conditional.ReadWithOptions("a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: `"etag"`},
+	})
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	_, err = conditional.ReadWithOptions("a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: `"stale"`},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+	_, err = conditional.ReadWithOptions("a.txt", gostorage.ReadOptions{
+		Preconditions: gostorage.Preconditions{IfNoneMatch: `"etag"`},
+	})
+	require.ErrorIs(t, err, gostorage.ErrNotModified)
+
+	require.NoError(t, s3Storage.PutWithOptions("a.txt", strings.NewReader("v2"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfMatch: "etag"},
+	}))
+	require.Equal(t, "etag", completeIfMatch)
+	err = s3Storage.PutWithOptions("a.txt", strings.NewReader("v2"), gostorage.PutOptions{
+		Preconditions: gostorage.Preconditions{IfNoneMatch: "*"},
+	})
+	require.ErrorIs(t, err, gostorage.ErrPreconditionFailed)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Sync(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("src/1.txt", strings.NewReader("one"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("src/dir/2.txt", strings.NewReader("two"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("dst/dir/2.txt", strings.NewReader("two"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("dst/stale.txt", strings.NewReader("stale"), gostorage.ObjectPrivate))
+
+	var events []gostorage.SyncEvent
+	options := gostorage.SyncOptions{
+		Delete: true,
+		Observer: func(event gostorage.SyncEvent) {
+			events = append(events, event)
+		},
+	}
+	result, err := gostorage.Sync(context.Background(), storage, "src/", storage, "dst/", options)
+	require.NoError(t, err)
+	require.Equal(t, gostorage.SyncResult{Scanned: 2, Copied: 1, Skipped: 1, Deleted: 1, Bytes: 3}, result)
+
+	byType := map[gostorage.SyncEventType][]gostorage.SyncEvent{}
+	for _, event := range events {
+		require.False(t, event.At.IsZero())
+		byType[event.Type] = append(byType[event.Type], event)
+	}
+	require.Len(t, byType[gostorage.SyncEventScanned], 2)
+	require.Equal(t, "dst/1.txt", byType[gostorage.SyncEventCopied][0].DstObjectPath)
+	require.NotEmpty(t, byType[gostorage.SyncEventCopied][0].Checksum)
+	require.Equal(t, "unchanged", byType[gostorage.SyncEventSkipped][0].Reason)
+	require.Equal(t, "dst/stale.txt", byType[gostorage.SyncEventDeleted][0].DstObjectPath)
+
+	exist, err := storage.Exist("dst/stale.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// a second sync has nothing to do
+	result, err = gostorage.Sync(context.Background(), storage, "src/", storage, "dst/", gostorage.SyncOptions{Delete: true})
+	require.NoError(t, err)
+	require.Equal(t, gostorage.SyncResult{Scanned: 2, Skipped: 2}, result)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_BandwidthLimiter(t *testing.T) {
+	_, err := gostorage.NewBandwidthLimiter(gostorage.BandwidthOptions{Windows: []string{"22:00"}})
+	require.Error(t, err)
+
+	// rate apply all day without windows
+	limiter, err := gostorage.NewBandwidthLimiter(gostorage.BandwidthOptions{WindowRate: 1000})
+	require.NoError(t, err)
+	startedAt := time.Now()
+	require.NoError(t, limiter.Wait(context.Background(), 300))
+	require.NoError(t, limiter.Wait(context.Background(), 300))
+	require.GreaterOrEqual(t, time.Since(startedAt), 250*time.Millisecond)
+
+	// transfers outside windows are paused until the next window
+	now := time.Now().UTC()
+	window := now.Add(2*time.Hour).Format("15:04") + "-" + now.Add(3*time.Hour).Format("15:04")
+	limiter, err = gostorage.NewBandwidthLimiter(gostorage.BandwidthOptions{Windows: []string{window}})
+	require.NoError(t, err)
+	require.False(t, limiter.InWindow(now))
+	require.True(t, limiter.InWindow(now.Add(150*time.Minute)))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.Wait(ctx, 1), context.DeadlineExceeded)
+
+	// scheduled jobs run with their limiter, which Sync use for its transfers
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("src/1.txt", strings.NewReader("one"), gostorage.ObjectPrivate))
+	scheduler := gostorage.NewScheduler(storage, "locks")
+	require.NoError(t, scheduler.AddJob(gostorage.ScheduledJob{
+		Name:      "sync",
+		Schedule:  "@daily",
+		Bandwidth: limiter,
+		Run: func(ctx context.Context) error {
+			require.Same(t, limiter, gostorage.BandwidthFromContext(ctx))
+			ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer cancel()
+			_, err := gostorage.Sync(ctx, storage, "src/", storage, "dst/", gostorage.SyncOptions{})
+			return err
+		},
+	}))
+	result, err := scheduler.RunNow(context.Background(), "sync")
+	require.NoError(t, err)
+	require.Error(t, result.Err)
+	require.Contains(t, result.Err.Error(), "1 objects failed")
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_MimeType(t *testing.T) {
+	storage := getLocalStorage()
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+
+	// content type come from extension, then sniffing, unless given
+	require.NoError(t, storage.Put("page", strings.NewReader("<html><body>hi</body></html>"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("style.css", strings.NewReader("body {}"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.PutWithOptions("data", strings.NewReader("{}"), gostorage.PutOptions{
+		ObjectMetadata: gostorage.ObjectMetadata{Headers: gostorage.ObjectHeaders{ContentType: "application/json"}},
+	}))
+	for objectPath, contentType := range map[string]string{
+		"page":      "text/html; charset=utf-8",
+		"style.css": "text/css; charset=utf-8",
+		"data":      "application/json",
+	} {
+		metadata, err := storage.GetMetadata(objectPath)
+		require.NoError(t, err)
+		require.Equal(t, contentType, metadata.Headers.ContentType, objectPath)
+	}
+	reader, err := storage.Read("page")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "<html><body>hi</body></html>", string(content))
+
+	// local storage sniff content
+	require.NoError(t, storage.Put("photo.jpg", strings.NewReader(png), gostorage.ObjectPrivate))
+	mimeType, err := storage.MimeType("photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "image/png", mimeType)
+	_, err = storage.MimeType("missing")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	// S3 return stored content type and send the detected one
+	var uploadContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Type", "image/png")
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			uploadContentType = r.Header.Get("Content-Type")
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>upload</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			require.Equal(t, png, string(body))
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>upload</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithoutACL())
+	mimeType, err = s3Storage.MimeType("photo")
+	require.NoError(t, err)
+	require.Equal(t, "image/png", mimeType)
+	require.NoError(t, s3Storage.Put("upload", strings.NewReader(png), gostorage.ObjectPrivate))
+	require.Equal(t, "image/png", uploadContentType)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_PutRules(t *testing.T) {
+	cleanTestDir()
+	rules := gostorage.WithPutRules(
+		gostorage.PutRule{Pattern: "*.pdf", Visibility: gostorage.ObjectPrivate, StorageClass: "STANDARD_IA"},
+		gostorage.PutRule{ContentType: "image/", Visibility: gostorage.ObjectPublicRead, CacheControl: "public, max-age=31536000"},
+	)
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil, rules)
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+
+	require.NoError(t, storage.Put("docs/a.pdf", strings.NewReader("%PDF-1.4"), gostorage.ObjectPublicRead))
+	visibility, err := storage.GetVisibility("docs/a.pdf")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPrivate, visibility)
+
+	// content type is sniffed before matching
+	require.NoError(t, storage.Put("avatars/42", strings.NewReader(png), gostorage.ObjectPrivate))
+	visibility, err = storage.GetVisibility("avatars/42")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPublicRead, visibility)
+	metadata, err := storage.GetMetadata("avatars/42")
+	require.NoError(t, err)
+	require.Equal(t, "public, max-age=31536000", metadata.Headers.CacheControl)
+
+	// other objects are left alone
+	require.NoError(t, storage.Put("notes.txt", strings.NewReader("notes"), gostorage.ObjectPrivate))
+	metadata, err = storage.GetMetadata("notes.txt")
+	require.NoError(t, err)
+	require.Empty(t, metadata.Headers.CacheControl)
+
+	// S3 set storage class of matching objects
+	var storageClass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			storageClass = r.Header.Get("X-Amz-Storage-Class")
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>a.pdf</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>a.pdf</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithoutACL(), rules)
+	require.NoError(t, s3Storage.Put("invoices/a.pdf", strings.NewReader("%PDF-1.4"), gostorage.ObjectPrivate))
+	require.Equal(t, "STANDARD_IA", storageClass)
+
+	// Clean up
+	cleanTestDir()
+}
+
+// interruptedStorage fail reads of ranges after failAfter bytes, recording requested offsets
+type interruptedStorage struct {
+	gostorage.Storage
+	failAfter int64
+	offsets   []int64
+}
+
+func (s *interruptedStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	s.offsets = append(s.offsets, offset)
+	reader, err := s.Storage.ReadRange(objectPath, offset, length)
+	if err != nil || s.failAfter <= 0 {
+		return reader, err
+	}
+	failing := io.MultiReader(io.LimitReader(reader, s.failAfter), iotest.ErrReader(errors.New("connection reset")))
+	s.failAfter = 0
+	return ioutil.NopCloser(failing), nil
+}
+
+func Test_DownloadUploadFile(t *testing.T) {
+	storage := getLocalStorage()
+	dir := t.TempDir()
+
+	srcPath := filepath.Join(dir, "report.csv")
+	require.NoError(t, ioutil.WriteFile(srcPath, []byte("id,total\n1,42\n"), 0644))
+	require.NoError(t, gostorage.UploadFile(storage, srcPath, "reports/report.csv", gostorage.ObjectPrivate))
+	metadata, err := storage.GetMetadata("reports/report.csv")
+	require.NoError(t, err)
+	require.Equal(t, "text/csv; charset=utf-8", metadata.Headers.ContentType)
+
+	// interrupted downloads leave a part file which is resumed
+	dstPath := filepath.Join(dir, "downloads", "nested", "report.csv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dstPath), 0755))
+	require.NoError(t, ioutil.WriteFile(dstPath+".stale.part", []byte("old"), 0644))
+	interrupted := &interruptedStorage{Storage: storage, failAfter: 5}
+	require.Error(t, gostorage.DownloadFile(interrupted, "reports/report.csv", dstPath))
+	_, err = os.Stat(dstPath)
+	require.True(t, os.IsNotExist(err))
+	parts, err := filepath.Glob(dstPath + ".*.part")
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+
+	require.NoError(t, gostorage.DownloadFile(interrupted, "reports/report.csv", dstPath))
+	require.Equal(t, []int64{0, 5}, interrupted.offsets)
+	content, err := ioutil.ReadFile(dstPath)
+	require.NoError(t, err)
+	require.Equal(t, "id,total\n1,42\n", string(content))
+	parts, err = filepath.Glob(dstPath + ".*.part")
+	require.NoError(t, err)
+	require.Empty(t, parts)
+
+	_, err = os.Stat(dstPath + ".stale.part")
+	require.True(t, os.IsNotExist(err))
+	require.ErrorIs(t, gostorage.DownloadFile(storage, "reports/missing.csv", dstPath), gostorage.ErrObjectNotExist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_Ping(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil)
+
+	// Ping don't create missing directories like Connect
+	require.ErrorIs(t, storage.Ping(context.Background()), gostorage.ErrObjectNotExist)
+	require.NoError(t, storage.Connect(context.Background()))
+	require.NoError(t, storage.Ping(context.Background()))
+
+	// S3 check the bucket
+	var status int32 = http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodHead, r.Method)
+		require.Equal(t, "/bucket", r.URL.Path)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, s3Storage.Ping(context.Background()))
+
+	checker := gostorage.NewHealthChecker(s3Storage, time.Hour, time.Second)
+	require.NoError(t, checker.Check(context.Background()))
+	require.False(t, checker.CheckedAt().IsZero())
+	recorder := httptest.NewRecorder()
+	checker.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	atomic.StoreInt32(&status, http.StatusForbidden)
+	require.ErrorIs(t, checker.Check(context.Background()), gostorage.ErrPermissionDenied)
+	require.ErrorIs(t, checker.LastError(), gostorage.ErrPermissionDenied)
+	recorder = httptest.NewRecorder()
+	checker.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_S3Encryption(t *testing.T) {
+	requests := map[string]http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			requests["create"] = r.Header.Clone()
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+			requests["copy"] = r.Header.Clone()
+			fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	newStorage := func(encryption gostorage.S3Encryption) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", gostorage.WithoutACL(), gostorage.WithS3Encryption(encryption))
+	}
+
+	// SSE-KMS with a bucket key on uploads and copies
+	storage := newStorage(gostorage.S3Encryption{Algorithm: gostorage.S3EncryptionKMS, KMSKeyID: "key-1", BucketKey: true})
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("content"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Copy("a.txt", "b.txt"))
+	for _, name := range []string{"create", "copy"} {
+		headers := requests[name]
+		require.Equal(t, "aws:kms", headers.Get("X-Amz-Server-Side-Encryption"), name)
+		require.Equal(t, "key-1", headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"), name)
+		require.Equal(t, "true", headers.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"), name)
+	}
+
+	// DSSE-KMS don't support bucket keys
+	storage = newStorage(gostorage.S3Encryption{Algorithm: gostorage.S3EncryptionDSSEKMS, BucketKey: true})
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("content"), gostorage.ObjectPrivate))
+	require.Equal(t, "aws:kms:dsse", requests["create"].Get("X-Amz-Server-Side-Encryption"))
+	require.Empty(t, requests["create"].Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	require.Empty(t, requests["create"].Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled"))
+}
+
+func Test_S3Endpoints(t *testing.T) {
+	var hits [2]int32
+	newServer := func(index int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits[index], 1)
+			w.Header().Set("Content-Length", "7")
+			w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		}))
+	}
+	first, second := newServer(0), newServer(1)
+	defer second.Close()
+
+	newStorage := func(options gostorage.S3EndpointOptions) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        first.URL,
+		}, "bucket", gostorage.WithoutACL(), gostorage.WithS3Endpoints([]string{first.URL, second.URL}, options))
+	}
+
+	// round robin spread requests across endpoints
+	storage := newStorage(gostorage.S3EndpointOptions{RoundRobin: true})
+	for i := 0; i < 4; i++ {
+		_, err := storage.Stat("a.txt")
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits[0]))
+	require.Equal(t, int32(2), atomic.LoadInt32(&hits[1]))
+
+	// a gateway going down fail over to the next one and stay skipped during the cooldown
+	first.Close()
+	var changes []string
+	storage = newStorage(gostorage.S3EndpointOptions{OnStateChange: func(endpoint string, healthy bool) {
+		changes = append(changes, fmt.Sprintf("%s %v", endpoint, healthy))
+	}})
+	for i := 0; i < 3; i++ {
+		info, err := storage.Stat("a.txt")
+		require.NoError(t, err)
+		require.Equal(t, int64(7), info.Size)
+	}
+	require.Equal(t, int32(5), atomic.LoadInt32(&hits[1]))
+	require.Equal(t, []string{first.URL + " false"}, changes)
+}
+
+func Test_Trash(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost/public", nil, gostorage.WithTrash(""))
+	trash, ok := storage.(gostorage.TrashStorage)
+	require.True(t, ok)
+
+	// Delete move objects to trash
+	require.NoError(t, storage.Put("docs/a.txt", strings.NewReader("first"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Delete("docs/a.txt", "docs/missing.txt"))
+	exist, err := storage.Exist("docs/a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	trashed := listObjectPaths(t, storage, ".trash/")
+	require.Len(t, trashed, 1)
+	require.True(t, strings.HasSuffix(trashed[0], "/docs/a.txt"))
+
+	// Restore bring back the latest trashed copy
+	require.NoError(t, storage.Put("docs/a.txt", strings.NewReader("second"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.DeletePrefix("docs/"))
+	require.Len(t, listObjectPaths(t, storage, ".trash/"), 2)
+	require.NoError(t, trash.Restore("docs/a.txt"))
+	content, err := storage.Read("docs/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(content)
+	content.Close()
+	require.NoError(t, err)
+	require.Equal(t, "second", string(data))
+	require.ErrorIs(t, trash.Restore("docs/missing.txt"), gostorage.ErrObjectNotExist)
+
+	// PurgeTrash keep recent objects and delete older ones for good
+	require.NoError(t, trash.PurgeTrash(time.Hour))
+	require.Len(t, listObjectPaths(t, storage, ".trash/"), 1)
+	require.NoError(t, trash.PurgeTrash(0))
+	require.Empty(t, listObjectPaths(t, storage, ".trash/"))
+
+	// Trash must be enabled
+	require.Error(t, getLocalStorage().(gostorage.TrashStorage).PurgeTrash(0))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func listObjectPaths(t *testing.T, storage gostorage.Storage, prefix string) []string {
+	iterator, err := storage.List(prefix)
+	require.NoError(t, err)
+	var objectPaths []string
+	for iterator.Next() {
+		objectPaths = append(objectPaths, iterator.Object().ObjectPath)
+	}
+	require.NoError(t, iterator.Err())
+	return objectPaths
+}
+
+func Test_ListLexicalOrder(t *testing.T) {
+	storage := getLocalStorage()
+	for _, objectPath := range []string{"a/b", "a.txt", "a-c.txt", "b"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader("content"), gostorage.ObjectPrivate))
+	}
+	require.Equal(t, []string{"a-c.txt", "a.txt", "a/b", "b"}, listObjectPaths(t, storage, ""))
+	require.Equal(t, []string{"a-c.txt", "a.txt", "a/b"}, listObjectPaths(t, storage, "a"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_InventoryJob(t *testing.T) {
+	storage := getLocalStorage()
+	for _, objectPath := range []string{"data/a.txt", "data/b.txt", "data/c/d.txt", "other.txt"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader("content"), gostorage.ObjectPrivate))
+	}
+
+	readInventory := func() []string {
+		reader, err := storage.Read("reports/inventory.json.gz")
+		require.NoError(t, err)
+		defer reader.Close()
+		gzipReader, err := gzip.NewReader(reader)
+		require.NoError(t, err)
+		decoder := json.NewDecoder(gzipReader)
+		var objectPaths []string
+		for decoder.More() {
+			var object gostorage.ObjectInfo
+			require.NoError(t, decoder.Decode(&object))
+			require.Equal(t, int64(7), object.Size)
+			objectPaths = append(objectPaths, object.ObjectPath)
+		}
+		return objectPaths
+	}
+
+	// the listing is written in the background then parts and checkpoint are removed
+	job := gostorage.StartInventoryJob(context.Background(), storage, "data/", "reports/inventory.json.gz")
+	require.NoError(t, job.Wait())
+	require.Equal(t, int64(3), job.Objects())
+	require.Equal(t, []string{"data/a.txt", "data/b.txt", "data/c/d.txt"}, readInventory())
+	require.Empty(t, listObjectPaths(t, storage, ".inventory/"))
+
+	// a checkpointed job resume after the written objects
+	var part bytes.Buffer
+	writer := gzip.NewWriter(&part)
+	require.NoError(t, json.NewEncoder(writer).Encode(gostorage.ObjectInfo{ObjectPath: "data/a.txt", Size: 7}))
+	require.NoError(t, writer.Close())
+	require.NoError(t, storage.Put(".inventory/reports/inventory.json.gz/part-000001.json.gz", &part, gostorage.ObjectPrivate))
+	checkpoint, err := json.Marshal(gostorage.InventoryCheckpoint{Prefix: "data/", DstObjectPath: "reports/inventory.json.gz", Parts: 1, Objects: 1, LastObjectPath: "data/a.txt"})
+	require.NoError(t, err)
+	require.NoError(t, storage.Put(".inventory/reports/inventory.json.gz/checkpoint.json", bytes.NewReader(checkpoint), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Delete("reports/inventory.json.gz"))
+
+	job = gostorage.StartInventoryJob(context.Background(), storage, "data/", "reports/inventory.json.gz")
+	require.NoError(t, job.Wait())
+	require.Equal(t, int64(3), job.Objects())
+	require.Equal(t, []string{"data/a.txt", "data/b.txt", "data/c/d.txt"}, readInventory())
+
+	// a canceled job stop
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	job = gostorage.StartInventoryJob(ctx, storage, "data/", "reports/canceled.json.gz")
+	<-job.Done()
+	require.ErrorIs(t, job.Wait(), context.Canceled)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_AuthenticatedReadAndBucketOwnerVisibility(t *testing.T) {
+	storage := getLocalStorage()
+
+	// local storage don't publish such objects but keep their visibility
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("content"), gostorage.ObjectAuthenticatedRead))
+	require.False(t, fileExists("storage-test/public/a.txt"))
+	visibility, err := storage.GetVisibility("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectAuthenticatedRead, visibility)
+	grants, err := storage.GetACL("a.txt")
+	require.NoError(t, err)
+	require.Contains(t, grants, gostorage.Grant{GranteeType: gostorage.GranteeGroup, GranteeURI: gostorage.GroupAuthenticatedUsers, Permission: gostorage.PermissionRead})
+
+	require.NoError(t, storage.SetVisibility("a.txt", gostorage.ObjectPublicRead))
+	require.NoError(t, storage.SetVisibility("a.txt", gostorage.ObjectBucketOwnerFullControl))
+	require.False(t, fileExists("storage-test/public/a.txt"))
+	visibility, err = storage.GetVisibility("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectBucketOwnerFullControl, visibility)
+
+	// S3 send canned ACLs and read them back from grants
+	var acl string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			acl = r.Header.Get("X-Amz-Acl")
+			return
+		}
+		fmt.Fprint(w, `<AccessControlPolicy><Owner><ID>owner</ID></Owner><AccessControlList>`+
+			`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>owner</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>`+
+			`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AuthenticatedUsers</URI></Grantee><Permission>READ</Permission></Grant>`+
+			`</AccessControlList></AccessControlPolicy>`)
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, s3Storage.SetVisibility("a.txt", gostorage.ObjectBucketOwnerFullControl))
+	require.Equal(t, "bucket-owner-full-control", acl)
+	visibility, err = s3Storage.GetVisibility("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectAuthenticatedRead, visibility)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_MigrateKeys(t *testing.T) {
+	storage := getLocalStorage()
+	for _, objectPath := range []string{"old/a.txt", "old/b.txt", "old/c.txt"} {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader("content of "+objectPath), gostorage.ObjectPrivate))
+	}
+
+	// failed mappings don't stop the migration and hold back the checkpoint
+	var events []gostorage.MigrateEvent
+	options := gostorage.MigrateOptions{
+		CheckpointPath:     "migrations/paths.checkpoint",
+		CheckpointInterval: 1,
+		Observer:           func(event gostorage.MigrateEvent) { events = append(events, event) },
+	}
+	mapping := "old/a.txt,new/a.txt\nold/missing.txt,new/missing.txt\nold/b.txt,new/b.txt\n"
+	result, err := gostorage.MigrateKeys(context.Background(), storage, strings.NewReader(mapping), options)
+	require.Error(t, err)
+	require.Equal(t, gostorage.MigrateResult{Migrated: 2, Errored: 1, Bytes: 40}, result)
+	require.Len(t, events, 3)
+	require.Equal(t, gostorage.MigrateEventErrored, events[1].Type)
+	require.Equal(t, 2, events[1].Line)
+	exist, err := storage.Exist("old/a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	content, err := storage.Read("new/a.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(content)
+	content.Close()
+	require.NoError(t, err)
+	require.Equal(t, "content of old/a.txt", string(data))
+
+	// started again the migration resume at the failed mapping, migrated ones are skipped
+	require.NoError(t, storage.Put("old/missing.txt", strings.NewReader("found"), gostorage.ObjectPrivate))
+	events = nil
+	mapping = `{"old": "old/a.txt", "new": "new/a.txt"}
+{"old": "old/missing.txt", "new": "new/missing.txt"}
+{"old": "old/b.txt", "new": "new/b.txt"}
+{"old": "old/c.txt", "new": "new/c.txt"}
+`
+	options.Format = gostorage.MappingJSONLines
+	result, err = gostorage.MigrateKeys(context.Background(), storage, strings.NewReader(mapping), options)
+	require.NoError(t, err)
+	require.Equal(t, gostorage.MigrateResult{Migrated: 2, Skipped: 1, Bytes: 25}, result)
+	require.Equal(t, 2, events[0].Line)
+	require.Equal(t, "already migrated", events[1].Reason)
+	exist, err = storage.Exist("migrations/paths.checkpoint")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// invalid mappings stop the migration
+	_, err = gostorage.MigrateKeys(context.Background(), storage, strings.NewReader("old/a.txt\n"), gostorage.MigrateOptions{})
+	require.Error(t, err)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_PutWithResult(t *testing.T) {
+	storage := getLocalStorage()
+
+	// local storage report sha256 of the content as ETag
+	result, err := gostorage.PutWithResult(storage, "a.txt", strings.NewReader("content"), gostorage.PutOptions{Visibility: gostorage.ObjectPrivate})
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("content"))
+	require.Equal(t, gostorage.PutResult{ETag: hex.EncodeToString(sum[:]), Size: 7}, result)
+
+	// wrappers are asked the ETag afterwards
+	result, err = gostorage.PutWithResult(struct{ gostorage.Storage }{storage}, "b.txt", iotest.OneByteReader(strings.NewReader("content")), gostorage.PutOptions{})
+	require.NoError(t, err)
+	require.Equal(t, gostorage.PutResult{ETag: hex.EncodeToString(sum[:]), Size: 7}, result)
+
+	// S3 report ETag and version of the completed upload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+		case r.Method == http.MethodPut:
+			w.Header().Set("ETag", `"part"`)
+		case r.Method == http.MethodPost:
+			w.Header().Set("X-Amz-Version-Id", "v1")
+			fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>bucket</Bucket><Key>a.txt</Key><ETag>"etag-1"</ETag></CompleteMultipartUploadResult>`)
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithoutACL())
+	result, err = gostorage.PutWithResult(s3Storage, "a.txt", strings.NewReader("content"), gostorage.PutOptions{})
+	require.NoError(t, err)
+	require.Equal(t, gostorage.PutResult{ETag: "etag-1", VersionID: "v1", Size: 7}, result)
+
+	// Clean up
+	cleanTestDir()
+}
+
+// laggingStorage never see objects, like an eventually consistent backend right after a write
+type laggingStorage struct {
+	gostorage.Storage
+}
+
+func (s laggingStorage) ReadRange(objectPath string, offset, length int64) (io.ReadCloser, error) {
+	return nil, gostorage.ErrObjectNotExist
+}
+
+func (s laggingStorage) Exist(objectPath string) (bool, error) {
+	return false, nil
+}
+
+func (s laggingStorage) Stat(objectPath string) (gostorage.ObjectInfo, error) {
+	return gostorage.ObjectInfo{}, gostorage.ErrObjectNotExist
+}
+
+func Test_ReadYourWrites(t *testing.T) {
+	backend := getLocalStorage()
+	storage := gostorage.WithReadYourWrites(laggingStorage{backend}, gostorage.ReadYourWritesOptions{Window: 100 * time.Millisecond})
+
+	// writes are read back during the window
+	require.NoError(t, storage.Put("a.txt", strings.NewReader("content"), gostorage.ObjectPrivate))
+	reader, err := storage.ReadRange("a.txt", 2, 3)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, "nte", string(data))
+	exist, err := storage.Exist("/a.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	info, err := storage.Stat("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), info.Size)
+
+	// moved and deleted objects are gone right away
+	require.NoError(t, storage.Move("a.txt", "b.txt"))
+	exist, err = storage.Exist("a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	reader, err = storage.Read("b.txt")
+	require.NoError(t, err)
+	reader.Close()
+	require.NoError(t, storage.Delete("b.txt"))
+	_, err = storage.Read("b.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	// after the window reads go to the backend
+	require.NoError(t, storage.Put("c.txt", strings.NewReader("content"), gostorage.ObjectPrivate))
+	time.Sleep(150 * time.Millisecond)
+	exist, err = storage.Exist("c.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = backend.Exist("c.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_DetectACLDrift(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("public/logo.png", strings.NewReader("logo"), gostorage.ObjectPublicRead))
+	require.NoError(t, storage.Put("public/banner.png", strings.NewReader("banner"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("invoices/1.pdf", strings.NewReader("invoice"), gostorage.ObjectPublicRead))
+	require.NoError(t, storage.Put("invoices/2.pdf", strings.NewReader("invoice"), gostorage.ObjectPrivate))
+	policy := gostorage.VisibilityByPrefix(map[string]gostorage.ObjectVisibility{"public/": gostorage.ObjectPublicRead})
+
+	// drifts are reported without changing anything
+	var observed []string
+	drifts, err := gostorage.DetectACLDrift(context.Background(), storage, "", policy, gostorage.ACLDriftOptions{
+		Observer: func(drift gostorage.ACLDrift) { observed = append(observed, drift.ObjectPath) },
+	})
+	require.NoError(t, err)
+	require.Len(t, drifts, 2)
+	require.Equal(t, "invoices/1.pdf", drifts[0].ObjectPath)
+	require.Equal(t, gostorage.ObjectPublicRead, drifts[0].Actual)
+	require.True(t, drifts[0].Public())
+	require.Equal(t, "public/banner.png", drifts[1].ObjectPath)
+	require.False(t, drifts[1].Public())
+	require.Equal(t, []string{"invoices/1.pdf", "public/banner.png"}, observed)
+
+	// remediation set the expected visibility
+	drifts, err = gostorage.DetectACLDrift(context.Background(), storage, "invoices/", policy, gostorage.ACLDriftOptions{Remediate: true})
+	require.NoError(t, err)
+	require.Len(t, drifts, 1)
+	require.True(t, drifts[0].Remediated)
+	visibility, err := storage.GetVisibility("invoices/1.pdf")
+	require.NoError(t, err)
+	require.Equal(t, gostorage.ObjectPrivate, visibility)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_S3CustomEndpoint(t *testing.T) {
+	var paths []string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Length", "7")
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	// path-style requests and links on the endpoint, the self-signed certificate is accepted
+	storage := gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "",
+		gostorage.WithS3Endpoint(server.URL, true), gostorage.WithS3InsecureSkipVerify())
+	info, err := storage.Stat("a.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), info.Size)
+	require.Equal(t, []string{"/bucket/a.txt"}, paths)
+	objectURL, err := storage.URL("a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/bucket/a.txt", objectURL)
+
+	// certificates are verified by default
+	storage = gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "",
+		gostorage.WithS3Endpoint(server.URL, true))
+	_, err = storage.Stat("a.txt")
+	require.Error(t, err)
+
+	// virtual hosted links put the bucket in the host
+	storage = gostorage.NewAWSS3Storage("bucket", "us-east-1", "AKID", "SECRET", "", gostorage.WithS3Endpoint("s3.example.com", false))
+	objectURL, err = storage.URL("a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://bucket.s3.example.com/a.txt", objectURL)
+}
+
+// corruptingStorage return altered content when reading corruptPath, failing verification
+type corruptingStorage struct {
+	gostorage.Storage
+	corruptPath string
+}
+
+func (s *corruptingStorage) Read(objectPath string) (io.ReadCloser, error) {
+	if objectPath == s.corruptPath {
+		return ioutil.NopCloser(strings.NewReader("corrupted")), nil
+	}
+	return s.Storage.Read(objectPath)
+}
+
+func Test_MoveBetweenStorages(t *testing.T) {
+	src := getLocalStorage()
+	archive := gostorage.NewLocalStorage("storage-test/archive", "storage-test/archive-public", "http://localhost:8000/archive", nil)
+	read := func(storage gostorage.Storage, objectPath string) string {
+		reader, err := storage.Read(objectPath)
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(reader)
+		require.NoError(t, err)
+		_ = reader.Close()
+		return string(content)
+	}
+
+	var phases []gostorage.TransferPhase
+	auditor := func(record gostorage.TransferAuditRecord) {
+		phases = append(phases, record.Phase)
+	}
+
+	// copy, verify then delete the source
+	require.NoError(t, src.Put("invoices/1.pdf", strings.NewReader("v1"), gostorage.ObjectPrivate))
+	require.NoError(t, gostorage.Move(src, "invoices/1.pdf", archive, "2026/1.pdf", auditor))
+	require.Equal(t, []gostorage.TransferPhase{gostorage.TransferPhaseCopy, gostorage.TransferPhaseVerify, gostorage.TransferPhaseDelete}, phases)
+	require.Equal(t, "v1", read(archive, "2026/1.pdf"))
+	exist, err := src.Exist("invoices/1.pdf")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// failed verification restore the existing destination and keep the source
+	phases = nil
+	require.NoError(t, src.Put("invoices/1.pdf", strings.NewReader("v2"), gostorage.ObjectPrivate))
+	dst := &corruptingStorage{Storage: archive, corruptPath: "2026/1.pdf"}
+	require.Error(t, gostorage.Move(src, "invoices/1.pdf", dst, "2026/1.pdf", auditor))
+	require.Equal(t, []gostorage.TransferPhase{gostorage.TransferPhaseCopy, gostorage.TransferPhaseVerify, gostorage.TransferPhaseRollback}, phases)
+	require.Equal(t, "v1", read(archive, "2026/1.pdf"))
+	require.Equal(t, "v2", read(src, "invoices/1.pdf"))
+	require.Equal(t, []string{"2026/1.pdf"}, listObjectPaths(t, archive, ""))
+
+	// failed verification remove a destination created by the move
+	dst.corruptPath = "2026/2.pdf"
+	require.Error(t, gostorage.Move(src, "invoices/1.pdf", dst, "2026/2.pdf", nil))
+	exist, err = archive.Exist("2026/2.pdf")
+	require.NoError(t, err)
+	require.False(t, exist)
+	require.Equal(t, "v2", read(src, "invoices/1.pdf"))
+
+	// moving an object onto itself keep it
+	phases = nil
+	require.NoError(t, gostorage.Move(src, "invoices/1.pdf", src, "/invoices/./1.pdf", auditor))
+	require.Empty(t, phases)
+	require.Equal(t, "v2", read(src, "invoices/1.pdf"))
+
+	// failing to delete the destination backup is reported to the auditor
+	var records []gostorage.TransferAuditRecord
+	failing := &backupDeleteFailingStorage{Storage: archive}
+	require.NoError(t, gostorage.Move(src, "invoices/1.pdf", failing, "2026/1.pdf", func(record gostorage.TransferAuditRecord) {
+		records = append(records, record)
+	}))
+	require.Len(t, records, 4)
+	require.Equal(t, gostorage.TransferPhaseCleanup, records[2].Phase)
+	require.Contains(t, records[2].Error, ".move-backup-")
+	require.Equal(t, gostorage.TransferPhaseDelete, records[3].Phase)
+	require.Equal(t, "v2", read(archive, "2026/1.pdf"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+// backupDeleteFailingStorage fail deleting backups taken by Move
+type backupDeleteFailingStorage struct {
+	gostorage.Storage
+}
+
+func (s *backupDeleteFailingStorage) Delete(objectPaths ...string) error {
+	for _, objectPath := range objectPaths {
+		if strings.Contains(objectPath, ".move-backup-") {
+			return errors.New("access denied")
+		}
+	}
+	return s.Storage.Delete(objectPaths...)
+}
+
+func Test_OSSInternalEndpoint(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// endpoints without a region of the instance are kept
+	storage := gostorage.NewAlibabaOSSStorage("bucket", server.URL, "AKID", "SECRET", gostorage.WithOSSInternalEndpoint())
+	exist, err := storage.Exist("a.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	// cross region endpoints are kept, the bucket would be unreachable through another region
+	region, ok := gostorage.StorageRegion(gostorage.NewAlibabaOSSStorage("bucket", "https://oss-eu-central-1.aliyuncs.com", "AKID", "SECRET", gostorage.WithOSSInternalEndpoint()))
+	require.True(t, ok)
+	require.Equal(t, "eu-central-1", region)
+	bucket, ok := gostorage.OSSBucket(gostorage.NewAlibabaOSSStorage("bucket", "https://oss-eu-central-1.aliyuncs.com", "AKID", "SECRET", gostorage.WithOSSInternalEndpoint()))
+	require.True(t, ok)
+	require.Equal(t, "https://oss-eu-central-1.aliyuncs.com", bucket.Client.Config.Endpoint)
+}
+
+func Test_Compose(t *testing.T) {
+	// local storage may append to one of the sources
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("logs/app.log", strings.NewReader("line 1\n"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Put("logs/chunk.log", strings.NewReader("line 2\n"), gostorage.ObjectPrivate))
+	require.NoError(t, storage.Compose("logs/app.log", gostorage.ObjectPrivate, "logs/app.log", "logs/chunk.log"))
+	reader, err := storage.Read("logs/app.log")
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	_ = reader.Close()
+	require.Equal(t, "line 1\nline 2\n", string(content))
+
+	// S3 copy sources above 5GB as ranged parts
+	var mu sync.Mutex
+	var copies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead && strings.HasSuffix(r.URL.Path, "/big.bin"):
+			w.Header().Set("Content-Length", "6442450944")
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", "10")
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			w.Write([]byte(`<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>all.bin</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut && query.Has("partNumber"):
+			copies = append(copies, query.Get("partNumber")+" "+r.Header.Get("X-Amz-Copy-Source")+" "+r.Header.Get("X-Amz-Copy-Source-Range"))
+			w.Write([]byte(`<CopyPartResult><ETag>"etag"</ETag></CopyPartResult>`))
+		case r.Method == http.MethodPost && query.Has("uploadId"):
+			w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+		}
+	}))
+	defer server.Close()
+
+	s3Storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket")
+	require.NoError(t, s3Storage.Compose("all.bin", gostorage.ObjectPrivate, "big.bin", "tail.bin"))
+	require.Equal(t, []string{
+		"1 bucket/big.bin bytes=0-3221225471",
+		"2 bucket/big.bin bytes=3221225472-6442450943",
+		"3 bucket/tail.bin ",
+	}, copies)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_CostEstimator(t *testing.T) {
+	estimator := gostorage.NewCostEstimator(gostorage.PricingTable{
+		RequestCost: map[gostorage.CostOperation]float64{
+			gostorage.CostOperationPut:  0.5,
+			gostorage.CostOperationRead: 0.25,
+		},
+		TransferOutPerGB: 1024 * 1024 * 1024, // one dollar per byte
+	}, 1)
+	storage := gostorage.WithCostEstimation(getLocalStorage(), estimator)
+
+	require.NoError(t, storage.Put(`naïve"q/a.txt`, strings.NewReader("hello"), gostorage.ObjectPrivate))
+	reader, err := storage.Read(`naïve"q/a.txt`)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.NoError(t, storage.Delete(`naïve"q/a.txt`))
+
+	require.Equal(t, []gostorage.CostEntry{
+		{Operation: gostorage.CostOperationDelete, Prefix: `naïve"q`},
+		{Operation: gostorage.CostOperationPut, Prefix: `naïve"q`, Requests: 1, BytesIn: 5, EstimatedCostUSD: 0.5},
+		{Operation: gostorage.CostOperationRead, Prefix: `naïve"q`, Requests: 1, BytesOut: 5, EstimatedCostUSD: 5.25},
+	}, estimator.Snapshot())
+
+	// labels are escaped as prometheus expect, non-ASCII is kept
+	rec := httptest.NewRecorder()
+	estimator.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	require.Contains(t, body, "# TYPE gostorage_estimated_cost_usd_total counter\n")
+	require.Contains(t, body, `gostorage_estimated_cost_usd_total{operation="read",prefix="naïve\"q"} 5.25`+"\n")
+	require.Contains(t, body, `gostorage_requests_total{operation="put",prefix="naïve\"q"} 1`+"\n")
+	require.Contains(t, body, `gostorage_transfer_out_bytes_total{operation="read",prefix="naïve\"q"} 5`+"\n")
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_OracleOCIStorage(t *testing.T) {
+	// appending driver options must not write into the caller's slice
+	opts := make([]gostorage.Option, 0, 4)
+	opts = append(opts, gostorage.WithoutURLExistenceCheck())
+	storage := gostorage.NewOracleOCIStorage(gostorage.OCIConfig{
+		Namespace:       "tenancy-ns",
+		Region:          "eu-frankfurt-1",
+		Bucket:          "bucket",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+	}, opts...)
+	require.Nil(t, opts[:2][1])
+	gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET"}, "bucket", opts...)
+	require.Nil(t, opts[:2][1])
+
+	// without API signing key TemporaryURL presign against the S3 compatible endpoint
+	signedURL, err := storage.TemporaryURL("docs/a.txt", time.Hour, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(signedURL, "https://tenancy-ns.compat.objectstorage.eu-frankfurt-1.oraclecloud.com/bucket/docs/a.txt?"), signedURL)
+	require.Contains(t, signedURL, "X-Amz-Expires=3600")
+
+	region, ok := gostorage.StorageRegion(storage)
+	require.True(t, ok)
+	require.Equal(t, "eu-frankfurt-1", region)
+	require.False(t, storage.Capabilities().Versioning)
+}
+
+func Test_PartitionedWriter(t *testing.T) {
+	at := time.Date(2024, time.March, 5, 7, 30, 0, 0, time.FixedZone("UTC+9", 9*60*60))
+	objectPath, err := gostorage.ExpandKeyTemplate("events/{yyyy}/{mm}/{dd}/{hh}/{name}-{unix}.json", at, "click")
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("events/2024/03/04/22/click-%d.json", at.Unix()), objectPath)
+
+	first, err := gostorage.ExpandKeyTemplate("{uuid}", at, "")
+	require.NoError(t, err)
+	second, err := gostorage.ExpandKeyTemplate("{uuid}", at, "")
+	require.NoError(t, err)
+	require.Len(t, first, 36)
+	require.Equal(t, "4", first[14:15])
+	require.NotEqual(t, first, second)
+
+	// Put route objects into the partition of current time
+	storage := getLocalStorage()
+	writer := gostorage.NewPartitionedWriter(storage, "logs/{yyyy}/{name}/{uuid}.log", gostorage.ObjectPrivate)
+	year := time.Now().UTC().Year()
+	objectPath, err = writer.Put("api", strings.NewReader("line"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(objectPath, fmt.Sprintf("logs/%d/api/", year)) || strings.HasPrefix(objectPath, fmt.Sprintf("logs/%d/api/", year+1)), objectPath)
+	require.Equal(t, []string{objectPath}, listObjectPaths(t, storage, "logs/"))
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_OperationTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithOperationTimeout(gostorage.OperationTimeouts{
+		Default:  100 * time.Millisecond,
+		Metadata: 50 * time.Millisecond,
+	}))
+
+	// hung requests fail once the operation timeout elapse
+	start := time.Now()
+	_, err := storage.Stat("a.txt")
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	// operations without own timeout use Default
+	start = time.Now()
+	_, err = storage.Read("a.txt")
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(5*time.Second))
+
+	// deadline of the caller context take precedence
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	require.Error(t, storage.Ping(ctx))
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(250*time.Millisecond))
+}
+
+type failingSeeker struct {
+	*bytes.Reader
+	failAt int64
+}
+
+func (s *failingSeeker) Read(p []byte) (int, error) {
+	offset, _ := s.Seek(0, io.SeekCurrent)
+	if offset+int64(len(p)) > s.failAt {
+		return 0, errors.New("connection reset")
+	}
+	return s.Reader.Read(p)
+}
+
+func Test_PutResumable(t *testing.T) {
+	fake := &multipartServer{parts: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// checkpoints shared through a storage let another instance resume the upload
+	checkpoints := gostorage.NewStorageCheckpointStore(getLocalStorage())
+	newStorage := func() gostorage.ResumableStorage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", gostorage.WithUploadCheckpointStore(checkpoints)).(gostorage.ResumableStorage)
+	}
+
+	partSize := 5120 * 1024
+	content := strings.Repeat("a", partSize) + "tail"
+	err := newStorage().PutResumable("piped.bin", &failingSeeker{Reader: bytes.NewReader([]byte(content)), failAt: int64(partSize)}, gostorage.ObjectPrivate)
+	require.EqualError(t, err, "connection reset")
+	require.False(t, fake.completed)
+	require.False(t, fake.aborted)
+	checkpoint, err := checkpoints.Load("piped.bin")
+	require.NoError(t, err)
+	require.Equal(t, "upload-1", checkpoint.UploadID)
+	require.Equal(t, int64(partSize), checkpoint.Offset)
+	require.Equal(t, []gostorage.CheckpointPart{{Number: 1, ETag: `"etag-1"`, Size: int64(partSize)}}, checkpoint.Parts)
+
+	// resumed upload only send the remaining part and remove the checkpoint
+	require.NoError(t, newStorage().PutResumable("piped.bin", bytes.NewReader([]byte(content)), gostorage.ObjectPrivate))
+	require.True(t, fake.completed)
+	require.Equal(t, 1, fake.initiated)
+	require.Equal(t, map[string]string{"1": content[:partSize], "2": "tail"}, fake.parts)
+	checkpoint, err = checkpoints.Load("piped.bin")
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_ReadRetry(t *testing.T) {
+	var mu sync.Mutex
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+
+		w.Header().Set("ETag", `"etag"`)
+		if r.Header.Get("Range") == "" {
+			// break the stream after 4 of 10 bytes
+			w.Header().Set("Content-Length", "10")
+			w.Write([]byte("0123"))
+			w.(http.Flusher).Flush()
+			return
+		}
+		require.Equal(t, `"etag"`, r.Header.Get("If-Match"))
+		w.Header().Set("Content-Length", "6")
+		w.Header().Set("Content-Range", "bytes 4-9/10")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("456789"))
+	}))
+	defer server.Close()
+
+	newStorage := func(opts ...gostorage.Option) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", opts...)
+	}
+
+	// broken stream is reconnected from the last offset
+	reader, err := newStorage(gostorage.WithReadRetry(1)).Read("a.txt")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "0123456789", string(data))
+	require.Equal(t, []string{"", "bytes=4-"}, ranges)
+
+	// without retry the error reach the caller
+	ranges = nil
+	reader, err = newStorage().Read("a.txt")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(reader)
+	require.Error(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, []string{""}, ranges)
+}
+
+func Test_AdaptivePartSize(t *testing.T) {
+	upload := func(opts ...gostorage.Option) []int {
+		fake := &multipartServer{parts: make(map[string]string)}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+
+		storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", opts...)
+		require.NoError(t, storage.Put("piped.bin", strings.NewReader(strings.Repeat("a", 25*1024*1024)), gostorage.ObjectPrivate))
+		require.True(t, fake.completed)
+
+		var sizes []int
+		for i := 1; i <= len(fake.parts); i++ {
+			sizes = append(sizes, len(fake.parts[fmt.Sprint(i)]))
+		}
+		return sizes
+	}
+
+	// parts stay at the minimum size by default
+	mb := 1024 * 1024
+	require.Equal(t, []int{5 * mb, 5 * mb, 5 * mb, 5 * mb, 5 * mb}, upload())
+
+	// fast parts double the size up to the cap
+	require.Equal(t, []int{5 * mb, 10 * mb, 10 * mb}, upload(gostorage.WithAdaptivePartSize(10*mb)))
+}
+
+func Test_UploadMemoryLimiter(t *testing.T) {
+	started := make(chan struct{}, 2)
+	proceed := make(chan struct{})
+	limiter := gostorage.NewUploadMemoryLimiter(5120 * 1024)
+
+	// storages sharing the limiter upload to servers holding every part until proceed
+	var fakes []*multipartServer
+	var storages []gostorage.Storage
+	for i := 0; i < 2; i++ {
+		fake := &multipartServer{parts: make(map[string]string)}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Has("partNumber") {
+				started <- struct{}{}
+				<-proceed
+			}
+			fake.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		fakes = append(fakes, fake)
+		storages = append(storages, gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", gostorage.WithUploadMemoryLimiter(limiter)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(storages))
+	for i, storage := range storages {
+		wg.Add(1)
+		go func(i int, storage gostorage.Storage) {
+			defer wg.Done()
+			errs[i] = storage.Put("piped.bin", strings.NewReader("hello"), gostorage.ObjectPrivate)
+		}(i, storage)
+	}
+
+	// the second upload wait for the part buffer of the first one
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	require.Len(t, started, 0)
+	require.Equal(t, int64(5120*1024), limiter.InFlight())
+
+	close(proceed)
+	wg.Wait()
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Equal(t, int64(0), limiter.InFlight())
+	for _, fake := range fakes {
+		require.True(t, fake.completed)
+		require.Equal(t, map[string]string{"1": "hello"}, fake.parts)
+	}
+}
+
+func Test_DirectoryMarkers(t *testing.T) {
+	var mu sync.Mutex
+	var created []string
+	objects := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		query := r.URL.Query()
+		switch {
+		case r.Method == http.MethodHead && objects[key]:
+			w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && query.Has("uploads"):
+			fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>bucket</Bucket><Key>%s</Key><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`, key)
+		case r.Method == http.MethodPut && query.Has("partNumber"):
+			w.Header().Set("ETag", `"etag-1"`)
+		case r.Method == http.MethodPost || r.Method == http.MethodPut:
+			objects[key] = true
+			created = append(created, key)
+			if r.Method == http.MethodPost {
+				w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"etag"</ETag></CompleteMultipartUploadResult>`))
+			}
+		}
+	}))
+	defer server.Close()
+
+	newStorage := func(opts ...gostorage.Option) gostorage.Storage {
+		return gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", opts...)
+	}
+
+	// Put create markers of missing parent directories, deepest first
+	storage := newStorage(gostorage.WithDirectoryMarkers())
+	require.NoError(t, storage.Put("/warehouse/events/part-0.parquet", strings.NewReader("data"), gostorage.ObjectPrivate))
+	require.Equal(t, []string{"warehouse/events/part-0.parquet", "warehouse/events/", "warehouse/"}, created)
+
+	// existing marker stop the walk up
+	created = nil
+	require.NoError(t, storage.Put("warehouse/events/part-1.parquet", strings.NewReader("data"), gostorage.ObjectPrivate))
+	require.Equal(t, []string{"warehouse/events/part-1.parquet"}, created)
+
+	// Exist honor markers only in directory marker mode
+	exist, err := storage.Exist("warehouse/events")
+	require.NoError(t, err)
+	require.True(t, exist)
+	exist, err = storage.Exist("warehouse/missing")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = newStorage().Exist("warehouse/events")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	created = nil
+	require.NoError(t, newStorage().Put("lake/a.txt", strings.NewReader("data"), gostorage.ObjectPrivate))
+	require.Equal(t, []string{"lake/a.txt"}, created)
+}
+
+// hookReader call hook before the first Read, e.g. to observe a storage in the middle of an upload
+type hookReader struct {
+	io.Reader
+	hook func()
+	once sync.Once
+}
+
+func (r *hookReader) Read(p []byte) (int, error) {
+	r.once.Do(r.hook)
+	return r.Reader.Read(p)
+}
+
+func Test_PublishAtomic(t *testing.T) {
+	storage := getLocalStorage()
+	readTree := func() map[string]string {
+		pointer, err := gostorage.CurrentPublishedVersion(storage, "site")
+		require.NoError(t, err)
+		tree := map[string]string{}
+		for _, filePath := range pointer.Files {
+			reader, err := storage.Read(pointer.ObjectPath("site", filePath))
+			require.NoError(t, err)
+			data, err := ioutil.ReadAll(reader)
+			reader.Close()
+			require.NoError(t, err)
+			tree[filePath] = string(data)
+		}
+		return tree
+	}
+
+	first, err := gostorage.PublishAtomic(storage, "site", []gostorage.PublishFile{
+		{Path: "index.html", Source: strings.NewReader("v1"), Visibility: gostorage.ObjectPublicRead},
+		{Path: "/assets/app.js", Source: strings.NewReader("v1"), Visibility: gostorage.ObjectPublicRead},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"index.html", "assets/app.js"}, first.Files)
+
+	// readers see the previous tree while the next one is uploaded, and the new tree once published
+	var during map[string]string
+	_, err = gostorage.PublishAtomic(storage, "site", []gostorage.PublishFile{
+		{Path: "index.html", Source: strings.NewReader("v2"), Visibility: gostorage.ObjectPublicRead},
+		{Path: "assets/app.js", Source: &hookReader{Reader: strings.NewReader("v2"), hook: func() { during = readTree() }}, Visibility: gostorage.ObjectPublicRead},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"index.html": "v1", "assets/app.js": "v1"}, during)
+	require.Equal(t, map[string]string{"index.html": "v2", "assets/app.js": "v2"}, readTree())
+
+	// failed publish keep the current tree
+	_, err = gostorage.PublishAtomic(storage, "site", []gostorage.PublishFile{
+		{Path: "index.html", Source: strings.NewReader("v3"), Visibility: gostorage.ObjectPublicRead},
+		{Path: "assets/app.js", Source: iotest.ErrReader(errors.New("disk failed")), Visibility: gostorage.ObjectPublicRead},
+	})
+	require.Error(t, err)
+	require.Equal(t, map[string]string{"index.html": "v2", "assets/app.js": "v2"}, readTree())
+
+	// paths escaping the version are rejected before anything is uploaded
+	uploaded := listObjectPaths(t, storage, "site/")
+	for _, filePath := range []string{"../CURRENT", "assets/../../CURRENT", "a/../b.txt", ""} {
+		_, err = gostorage.PublishAtomic(storage, "site", []gostorage.PublishFile{
+			{Path: "index.html", Source: strings.NewReader("evil"), Visibility: gostorage.ObjectPublicRead},
+			{Path: filePath, Source: strings.NewReader("evil"), Visibility: gostorage.ObjectPublicRead},
+		})
+		require.ErrorIs(t, err, gostorage.ErrInvalidObjectPath, filePath)
+	}
+	require.Equal(t, uploaded, listObjectPaths(t, storage, "site/"))
+
+	// rolling back flip the pointer to an older version
+	require.NoError(t, gostorage.SetPublishedVersion(storage, "site", first))
+	require.Equal(t, map[string]string{"index.html": "v1", "assets/app.js": "v1"}, readTree())
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_PutVerification(t *testing.T) {
+	partSum := md5.Sum([]byte("hello"))
+	uploadSum := md5.Sum(partSum[:])
+	multipartETag := fmt.Sprintf(`"%x-1"`, uploadSum)
+
+	newStorage := func(heads []string) (gostorage.Storage, *int, func()) {
+		fake := &multipartServer{parts: make(map[string]string)}
+		var count int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodHead {
+				fake.ServeHTTP(w, r)
+				return
+			}
+			etag := heads[min(count, len(heads)-1)]
+			count++
+			if etag == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", "5")
+			w.Header().Set("ETag", etag)
+		}))
+		storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+			Endpoint:        server.URL,
+		}, "bucket", gostorage.WithPutVerification(3, time.Millisecond))
+		return storage, &count, server.Close
+	}
+
+	// eventually consistent endpoint is polled until the object show up
+	storage, heads, closeServer := newStorage([]string{"", multipartETag})
+	require.NoError(t, storage.Put("piped.bin", strings.NewReader("hello"), gostorage.ObjectPrivate))
+	require.Equal(t, 2, *heads)
+	closeServer()
+
+	// mismatching checksum fail after every attempt
+	storage, heads, closeServer = newStorage([]string{`"5d41402abc4b2a76b9719d911017c592-1"`})
+	err := storage.Put("piped.bin", strings.NewReader("hello"), gostorage.ObjectPrivate)
+	require.ErrorIs(t, err, gostorage.ErrPutVerification)
+	require.Contains(t, err.Error(), "piped.bin")
+	require.Equal(t, 3, *heads)
+	closeServer()
+}
+
+func Test_S3Preflight(t *testing.T) {
+	bucketRegion := "us-east-2"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case r.URL.Path == "/bucket" && r.Method == http.MethodHead:
+			w.Header().Set("X-Amz-Bucket-Region", bucketRegion)
+		case r.Method == http.MethodPut && query.Has("acl"):
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		case r.Method == http.MethodGet && query.Has("acl"):
+			w.Write([]byte(`<AccessControlPolicy></AccessControlPolicy>`))
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			w.Write([]byte("preflight"))
+		case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+			w.Write([]byte(`<CopyObjectResult></CopyObjectResult>`))
+		case r.Method == http.MethodPost && query.Has("delete"):
+			w.Write([]byte(`<DeleteResult></DeleteResult>`))
+		}
+	}))
+	defer server.Close()
+
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+		Region:          "eu-west-1",
+	}, "bucket", gostorage.WithPreflight())
+
+	// bucket in another region stop the checks
+	report, err := storage.(gostorage.Validator).Validate(context.Background())
+	require.NoError(t, err)
+	require.True(t, report.BucketExists)
+	require.Equal(t, "us-east-2", report.BucketRegion)
+	require.Empty(t, report.Checks)
+	require.EqualError(t, report.Err(), "err storage preflight failed: bucket bucket is in region us-east-2 but storage is configured with eu-west-1")
+
+	// every permission is checked, denied ones come with a hint
+	bucketRegion = "eu-west-1"
+	report, err = storage.(gostorage.Validator).Validate(context.Background())
+	require.NoError(t, err)
+	require.True(t, report.BucketAccessible)
+	require.Len(t, report.Checks, 7)
+	var failed []gostorage.PreflightCheck
+	for _, check := range report.Checks {
+		if !check.OK {
+			failed = append(failed, check)
+		}
+	}
+	require.Len(t, failed, 1)
+	require.Equal(t, "s3:PutObjectAcl", failed[0].Permission)
+	require.Equal(t, "access denied, grant s3:PutObjectAcl on the bucket to the configured credentials", failed[0].Hint)
+	require.False(t, report.OK())
+
+	// Connect fail with the summary
+	err = storage.Connect(context.Background())
+	require.EqualError(t, err, "err storage preflight failed: s3:PutObjectAcl (needed by SetVisibility): access denied, grant s3:PutObjectAcl on the bucket to the configured credentials")
+}
+
+// redirectTransport send every request to a test server, keeping the original Host
+type redirectTransport struct {
+	target string
+	next   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	redirected := r.Clone(r.Context())
+	redirected.Host = r.URL.Host
+	redirected.URL.Scheme = "http"
+	redirected.URL.Host = t.target
+	return t.next.RoundTrip(redirected)
+}
+
+func Test_S3Express(t *testing.T) {
+	require.Panics(t, func() {
+		gostorage.NewAWSS3Storage("data", "us-east-1", "AKID", "SECRET", "", gostorage.WithS3Express())
+	})
+
+	var mu sync.Mutex
+	var sessions int
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Query().Has("session") {
+			sessions++
+			require.Contains(t, r.Header.Get("Authorization"), "Credential=AKID/")
+			require.Contains(t, r.Header.Get("Authorization"), "/us-east-1/s3express/aws4_request")
+			fmt.Fprintf(w, `<CreateSessionResult><Credentials><AccessKeyId>SESSIONID</AccessKeyId><SecretAccessKey>SESSIONSECRET</SecretAccessKey><SessionToken>session-token</SessionToken><Expiration>%s</Expiration></Credentials></CreateSessionResult>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			return
+		}
+		requests = append(requests, r)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+	}))
+	defer server.Close()
+
+	// zonal endpoint host is redirected to the test server
+	transport := http.DefaultTransport
+	http.DefaultTransport = redirectTransport{target: server.Listener.Addr().String(), next: transport}
+	defer func() { http.DefaultTransport = transport }()
+
+	storage := gostorage.NewAWSS3Storage("data--use1-az4--x-s3", "us-east-1", "AKID", "SECRET", "", gostorage.WithS3Express())
+	for i := 0; i < 2; i++ {
+		exist, err := storage.Exist("docs/a.txt")
+		require.NoError(t, err)
+		require.True(t, exist)
+	}
+
+	// one session is created and its credentials sign every request
+	require.Equal(t, 1, sessions)
+	require.Len(t, requests, 2)
+	for _, r := range requests {
+		require.Equal(t, "data--use1-az4--x-s3.s3express-use1-az4.us-east-1.amazonaws.com", r.Host)
+		require.Equal(t, "session-token", r.Header.Get("X-Amz-S3session-Token"))
+		require.Contains(t, r.Header.Get("Authorization"), "Credential=SESSIONID/")
+		require.Contains(t, r.Header.Get("Authorization"), "/us-east-1/s3express/aws4_request")
+	}
+}
+
+func Test_HuaweiOBSStorage(t *testing.T) {
+	storage := gostorage.NewHuaweiOBSStorage("obs.ap-southeast-3.myhuaweicloud.com", "AKID", "SECRET", "bucket")
+	url, err := storage.URL("/docs/a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://bucket.obs.ap-southeast-3.myhuaweicloud.com/docs/a.txt", url)
+
+	signedURL, err := storage.TemporaryURL("docs/a.txt", time.Hour, nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(signedURL, "https://bucket.obs.ap-southeast-3.myhuaweicloud.com/docs/a.txt?"), signedURL)
+	require.Contains(t, signedURL, "%2Fap-southeast-3%2Fs3%2Faws4_request")
+
+	// region is taken from the endpoint, custom endpoints use the default region
+	region, ok := gostorage.StorageRegion(storage)
+	require.True(t, ok)
+	require.Equal(t, "ap-southeast-3", region)
+	region, _ = gostorage.StorageRegion(gostorage.NewHuaweiOBSStorage("http://obs.internal:9000/path", "AKID", "SECRET", "bucket"))
+	require.Equal(t, "cn-north-4", region)
+	require.Panics(t, func() {
+		gostorage.NewHuaweiOBSStorage("", "AKID", "SECRET", "bucket")
+	})
+
+	// OBS_ variables select the driver
+	os.Setenv("OBS_ENDPOINT", "obs.af-south-1.myhuaweicloud.com")
+	os.Setenv("OBS_BUCKET", "assets")
+	defer func() {
+		os.Unsetenv("OBS_ENDPOINT")
+		os.Unsetenv("OBS_BUCKET")
+	}()
+	storage, err = gostorage.FromEnv()
+	require.NoError(t, err)
+	url, err = storage.URL("a.txt", nil)
+	require.NoError(t, err)
+	require.Equal(t, "https://assets.obs.af-south-1.myhuaweicloud.com/a.txt", url)
+}
+
+func Test_LocalCapabilities(t *testing.T) {
+	storage := getLocalStorage()
+	capabilities := storage.Capabilities()
+	require.True(t, capabilities.LegalHold)
+	require.True(t, capabilities.ConditionalWrite)
+	require.False(t, capabilities.PresignedUpload)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_TemporaryURLs(t *testing.T) {
+	cleanTestDir()
+	storage := gostorage.NewLocalStorage("storage-test/private", "storage-test/public", "http://localhost:8000/files",
+		func(absoluteFilePath string, objectPath string, expireIn time.Duration) (string, error) {
+			if objectPath == "locked.txt" {
+				return "", errors.New("err signing locked object")
+			}
+			return fmt.Sprintf("http://localhost:8000/signed/%s?expires=%d", objectPath, int(expireIn.Seconds())), nil
+		})
+
+	objectPaths := []string{"c.txt", "a.txt", "docs/b.txt", "locked.txt"}
+	for _, objectPath := range objectPaths {
+		require.NoError(t, storage.Put(objectPath, strings.NewReader(objectPath), gostorage.ObjectPrivate))
+	}
+
+	// every path get its own URL, same as signing them one by one
+	signedURLs, err := storage.TemporaryURLs(objectPaths[:3], time.Hour, nil)
+	require.NoError(t, err)
+	require.Len(t, signedURLs, 3)
+	for _, objectPath := range objectPaths[:3] {
+		signedURL, err := storage.TemporaryURL(objectPath, time.Hour, nil)
+		require.NoError(t, err)
+		require.Equal(t, signedURL, signedURLs[objectPath])
+	}
+
+	// a single failing path fail the whole batch
+	signedURLs, err = storage.TemporaryURLs(objectPaths, time.Hour, nil)
+	require.EqualError(t, err, "err signing locked object")
+	require.Nil(t, signedURLs)
+
+	signedURLs, err = storage.TemporaryURLs(nil, time.Hour, nil)
+	require.NoError(t, err)
+	require.Empty(t, signedURLs)
+
+	// Clean up
+	cleanTestDir()
+}
+
+func Test_GetACL(t *testing.T) {
+	storage := getLocalStorage()
+	require.NoError(t, storage.Put("public.txt", strings.NewReader("public"), gostorage.ObjectPublicRead))
+	require.NoError(t, storage.Put("private.txt", strings.NewReader("private"), gostorage.ObjectPrivate))
+
+	owner := gostorage.Grant{GranteeType: gostorage.GranteeCanonicalUser, Permission: gostorage.PermissionFullControl}
+	allUsersRead := gostorage.Grant{GranteeType: gostorage.GranteeGroup, GranteeURI: gostorage.GroupAllUsers, Permission: gostorage.PermissionRead}
+
+	grants, err := storage.GetACL("public.txt")
+	require.NoError(t, err)
+	require.Equal(t, []gostorage.Grant{owner, allUsersRead}, grants)
+
+	grants, err = storage.GetACL("private.txt")
+	require.NoError(t, err)
+	require.Equal(t, []gostorage.Grant{owner}, grants)
+
+	// grants follow visibility changes
+	require.NoError(t, storage.SetVisibility("public.txt", gostorage.ObjectPrivate))
+	grants, err = storage.GetACL("public.txt")
+	require.NoError(t, err)
+	require.Equal(t, []gostorage.Grant{owner}, grants)
+
+	_, err = storage.GetACL("missing.txt")
+	require.ErrorIs(t, err, gostorage.ErrObjectNotExist)
+
+	// Clean up
+	cleanTestDir()
+}
+
+type bufferLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *bufferLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func Test_DebugTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-amz-request-id", "REQ123")
+		if r.URL.Query().Get("list-type") != "" {
+			fmt.Fprint(w, `<ListBucketResult><Name>bucket</Name><IsTruncated>false</IsTruncated></ListBucketResult>`)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+
+	logger := &bufferLogger{}
+	storage := gostorage.NewS3CompatibleStorage("storj", gostorage.S3Credentials{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		Endpoint:        server.URL,
+	}, "bucket", gostorage.WithDebug(), gostorage.WithLogger(logger))
+
+	reader, err := storage.Read("docs/a.txt")
+	require.NoError(t, err)
+	reader.Close()
+	_, err = storage.Exist("docs/missing.txt")
+	require.NoError(t, err)
+	iterator, err := storage.List("docs/")
+	require.NoError(t, err)
+	for iterator.Next() {
+	}
+	require.NoError(t, iterator.Err())
+
+	require.Len(t, logger.lines, 3)
+	require.Contains(t, logger.lines[0], "[S3] GET /bucket/docs/a.txt status=200")
+	require.Contains(t, logger.lines[0], "request_id=REQ123")
+	require.Contains(t, logger.lines[1], "[S3] HEAD /bucket/docs/missing.txt status=404")
+	require.Contains(t, logger.lines[2], "[S3] GET /bucket status=200")
+
+	// credentials, signatures and query string are never logged
+	for _, line := range logger.lines {
+		require.NotContains(t, line, "AKID")
+		require.NotContains(t, line, "SECRET")
+		require.NotContains(t, line, "Signature")
+		require.NotContains(t, line, "prefix=")
+	}
+
+	// failed requests log the cause without the URL
+	server.Close()
+	_, err = storage.Read("docs/a.txt")
+	require.Error(t, err)
+	line := logger.lines[len(logger.lines)-1]
+	require.Contains(t, line, "[S3] GET /bucket/docs/a.txt err=")
+	require.NotContains(t, line, server.URL)
+}
@@ -0,0 +1,30 @@
+package gostorage
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+var _ LastModifiedStorage = (*storageLocalFile)(nil)
+
+// LastModifiedStorage is implemented by storages able to set last modified time of objects to any time,
+// object stores only bump it to now with Touch
+type LastModifiedStorage interface {
+	Storage
+
+	// SetLastModified change last modified time of objectPath keeping its content
+	SetLastModified(objectPath string, lastModified time.Time) error
+}
+
+// touchObject bump last modified time of objectPath by setting its metadata again, which copy the
+// object onto itself on S3 and OSS, missing objects are created empty and private
+func touchObject(storage Storage, objectPath string) error {
+	metadata, err := storage.GetMetadata(objectPath)
+	if errors.Is(err, ErrObjectNotExist) {
+		return storage.Put(objectPath, bytes.NewReader(nil), ObjectPrivate)
+	} else if err != nil {
+		return err
+	}
+	return storage.SetMetadata(objectPath, metadata)
+}
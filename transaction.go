@@ -0,0 +1,277 @@
+package gostorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+const transactionStagingPrefix = ".transactions"
+
+// ErrTransactionConflict is returned by Commit when another transaction replaced the manifest
+// since this one read it
+var ErrTransactionConflict = errors.New("transaction manifest was changed by another commit")
+
+// TransactionManifest is written to the manifest path when a transaction is committed, it is the
+// single commit point: objects are never copied to their paths, readers resolve them through
+// Locations of the latest manifest, e.g. with ReadTransactionObject
+type TransactionManifest struct {
+	ID          string            `json:"id"`
+	CommittedAt time.Time         `json:"committed_at"`
+	Objects     []string          `json:"objects"`
+	Deleted     []string          `json:"deleted,omitempty"`
+	Locations   map[string]string `json:"locations"` // object path to the object storing its content
+}
+
+// ObjectPath return the object storing content of objectPath, false if the manifest doesn't list it
+func (m *TransactionManifest) ObjectPath(objectPath string) (string, bool) {
+	location, ok := m.Locations[objectKey(objectPath)]
+	return location, ok
+}
+
+// Transaction stage multiple Put and Delete under a prefix of its own and apply them on Commit by
+// writing a new manifest, readers resolving objects through the manifest never observe
+// half-written artifacts. Staged objects the new manifest no longer reference are deleted after
+// the commit, readers holding an older manifest get ErrObjectNotExist and should read it again.
+type Transaction struct {
+	mu           sync.Mutex
+	storage      Storage
+	id           string
+	manifestPath string
+	puts         []string
+	deletes      []string
+	done         bool
+}
+
+// BeginTransaction start a transaction which will publish its manifest at manifestPath on commit
+func BeginTransaction(storage Storage, manifestPath string) (*Transaction, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		storage:      storage,
+		id:           id,
+		manifestPath: manifestPath,
+	}, nil
+}
+
+// ID return unique transaction id
+func (t *Transaction) ID() string {
+	return t.id
+}
+
+// Put write source under the transaction prefix, the object is published on Commit
+func (t *Transaction) Put(objectPath string, source io.Reader, visibility ObjectVisibility) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("err transaction %s already finished", t.id)
+	}
+
+	objectPath = objectKey(objectPath)
+	if err := t.storage.Put(t.stagingPath(objectPath), source, visibility); err != nil {
+		return err
+	}
+
+	t.puts = append(t.puts, objectPath)
+	return nil
+}
+
+// Delete mark object paths to be removed from the manifest on Commit
+func (t *Transaction) Delete(objectPaths ...string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("err transaction %s already finished", t.id)
+	}
+
+	for _, objectPath := range objectPaths {
+		t.deletes = append(t.deletes, objectKey(objectPath))
+	}
+	return nil
+}
+
+// Commit replace the manifest with one listing the objects of the previous manifest, staged puts
+// and without deleted objects. The manifest write is conditional on the manifest read, so
+// concurrent commits fail with ErrTransactionConflict instead of losing updates. Staged objects
+// are discarded when the manifest can't be written, objects replaced or deleted by the new
+// manifest are deleted once it's written.
+func (t *Transaction) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("err transaction %s already finished", t.id)
+	}
+	t.done = true
+
+	manifest, previous, err := t.commit()
+	if err != nil {
+		if cleanErr := t.cleanStaging(); cleanErr != nil {
+			return fmt.Errorf("err commit transaction %s: %s, cleaning staged objects failed: %s", t.id, err, cleanErr)
+		}
+		return fmt.Errorf("err commit transaction %s: %w", t.id, err)
+	}
+	if stale := t.staleStaging(manifest, previous); len(stale) > 0 {
+		// the manifest is committed, objects left behind only waste space
+		if err := t.storage.Delete(stale...); err != nil {
+			return fmt.Errorf("err transaction %s committed, deleting unreferenced objects failed: %s", t.id, err)
+		}
+	}
+	return nil
+}
+
+// commit write the new manifest and return it with the manifest it replaced, nil for the first one
+func (t *Transaction) commit() (*TransactionManifest, *TransactionManifest, error) {
+	previous, etag, err := readTransactionManifest(t.storage, t.manifestPath)
+	if err != nil && !errors.Is(err, ErrObjectNotExist) {
+		return nil, nil, err
+	}
+
+	manifest := &TransactionManifest{
+		ID:        t.id,
+		Deleted:   t.deletes,
+		Locations: map[string]string{},
+	}
+	preconditions := Preconditions{IfNoneMatch: "*"}
+	if previous != nil {
+		for objectPath, location := range previous.Locations {
+			manifest.Locations[objectPath] = location
+		}
+		preconditions = Preconditions{IfMatch: etag}
+	}
+	for _, objectPath := range t.puts {
+		manifest.Locations[objectPath] = t.stagingPath(objectPath)
+	}
+	for _, objectPath := range t.deletes {
+		delete(manifest.Locations, objectPath)
+	}
+	for objectPath := range manifest.Locations {
+		manifest.Objects = append(manifest.Objects, objectPath)
+	}
+	sort.Strings(manifest.Objects)
+
+	manifest.CommittedAt = time.Now()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = t.storage.PutWithOptions(t.manifestPath, bytes.NewReader(data), PutOptions{
+		Visibility:    ObjectPrivate,
+		Preconditions: preconditions,
+	})
+	if errors.Is(err, ErrPreconditionFailed) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrTransactionConflict, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return manifest, previous, nil
+}
+
+// Rollback discard everything staged by the transaction
+func (t *Transaction) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return fmt.Errorf("err transaction %s already finished", t.id)
+	}
+	t.done = true
+	return t.cleanStaging()
+}
+
+// ReadTransactionManifest return the latest committed manifest at manifestPath
+func ReadTransactionManifest(storage Storage, manifestPath string) (*TransactionManifest, error) {
+	manifest, _, err := readTransactionManifest(storage, manifestPath)
+	return manifest, err
+}
+
+// ReadTransactionObject read objectPath as of the latest committed manifest at manifestPath,
+// objects the manifest doesn't list fail with ErrObjectNotExist
+func ReadTransactionObject(storage Storage, manifestPath string, objectPath string) (io.ReadCloser, error) {
+	manifest, err := ReadTransactionManifest(storage, manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	location, ok := manifest.ObjectPath(objectPath)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not in transaction manifest %s", ErrObjectNotExist, objectPath, manifestPath)
+	}
+	return storage.Read(location)
+}
+
+// readTransactionManifest return manifest and the ETag it was read with
+func readTransactionManifest(storage Storage, manifestPath string) (*TransactionManifest, string, error) {
+	info, err := storage.Stat(manifestPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reader, err := storage.Read(manifestPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+
+	var manifest TransactionManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, "", fmt.Errorf("err invalid transaction manifest %s: %s", manifestPath, err)
+	}
+	return &manifest, info.ETag, nil
+}
+
+func (t *Transaction) stagingPath(objectPath string) string {
+	return path.Join(transactionStagingPrefix, t.id, "objects", objectPath)
+}
+
+// staleStaging return staged objects the committed manifest doesn't reference, i.e. overwritten
+// or deleted within the transaction, and objects of the previous manifest it replaced or deleted
+func (t *Transaction) staleStaging(manifest *TransactionManifest, previous *TransactionManifest) []string {
+	referenced := make(map[string]bool, len(manifest.Locations))
+	for _, location := range manifest.Locations {
+		referenced[location] = true
+	}
+
+	stale := make(map[string]bool)
+	for _, objectPath := range t.puts {
+		if !referenced[t.stagingPath(objectPath)] {
+			stale[t.stagingPath(objectPath)] = true
+		}
+	}
+	if previous != nil {
+		for _, location := range previous.Locations {
+			if !referenced[location] {
+				stale[location] = true
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(stale))
+	for location := range stale {
+		paths = append(paths, location)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (t *Transaction) cleanStaging() error {
+	var paths []string
+	for _, objectPath := range t.puts {
+		paths = append(paths, t.stagingPath(objectPath))
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return t.storage.Delete(paths...)
+}
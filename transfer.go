@@ -0,0 +1,196 @@
+package gostorage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+)
+
+type TransferPhase string
+
+const (
+	TransferPhaseCopy     TransferPhase = "copy"
+	TransferPhaseVerify   TransferPhase = "verify"
+	TransferPhaseDelete   TransferPhase = "delete"
+	TransferPhaseRollback TransferPhase = "rollback"
+	TransferPhaseCleanup  TransferPhase = "cleanup" // removal of the destination backup after a move
+)
+
+// TransferAuditRecord describe the result of a single phase of a cross storage move
+type TransferAuditRecord struct {
+	Phase         TransferPhase `json:"phase"`
+	SrcObjectPath string        `json:"src_object_path"`
+	DstObjectPath string        `json:"dst_object_path"`
+	Checksum      string        `json:"checksum,omitempty"` // sha256 hex
+	Error         string        `json:"error,omitempty"`
+	At            time.Time     `json:"at"`
+}
+
+// TransferAuditor receive an audit record for each phase, it may be nil
+type TransferAuditor func(record TransferAuditRecord)
+
+// Transfer stream an object from src storage into dst storage keeping its visibility,
+// return sha256 checksum of the transferred content
+func Transfer(src Storage, srcObjectPath string, dst Storage, dstObjectPath string) (string, error) {
+	return transfer(context.Background(), src, srcObjectPath, dst, dstObjectPath)
+}
+
+// transfer behave like Transfer throttled by bandwidth limiter of ctx
+func transfer(ctx context.Context, src Storage, srcObjectPath string, dst Storage, dstObjectPath string) (string, error) {
+	visibility, err := src.GetVisibility(srcObjectPath)
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := src.Read(srcObjectPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	source := BandwidthFromContext(ctx).Reader(ctx, io.TeeReader(reader, hash))
+	if err := dst.Put(dstObjectPath, source, visibility); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Move transfer an object between storages in two phases: copy then verify the checksum
+// of the destination before deleting the source. When copy or verification fail, the source
+// is kept untouched and the destination is restored from a backup taken before the copy,
+// or removed when it didn't exist. Moving an object onto itself does nothing.
+func Move(src Storage, srcObjectPath string, dst Storage, dstObjectPath string, auditor TransferAuditor) error {
+	if sameStorage(src, dst) && sameObjectPath(srcObjectPath, dstObjectPath) {
+		return nil
+	}
+
+	audit := func(phase TransferPhase, checksum string, err error) {
+		if auditor == nil {
+			return
+		}
+		record := TransferAuditRecord{
+			Phase:         phase,
+			SrcObjectPath: srcObjectPath,
+			DstObjectPath: dstObjectPath,
+			Checksum:      checksum,
+			At:            time.Now(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		auditor(record)
+	}
+
+	backup, err := backupMoveDestination(dst, dstObjectPath)
+	if err != nil {
+		return fmt.Errorf("err move %s: %s", srcObjectPath, err)
+	}
+
+	rollback := func(cause error) error {
+		err := backup.restore(dst, dstObjectPath)
+		audit(TransferPhaseRollback, "", err)
+		if err != nil {
+			return fmt.Errorf("err move %s: %s, rollback failed: %s", srcObjectPath, cause, err)
+		}
+		return fmt.Errorf("err move %s: %s", srcObjectPath, cause)
+	}
+
+	checksum, err := Transfer(src, srcObjectPath, dst, dstObjectPath)
+	audit(TransferPhaseCopy, checksum, err)
+	if err != nil {
+		return rollback(err)
+	}
+
+	dstChecksum, err := objectChecksum(dst, dstObjectPath)
+	if err == nil && dstChecksum != checksum {
+		err = fmt.Errorf("checksum mismatch, expected %s got %s", checksum, dstChecksum)
+	}
+	audit(TransferPhaseVerify, dstChecksum, err)
+	if err != nil {
+		return rollback(err)
+	}
+
+	if backup.objectPath != "" {
+		// the move succeeded, a leftover backup only waste space so it's reported but doesn't fail the move
+		if err := dst.Delete(backup.objectPath); err != nil {
+			audit(TransferPhaseCleanup, "", fmt.Errorf("err deleting backup %s: %s", backup.objectPath, err))
+		}
+	}
+	err = src.Delete(srcObjectPath)
+	audit(TransferPhaseDelete, checksum, err)
+	return err
+}
+
+// sameStorage report whether a and b end at the same driver, e.g. a cache wrapping b
+func sameStorage(a Storage, b Storage) bool {
+	a, b = underlying(a), underlying(b)
+	if a == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// moveBackup is copy of the destination of Move taken before overwriting it,
+// objectPath is empty when the destination didn't exist
+type moveBackup struct {
+	objectPath string
+	visibility ObjectVisibility
+}
+
+func backupMoveDestination(dst Storage, dstObjectPath string) (moveBackup, error) {
+	exist, err := dst.Exist(dstObjectPath)
+	if err != nil || !exist {
+		return moveBackup{}, err
+	}
+
+	visibility, err := dst.GetVisibility(dstObjectPath)
+	if err != nil {
+		return moveBackup{}, err
+	}
+	id, err := newRandomID()
+	if err != nil {
+		return moveBackup{}, err
+	}
+
+	backupPath := dstObjectPath + ".move-backup-" + id
+	if err := dst.Copy(dstObjectPath, backupPath); err != nil {
+		return moveBackup{}, err
+	}
+	return moveBackup{objectPath: backupPath, visibility: visibility}, nil
+}
+
+// restore put the destination back to its state before Move
+func (b moveBackup) restore(dst Storage, dstObjectPath string) error {
+	if b.objectPath == "" {
+		return dst.Delete(dstObjectPath)
+	}
+
+	if err := dst.Copy(b.objectPath, dstObjectPath); err != nil {
+		return err
+	}
+	if err := dst.SetVisibility(dstObjectPath, b.visibility); err != nil {
+		return err
+	}
+	return dst.Delete(b.objectPath)
+}
+
+// objectChecksum read the whole object and return its sha256 hex
+func objectChecksum(storage Storage, objectPath string) (string, error) {
+	reader, err := storage.Read(objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
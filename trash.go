@@ -0,0 +1,189 @@
+package gostorage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	_ TrashStorage = (*storageS3)(nil)
+	_ TrashStorage = (*storageAlibabaOSS)(nil)
+	_ TrashStorage = (*storageLocalFile)(nil)
+)
+
+const (
+	defaultTrashPrefix = ".trash/"
+	trashTimeFormat    = "20060102T150405.000000000Z"
+)
+
+// TrashStorage is implemented by storages able to keep deleted objects in trash, see WithTrash
+type TrashStorage interface {
+	Storage
+
+	// Restore move the latest trashed copy of objectPath back to objectPath
+	Restore(objectPath string) error
+
+	// PurgeTrash delete for good objects trashed more than olderThan ago
+	PurgeTrash(olderThan time.Duration) error
+}
+
+// WithTrash make Delete and DeletePrefix move objects to "<prefix><timestamp>/<object path>"
+// instead of deleting them, so they can be restored until the trash is purged. Empty prefix
+// default to ".trash/". Deleting objects already in trash delete them for good. Trashed objects
+// are still listed under prefix and billed by the backend.
+func WithTrash(prefix string) Option {
+	return func(o *storageOptions) {
+		if prefix == "" {
+			prefix = defaultTrashPrefix
+		}
+		o.trashPrefix = strings.TrimSuffix(trimPrefixRoot(prefix), "/") + "/"
+	}
+}
+
+// checkTrash return error when trash isn't enabled
+func (o storageOptions) checkTrash() error {
+	if o.trashPrefix == "" {
+		return fmt.Errorf("err trash is disabled, see WithTrash")
+	}
+	return nil
+}
+
+func (o storageOptions) inTrash(objectPath string) bool {
+	return o.trashPrefix != "" && strings.HasPrefix(objectKey(objectPath), o.trashPrefix)
+}
+
+// moveToTrash move objectPaths outside trash to trash and return the others, which are deleted
+// for good. Missing objects are ignored like Delete does.
+func (o storageOptions) moveToTrash(storage Storage, objectPaths []string) ([]string, error) {
+	if o.trashPrefix == "" {
+		return objectPaths, nil
+	}
+
+	now := time.Now().UTC()
+	var trashed []string
+	for _, objectPath := range objectPaths {
+		if o.inTrash(objectPath) {
+			trashed = append(trashed, objectPath)
+			continue
+		}
+		trashPath := o.trashPrefix + now.Format(trashTimeFormat) + "/" + objectKey(objectPath)
+		if err := storage.Move(objectPath, trashPath); err != nil && !errors.Is(err, ErrObjectNotExist) {
+			return nil, fmt.Errorf("err moving %s to trash: %w", objectPath, err)
+		}
+	}
+	return trashed, nil
+}
+
+// storageTrash return trash options of the driver under storage, trashPrefix is empty when
+// the driver doesn't keep deleted objects in trash
+func storageTrash(storage Storage) storageOptions {
+	switch s := underlying(storage).(type) {
+	case *storageS3:
+		return s.options
+	case *storageOCI:
+		return s.options
+	case *storageAlibabaOSS:
+		return s.options
+	case *storageLocalFile:
+		return s.options
+	}
+	return storageOptions{}
+}
+
+// trashedMatching return trashed copies in storage of objects whose original path match
+func (o storageOptions) trashedMatching(storage Storage, match func(objectPath string) bool) ([]string, error) {
+	if o.trashPrefix == "" {
+		return nil, nil
+	}
+
+	iterator, err := storage.List(o.trashPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var trashed []string
+	for iterator.Next() {
+		trashPath := iterator.Object().ObjectPath
+		if _, originalPath, ok := o.parseTrashPath(trashPath); ok && match(originalPath) {
+			trashed = append(trashed, trashPath)
+		}
+	}
+	return trashed, iterator.Err()
+}
+
+// parseTrashPath return when the object at trashPath was trashed and its original path
+func (o storageOptions) parseTrashPath(trashPath string) (time.Time, string, bool) {
+	rest := strings.TrimPrefix(objectKey(trashPath), o.trashPrefix)
+	timestamp, objectPath, found := strings.Cut(rest, "/")
+	if !found {
+		return time.Time{}, "", false
+	}
+	trashedAt, err := time.Parse(trashTimeFormat, timestamp)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return trashedAt, objectPath, true
+}
+
+// restoreFromTrash move the latest trashed copy of objectPath in storage back
+func (o storageOptions) restoreFromTrash(storage Storage, objectPath string) error {
+	if err := o.checkTrash(); err != nil {
+		return err
+	}
+
+	iterator, err := storage.List(o.trashPrefix)
+	if err != nil {
+		return err
+	}
+	var latestPath string
+	var latestAt time.Time
+	for iterator.Next() {
+		trashPath := iterator.Object().ObjectPath
+		trashedAt, originalPath, ok := o.parseTrashPath(trashPath)
+		if ok && sameObjectPath(originalPath, objectPath) && trashedAt.After(latestAt) {
+			latestPath, latestAt = trashPath, trashedAt
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+	if latestPath == "" {
+		return fmt.Errorf("%w: %s in trash", ErrObjectNotExist, objectPath)
+	}
+	return storage.Move(latestPath, objectPath)
+}
+
+// purgeTrash delete objects of storage trashed before olderThan for good
+func (o storageOptions) purgeTrash(storage Storage, olderThan time.Duration) error {
+	if err := o.checkTrash(); err != nil {
+		return err
+	}
+
+	iterator, err := storage.List(o.trashPrefix)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-olderThan)
+	var expired []string
+	for iterator.Next() {
+		trashPath := iterator.Object().ObjectPath
+		if trashedAt, _, ok := o.parseTrashPath(trashPath); ok && trashedAt.Before(cutoff) {
+			expired = append(expired, trashPath)
+		}
+	}
+	if err := iterator.Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(expired); start += deleteBatchSize {
+		end := start + deleteBatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+		if err := storage.Delete(expired[start:end]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
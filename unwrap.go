@@ -0,0 +1,53 @@
+package gostorage
+
+import (
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Unwrapper is implemented by storages adding behavior to another storage, e.g. NewDiskCache.
+// Guarded storages don't unwrap, so their authorization can't be bypassed.
+type Unwrapper interface {
+	// Unwrap return the wrapped storage, nil when it's not available
+	Unwrap() Storage
+}
+
+// underlying follow Unwrap until reaching a storage which doesn't wrap another one
+func underlying(storage Storage) Storage {
+	for storage != nil {
+		wrapper, ok := storage.(Unwrapper)
+		if !ok {
+			return storage
+		}
+		storage = wrapper.Unwrap()
+	}
+	return nil
+}
+
+// S3Client return AWS SDK client and bucket name of storages talking S3 API (AWS S3, S3 compatible
+// presets, Huawei OBS and Oracle OCI), so provider specific operations can be performed directly
+func S3Client(storage Storage) (*s3.S3, string, bool) {
+	switch s := underlying(storage).(type) {
+	case *storageS3:
+		return s.s3, s.bucketName, true
+	case *storageOCI:
+		return s.s3, s.bucketName, true
+	}
+	return nil, "", false
+}
+
+// OSSBucket return Alibaba OSS SDK bucket of OSS storage
+func OSSBucket(storage Storage) (*oss.Bucket, bool) {
+	if s, ok := underlying(storage).(*storageAlibabaOSS); ok {
+		return s.ossBucket(), true
+	}
+	return nil, false
+}
+
+// LocalBaseDir return directories of private and public files of local storage
+func LocalBaseDir(storage Storage) (baseDir string, publicBaseDir string, ok bool) {
+	if s, ok := underlying(storage).(*storageLocalFile); ok {
+		return s.baseDir, s.publicBaseDir, true
+	}
+	return "", "", false
+}
@@ -0,0 +1,59 @@
+package gostorage
+
+import (
+	"sync"
+)
+
+// UploadMemoryLimiter bound total bytes of part buffers held by in-flight uploads,
+// Put blocks until enough memory is released by other uploads
+type UploadMemoryLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	maxBytes int64
+	inFlight int64
+}
+
+// NewUploadMemoryLimiter create limiter allowing at most maxBytes of upload buffers,
+// the same limiter can be shared by multiple storages using WithUploadMemoryLimiter
+func NewUploadMemoryLimiter(maxBytes int64) *UploadMemoryLimiter {
+	limiter := &UploadMemoryLimiter{maxBytes: maxBytes}
+	limiter.cond = sync.NewCond(&limiter.mu)
+	return limiter
+}
+
+// acquire block until n bytes are available, request bigger than the limit is clamped
+// so it can proceed alone instead of blocking forever
+func (l *UploadMemoryLimiter) acquire(n int64) int64 {
+	if l == nil || n <= 0 {
+		return 0
+	}
+	if n > l.maxBytes {
+		n = l.maxBytes
+	}
+
+	l.mu.Lock()
+	for l.inFlight+n > l.maxBytes {
+		l.cond.Wait()
+	}
+	l.inFlight += n
+	l.mu.Unlock()
+	return n
+}
+
+func (l *UploadMemoryLimiter) release(n int64) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	l.inFlight -= n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// InFlight return bytes currently held by uploads
+func (l *UploadMemoryLimiter) InFlight() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
@@ -1,9 +1,18 @@
 package gostorage
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
 	"os"
+	"path"
+	"strings"
+	"sync"
 )
 
+const maxSignWorkers = 16 // maximum goroutines used when signing urls in batch
+
 // mkdirIfNotExists create directory including children directory if not exists
 func mkdirIfNotExists(path string) error {
 	_, err := os.Stat(path)
@@ -22,3 +31,121 @@ func isFileExists(path string) bool {
 	}
 	return !stat.IsDir()
 }
+
+// signURLs call sign for each object path concurrently and collect the results,
+// the first error encountered is returned
+func signURLs(objectPaths []string, sign func(objectPath string) (string, error)) (map[string]string, error) {
+	result := make(map[string]string, len(objectPaths))
+	if len(objectPaths) == 0 {
+		return result, nil
+	}
+
+	workers := maxSignWorkers
+	if len(objectPaths) < workers {
+		workers = len(objectPaths)
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	jobs := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for objectPath := range jobs {
+				signedURL, err := sign(objectPath)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					result[objectPath] = signedURL
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, objectPath := range objectPaths {
+		jobs <- objectPath
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
+
+// visibilityGrants describe a canned visibility as list of grants,
+// ownerID may be empty if the owner is not known by the backend
+func visibilityGrants(ownerID string, visibility ObjectVisibility) []Grant {
+	grants := []Grant{
+		{GranteeType: GranteeCanonicalUser, GranteeID: ownerID, Permission: PermissionFullControl},
+	}
+
+	if visibility == ObjectPublicRead || visibility == ObjectPublicReadWrite {
+		grants = append(grants, Grant{GranteeType: GranteeGroup, GranteeURI: GroupAllUsers, Permission: PermissionRead})
+	}
+	if visibility == ObjectPublicReadWrite {
+		grants = append(grants, Grant{GranteeType: GranteeGroup, GranteeURI: GroupAllUsers, Permission: PermissionWrite})
+	}
+	if visibility == ObjectAuthenticatedRead {
+		grants = append(grants, Grant{GranteeType: GranteeGroup, GranteeURI: GroupAuthenticatedUsers, Permission: PermissionRead})
+	}
+	return grants
+}
+
+// newRandomID return random hex string used for tokens and temporary object names
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// cancelOnCloseReader release context of a streaming operation once the reader is closed
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (r *cancelOnCloseReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
+
+// directoryMarkers return marker keys ("dir/") of every parent directory of objectPath,
+// ordered from the deepest directory to the top most one
+func directoryMarkers(objectPath string) []string {
+	var markers []string
+	for dir := path.Dir(objectPath); dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		markers = append(markers, strings.TrimPrefix(dir, "/")+"/")
+	}
+	return markers
+}
+
+// ensureDirectoryMarkers create missing markers, stopping at the first existing one
+// since its parents are expected to exist too
+func ensureDirectoryMarkers(objectPath string, exist func(key string) (bool, error), create func(key string) error) error {
+	for _, marker := range directoryMarkers(objectPath) {
+		found, err := exist(marker)
+		if err != nil {
+			return err
+		}
+		if found {
+			return nil
+		}
+		if err := create(marker); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package gostorage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrPutVerification returned when an uploaded object doesn't match the uploaded data
+// after every verification attempt
+var ErrPutVerification = errors.New("uploaded object verification failed")
+
+// putDigest compute size and md5 of data passing through a reader
+type putDigest struct {
+	reader io.Reader
+	md5    hash.Hash
+	size   int64
+}
+
+func newPutDigest(source io.Reader) *putDigest {
+	return &putDigest{reader: source, md5: md5.New()}
+}
+
+func (d *putDigest) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	d.size += int64(n)
+	_, _ = d.md5.Write(p[:n])
+	return n, err
+}
+
+func (d *putDigest) etag() string {
+	return hex.EncodeToString(d.md5.Sum(nil))
+}
+
+// multipartETag compute ETag S3 assign to a multipart upload: md5 of concatenated part md5s
+// followed by the number of parts
+func multipartETag(partMD5s [][]byte) string {
+	hash := md5.New()
+	for _, sum := range partMD5s {
+		_, _ = hash.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(hash.Sum(nil)), len(partMD5s))
+}
+
+// objectHead fetch size and ETag of an uploaded object
+type objectHead func() (size int64, etag string, err error)
+
+// verifyPut poll object metadata until it match expected size and ETag (empty etag skip the
+// comparison), retrying for eventually consistent endpoints. Verification is skipped when disabled.
+func (o storageOptions) verifyPut(objectPath string, size int64, etag string, head objectHead) error {
+	if o.putVerifyAttempts <= 0 {
+		return nil
+	}
+
+	var reason string
+	for attempt := 1; attempt <= o.putVerifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(o.putVerifyDelay)
+		}
+
+		actualSize, actualETag, err := head()
+		actualETag = strings.Trim(actualETag, `"`)
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case actualSize != size:
+			reason = fmt.Sprintf("size %d, expected %d", actualSize, size)
+		case etag != "" && !strings.EqualFold(actualETag, etag):
+			reason = fmt.Sprintf("etag %s, expected %s", actualETag, etag)
+		default:
+			return nil
+		}
+		o.logger.Debugf("verifying %s attempt %d failed: %s\n", objectPath, attempt, reason)
+	}
+	return fmt.Errorf("%w: %s: %s", ErrPutVerification, objectPath, reason)
+}
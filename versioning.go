@@ -0,0 +1,66 @@
+package gostorage
+
+import (
+	"io"
+	"net/url"
+	"time"
+)
+
+var (
+	_ VersionedStorage = (*storageS3)(nil)
+	_ VersionedStorage = (*storageAlibabaOSS)(nil)
+	_ VersionPurger    = (*storageS3)(nil)
+	_ VersionPurger    = (*storageAlibabaOSS)(nil)
+)
+
+// VersionedStorage is implemented by storages able to address a specific version of an object,
+// so immutable references (e.g. a contract as it was signed) always resolve to the same bytes.
+// Versioning must be enabled on the bucket.
+type VersionedStorage interface {
+	Storage
+
+	// CurrentVersion return version ID of the current object version, empty when the bucket isn't versioned
+	CurrentVersion(objectPath string) (string, error)
+
+	// ReadVersion behave like Read for the given version, empty versionID read the current version
+	ReadVersion(objectPath string, versionID string) (io.ReadCloser, error)
+
+	// URLVersion behave like URL for the given version
+	URLVersion(objectPath string, versionID string) (string, error)
+
+	// TemporaryURLVersion behave like TemporaryURL for the given version
+	TemporaryURLVersion(objectPath string, versionID string, expireIn time.Duration) (string, error)
+}
+
+// ObjectVersion is a version or a delete marker of an object in a versioned bucket
+type ObjectVersion struct {
+	ObjectPath   string
+	VersionID    string
+	DeleteMarker bool
+}
+
+// VersionPurger is implemented by storages able to permanently remove versions of objects, which
+// Delete of a versioned bucket keep behind a delete marker. Tags and metadata go with their version.
+type VersionPurger interface {
+	// ListVersions return every version and delete marker of objects under prefix
+	ListVersions(prefix string) ([]ObjectVersion, error)
+
+	// DeleteVersions permanently delete versions, objects failing are reported by MultiDeleteError
+	DeleteVersions(versions ...ObjectVersion) error
+}
+
+// withVersionQuery add versionId query parameter to rawURL
+func withVersionQuery(rawURL string, versionID string) (string, error) {
+	if versionID == "" {
+		return rawURL, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("versionId", versionID)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,78 @@
+package gostorage
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrWriteAborted is default cause of writes aborted by ObjectWriter.CloseWithError
+var ErrWriteAborted = errors.New("write aborted")
+
+// ObjectWriter stream data into an object, e.g.
+//
+//	writer, err := storage.Writer("exports/report.csv", gostorage.ObjectPrivate)
+//	if _, err := csv.NewWriter(writer).WriteAll(rows); err != nil {
+//		writer.CloseWithError(err)
+//	}
+//	err = writer.Close()
+//
+// Nothing is visible in storage before Close returns successfully.
+type ObjectWriter interface {
+	io.WriteCloser
+
+	// CloseWithError abort the write so nothing is stored, nil err means ErrWriteAborted.
+	// Return error of cleaning up the partial upload, if any.
+	CloseWithError(err error) error
+}
+
+// pipeObjectWriter feed written data to put running in the background through a pipe,
+// put fail on aborted writes so partial uploads are discarded by the backend
+type pipeObjectWriter struct {
+	pipe *io.PipeWriter
+	done chan error
+
+	once   sync.Once
+	result error
+}
+
+func newPipeObjectWriter(put func(source io.Reader) error) ObjectWriter {
+	reader, writer := io.Pipe()
+	w := &pipeObjectWriter{pipe: writer, done: make(chan error, 1)}
+	go func() {
+		err := put(reader)
+		// unblock pending writes when put stop reading early
+		reader.CloseWithError(err)
+		w.done <- err
+	}()
+	return w
+}
+
+func (w *pipeObjectWriter) Write(p []byte) (int, error) {
+	return w.pipe.Write(p)
+}
+
+func (w *pipeObjectWriter) Close() error {
+	w.once.Do(func() {
+		w.pipe.Close()
+		w.result = <-w.done
+	})
+	return w.result
+}
+
+func (w *pipeObjectWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = ErrWriteAborted
+	}
+
+	aborted := false
+	w.once.Do(func() {
+		aborted = true
+		w.pipe.CloseWithError(err)
+		w.result = <-w.done
+	})
+	if !aborted || errors.Is(w.result, err) {
+		return nil
+	}
+	return w.result
+}